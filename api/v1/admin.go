@@ -0,0 +1,42 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/parikshitg/urlshortener/internal/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ndjsonContentType is the media type of exports, one json document per line.
+const ndjsonContentType = "application/x-ndjson"
+
+// purge deletes expired links immediately.
+func (r resource) purge(c *gin.Context) {
+	if err := r.svc.Purge(c.Request.Context()); err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// export writes the links of every tenant as newline delimited json.
+func (r resource) export(c *gin.Context) {
+	links, err := r.svc.Export(c.Request.Context())
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	c.Header("Content-Type", ndjsonContentType)
+	c.Header("Content-Disposition", `attachment; filename="links.ndjson"`)
+	c.Status(http.StatusOK)
+	enc := json.NewEncoder(c.Writer)
+	for _, link := range links {
+		if err := enc.Encode(newLinkResponse(link)); err != nil {
+			return
+		}
+	}
+}
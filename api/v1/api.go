@@ -2,16 +2,38 @@ package v1
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/parikshitg/urlshortener/internal/auth"
+	"github.com/parikshitg/urlshortener/internal/middleware"
 	"github.com/parikshitg/urlshortener/internal/service"
 )
 
 type resource struct {
-	svc *service.Service
+	svc   *service.Service
+	auth  *service.AuthService
+	pages *Templates
+}
+
+// Options holds optional features and middlewares applied to routes by
+// RegisterHandlers. Nil middlewares are skipped.
+type Options struct {
+	// Idempotency is applied to the write endpoints.
+	Idempotency gin.HandlerFunc
+	// Docs serves the interactive api documentation at /v1/docs.
+	Docs bool
+	// Auth requires credentials with the matching scope on the /v1
+	// endpoints and serves the api key endpoints. Nil disables auth.
+	Auth *service.AuthService
+	// Templates are the pages served on short urls. Nil uses the embedded
+	// ones.
+	Templates *Templates
 }
 
 // RegisterHandlers is used to register api endpoints under v1 api package.
-func RegisterHandlers(r *gin.Engine, svc *service.Service, healthService *service.HealthService) {
-	res := resource{svc}
+func RegisterHandlers(r *gin.Engine, svc *service.Service, healthService *service.HealthService, opts Options) {
+	res := resource{svc: svc, auth: opts.Auth, pages: opts.Templates}
+	if res.pages == nil {
+		res.pages = defaultTemplates()
+	}
 	healthHandler := NewHealthHandler(healthService)
 
 	// Health check endpoints grouped under /health
@@ -21,11 +43,71 @@ func RegisterHandlers(r *gin.Engine, svc *service.Service, healthService *servic
 		healthGroup.GET("/ready", healthHandler.Ready)
 	}
 
-	// resolve redirects to original url.
+	// resolve redirects to original url, it is always public. Protected
+	// links post their password form to the same url. The rest of the path
+	// is passed on by links that allow it. A code ending in + previews the
+	// link instead. HEAD requests of link checkers are redirected too.
 	r.GET("/:code", res.resolve)
+	r.HEAD("/:code", res.resolve)
+	r.POST("/:code", res.resolve)
+	r.GET("/:code/*rest", res.resolve)
+	r.HEAD("/:code/*rest", res.resolve)
+	r.POST("/:code/*rest", res.resolve)
+
+	// The api description is public.
+	r.GET("/v1/openapi.json", openAPI)
+	if opts.Docs {
+		r.GET("/v1/docs", docs)
+	}
 
 	v1 := r.Group("/v1")
-	v1.POST("/shorten", res.shorten)
-	v1.POST("/metrics", res.metrics)
-	v1.POST("/qr", res.qr)
+	if opts.Auth != nil {
+		v1.Use(middleware.Authenticate(opts.Auth))
+	}
+	scope := func(scope string) gin.HandlerFunc {
+		if opts.Auth == nil {
+			return nil
+		}
+		return middleware.RequireScope(scope)
+	}
+
+	v1.POST("/shorten", chain(scope(auth.ScopeLinksWrite), opts.Idempotency, res.shorten)...)
+	v1.POST("/shorten/batch", chain(scope(auth.ScopeLinksWrite), opts.Idempotency, res.shortenBatch)...)
+	v1.POST("/metrics", chain(scope(auth.ScopeMetricsRead), res.metrics)...)
+	v1.POST("/qr", chain(scope(auth.ScopeLinksWrite), opts.Idempotency, res.qr)...)
+	v1.GET("/links", chain(scope(auth.ScopeLinksRead), res.listLinks)...)
+	v1.GET("/links/:code", chain(scope(auth.ScopeLinksRead), res.getLink)...)
+	v1.PATCH("/links/:code", chain(scope(auth.ScopeLinksWrite), res.updateLink)...)
+	v1.DELETE("/links/:code", chain(scope(auth.ScopeLinksWrite), res.deleteLink)...)
+	v1.PUT("/links/:code/variants", chain(scope(auth.ScopeLinksWrite), res.updateVariants)...)
+	v1.GET("/links/:code/stats", chain(scope(auth.ScopeMetricsRead), res.linkStats)...)
+	v1.GET("/links/:code/analytics", chain(scope(auth.ScopeMetricsRead), res.linkAnalytics)...)
+	v1.GET("/links/:code/uniques", chain(scope(auth.ScopeMetricsRead), res.linkUniques)...)
+	v1.POST("/campaigns", chain(scope(auth.ScopeLinksWrite), res.createCampaign)...)
+	v1.GET("/campaigns", chain(scope(auth.ScopeLinksRead), res.listCampaigns)...)
+	v1.GET("/campaigns/:id", chain(scope(auth.ScopeLinksRead), res.getCampaign)...)
+	v1.PATCH("/campaigns/:id", chain(scope(auth.ScopeLinksWrite), res.updateCampaign)...)
+	v1.DELETE("/campaigns/:id", chain(scope(auth.ScopeLinksWrite), res.deleteCampaign)...)
+	v1.GET("/campaigns/:id/stats", chain(scope(auth.ScopeMetricsRead), res.campaignStats)...)
+	v1.GET("/campaigns/:id/uniques", chain(scope(auth.ScopeMetricsRead), res.campaignUniques)...)
+	v1.POST("/admin/purge", chain(scope(auth.ScopeLinksWrite), res.purge)...)
+	v1.GET("/admin/export", chain(scope(auth.ScopeLinksRead), res.export)...)
+	v1.GET("/audit", chain(scope(auth.ScopeAuditRead), res.auditLog)...)
+
+	if opts.Auth != nil {
+		v1.POST("/keys", chain(scope(auth.ScopeKeysManage), res.createAPIKey)...)
+		v1.GET("/keys", chain(scope(auth.ScopeKeysManage), res.listAPIKeys)...)
+		v1.DELETE("/keys/:id", chain(scope(auth.ScopeKeysManage), res.revokeAPIKey)...)
+	}
+}
+
+// chain returns the non-nil handlers in order.
+func chain(handlers ...gin.HandlerFunc) []gin.HandlerFunc {
+	var out []gin.HandlerFunc
+	for _, h := range handlers {
+		if h != nil {
+			out = append(out, h)
+		}
+	}
+	return out
 }
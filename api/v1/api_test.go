@@ -3,17 +3,26 @@ package v1
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/parikshitg/urlshortener/internal/auth"
 	"github.com/parikshitg/urlshortener/internal/common"
 	"github.com/parikshitg/urlshortener/internal/config"
 	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/problem"
 	"github.com/parikshitg/urlshortener/internal/service"
+	"github.com/parikshitg/urlshortener/internal/storage"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
 	"github.com/parikshitg/urlshortener/internal/storage/mocks"
+	"github.com/parikshitg/urlshortener/internal/validator"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/mock/gomock"
 )
@@ -35,7 +44,7 @@ func setupTestRouter() (*gin.Engine, *mocks.MockStorage, *service.Service, *serv
 	svc := service.NewService(mockStorage, cfg, logger)
 	healthService := service.NewHealthService(mockStorage, logger)
 
-	RegisterHandlers(router, svc, healthService)
+	RegisterHandlers(router, svc, healthService, Options{})
 
 	return router, mockStorage, svc, healthService
 }
@@ -56,9 +65,11 @@ func TestShortenEndpoint(t *testing.T) {
 				URL: "https://example.com",
 			},
 			setupMocks: func() {
-				mockStorage.EXPECT().GetCode("https://example.com").Return("", false)
-				mockStorage.EXPECT().CodeExists(gomock.Any()).Return(false).AnyTimes()
-				mockStorage.EXPECT().Save("https://example.com", gomock.Any(), "example.com")
+				mockStorage.EXPECT().GetCode("", "", "https://example.com").Return("", false)
+				mockStorage.EXPECT().CodeExists("", gomock.Any()).Return(false).AnyTimes()
+				mockStorage.EXPECT().Save(gomock.Cond(func(link storage.Link) bool {
+					return link.URL == "https://example.com" && link.Domain == "example.com" && link.Code != ""
+				})).Return(nil)
 			},
 			expectedStatus: http.StatusOK,
 			expectedBody: map[string]string{
@@ -71,7 +82,7 @@ func TestShortenEndpoint(t *testing.T) {
 				URL: "https://example.com",
 			},
 			setupMocks: func() {
-				mockStorage.EXPECT().GetCode("https://example.com").Return("abc123", true)
+				mockStorage.EXPECT().GetCode("", "", "https://example.com").Return("abc123", true)
 			},
 			expectedStatus: http.StatusOK,
 			expectedBody: map[string]string{
@@ -87,8 +98,9 @@ func TestShortenEndpoint(t *testing.T) {
 				// No storage calls expected
 			},
 			expectedStatus: http.StatusBadRequest,
-			expectedBody: ErrorResponse{
-				Message: "url is required",
+			expectedBody: problem.Problem{
+				Code:   problem.CodeInvalidRequest,
+				Detail: "url is required",
 			},
 		},
 		{
@@ -107,7 +119,25 @@ func TestShortenEndpoint(t *testing.T) {
 			setupMocks: func() {
 				// No storage calls expected for invalid URL
 			},
-			expectedStatus: http.StatusInternalServerError,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: problem.Problem{
+				Code:   problem.CodeURLInvalid,
+				Reason: "missing_scheme",
+			},
+		},
+		{
+			name: "blocked domain",
+			requestBody: ShortenRequest{
+				URL: "http://localhost/admin",
+			},
+			setupMocks: func() {
+				// No storage calls expected for blocked domain
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedBody: problem.Problem{
+				Code:   problem.CodeDomainBlocked,
+				Reason: "domain_blocked",
+			},
 		},
 	}
 
@@ -142,14 +172,62 @@ func TestShortenEndpoint(t *testing.T) {
 					assert.Contains(t, shortUrl.(string), "http://localhost:8080/")
 				} else if tt.name == "URL already exists" {
 					assert.Equal(t, "http://localhost:8080/abc123", response["shortUrl"])
-				} else if tt.name == "missing URL" {
-					assert.Equal(t, "url is required", response["message"])
+				} else if expected, ok := tt.expectedBody.(problem.Problem); ok {
+					assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+					assert.Equal(t, expected.Code, response["code"])
+					assert.Equal(t, float64(tt.expectedStatus), response["status"])
+					assert.Equal(t, "/v1/shorten", response["instance"])
+					if expected.Detail != "" {
+						assert.Equal(t, expected.Detail, response["detail"])
+					}
+					if expected.Reason != "" {
+						assert.Equal(t, expected.Reason, response["reason"])
+					}
 				}
 			}
 		})
 	}
 }
 
+func TestShortenBatchEndpoint(t *testing.T) {
+	router, mockStorage, _, _ := setupTestRouter()
+
+	mockStorage.EXPECT().GetCode("", "", "https://example.com").Return("abc123", true)
+	mockStorage.EXPECT().CodeExists("", "promo").Return(false)
+	mockStorage.EXPECT().Save(gomock.Cond(func(link storage.Link) bool {
+		return link.Code == "promo" && link.URL == "https://example.com/x"
+	})).Return(nil)
+
+	body, _ := json.Marshal(BatchShortenRequest{Items: []ShortenRequest{
+		{URL: "https://example.com"},
+		{URL: ""},
+		{URL: "https://example.com/x", Alias: "promo"},
+		{URL: "https://example.com/y", TTL: "soon"},
+		{URL: "https://example.com/z", Alias: "bad-alias"},
+	}})
+	req := httptest.NewRequest("POST", "/v1/shorten/batch", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response BatchShortenResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	if assert.Len(t, response.Results, 5) {
+		assert.Equal(t, "http://localhost:8080/abc123", response.Results[0].ShortURL)
+		assert.Equal(t, problem.CodeInvalidRequest, response.Results[1].Error.Code)
+		assert.Equal(t, "http://localhost:8080/promo", response.Results[2].ShortURL)
+		assert.Equal(t, problem.CodeTTLInvalid, response.Results[3].Error.Code)
+		assert.Equal(t, problem.CodeAliasInvalid, response.Results[4].Error.Code)
+		for i, res := range response.Results {
+			assert.Equal(t, i, res.Index)
+		}
+	}
+}
+
 func TestResolveEndpoint(t *testing.T) {
 	router, mockStorage, _, _ := setupTestRouter()
 
@@ -164,7 +242,7 @@ func TestResolveEndpoint(t *testing.T) {
 			name: "successful resolution",
 			code: "abc123",
 			setupMocks: func() {
-				mockStorage.EXPECT().GetURL("abc123").Return("https://example.com")
+				mockStorage.EXPECT().GetLink("", "abc123").Return(storage.LinkRecord{Code: "abc123", URL: "https://example.com"}, true)
 			},
 			expectedStatus:   http.StatusFound,
 			expectedLocation: "https://example.com",
@@ -173,7 +251,7 @@ func TestResolveEndpoint(t *testing.T) {
 			name: "code not found",
 			code: "nonexistent",
 			setupMocks: func() {
-				mockStorage.EXPECT().GetURL("nonexistent").Return("")
+				mockStorage.EXPECT().GetLink("", "nonexistent").Return(storage.LinkRecord{}, false)
 			},
 			expectedStatus: http.StatusNotFound,
 		},
@@ -211,17 +289,19 @@ func TestResolveEndpoint(t *testing.T) {
 			}
 
 			if tt.expectedStatus == http.StatusNotFound {
-				var response ErrorResponse
+				var response problem.Problem
 				err := json.Unmarshal(w.Body.Bytes(), &response)
 				assert.NoError(t, err)
-				assert.Equal(t, "short url not found", response.Message)
+				assert.Equal(t, problem.CodeNotFound, response.Code)
+				assert.Equal(t, "short url not found", response.Detail)
 			}
 
 			if tt.expectedStatus == http.StatusBadRequest {
-				var response ErrorResponse
+				var response problem.Problem
 				err := json.Unmarshal(w.Body.Bytes(), &response)
 				assert.NoError(t, err)
-				assert.Contains(t, response.Message, "invalid")
+				assert.Equal(t, problem.CodeCodeInvalid, response.Code)
+				assert.Contains(t, response.Detail, "invalid")
 			}
 		})
 	}
@@ -248,7 +328,7 @@ func TestMetricsEndpoint(t *testing.T) {
 					{Rank: 2, Domain: "google.com", Shortened: 50},
 					{Rank: 3, Domain: "github.com", Shortened: 25},
 				}
-				mockStorage.EXPECT().TopDomains(3).Return(expected)
+				mockStorage.EXPECT().TopDomains("", 3).Return(expected)
 			},
 			expectedStatus: http.StatusOK,
 			expectedCount:  3,
@@ -262,7 +342,7 @@ func TestMetricsEndpoint(t *testing.T) {
 				expected := []common.TopN{
 					{Rank: 1, Domain: "example.com", Shortened: 100},
 				}
-				mockStorage.EXPECT().TopDomains(3).Return(expected) // Uses default from config
+				mockStorage.EXPECT().TopDomains("", 3).Return(expected) // Uses default from config
 			},
 			expectedStatus: http.StatusOK,
 			expectedCount:  1,
@@ -312,10 +392,11 @@ func TestMetricsEndpoint(t *testing.T) {
 				assert.NoError(t, err)
 				assert.Equal(t, tt.expectedCount, len(response))
 			} else if tt.expectedStatus == http.StatusBadRequest {
-				var response ErrorResponse
+				var response problem.Problem
 				err := json.Unmarshal(w.Body.Bytes(), &response)
 				assert.NoError(t, err)
-				assert.NotEmpty(t, response.Message)
+				assert.Equal(t, problem.CodeInvalidRequest, response.Code)
+				assert.NotEmpty(t, response.Detail)
 			}
 		})
 	}
@@ -339,7 +420,7 @@ func TestHealthEndpoints(t *testing.T) {
 	})
 
 	t.Run("Ready endpoint - healthy", func(t *testing.T) {
-		mockStorage.EXPECT().CodeExists("health-check").Return(false)
+		mockStorage.EXPECT().CodeExists("", "health-check").Return(false)
 
 		req := httptest.NewRequest("GET", "/health/ready", nil)
 		w := httptest.NewRecorder()
@@ -355,7 +436,7 @@ func TestHealthEndpoints(t *testing.T) {
 	})
 
 	t.Run("Ready endpoint - degraded", func(t *testing.T) {
-		mockStorage.EXPECT().CodeExists("health-check").DoAndReturn(func(code string) bool {
+		mockStorage.EXPECT().CodeExists("", "health-check").DoAndReturn(func(namespace, code string) bool {
 			time.Sleep(150 * time.Millisecond) // Simulate slow response
 			return false
 		})
@@ -402,20 +483,34 @@ func TestIsValidCode(t *testing.T) {
 	}
 }
 
-func TestNewErrorResponse(t *testing.T) {
-	t.Run("with error", func(t *testing.T) {
-		err := assert.AnError
-		response := NewErrorResponse("test message", err)
-
-		assert.Equal(t, "test message", response.Message)
-		assert.Equal(t, err.Error(), response.Error)
-	})
+func TestProblemFromError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"blocked ip", &service.URLError{Reason: validator.ReasonIPBlocked, Message: "blocked"}, http.StatusBadRequest, problem.CodeDomainBlocked},
+		{"too long", &service.URLError{Reason: validator.ReasonTooLong, Message: "too long"}, http.StatusBadRequest, problem.CodeURLTooLong},
+		{"code taken", fmt.Errorf("%w: promo", service.ErrCodeTaken), http.StatusConflict, problem.CodeCodeTaken},
+		{"domain not allowed", service.ErrDomainNotAllowed, http.StatusBadRequest, problem.CodeDomainNotAllowed},
+		{"batch too large", service.ErrBatchTooLarge, http.StatusRequestEntityTooLarge, problem.CodeBatchTooLarge},
+		{"campaigns unsupported", service.ErrCampaignsUnsupported, http.StatusNotImplemented, problem.CodeNotImplemented},
+		{"unknown", assert.AnError, http.StatusInternalServerError, problem.CodeInternal},
+	}
 
-	t.Run("without error", func(t *testing.T) {
-		response := NewErrorResponse("test message", nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := problemFromError(tt.err)
+			assert.Equal(t, tt.expectedStatus, p.Status)
+			assert.Equal(t, tt.expectedCode, p.Code)
+			assert.Equal(t, "urn:urlshortener:problem:"+tt.expectedCode, p.Type)
+		})
+	}
 
-		assert.Equal(t, "test message", response.Message)
-		assert.Empty(t, response.Error)
+	t.Run("internal errors are not exposed", func(t *testing.T) {
+		p := problemFromError(assert.AnError)
+		assert.NotContains(t, p.Detail, assert.AnError.Error())
 	})
 }
 
@@ -432,3 +527,977 @@ func TestNewHealthHandler(t *testing.T) {
 	assert.NotNil(t, handler)
 	assert.Equal(t, healthService, handler.healthService)
 }
+
+func TestAPIKeyAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{
+		BaseURL:    "http://localhost:8080",
+		CodeLength: 7,
+		TopN:       3,
+		Auth:       config.AuthConfig{Enabled: true, AdminKey: "admin-secret"},
+	}
+	logger := logger.New("error", "text")
+	svc := service.NewService(store, cfg, logger)
+	RegisterHandlers(router, svc, service.NewHealthService(store, logger), Options{
+		Auth: service.NewAuthService(store, nil, cfg, logger),
+	})
+
+	do := func(method, path string, body interface{}, header, value string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			_ = json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	assertProblem := func(w *httptest.ResponseRecorder, status int, code string) {
+		t.Helper()
+		assert.Equal(t, status, w.Code)
+		var p problem.Problem
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		assert.Equal(t, code, p.Code)
+	}
+	shorten := ShortenRequest{URL: "https://example.com"}
+
+	// missing and unknown credentials
+	w := do("POST", "/v1/shorten", shorten, "", "")
+	assertProblem(w, http.StatusUnauthorized, problem.CodeUnauthorized)
+	assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+	assertProblem(do("POST", "/v1/shorten", shorten, "X-API-Key", "usk_unknown"), http.StatusUnauthorized, problem.CodeUnauthorized)
+
+	// the admin key creates a scoped key
+	w = do("POST", "/v1/keys", CreateAPIKeyRequest{Name: "ci", Scopes: []string{auth.ScopeLinksWrite}}, "Authorization", "Bearer admin-secret")
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created CreateAPIKeyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.ID)
+	assert.NotEmpty(t, created.Key)
+	assert.Equal(t, []string{auth.ScopeLinksWrite}, created.Scopes)
+
+	assertProblem(do("POST", "/v1/keys", CreateAPIKeyRequest{Scopes: []string{"everything"}}, "X-API-Key", "admin-secret"), http.StatusBadRequest, problem.CodeScopeInvalid)
+
+	// the key is limited to its scopes
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/shorten", shorten, "X-API-Key", created.Key).Code)
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/shorten", shorten, "Authorization", "Bearer "+created.Key).Code)
+	assertProblem(do("POST", "/v1/metrics", MetricsRequest{}, "X-API-Key", created.Key), http.StatusForbidden, problem.CodeForbidden)
+	assertProblem(do("GET", "/v1/keys", nil, "X-API-Key", created.Key), http.StatusForbidden, problem.CodeForbidden)
+
+	// list never exposes secrets or hashes
+	w = do("GET", "/v1/keys", nil, "X-API-Key", "admin-secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Key)
+	assert.NotContains(t, w.Body.String(), "hash")
+	var list ListAPIKeysResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	if assert.Len(t, list.Keys, 1) {
+		assert.Nil(t, list.Keys[0].RevokedAt)
+	}
+
+	// redirects stay public
+	code := strings.TrimPrefix(func() string {
+		var resp ShortenResponse
+		_ = json.Unmarshal(do("POST", "/v1/shorten", shorten, "X-API-Key", created.Key).Body.Bytes(), &resp)
+		return resp.ShortURL
+	}(), "http://localhost:8080/")
+	assert.Equal(t, http.StatusFound, do("GET", "/"+code, nil, "", "").Code)
+
+	// revoked keys stop working
+	assert.Equal(t, http.StatusNoContent, do("DELETE", "/v1/keys/"+created.ID, nil, "X-API-Key", "admin-secret").Code)
+	assertProblem(do("DELETE", "/v1/keys/missing", nil, "X-API-Key", "admin-secret"), http.StatusNotFound, problem.CodeNotFound)
+	assertProblem(do("POST", "/v1/shorten", shorten, "X-API-Key", created.Key), http.StatusUnauthorized, problem.CodeUnauthorized)
+}
+
+// setupAuthRouter returns a router with auth enabled on a memory store and
+// the admin key "admin-secret". do sends a request with key and decodes the
+// json response into out, if not nil; a *string out receives the raw body.
+func setupAuthRouter(t *testing.T) (do func(method, path string, body interface{}, key string, out interface{}) int) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{
+		BaseURL:    "http://localhost:8080",
+		CodeLength: 7,
+		TopN:       3,
+		Auth:       config.AuthConfig{Enabled: true, AdminKey: "admin-secret"},
+	}
+	logger := logger.New("error", "text")
+	svc := service.NewService(store, cfg, logger)
+	RegisterHandlers(router, svc, service.NewHealthService(store, logger), Options{
+		Auth: service.NewAuthService(store, nil, cfg, logger),
+	})
+
+	return func(method, path string, body interface{}, key string, out interface{}) int {
+		var buf bytes.Buffer
+		if body != nil {
+			_ = json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		switch out := out.(type) {
+		case nil:
+		case *string:
+			*out = w.Body.String()
+		default:
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), out))
+		}
+		return w.Code
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	do := setupAuthRouter(t)
+	scopes := []string{auth.ScopeLinksRead, auth.ScopeLinksWrite, auth.ScopeMetricsRead, auth.ScopeKeysManage}
+	var acme, globex CreateAPIKeyResponse
+	assert.Equal(t, http.StatusCreated, do("POST", "/v1/keys", CreateAPIKeyRequest{Tenant: "acme", Scopes: scopes}, "admin-secret", &acme))
+	assert.Equal(t, http.StatusCreated, do("POST", "/v1/keys", CreateAPIKeyRequest{Tenant: "globex", Scopes: scopes}, "admin-secret", &globex))
+	assert.Equal(t, "acme", acme.Tenant)
+
+	var shortened ShortenResponse
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/shorten", ShortenRequest{URL: "https://example.com"}, acme.Key, &shortened))
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/shorten", ShortenRequest{URL: "https://example.com"}, globex.Key, nil))
+	code := strings.TrimPrefix(shortened.ShortURL, "http://localhost:8080/")
+
+	// the owner sees its link, other tenants do not
+	var link LinkResponse
+	assert.Equal(t, http.StatusOK, do("GET", "/v1/links/"+code, nil, acme.Key, &link))
+	assert.Equal(t, "acme", link.Owner)
+	assert.Equal(t, "https://example.com", link.URL)
+	assert.Equal(t, http.StatusNotFound, do("GET", "/v1/links/"+code, nil, globex.Key, nil))
+	assert.Equal(t, http.StatusNotFound, do("PATCH", "/v1/links/"+code, UpdateLinkRequest{URL: "https://evil.com"}, globex.Key, nil))
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/v1/links/"+code, nil, globex.Key, nil))
+
+	var list ListLinksResponse
+	assert.Equal(t, http.StatusOK, do("GET", "/v1/links", nil, globex.Key, &list))
+	if assert.Len(t, list.Links, 1) {
+		assert.Equal(t, "globex", list.Links[0].Owner)
+	}
+	assert.Equal(t, http.StatusForbidden, do("GET", "/v1/links?all=true", nil, globex.Key, nil))
+	assert.Equal(t, http.StatusOK, do("GET", "/v1/links?all=true", nil, "admin-secret", &list))
+	assert.Len(t, list.Links, 2)
+
+	// metrics are per tenant; global metrics are for admins
+	var top []common.TopN
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/metrics", MetricsRequest{}, acme.Key, &top))
+	if assert.Len(t, top, 1) {
+		assert.Equal(t, 1, top[0].Shortened)
+	}
+	assert.Equal(t, http.StatusForbidden, do("POST", "/v1/metrics", MetricsRequest{Global: true}, acme.Key, nil))
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/metrics", MetricsRequest{Global: true}, "admin-secret", &top))
+	if assert.Len(t, top, 1) {
+		assert.Equal(t, 2, top[0].Shortened)
+	}
+
+	// tenant keys cannot mint keys for other tenants
+	assert.Equal(t, http.StatusForbidden, do("POST", "/v1/keys", CreateAPIKeyRequest{Tenant: "acme", Scopes: scopes}, globex.Key, nil))
+
+	// owners update and delete their links
+	assert.Equal(t, http.StatusOK, do("PATCH", "/v1/links/"+code, UpdateLinkRequest{URL: "https://example.org"}, acme.Key, &link))
+	assert.Equal(t, "https://example.org", link.URL)
+	assert.Equal(t, http.StatusNoContent, do("DELETE", "/v1/links/"+code, nil, acme.Key, nil))
+	assert.Equal(t, http.StatusNotFound, do("GET", "/v1/links/"+code, nil, acme.Key, nil))
+}
+
+func TestRoleBasedAccess(t *testing.T) {
+	do := setupAuthRouter(t)
+
+	scopes := []string{auth.ScopeLinksRead, auth.ScopeLinksWrite, auth.ScopeMetricsRead, auth.ScopeKeysManage}
+	var viewer, editor CreateAPIKeyResponse
+	assert.Equal(t, http.StatusCreated, do("POST", "/v1/keys", CreateAPIKeyRequest{Tenant: "acme", Role: "viewer", Scopes: scopes}, "admin-secret", &viewer))
+	assert.Equal(t, http.StatusCreated, do("POST", "/v1/keys", CreateAPIKeyRequest{Tenant: "acme", Scopes: scopes}, "admin-secret", &editor))
+	assert.Equal(t, "viewer", viewer.Role)
+	assert.Equal(t, "editor", editor.Role)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/v1/keys", CreateAPIKeyRequest{Role: "root", Scopes: scopes}, "admin-secret", nil))
+
+	// viewers read, editors write
+	var p problem.Problem
+	assert.Equal(t, http.StatusForbidden, do("POST", "/v1/shorten", ShortenRequest{URL: "https://example.com"}, viewer.Key, &p))
+	assert.Equal(t, problem.CodeForbidden, p.Code)
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/shorten", ShortenRequest{URL: "https://example.com"}, editor.Key, nil))
+	assert.Equal(t, http.StatusOK, do("GET", "/v1/links", nil, viewer.Key, nil))
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/metrics", MetricsRequest{}, viewer.Key, nil))
+
+	// admin operations, whatever the scopes of the key
+	for _, key := range []string{viewer.Key, editor.Key} {
+		assert.Equal(t, http.StatusForbidden, do("POST", "/v1/admin/purge", nil, key, nil))
+		assert.Equal(t, http.StatusForbidden, do("GET", "/v1/admin/export", nil, key, nil))
+		assert.Equal(t, http.StatusForbidden, do("GET", "/v1/keys", nil, key, nil))
+	}
+	assert.Equal(t, http.StatusNoContent, do("POST", "/v1/admin/purge", nil, "admin-secret", nil))
+
+	var export string
+	assert.Equal(t, http.StatusOK, do("GET", "/v1/admin/export", nil, "admin-secret", &export))
+	lines := strings.Split(strings.TrimSpace(export), "\n")
+	if assert.Len(t, lines, 1) {
+		var link LinkResponse
+		assert.NoError(t, json.Unmarshal([]byte(lines[0]), &link))
+		assert.Equal(t, "acme", link.Owner)
+	}
+}
+
+func TestAuditLogEndpoint(t *testing.T) {
+	do := setupAuthRouter(t)
+
+	scopes := []string{auth.ScopeLinksRead, auth.ScopeLinksWrite, auth.ScopeAuditRead}
+	var editor CreateAPIKeyResponse
+	assert.Equal(t, http.StatusCreated, do("POST", "/v1/keys", CreateAPIKeyRequest{Tenant: "acme", Scopes: scopes}, "admin-secret", &editor))
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/shorten", ShortenRequest{URL: "https://example.com", Alias: "promo"}, editor.Key, nil))
+	assert.Equal(t, http.StatusForbidden, do("GET", "/v1/audit", nil, editor.Key, nil))
+
+	var log AuditLogResponse
+	assert.Equal(t, http.StatusOK, do("GET", "/v1/audit?limit=2", nil, "admin-secret", &log))
+	if assert.Len(t, log.Events, 2) {
+		assert.Equal(t, "audit.read", log.Events[0].Action)
+		assert.Equal(t, "denied", log.Events[0].Outcome)
+		assert.Equal(t, "link.create", log.Events[1].Action)
+		assert.Equal(t, "link:/promo", log.Events[1].Target)
+		assert.JSONEq(t, `{"url":"https://example.com","domain":"example.com","owner":"acme"}`, string(log.Events[1].After))
+	}
+	assert.NotEmpty(t, log.NextCursor)
+
+	cursor := log.NextCursor
+	log = AuditLogResponse{}
+	assert.Equal(t, http.StatusOK, do("GET", "/v1/audit?cursor="+cursor, nil, "admin-secret", &log))
+	if assert.Len(t, log.Events, 1) {
+		assert.Equal(t, "key.create", log.Events[0].Action)
+	}
+	assert.Empty(t, log.NextCursor)
+
+	assert.Equal(t, http.StatusOK, do("GET", "/v1/audit?action=link.create", nil, "admin-secret", &log))
+	assert.Len(t, log.Events, 1)
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/v1/audit?from=yesterday", nil, "admin-secret", nil))
+	assert.Equal(t, http.StatusBadRequest, do("GET", "/v1/audit?limit=0", nil, "admin-secret", nil))
+}
+
+func TestPasswordProtectedResolve(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "http://localhost:8080", CodeLength: 7, TopN: 3}
+	logger := logger.New("error", "text")
+	RegisterHandlers(router, service.NewService(store, cfg, logger), service.NewHealthService(store, logger), Options{})
+
+	send := func(method, path string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if method == "POST" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	var shortened ShortenResponse
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/shorten", strings.NewReader(`{"url":"https://example.com/doc","alias":"doc","password":"hunter2"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &shortened))
+
+	form := send("GET", "/doc", "")
+	assert.Equal(t, http.StatusOK, form.Code)
+	assert.Contains(t, form.Header().Get("Content-Type"), "text/html")
+	assert.Equal(t, "no-store", form.Header().Get("Cache-Control"))
+	assert.Contains(t, form.Body.String(), `<form method="post">`)
+
+	wrong := send("POST", "/doc", "password=guess")
+	assert.Equal(t, http.StatusForbidden, wrong.Code)
+	assert.Contains(t, wrong.Body.String(), "Incorrect password.")
+
+	right := send("POST", "/doc", "password=hunter2")
+	assert.Equal(t, http.StatusSeeOther, right.Code)
+	assert.Equal(t, "https://example.com/doc", right.Header().Get("Location"))
+
+	var link LinkResponse
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/links/doc", nil))
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+	assert.True(t, link.Protected)
+}
+
+func TestPasswordAttemptsIgnoreForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	// as configured with TRUSTED_PROXIES=none
+	assert.NoError(t, router.SetTrustedProxies(nil))
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{
+		BaseURL:    "http://localhost:8080",
+		CodeLength: 7,
+		Password:   config.PasswordConfig{MaxAttempts: 2, AttemptWindow: time.Minute},
+	}
+	logger := logger.New("error", "text")
+	RegisterHandlers(router, service.NewService(store, cfg, logger), service.NewHealthService(store, logger), Options{})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/shorten", strings.NewReader(`{"url":"https://example.com/doc","alias":"doc","password":"hunter2"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// a new forwarded address per guess does not reset the throttle
+	for i, want := range []int{http.StatusForbidden, http.StatusForbidden, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("POST", "/doc", strings.NewReader("password=guess"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("203.0.113.%d", i+1))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, want, w.Code, "guess %d", i+1)
+	}
+}
+
+func TestOneTimeLinkResolve(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "http://localhost:8080", CodeLength: 7, TopN: 3}
+	logger := logger.New("error", "text")
+	RegisterHandlers(router, service.NewService(store, cfg, logger), service.NewHealthService(store, logger), Options{})
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com/reset","alias":"reset","maxClicks":1}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/v1/shorten", `{"url":"https://example.com","maxClicks":-1}`).Code)
+
+	first := send("GET", "/reset", "")
+	assert.Equal(t, http.StatusFound, first.Code)
+	assert.Equal(t, "https://example.com/reset", first.Header().Get("Location"))
+
+	gone := send("GET", "/reset", "")
+	assert.Equal(t, http.StatusGone, gone.Code)
+	var p problem.Problem
+	assert.NoError(t, json.Unmarshal(gone.Body.Bytes(), &p))
+	assert.Equal(t, problem.CodeLinkExhausted, p.Code)
+
+	var link LinkResponse
+	assert.NoError(t, json.Unmarshal(send("GET", "/v1/links/reset", "").Body.Bytes(), &link))
+	assert.Equal(t, 1, link.MaxClicks)
+	if assert.NotNil(t, link.ClicksLeft) {
+		assert.Equal(t, 0, *link.ClicksLeft)
+	}
+}
+
+func TestScheduledLinkResolve(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "http://localhost:8080", CodeLength: 7, TopN: 3}
+	logger := logger.New("error", "text")
+	RegisterHandlers(router, service.NewService(store, cfg, logger), service.NewHealthService(store, logger), Options{})
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	start := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com/sale","alias":"soon","notBefore":"`+start+`"}`).Code)
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com/sale","alias":"teaser","notBefore":"`+start+`","fallbackUrl":"https://example.com/teaser"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/v1/shorten", `{"url":"https://example.com","notBefore":"`+start+`","notAfter":"2000-01-01T00:00:00Z"}`).Code)
+
+	soon := send("GET", "/soon", "")
+	assert.Equal(t, http.StatusNotFound, soon.Code)
+	var p problem.Problem
+	assert.NoError(t, json.Unmarshal(soon.Body.Bytes(), &p))
+	assert.Equal(t, problem.CodeLinkNotActive, p.Code)
+	assert.Contains(t, p.Detail, start)
+
+	teaser := send("GET", "/teaser", "")
+	assert.Equal(t, http.StatusFound, teaser.Code)
+	assert.Equal(t, "https://example.com/teaser", teaser.Header().Get("Location"))
+
+	var link LinkResponse
+	assert.NoError(t, json.Unmarshal(send("GET", "/v1/links/teaser", "").Body.Bytes(), &link))
+	assert.Equal(t, start, link.NotBefore.UTC().Format(time.RFC3339))
+	assert.True(t, link.NotAfter.IsZero())
+	assert.Equal(t, "https://example.com/teaser", link.FallbackURL)
+}
+
+func TestRedirectStatusResolve(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{
+		BaseURL:    "http://localhost:8080",
+		CodeLength: 7,
+		TopN:       3,
+		Redirect:   config.RedirectConfig{Status: http.StatusFound, PermanentMaxAge: 10 * time.Minute},
+	}
+	logger := logger.New("error", "text")
+	RegisterHandlers(router, service.NewService(store, cfg, logger), service.NewHealthService(store, logger), Options{})
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com/docs","alias":"docs","redirectStatus":301}`).Code)
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://api.example.com/hook","alias":"hook","redirectStatus":307}`).Code)
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com/home","alias":"home"}`).Code)
+	invalid := send("POST", "/v1/shorten", `{"url":"https://example.com","redirectStatus":303}`)
+	assert.Equal(t, http.StatusBadRequest, invalid.Code)
+	var p problem.Problem
+	assert.NoError(t, json.Unmarshal(invalid.Body.Bytes(), &p))
+	assert.Equal(t, problem.CodeRedirectStatusInvalid, p.Code)
+
+	docs := send("GET", "/docs", "")
+	assert.Equal(t, http.StatusMovedPermanently, docs.Code)
+	assert.Equal(t, "https://example.com/docs", docs.Header().Get("Location"))
+	assert.Equal(t, "public, max-age=600", docs.Header().Get("Cache-Control"))
+
+	// temporary redirects keep the method of the request
+	hook := send("POST", "/hook", `{"event":"ping"}`)
+	assert.Equal(t, http.StatusTemporaryRedirect, hook.Code)
+	assert.Equal(t, "no-store", hook.Header().Get("Cache-Control"))
+
+	home := send("GET", "/home", "")
+	assert.Equal(t, http.StatusFound, home.Code)
+	assert.Equal(t, "no-store", home.Header().Get("Cache-Control"))
+
+	var link LinkResponse
+	assert.NoError(t, json.Unmarshal(send("GET", "/v1/links/home", "").Body.Bytes(), &link))
+	assert.Equal(t, http.StatusFound, link.RedirectStatus)
+}
+
+func TestPassthroughResolve(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "http://localhost:8080", CodeLength: 7, TopN: 3}
+	logger := logger.New("error", "text")
+	RegisterHandlers(router, service.NewService(store, cfg, logger), service.NewHealthService(store, logger), Options{})
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com/docs?lang=en#top","alias":"docs","passthrough":"path_query"}`).Code)
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com/home","alias":"home"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, send("POST", "/v1/shorten", `{"url":"https://example.com","passthrough":"fragment"}`).Code)
+
+	docs := send("GET", "/docs/guide/start?utm_source=mail&lang=de", "")
+	assert.Equal(t, http.StatusFound, docs.Code)
+	assert.Equal(t, "https://example.com/docs/guide/start?utm_source=mail&lang=de#top", docs.Header().Get("Location"))
+
+	home := send("GET", "/home?utm_source=mail", "")
+	assert.Equal(t, http.StatusFound, home.Code)
+	assert.Equal(t, "https://example.com/home", home.Header().Get("Location"))
+	assert.Equal(t, http.StatusNotFound, send("GET", "/home/guide", "").Code)
+
+	var link LinkResponse
+	assert.NoError(t, json.Unmarshal(send("GET", "/v1/links/docs", "").Body.Bytes(), &link))
+	assert.Equal(t, service.PassthroughPathQuery, link.Passthrough)
+}
+
+func TestUTMTaggedResolve(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{
+		BaseURL:     "http://localhost:8080",
+		CodeLength:  7,
+		TopN:        3,
+		UTMDefaults: map[string]common.UTM{"localhost:8080": {Source: "shortener", Medium: "link"}},
+	}
+	logger := logger.New("error", "text")
+	RegisterHandlers(router, service.NewService(store, cfg, logger), service.NewHealthService(store, logger), Options{})
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com/sale#top","alias":"sale","utm":{"medium":"email","campaign":"spring"}}`).Code)
+
+	sale := send("GET", "/sale", "")
+	assert.Equal(t, http.StatusFound, sale.Code)
+	assert.Equal(t, "https://example.com/sale?utm_medium=email&utm_campaign=spring&utm_source=shortener#top", sale.Header().Get("Location"))
+
+	var link LinkResponse
+	assert.NoError(t, json.Unmarshal(send("GET", "/v1/links/sale", "").Body.Bytes(), &link))
+	assert.Equal(t, "https://example.com/sale#top", link.URL)
+	assert.Equal(t, common.UTM{Medium: "email", Campaign: "spring"}, link.UTM)
+}
+
+func TestTargetedResolve(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "http://localhost:8080", CodeLength: 7, TopN: 3}
+	logger := logger.New("error", "text")
+	RegisterHandlers(router, service.NewService(store, cfg, logger), service.NewHealthService(store, logger), Options{})
+
+	send := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	bad := send("POST", "/v1/shorten", `{"url":"https://example.com","targets":[{"name":"app","url":"https://apps.apple.com"}]}`, nil)
+	assert.Equal(t, http.StatusBadRequest, bad.Code)
+	assert.Contains(t, bad.Body.String(), problem.CodeTargetsInvalid)
+
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com","alias":"app","targets":[`+
+		`{"name":"ios","device":"ios","url":"https://apps.apple.com/app/id1"},`+
+		`{"name":"de","language":"de","url":"https://example.de"}]}`, nil).Code)
+
+	ios := send("GET", "/app", "", map[string]string{"User-Agent": "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X)"})
+	assert.Equal(t, http.StatusFound, ios.Code)
+	assert.Equal(t, "https://apps.apple.com/app/id1", ios.Header().Get("Location"))
+	assert.Equal(t, "no-store", ios.Header().Get("Cache-Control"))
+
+	de := send("GET", "/app", "", map[string]string{"Accept-Language": "de-CH, en;q=0.8", "Referer": "https://www.google.de/search?q=app"})
+	assert.Equal(t, "https://example.de", de.Header().Get("Location"))
+	assert.Equal(t, "https://example.com", send("GET", "/app", "", nil).Header().Get("Location"))
+
+	var link LinkResponse
+	assert.NoError(t, json.Unmarshal(send("GET", "/v1/links/app", "", nil).Body.Bytes(), &link))
+	assert.Len(t, link.Targets, 2)
+
+	var stats LinkStatsResponse
+	w := send("GET", "/v1/links/app/stats", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	// the clicks of today, by day
+	assert.Len(t, stats.Days, 1)
+	stats.Days = nil
+	assert.Equal(t, LinkStatsResponse{
+		Code:      "app",
+		Clicks:    3,
+		Rules:     map[string]int64{"ios": 1, "de": 1, "default": 1},
+		Referrers: map[string]int64{"www.google.de": 1},
+	}, stats)
+	assert.Equal(t, http.StatusNotFound, send("GET", "/v1/links/missing/stats", "", nil).Code)
+}
+
+func TestVariantResolve(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "http://localhost:8080", CodeLength: 7, TopN: 3}
+	logger := logger.New("error", "text")
+	RegisterHandlers(router, service.NewService(store, cfg, logger), service.NewHealthService(store, logger), Options{})
+
+	send := func(method, path, body string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	bad := send("POST", "/v1/shorten", `{"url":"https://example.com","variants":[{"name":"a","url":"https://example.com/a","weight":1}]}`)
+	assert.Equal(t, http.StatusBadRequest, bad.Code)
+	assert.Contains(t, bad.Body.String(), problem.CodeVariantsInvalid)
+
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com","alias":"ab","variants":[`+
+		`{"name":"a","url":"https://example.com/a","weight":1},{"name":"b","url":"https://example.com/b","weight":0}]}`).Code)
+
+	first := send("GET", "/ab", "")
+	assert.Equal(t, http.StatusFound, first.Code)
+	assert.Equal(t, "https://example.com/a", first.Header().Get("Location"))
+	assert.Equal(t, "no-store", first.Header().Get("Cache-Control"))
+	cookies := first.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, "variant", cookies[0].Name)
+		assert.Equal(t, "a", cookies[0].Value)
+		assert.Equal(t, "/ab", cookies[0].Path)
+		assert.True(t, cookies[0].HttpOnly)
+	}
+
+	w := send("PUT", "/v1/links/ab/variants", `{"variants":[{"name":"a","url":"https://example.com/a","weight":1},{"name":"b","url":"https://example.com/b","weight":1}]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var link LinkResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+	assert.Equal(t, "ab", link.Code)
+	assert.Equal(t, 1, link.Variants[1].Weight)
+
+	assert.Equal(t, "https://example.com/b", send("GET", "/ab", "", &http.Cookie{Name: "variant", Value: "b"}).Header().Get("Location"))
+	assert.Equal(t, http.StatusBadRequest, send("PUT", "/v1/links/ab/variants", `{"variants":[{"name":"a","url":"https://example.com/a","weight":1}]}`).Code)
+
+	var stats LinkStatsResponse
+	assert.NoError(t, json.Unmarshal(send("GET", "/v1/links/ab/stats", "").Body.Bytes(), &stats))
+	assert.Equal(t, map[string]int64{"a": 1, "b": 1}, stats.Variants)
+}
+
+func TestPreviewAndInterstitial(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "interstitial.html"), []byte(`leaving for {{.Domain}}: {{.URL}}`), 0o644))
+	templates, err := LoadTemplates(dir)
+	assert.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "http://localhost:8080", CodeLength: 7, TopN: 3, Preview: config.PreviewConfig{Allowlist: []string{"example.com"}}}
+	logger := logger.New("error", "text")
+	RegisterHandlers(router, service.NewService(store, cfg, logger), service.NewHealthService(store, logger), Options{Templates: templates})
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com/docs","alias":"docs","interstitial":true}`).Code)
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://unknown.net/page","alias":"away","interstitial":true}`).Code)
+
+	for _, path := range []string{"/docs+", "/docs?preview=1"} {
+		w := send("GET", path, "")
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		assert.Contains(t, w.Body.String(), "https://example.com/docs")
+		assert.Contains(t, w.Body.String(), "http://localhost:8080/docs")
+		assert.Contains(t, w.Body.String(), `src="data:image/png;base64,`)
+	}
+	assert.Equal(t, http.StatusNotFound, send("GET", "/missing+", "").Code)
+
+	// the preview of a one-time link does not give its destination away
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com/reset?token=s3cret","alias":"reset","maxClicks":1}`).Code)
+	page := send("GET", "/reset+", "")
+	assert.Equal(t, http.StatusOK, page.Code)
+	assert.Contains(t, page.Body.String(), "example.com")
+	assert.NotContains(t, page.Body.String(), "s3cret")
+
+	// allowlisted destinations redirect, others get the overridden page
+	assert.Equal(t, http.StatusFound, send("GET", "/docs", "").Code)
+	w := send("GET", "/away", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "leaving for unknown.net: https://unknown.net/page", w.Body.String())
+
+	var link LinkResponse
+	assert.NoError(t, json.Unmarshal(send("GET", "/v1/links/away", "").Body.Bytes(), &link))
+	assert.True(t, link.Interstitial)
+}
+
+func TestLinkDetails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "http://localhost:8080", CodeLength: 7, TopN: 3}
+	logger := logger.New("error", "text")
+	RegisterHandlers(router, service.NewService(store, cfg, logger), service.NewHealthService(store, logger), Options{})
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	list := func(query string) []string {
+		var resp ListLinksResponse
+		assert.NoError(t, json.Unmarshal(send("GET", "/v1/links"+query, "").Body.Bytes(), &resp))
+		codes := []string{}
+		for _, link := range resp.Links {
+			codes = append(codes, link.Code)
+		}
+		return codes
+	}
+
+	bad := send("POST", "/v1/shorten", `{"url":"https://example.com","tags":["a,b"]}`)
+	assert.Equal(t, http.StatusBadRequest, bad.Code)
+	assert.Contains(t, bad.Body.String(), problem.CodeDetailsInvalid)
+
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com/sale","alias":"sale",`+
+		`"title":"Spring Sale","tags":["Promo"],"metadata":{"team":"growth","region":"eu"}}`).Code)
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com/docs","alias":"docs"}`).Code)
+
+	var link LinkResponse
+	assert.NoError(t, json.Unmarshal(send("GET", "/v1/links/sale", "").Body.Bytes(), &link))
+	assert.Equal(t, "Spring Sale", link.Title)
+	assert.Equal(t, []string{"promo"}, link.Tags)
+	assert.Equal(t, map[string]string{"team": "growth", "region": "eu"}, link.Metadata)
+
+	assert.Equal(t, []string{"sale", "docs"}, list(""))
+	assert.Equal(t, []string{"sale"}, list("?tag=promo"))
+	assert.Equal(t, []string{"docs"}, list("?q=DOCS"))
+	assert.Equal(t, []string{"sale"}, list("?meta=team:growth&meta=region:eu"))
+	assert.Empty(t, list("?meta=team:growth&meta=region:us"))
+	assert.Equal(t, http.StatusBadRequest, send("GET", "/v1/links?meta=team", "").Code)
+
+	// updates keep what they leave out
+	w := send("PATCH", "/v1/links/docs", `{"description":"API reference","tags":["docs"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+	assert.Equal(t, "https://example.com/docs", link.URL)
+	assert.Equal(t, "API reference", link.Description)
+	assert.Equal(t, []string{"docs"}, link.Tags)
+	assert.Equal(t, http.StatusBadRequest, send("PATCH", "/v1/links/docs", `{}`).Code)
+
+	// exports carry the details
+	export := send("GET", "/v1/admin/export", "").Body.String()
+	assert.Contains(t, export, `"title":"Spring Sale"`)
+	assert.Contains(t, export, `"description":"API reference"`)
+}
+
+func TestCampaigns(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "http://localhost:8080", CodeLength: 7, TopN: 3}
+	logger := logger.New("error", "text")
+	RegisterHandlers(router, service.NewService(store, cfg, logger), service.NewHealthService(store, logger), Options{})
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	bad := send("POST", "/v1/campaigns", `{"name":""}`)
+	assert.Equal(t, http.StatusBadRequest, bad.Code)
+	assert.Contains(t, bad.Body.String(), problem.CodeCampaignInvalid)
+
+	var campaign CampaignResponse
+	w := send("POST", "/v1/campaigns", `{"name":"Spring"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &campaign))
+	assert.Equal(t, "Spring", campaign.Name)
+
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com/a","alias":"a","campaign":"`+campaign.ID+`"}`).Code)
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com/b","alias":"b"}`).Code)
+	assert.Equal(t, http.StatusNotFound, send("POST", "/v1/shorten", `{"url":"https://example.com/c","campaign":"missing"}`).Code)
+
+	var link LinkResponse
+	w = send("PATCH", "/v1/links/b", `{"campaign":"`+campaign.ID+`"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &link))
+	assert.Equal(t, campaign.ID, link.Campaign)
+	assert.Equal(t, http.StatusFound, send("GET", "/a", "").Code)
+
+	var list ListLinksResponse
+	assert.NoError(t, json.Unmarshal(send("GET", "/v1/links?campaign="+campaign.ID, "").Body.Bytes(), &list))
+	assert.Len(t, list.Links, 2)
+
+	var stats CampaignStatsResponse
+	w = send("GET", "/v1/campaigns/"+campaign.ID+"/stats", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, 2, stats.Links)
+	assert.Equal(t, 2, stats.Created)
+	assert.Equal(t, int64(1), stats.Clicks)
+	assert.Len(t, stats.Days, 30)
+	assert.Equal(t, http.StatusBadRequest, send("GET", "/v1/campaigns/"+campaign.ID+"/stats?from=2025-01-01T00:00:00Z&to=2024-01-01T00:00:00Z", "").Code)
+
+	var top []common.TopN
+	assert.NoError(t, json.Unmarshal(send("POST", "/v1/metrics", `{"campaign":"`+campaign.ID+`"}`).Body.Bytes(), &top))
+	if assert.Len(t, top, 1) {
+		assert.Equal(t, 2, top[0].Shortened)
+	}
+
+	w = send("PATCH", "/v1/campaigns/"+campaign.ID, `{"name":"Spring Sale","cascade":true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &campaign))
+	assert.Equal(t, "Spring Sale", campaign.Name)
+	assert.True(t, campaign.Cascade)
+
+	var campaigns ListCampaignsResponse
+	assert.NoError(t, json.Unmarshal(send("GET", "/v1/campaigns", "").Body.Bytes(), &campaigns))
+	assert.Len(t, campaigns.Campaigns, 1)
+
+	assert.Equal(t, http.StatusNoContent, send("DELETE", "/v1/campaigns/"+campaign.ID+"?cascade=true", "").Code)
+	assert.Equal(t, http.StatusNotFound, send("GET", "/v1/campaigns/"+campaign.ID, "").Code)
+	assert.Equal(t, http.StatusNotFound, send("GET", "/v1/links/a", "").Code)
+}
+
+func TestLinkAnalytics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "http://localhost:8080", CodeLength: 7, TopN: 3}
+	logger := logger.New("error", "text")
+	RegisterHandlers(router, service.NewService(store, cfg, logger), service.NewHealthService(store, logger), Options{})
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com","alias":"app"}`).Code)
+	for range 2 {
+		assert.Equal(t, http.StatusFound, send("GET", "/app", "").Code)
+	}
+
+	var analytics AnalyticsResponse
+	w := send("GET", "/v1/links/app/analytics?interval=minute", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &analytics))
+	assert.Equal(t, "minute", analytics.Interval)
+	assert.Equal(t, int64(2), analytics.Clicks)
+	assert.Len(t, analytics.Buckets, 24*60)
+
+	w = send("GET", "/v1/links/app/analytics?interval=day&from=2025-03-01T00:00:00Z&to=2025-03-08T00:00:00Z", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &analytics))
+	assert.Len(t, analytics.Buckets, 7)
+	assert.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), analytics.Buckets[0].Start)
+	assert.Equal(t, int64(0), analytics.Clicks)
+
+	bad := send("GET", "/v1/links/app/analytics?interval=week", "")
+	assert.Equal(t, http.StatusBadRequest, bad.Code)
+	assert.Contains(t, bad.Body.String(), problem.CodeRangeInvalid)
+	assert.Equal(t, http.StatusBadRequest, send("GET", "/v1/links/app/analytics?from=yesterday", "").Code)
+	assert.Equal(t, http.StatusNotFound, send("GET", "/v1/links/missing/analytics", "").Code)
+}
+
+func TestUniques(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "http://localhost:8080", CodeLength: 7, TopN: 3}
+	logger := logger.New("error", "text")
+	RegisterHandlers(router, service.NewService(store, cfg, logger), service.NewHealthService(store, logger), Options{})
+
+	send := func(method, path, body, userAgent string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("User-Agent", userAgent)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	var campaign CampaignResponse
+	assert.NoError(t, json.Unmarshal(send("POST", "/v1/campaigns", `{"name":"Spring"}`, "").Body.Bytes(), &campaign))
+	assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com","alias":"app","campaign":"`+campaign.ID+`"}`, "").Code)
+	for _, ua := range []string{"Firefox", "Firefox", "Safari"} {
+		assert.Equal(t, http.StatusFound, send("GET", "/app", "", ua).Code)
+	}
+
+	var uniques UniquesResponse
+	w := send("GET", "/v1/links/app/uniques?interval=week", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &uniques))
+	assert.Equal(t, "week", uniques.Interval)
+	assert.Equal(t, uint64(2), uniques.Visitors)
+	assert.Equal(t, time.Monday, uniques.Periods[0].Start.Weekday())
+
+	w = send("GET", "/v1/campaigns/"+campaign.ID+"/uniques?from=2025-03-01T00:00:00Z&to=2025-03-03T00:00:00Z", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &uniques))
+	assert.Len(t, uniques.Periods, 2)
+	assert.Equal(t, uint64(0), uniques.Visitors)
+
+	bad := send("GET", "/v1/links/app/uniques?interval=year", "", "")
+	assert.Equal(t, http.StatusBadRequest, bad.Code)
+	assert.Contains(t, bad.Body.String(), problem.CodeRangeInvalid)
+	assert.Equal(t, http.StatusNotFound, send("GET", "/v1/campaigns/missing/uniques", "", "").Code)
+}
+
+func TestBotClicks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "http://localhost:8080", CodeLength: 7, TopN: 3}
+	logger := logger.New("error", "text")
+	RegisterHandlers(router, service.NewService(store, cfg, logger), service.NewHealthService(store, logger), Options{})
+
+	send := func(method, path string, header http.Header) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, path, nil)
+		for name, values := range header {
+			r.Header[name] = values
+		}
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/shorten", strings.NewReader(`{"url":"https://example.com","alias":"app"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// bots are redirected like people
+	assert.Equal(t, http.StatusFound, send("GET", "/app", http.Header{"User-Agent": {"Mozilla/5.0 (X11; Linux x86_64)"}}).Code)
+	assert.Equal(t, http.StatusFound, send("GET", "/app", http.Header{"User-Agent": {"Twitterbot/1.0"}}).Code)
+	assert.Equal(t, http.StatusFound, send("GET", "/app", http.Header{"Sec-Purpose": {"prefetch"}}).Code)
+	head := send("HEAD", "/app", nil)
+	assert.Equal(t, http.StatusFound, head.Code)
+	assert.Equal(t, "https://example.com", head.Header().Get("Location"))
+
+	var stats LinkStatsResponse
+	w = send("GET", "/v1/links/app/stats", nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, int64(1), stats.Clicks)
+	assert.Zero(t, stats.Bots)
+	w = send("GET", "/v1/links/app/stats?bots=true", nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, int64(4), stats.Clicks)
+	assert.Equal(t, int64(3), stats.Bots)
+
+	var analytics AnalyticsResponse
+	w = send("GET", "/v1/links/app/analytics", nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &analytics))
+	assert.Equal(t, int64(1), analytics.Clicks)
+	w = send("GET", "/v1/links/app/analytics?bots=true", nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &analytics))
+	assert.Equal(t, int64(4), analytics.Clicks)
+	assert.Equal(t, int64(3), analytics.Buckets[len(analytics.Buckets)-1].Bots)
+}
+
+func TestBotsUseClicks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "http://localhost:8080", CodeLength: 7, TopN: 3}
+	logger := logger.New("error", "text")
+	RegisterHandlers(router, service.NewService(store, cfg, logger), service.NewHealthService(store, logger), Options{})
+
+	send := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	bot := map[string]string{"User-Agent": "Twitterbot/1.0"}
+	for _, first := range []struct {
+		alias, method string
+		header        map[string]string
+	}{
+		{"head", "HEAD", nil},
+		{"bot", "GET", bot},
+	} {
+		assert.Equal(t, http.StatusOK, send("POST", "/v1/shorten", `{"url":"https://example.com","alias":"`+first.alias+`","maxClicks":1}`, nil).Code)
+		assert.Equal(t, http.StatusFound, send(first.method, "/"+first.alias, "", first.header).Code)
+
+		var link LinkResponse
+		assert.NoError(t, json.Unmarshal(send("GET", "/v1/links/"+first.alias, "", nil).Body.Bytes(), &link))
+		if assert.NotNil(t, link.ClicksLeft) {
+			assert.Equal(t, 0, *link.ClicksLeft, first.alias)
+		}
+		for _, again := range []*httptest.ResponseRecorder{
+			send("HEAD", "/"+first.alias, "", nil),
+			send("GET", "/"+first.alias, "", bot),
+			send("GET", "/"+first.alias, "", nil),
+		} {
+			assert.Equal(t, http.StatusGone, again.Code, first.alias)
+			assert.Empty(t, again.Header().Get("Location"), first.alias)
+		}
+	}
+}
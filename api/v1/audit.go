@@ -0,0 +1,87 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/problem"
+	"github.com/parikshitg/urlshortener/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditEventResponse struct {
+	ID        string          `json:"id"`
+	Time      time.Time       `json:"time"`
+	Actor     string          `json:"actor,omitempty"`
+	Tenant    string          `json:"tenant,omitempty"`
+	Role      string          `json:"role,omitempty"`
+	RequestID string          `json:"requestId,omitempty"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target,omitempty"`
+	Outcome   string          `json:"outcome"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+}
+
+type AuditLogResponse struct {
+	Events []AuditEventResponse `json:"events"`
+	// NextCursor fetches the next, older page when passed as ?cursor=. It is
+	// empty on the last page.
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// auditLog lists audit events, newest first, filtered by the actor, action,
+// target, from and to query parameters and paged with limit and cursor.
+func (r resource) auditLog(c *gin.Context) {
+	filter := storage.AuditFilter{
+		Actor:  c.Query("actor"),
+		Action: c.Query("action"),
+		Target: c.Query("target"),
+		Before: c.Query("cursor"),
+	}
+	var ok bool
+	if filter.From, ok = queryTime(c, "from"); !ok {
+		return
+	}
+	if filter.To, ok = queryTime(c, "to"); !ok {
+		return
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			problem.Write(c, invalidRequest("limit must be a positive integer"))
+			return
+		}
+		filter.Limit = n
+	}
+
+	events, next, err := r.svc.AuditLog(c.Request.Context(), filter)
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	resp := &AuditLogResponse{Events: make([]AuditEventResponse, 0, len(events)), NextCursor: next}
+	for _, event := range events {
+		resp.Events = append(resp.Events, AuditEventResponse(event))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// queryTime parses the RFC 3339 time in query parameter name, if present,
+// writing a problem if it is invalid.
+func queryTime(c *gin.Context, name string) (time.Time, bool) {
+	v := c.Query(name)
+	if v == "" {
+		return time.Time{}, true
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		problem.Write(c, invalidRequest(name+" must be an RFC 3339 time"))
+		return time.Time{}, false
+	}
+	return t, true
+}
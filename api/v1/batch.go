@@ -0,0 +1,78 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/parikshitg/urlshortener/internal/problem"
+	"github.com/parikshitg/urlshortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BatchShortenRequest struct {
+	Items []ShortenRequest `json:"items"`
+}
+
+// BatchShortenResult is the result of the item at the same index of the
+// request. Exactly one of ShortURL and Error is set.
+type BatchShortenResult struct {
+	Index    int              `json:"index"`
+	ShortURL string           `json:"shortUrl,omitempty"`
+	Error    *problem.Problem `json:"error,omitempty"`
+}
+
+type BatchShortenResponse struct {
+	Results []BatchShortenResult `json:"results"`
+}
+
+func (r resource) shortenBatch(c *gin.Context) {
+	req := &BatchShortenRequest{}
+
+	// parse request
+	if err := c.ShouldBindJSON(req); err != nil {
+		problem.Write(c, invalidRequest("failed to parse request: "+err.Error()))
+		return
+	}
+
+	// validate request
+	if len(req.Items) == 0 {
+		problem.Write(c, invalidRequest("items are required"))
+		return
+	}
+
+	results := make([]BatchShortenResult, len(req.Items))
+	items := make([]service.BatchItem, 0, len(req.Items))
+	index := make([]int, 0, len(req.Items))
+	for i, item := range req.Items {
+		results[i].Index = i
+		if item.URL == "" {
+			results[i].Error = invalidRequest("url is required")
+			continue
+		}
+		opts, err := item.options()
+		if err != nil {
+			results[i].Error = problem.New(http.StatusBadRequest, problem.CodeTTLInvalid, err.Error())
+			continue
+		}
+		items = append(items, service.BatchItem{URL: item.URL, Options: opts})
+		index = append(index, i)
+	}
+
+	shortened, err := r.svc.ShortenBatch(c.Request.Context(), items)
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	for j, res := range shortened {
+		i := index[j]
+		if res.Err != nil {
+			results[i].Error = problemFromError(res.Err)
+			results[i].Error.Instance = c.Request.URL.Path
+			continue
+		}
+		results[i].ShortURL = res.ShortURL
+	}
+
+	c.JSON(http.StatusOK, &BatchShortenResponse{Results: results})
+}
@@ -0,0 +1,186 @@
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/problem"
+	"github.com/parikshitg/urlshortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateCampaignRequest struct {
+	Name string `json:"name"`
+	// ExpiresAt ends the campaign, which is then deleted.
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	// Cascade deletes the links of the campaign when it ends, instead of
+	// moving them out of it.
+	Cascade bool `json:"cascade,omitempty"`
+}
+
+// UpdateCampaignRequest changes a campaign. Absent fields are kept; an
+// expiresAt of "0001-01-01T00:00:00Z" removes the end.
+type UpdateCampaignRequest struct {
+	Name      *string    `json:"name,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Cascade   *bool      `json:"cascade,omitempty"`
+}
+
+type CampaignResponse struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	Cascade   bool      `json:"cascade,omitempty"`
+}
+
+type ListCampaignsResponse struct {
+	Campaigns []CampaignResponse `json:"campaigns"`
+}
+
+type CampaignStatsResponse struct {
+	Campaign string    `json:"campaign"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	// Links is the number of live links of the campaign.
+	Links int `json:"links"`
+	// Created and Clicks are the links created and their clicks in the range.
+	Created int                `json:"created"`
+	Clicks  int64              `json:"clicks"`
+	Days    []DayStatsResponse `json:"days"`
+}
+
+type DayStatsResponse struct {
+	Day     string `json:"day"`
+	Created int    `json:"created"`
+	Clicks  int64  `json:"clicks"`
+}
+
+func (r resource) createCampaign(c *gin.Context) {
+	req := &CreateCampaignRequest{}
+
+	// parse request
+	err := c.ShouldBindJSON(req)
+	if err != nil {
+		problem.Write(c, invalidRequest("failed to parse request: "+err.Error()))
+		return
+	}
+
+	campaign, err := r.svc.CreateCampaign(c.Request.Context(), service.CampaignOptions{
+		Name:      req.Name,
+		ExpiresAt: req.ExpiresAt,
+		Cascade:   req.Cascade,
+	})
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, CampaignResponse(campaign))
+}
+
+// listCampaigns lists the caller's campaigns; admins list every tenant's
+// campaigns with ?all=true.
+func (r resource) listCampaigns(c *gin.Context) {
+	campaigns, err := r.svc.ListCampaigns(c.Request.Context(), c.Query("all") == "true")
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	resp := &ListCampaignsResponse{Campaigns: make([]CampaignResponse, 0, len(campaigns))}
+	for _, campaign := range campaigns {
+		resp.Campaigns = append(resp.Campaigns, CampaignResponse(campaign))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (r resource) getCampaign(c *gin.Context) {
+	campaign, err := r.svc.GetCampaign(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, CampaignResponse(campaign))
+}
+
+func (r resource) updateCampaign(c *gin.Context) {
+	req := &UpdateCampaignRequest{}
+
+	// parse request
+	err := c.ShouldBindJSON(req)
+	if err != nil {
+		problem.Write(c, invalidRequest("failed to parse request: "+err.Error()))
+		return
+	}
+
+	campaign, err := r.svc.UpdateCampaign(c.Request.Context(), c.Param("id"), service.CampaignUpdate(*req))
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, CampaignResponse(campaign))
+}
+
+// deleteCampaign deletes a campaign; ?cascade=true deletes its links too.
+func (r resource) deleteCampaign(c *gin.Context) {
+	if err := r.svc.DeleteCampaign(c.Request.Context(), c.Param("id"), c.Query("cascade") == "true"); err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// campaignStats aggregates the links of a campaign by day between the from
+// and to query parameters. The clicks of bots are counted with bots=true.
+func (r resource) campaignStats(c *gin.Context) {
+	from, ok := queryTime(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := queryTime(c, "to")
+	if !ok {
+		return
+	}
+
+	stats, err := r.svc.CampaignStats(c.Request.Context(), c.Param("id"), from, to, c.Query("bots") == "true")
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	resp := &CampaignStatsResponse{
+		Campaign: stats.Campaign,
+		From:     stats.From,
+		To:       stats.To,
+		Links:    stats.Links,
+		Created:  stats.Created,
+		Clicks:   stats.Clicks,
+		Days:     make([]DayStatsResponse, 0, len(stats.Days)),
+	}
+	for _, d := range stats.Days {
+		resp.Days = append(resp.Days, DayStatsResponse(d))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// campaignUniques returns the unique visitors of the links of a campaign
+// per interval between the from and to query parameters.
+func (r resource) campaignUniques(c *gin.Context) {
+	q, ok := uniquesQuery(c)
+	if !ok {
+		return
+	}
+
+	uniques, err := r.svc.CampaignUniques(c.Request.Context(), c.Param("id"), q)
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+	c.JSON(http.StatusOK, newUniquesResponse(uniques))
+}
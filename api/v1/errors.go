@@ -1,14 +1,71 @@
 package v1
 
-type ErrorResponse struct {
-	Message string `json:"message"`
-	Error   string `json:"error,omitempty"`
+import (
+	"errors"
+	"net/http"
+
+	"github.com/parikshitg/urlshortener/internal/problem"
+	"github.com/parikshitg/urlshortener/internal/service"
+	"github.com/parikshitg/urlshortener/internal/validator"
+)
+
+// serviceErrors maps service sentinel errors to their status and code.
+var serviceErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{service.ErrDomainNotAllowed, http.StatusBadRequest, problem.CodeDomainNotAllowed},
+	{service.ErrInvalidAlias, http.StatusBadRequest, problem.CodeAliasInvalid},
+	{service.ErrInvalidTTL, http.StatusBadRequest, problem.CodeTTLInvalid},
+	{service.ErrInvalidPassword, http.StatusBadRequest, problem.CodePasswordInvalid},
+	{service.ErrInvalidMaxClicks, http.StatusBadRequest, problem.CodeMaxClicksInvalid},
+	{service.ErrInvalidSchedule, http.StatusBadRequest, problem.CodeScheduleInvalid},
+	{service.ErrInvalidRedirectStatus, http.StatusBadRequest, problem.CodeRedirectStatusInvalid},
+	{service.ErrInvalidPassthrough, http.StatusBadRequest, problem.CodePassthroughInvalid},
+	{service.ErrInvalidTargets, http.StatusBadRequest, problem.CodeTargetsInvalid},
+	{service.ErrInvalidVariants, http.StatusBadRequest, problem.CodeVariantsInvalid},
+	{service.ErrInvalidDetails, http.StatusBadRequest, problem.CodeDetailsInvalid},
+	{service.ErrInvalidCampaign, http.StatusBadRequest, problem.CodeCampaignInvalid},
+	{service.ErrInvalidRange, http.StatusBadRequest, problem.CodeRangeInvalid},
+	{service.ErrCampaignNotFound, http.StatusNotFound, problem.CodeNotFound},
+	{service.ErrCampaignsUnsupported, http.StatusNotImplemented, problem.CodeNotImplemented},
+	{service.ErrCodeTaken, http.StatusConflict, problem.CodeCodeTaken},
+	{service.ErrBatchTooLarge, http.StatusRequestEntityTooLarge, problem.CodeBatchTooLarge},
+	{service.ErrInvalidScope, http.StatusBadRequest, problem.CodeScopeInvalid},
+	{service.ErrInvalidRole, http.StatusBadRequest, problem.CodeRoleInvalid},
+	{service.ErrInvalidKeyName, http.StatusBadRequest, problem.CodeInvalidRequest},
+	{service.ErrAPIKeyNotFound, http.StatusNotFound, problem.CodeNotFound},
+	{service.ErrLinkNotFound, http.StatusNotFound, problem.CodeNotFound},
+	{service.ErrLinkExhausted, http.StatusGone, problem.CodeLinkExhausted},
+	{service.ErrLinkNotActive, http.StatusNotFound, problem.CodeLinkNotActive},
+	{service.ErrForbidden, http.StatusForbidden, problem.CodeForbidden},
 }
 
-func NewErrorResponse(message string, err error) *ErrorResponse {
-	res := &ErrorResponse{Message: message}
-	if err != nil {
-		res.Error = err.Error()
+// problemFromError maps an error returned by the service to a problem.
+// Unknown errors are internal errors and their details are not exposed.
+func problemFromError(err error) *problem.Problem {
+	var urlErr *service.URLError
+	if errors.As(err, &urlErr) {
+		code := problem.CodeURLInvalid
+		switch urlErr.Reason {
+		case validator.ReasonDomainBlocked, validator.ReasonIPBlocked:
+			code = problem.CodeDomainBlocked
+		case validator.ReasonTooLong:
+			code = problem.CodeURLTooLong
+		}
+		return problem.New(http.StatusBadRequest, code, urlErr.Message).WithReason(string(urlErr.Reason))
+	}
+
+	for _, e := range serviceErrors {
+		if errors.Is(err, e.err) {
+			return problem.New(e.status, e.code, err.Error())
+		}
 	}
-	return res
+	return problem.New(http.StatusInternalServerError, problem.CodeInternal, "internal server error")
+}
+
+// invalidRequest is the problem for malformed or incomplete requests.
+func invalidRequest(detail string) *problem.Problem {
+	return problem.New(http.StatusBadRequest, problem.CodeInvalidRequest, detail)
 }
@@ -0,0 +1,106 @@
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/auth"
+	"github.com/parikshitg/urlshortener/internal/problem"
+	"github.com/parikshitg/urlshortener/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateAPIKeyRequest struct {
+	// Name is a free-form label for the key.
+	Name string `json:"name,omitempty"`
+	// Tenant the key acts for; defaults to a new tenant of its own.
+	Tenant string `json:"tenant,omitempty"`
+	// Role of the key: viewer, editor or admin. (default is editor)
+	Role string `json:"role,omitempty"`
+	// Scopes are the permissions granted to the key.
+	Scopes []string `json:"scopes"`
+}
+
+// APIKeyResponse describes an api key without its secret.
+type APIKeyResponse struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Tenant    string     `json:"tenant"`
+	Role      string     `json:"role"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// CreateAPIKeyResponse is returned once, when a key is created. Key is the
+// secret and cannot be retrieved again.
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+type ListAPIKeysResponse struct {
+	Keys []APIKeyResponse `json:"keys"`
+}
+
+func (r resource) createAPIKey(c *gin.Context) {
+	req := &CreateAPIKeyRequest{}
+
+	// parse request
+	err := c.ShouldBindJSON(req)
+	if err != nil {
+		problem.Write(c, invalidRequest("failed to parse request: "+err.Error()))
+		return
+	}
+
+	key, secret, err := r.auth.CreateAPIKey(c.Request.Context(), req.Name, req.Tenant, auth.Role(req.Role), req.Scopes)
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	c.JSON(http.StatusCreated, &CreateAPIKeyResponse{APIKeyResponse: newAPIKeyResponse(key), Key: secret})
+}
+
+func (r resource) listAPIKeys(c *gin.Context) {
+	keys, err := r.auth.ListAPIKeys(c.Request.Context())
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	resp := &ListAPIKeysResponse{Keys: make([]APIKeyResponse, 0, len(keys))}
+	for _, key := range keys {
+		resp.Keys = append(resp.Keys, newAPIKeyResponse(key))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (r resource) revokeAPIKey(c *gin.Context) {
+	if err := r.auth.RevokeAPIKey(c.Request.Context(), c.Param("id")); err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func newAPIKeyResponse(key storage.APIKey) APIKeyResponse {
+	resp := APIKeyResponse{
+		ID:        key.ID,
+		Name:      key.Name,
+		Tenant:    key.Tenant,
+		Role:      key.Role,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+	}
+	if resp.Role == "" {
+		resp.Role = string(auth.DefaultRole)
+	}
+	if key.Revoked() {
+		revokedAt := key.RevokedAt
+		resp.RevokedAt = &revokedAt
+	}
+	return resp
+}
@@ -0,0 +1,245 @@
+package v1
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/problem"
+	"github.com/parikshitg/urlshortener/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LinkResponse struct {
+	Code     string `json:"code"`
+	ShortURL string `json:"shortUrl"`
+	URL      string `json:"url"`
+	// Domain is the short domain the link was created on.
+	Domain    string    `json:"domain"`
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Protected is set when resolving the link requires a password.
+	Protected bool `json:"protected,omitempty"`
+	// MaxClicks is the click limit of the link, absent when unlimited.
+	MaxClicks int `json:"maxClicks,omitempty"`
+	// ClicksLeft is the number of resolves left of a click-limited link.
+	ClicksLeft *int `json:"clicksLeft,omitempty"`
+	// NotBefore and NotAfter bound the window in which the link redirects.
+	NotBefore time.Time `json:"notBefore,omitzero"`
+	NotAfter  time.Time `json:"notAfter,omitzero"`
+	// FallbackURL is redirected to outside the window.
+	FallbackURL string `json:"fallbackUrl,omitempty"`
+	// RedirectStatus is the status code the link redirects with.
+	RedirectStatus int `json:"redirectStatus"`
+	// Passthrough is what of the short url is passed on to the url, absent
+	// for nothing.
+	Passthrough string `json:"passthrough,omitempty"`
+	// UTM are the utm parameters of the link, without the domain defaults.
+	UTM common.UTM `json:"utm,omitzero"`
+	// Targets are the targeting rules of the link.
+	Targets []common.TargetRule `json:"targets,omitempty"`
+	// Variants are the weighted destinations of the link.
+	Variants []common.Variant `json:"variants,omitempty"`
+	// Interstitial is set when the link shows a warning page before
+	// redirecting.
+	Interstitial bool `json:"interstitial,omitempty"`
+	// Title and Description describe the link to its managers.
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Tags label the link for filtering.
+	Tags []string `json:"tags,omitempty"`
+	// Metadata are free-form key/value pairs.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Campaign is the id of the campaign of the link.
+	Campaign string `json:"campaign,omitempty"`
+}
+
+type ListLinksResponse struct {
+	Links []LinkResponse `json:"links"`
+}
+
+// UpdateLinkRequest changes a link. Absent fields are kept; an empty title,
+// description, tags or metadata removes them and an empty campaign moves the
+// link out of its campaign.
+type UpdateLinkRequest struct {
+	URL         string            `json:"url,omitempty"`
+	Title       *string           `json:"title,omitempty"`
+	Description *string           `json:"description,omitempty"`
+	Tags        []string          `json:"tags,omitempty"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	Campaign    *string           `json:"campaign,omitempty"`
+}
+
+type UpdateVariantsRequest struct {
+	// Variants replace those of the link; empty removes them.
+	Variants []common.Variant `json:"variants"`
+}
+
+// listLinks lists the caller's links; admins list every tenant's links with ?all=true.
+// They are filtered by ?tag=, ?q=, ?campaign= and repeated ?meta=key:value.
+func (r resource) listLinks(c *gin.Context) {
+	query := service.LinkQuery{
+		All:      c.Query("all") == "true",
+		Tag:      c.Query("tag"),
+		Search:   c.Query("q"),
+		Campaign: c.Query("campaign"),
+	}
+	for _, pair := range c.QueryArray("meta") {
+		key, value, ok := strings.Cut(pair, ":")
+		if !ok || key == "" {
+			problem.Write(c, invalidRequest("meta must be key:value"))
+			return
+		}
+		if query.Metadata == nil {
+			query.Metadata = make(map[string]string)
+		}
+		query.Metadata[key] = value
+	}
+
+	links, err := r.svc.ListLinks(c.Request.Context(), query)
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	resp := &ListLinksResponse{Links: make([]LinkResponse, 0, len(links))}
+	for _, link := range links {
+		resp.Links = append(resp.Links, newLinkResponse(link))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (r resource) getLink(c *gin.Context) {
+	code, ok := linkCode(c)
+	if !ok {
+		return
+	}
+
+	link, err := r.svc.GetLink(c.Request.Context(), c.Query("domain"), code)
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, newLinkResponse(link))
+}
+
+func (r resource) updateLink(c *gin.Context) {
+	code, ok := linkCode(c)
+	if !ok {
+		return
+	}
+	req := &UpdateLinkRequest{}
+
+	// parse request
+	err := c.ShouldBindJSON(req)
+	if err != nil {
+		problem.Write(c, invalidRequest("failed to parse request: "+err.Error()))
+		return
+	}
+
+	// validate request
+	if req.URL == "" && req.Title == nil && req.Description == nil && req.Tags == nil && req.Metadata == nil && req.Campaign == nil {
+		problem.Write(c, invalidRequest("url, title, description, tags, metadata or campaign is required"))
+		return
+	}
+
+	link, err := r.svc.UpdateLink(c.Request.Context(), c.Query("domain"), code, service.LinkUpdate{
+		URL:         req.URL,
+		Title:       req.Title,
+		Description: req.Description,
+		Tags:        req.Tags,
+		Metadata:    req.Metadata,
+		Campaign:    req.Campaign,
+	})
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, newLinkResponse(link))
+}
+
+// updateVariants replaces the variants of a link, keeping its code.
+func (r resource) updateVariants(c *gin.Context) {
+	code, ok := linkCode(c)
+	if !ok {
+		return
+	}
+	req := &UpdateVariantsRequest{}
+
+	// parse request
+	err := c.ShouldBindJSON(req)
+	if err != nil {
+		problem.Write(c, invalidRequest("failed to parse request: "+err.Error()))
+		return
+	}
+
+	link, err := r.svc.UpdateVariants(c.Request.Context(), c.Query("domain"), code, req.Variants)
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, newLinkResponse(link))
+}
+
+func (r resource) deleteLink(c *gin.Context) {
+	code, ok := linkCode(c)
+	if !ok {
+		return
+	}
+
+	if err := r.svc.DeleteLink(c.Request.Context(), c.Query("domain"), code); err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// linkCode returns the code path parameter, writing a problem if it is invalid.
+func linkCode(c *gin.Context) (string, bool) {
+	code := c.Param("code")
+	if !isValidCode(code) {
+		problem.Write(c, problem.New(http.StatusBadRequest, problem.CodeCodeInvalid, "invalid code format"))
+		return "", false
+	}
+	return code, true
+}
+
+func newLinkResponse(link service.LinkInfo) LinkResponse {
+	resp := LinkResponse{
+		Code:           link.Code,
+		ShortURL:       link.ShortURL,
+		URL:            link.URL,
+		Domain:         link.ShortDomain,
+		Owner:          link.Owner,
+		CreatedAt:      link.CreatedAt,
+		ExpiresAt:      link.ExpiresAt,
+		Protected:      link.Protected,
+		MaxClicks:      link.MaxClicks,
+		NotBefore:      link.NotBefore,
+		NotAfter:       link.NotAfter,
+		FallbackURL:    link.FallbackURL,
+		RedirectStatus: link.RedirectStatus,
+		Passthrough:    link.Passthrough,
+		UTM:            link.UTM,
+		Targets:        link.Targets,
+		Variants:       link.Variants,
+		Interstitial:   link.Interstitial,
+		Title:          link.Details.Title,
+		Description:    link.Details.Description,
+		Tags:           link.Details.Tags,
+		Metadata:       link.Details.Metadata,
+		Campaign:       link.Campaign,
+	}
+	if link.MaxClicks > 0 {
+		clicksLeft := link.ClicksLeft
+		resp.ClicksLeft = &clicksLeft
+	}
+	return resp
+}
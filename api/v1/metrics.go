@@ -3,32 +3,39 @@ package v1
 import (
 	"net/http"
 
+	"github.com/parikshitg/urlshortener/internal/problem"
+	"github.com/parikshitg/urlshortener/internal/service"
+
 	"github.com/gin-gonic/gin"
 )
 
 type MetricsRequest struct {
 	TopN int `json:"topN"`
+	// Global returns the metrics of all tenants instead of the caller's. Admin only.
+	Global bool `json:"global,omitempty"`
+	// Campaign returns the metrics of the links of a campaign instead.
+	Campaign string `json:"campaign,omitempty"`
 }
 
 func (r resource) metrics(c *gin.Context) {
 	req := &MetricsRequest{}
 
 	// parse request
-	err := c.BindJSON(req)
+	err := c.ShouldBindJSON(req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, NewErrorResponse("failed to parse request", err))
+		problem.Write(c, invalidRequest("failed to parse request: "+err.Error()))
 		return
 	}
 
 	// validate request
 	if req.TopN < 0 {
-		c.JSON(http.StatusBadRequest, NewErrorResponse("topN must be non-negative", nil))
+		problem.Write(c, invalidRequest("topN must be non-negative"))
 		return
 	}
 
-	list, err := r.svc.Metrics(c.Request.Context(), req.TopN)
+	list, err := r.svc.Metrics(c.Request.Context(), service.MetricsQuery{TopN: req.TopN, Global: req.Global, Campaign: req.Campaign})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, NewErrorResponse("failed to retrieve metrics", err))
+		problem.Write(c, problemFromError(err))
 		return
 	}
 
@@ -0,0 +1,253 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/problem"
+	"github.com/parikshitg/urlshortener/internal/service"
+	"github.com/parikshitg/urlshortener/internal/storage"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openAPISchemas maps every schema in openapi.json to the Go type it documents.
+var openAPISchemas = map[string]reflect.Type{
+	"ShortenRequest":        reflect.TypeOf(ShortenRequest{}),
+	"ShortenResponse":       reflect.TypeOf(ShortenResponse{}),
+	"BatchShortenRequest":   reflect.TypeOf(BatchShortenRequest{}),
+	"BatchShortenResult":    reflect.TypeOf(BatchShortenResult{}),
+	"BatchShortenResponse":  reflect.TypeOf(BatchShortenResponse{}),
+	"MetricsRequest":        reflect.TypeOf(MetricsRequest{}),
+	"TopN":                  reflect.TypeOf(common.TopN{}),
+	"UTM":                   reflect.TypeOf(common.UTM{}),
+	"TargetRule":            reflect.TypeOf(common.TargetRule{}),
+	"Variant":               reflect.TypeOf(common.Variant{}),
+	"QRRequest":             reflect.TypeOf(QRRequest{}),
+	"Problem":               reflect.TypeOf(problem.Problem{}),
+	"HealthResponse":        reflect.TypeOf(service.HealthResponse{}),
+	"StorageHealth":         reflect.TypeOf(service.StorageHealth{}),
+	"CreateAPIKeyRequest":   reflect.TypeOf(CreateAPIKeyRequest{}),
+	"APIKeyResponse":        reflect.TypeOf(APIKeyResponse{}),
+	"CreateAPIKeyResponse":  reflect.TypeOf(CreateAPIKeyResponse{}),
+	"ListAPIKeysResponse":   reflect.TypeOf(ListAPIKeysResponse{}),
+	"LinkResponse":          reflect.TypeOf(LinkResponse{}),
+	"ListLinksResponse":     reflect.TypeOf(ListLinksResponse{}),
+	"LinkStatsResponse":     reflect.TypeOf(LinkStatsResponse{}),
+	"UpdateLinkRequest":     reflect.TypeOf(UpdateLinkRequest{}),
+	"UpdateVariantsRequest": reflect.TypeOf(UpdateVariantsRequest{}),
+	"AuditEventResponse":    reflect.TypeOf(AuditEventResponse{}),
+	"AuditLogResponse":      reflect.TypeOf(AuditLogResponse{}),
+	"CreateCampaignRequest": reflect.TypeOf(CreateCampaignRequest{}),
+	"UpdateCampaignRequest": reflect.TypeOf(UpdateCampaignRequest{}),
+	"CampaignResponse":      reflect.TypeOf(CampaignResponse{}),
+	"ListCampaignsResponse": reflect.TypeOf(ListCampaignsResponse{}),
+	"CampaignStatsResponse": reflect.TypeOf(CampaignStatsResponse{}),
+	"DayStatsResponse":      reflect.TypeOf(DayStatsResponse{}),
+	"AnalyticsResponse":     reflect.TypeOf(AnalyticsResponse{}),
+	"BucketResponse":        reflect.TypeOf(BucketResponse{}),
+	"UniquesResponse":       reflect.TypeOf(UniquesResponse{}),
+	"PeriodUniquesResponse": reflect.TypeOf(PeriodUniquesResponse{}),
+}
+
+type openAPIDoc struct {
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]openAPISchema `json:"schemas"`
+	} `json:"components"`
+}
+
+type openAPISchema struct {
+	Ref        string                   `json:"$ref"`
+	Type       string                   `json:"type"`
+	Properties map[string]openAPISchema `json:"properties"`
+	Items      *openAPISchema           `json:"items"`
+}
+
+func loadOpenAPI(t *testing.T) openAPIDoc {
+	t.Helper()
+	var doc openAPIDoc
+	require.NoError(t, json.Unmarshal(openAPISpec, &doc))
+	return doc
+}
+
+func TestOpenAPISchemasMatchTypes(t *testing.T) {
+	doc := loadOpenAPI(t)
+
+	for name := range doc.Components.Schemas {
+		_, ok := openAPISchemas[name]
+		assert.True(t, ok, "schema %s in openapi.json has no Go type in openAPISchemas", name)
+	}
+
+	for name, typ := range openAPISchemas {
+		schema, ok := doc.Components.Schemas[name]
+		if !assert.True(t, ok, "schema %s missing from openapi.json", name) {
+			continue
+		}
+
+		fields := jsonFields(typ)
+		assert.ElementsMatch(t, keys(fields), keys(schema.Properties), "properties of schema %s drifted from %s", name, typ)
+
+		for field, fieldType := range fields {
+			prop, ok := schema.Properties[field]
+			if !ok {
+				continue
+			}
+			assert.Equal(t, openAPIType(fieldType), schemaType(prop), "type of %s.%s drifted from %s", name, field, fieldType)
+		}
+	}
+}
+
+func TestOpenAPIPathsMatchRoutes(t *testing.T) {
+	doc := loadOpenAPI(t)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	_, _, svc, healthService := setupTestRouter()
+	authService := service.NewAuthService(memory.NewMemStore(0), nil, &config.Config{}, logger.New("error", "text"))
+	RegisterHandlers(router, svc, healthService, Options{Docs: true, Auth: authService})
+
+	var routes []string
+	for _, r := range router.Routes() {
+		path := r.Path
+		for _, seg := range strings.Split(path, "/") {
+			if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+				path = strings.Replace(path, seg, "{"+seg[1:]+"}", 1)
+			}
+		}
+		routes = append(routes, strings.ToLower(r.Method)+" "+path)
+	}
+
+	var documented []string
+	for path, methods := range doc.Paths {
+		for method := range methods {
+			documented = append(documented, method+" "+path)
+		}
+	}
+
+	sort.Strings(routes)
+	sort.Strings(documented)
+	assert.Equal(t, routes, documented, "openapi.json paths drifted from registered routes")
+}
+
+func TestOpenAPIEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	t.Run("spec is served", func(t *testing.T) {
+		router, _, _, _ := setupTestRouter()
+		req := httptest.NewRequest("GET", "/v1/openapi.json", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var doc map[string]interface{}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+		assert.Equal(t, "3.0.3", doc["openapi"])
+	})
+
+	t.Run("docs are disabled by default", func(t *testing.T) {
+		router, mockStorage, _, _ := setupTestRouter()
+		// unknown paths fall through to the passthrough of a "v1" link
+		mockStorage.EXPECT().GetLink("", "v1").Return(storage.LinkRecord{}, false)
+		req := httptest.NewRequest("GET", "/v1/docs", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("docs page is self-contained", func(t *testing.T) {
+		router := gin.New()
+		_, _, svc, healthService := setupTestRouter()
+		RegisterHandlers(router, svc, healthService, Options{Docs: true})
+		req := httptest.NewRequest("GET", "/v1/docs", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+		assert.Contains(t, w.Body.String(), `fetch("openapi.json")`)
+		assert.NotContains(t, w.Body.String(), "https://")
+	})
+}
+
+// jsonFields returns the json field names of a struct type and their types,
+// following the encoding/json rules for tags and embedded structs.
+func jsonFields(typ reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for k, v := range jsonFields(f.Type) {
+				fields[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+// openAPIType returns the OpenAPI type a Go type is encoded as.
+func openAPIType(typ reflect.Type) string {
+	if typ == reflect.TypeOf(time.Time{}) || typ == reflect.TypeOf([]byte(nil)) {
+		return "string"
+	}
+	if typ == reflect.TypeOf(json.RawMessage(nil)) {
+		return "object"
+	}
+	switch typ.Kind() {
+	case reflect.Ptr:
+		return openAPIType(typ.Elem())
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// schemaType returns the type of a property schema; references are objects.
+func schemaType(s openAPISchema) string {
+	if s.Ref != "" {
+		return "object"
+	}
+	return s.Type
+}
+
+func keys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	return out
+}
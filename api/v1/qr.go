@@ -3,35 +3,40 @@ package v1
 import (
 	"net/http"
 
+	"github.com/parikshitg/urlshortener/internal/problem"
+	"github.com/parikshitg/urlshortener/internal/service"
+
 	"github.com/gin-gonic/gin"
 )
 
 type QRRequest struct {
-	URL  string `json:"url"`
-	Size int    `json:"size"`
+	URL    string `json:"url"`
+	Size   int    `json:"size"`
+	Domain string `json:"domain,omitempty"`
 }
 
 func (r resource) qr(c *gin.Context) {
 	var req QRRequest
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, NewErrorResponse("failed to parse request", err))
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.Write(c, invalidRequest("failed to parse request: "+err.Error()))
 		return
 	}
 	if req.URL == "" {
-		c.JSON(http.StatusBadRequest, NewErrorResponse("url is required", nil))
+		problem.Write(c, invalidRequest("url is required"))
 		return
 	}
 	if req.Size <= 0 {
 		req.Size = 256
 	}
 	if req.Size < 64 || req.Size > 2048 {
-		c.JSON(http.StatusBadRequest, NewErrorResponse("size must be between 64 and 2048", nil))
+		problem.Write(c, invalidRequest("size must be between 64 and 2048"))
 		return
 	}
 
-	img, err := r.svc.QR(c.Request.Context(), req.URL, req.Size)
+	opts := service.ShortenOptions{Domain: req.Domain}
+	img, err := r.svc.QR(c.Request.Context(), req.URL, opts, req.Size)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, NewErrorResponse("failed to generate qr", err))
+		problem.Write(c, problemFromError(err))
 		return
 	}
 
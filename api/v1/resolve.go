@@ -1,46 +1,187 @@
 package v1
 
 import (
+	"encoding/base64"
 	"errors"
+	"html/template"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/problem"
+	"github.com/parikshitg/urlshortener/internal/service"
+	"github.com/parikshitg/urlshortener/internal/shortener"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// variantCookie keeps the variant a visitor was assigned. It is scoped
+	// to the path of the short url, so every link has its own.
+	variantCookie = "variant"
+	// variantCookieMaxAge is how long a visitor keeps its variant, in seconds.
+	variantCookieMaxAge = 30 * 24 * 60 * 60
+	// previewSuffix appended to a code shows the preview of the link.
+	previewSuffix = "+"
+)
+
 func (res resource) resolve(c *gin.Context) {
 	code := c.Param("code")
 	if code == "" {
-		c.JSON(http.StatusBadRequest, NewErrorResponse("missing code", errors.New("invalid short url")))
+		problem.Write(c, problem.New(http.StatusBadRequest, problem.CodeCodeInvalid, "missing code"))
 		return
 	}
+	code, preview := strings.CutSuffix(code, previewSuffix)
+	preview = preview || c.Query("preview") == "1"
 
 	// Validate code format (alphanumeric only)
 	if !isValidCode(code) {
-		c.JSON(http.StatusBadRequest, NewErrorResponse("invalid code format", nil))
+		problem.Write(c, problem.New(http.StatusBadRequest, problem.CodeCodeInvalid, "invalid code format"))
+		return
+	}
+
+	visit := service.Visit{
+		Host:  c.Request.Host,
+		Code:  code,
+		IP:    c.ClientIP(),
+		Path:  c.Param("rest"),
+		Query: c.Request.URL.RawQuery,
+		// targeting rules match on these
+		UserAgent:      c.Request.UserAgent(),
+		AcceptLanguage: c.GetHeader("Accept-Language"),
+		// bots are told apart by these
+		Method:  c.Request.Method,
+		Purpose: purpose(c),
+		// counted by host in the stats
+		Referrer: c.Request.Referer(),
+	}
+	if c.Request.Method == http.MethodPost {
+		visit.Password = c.PostForm("password")
+	}
+	if variant, err := c.Cookie(variantCookie); err == nil {
+		visit.Variant = variant
+	}
+	if preview {
+		res.preview(c, visit)
 		return
 	}
 
-	dest, ok := res.svc.Resolve(c.Request.Context(), code)
-	if !ok {
-		c.JSON(http.StatusNotFound, NewErrorResponse("short url not found", nil))
+	redirect, err := res.svc.Resolve(c.Request.Context(), visit)
+	if err != nil {
+		res.resolveError(c, err)
 		return
 	}
 
-	c.Redirect(http.StatusFound, dest)
+	if redirect.Variant != "" {
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(variantCookie, redirect.Variant, variantCookieMaxAge, "/"+code, "", c.Request.TLS != nil, true)
+	}
+	if redirect.Interstitial {
+		res.render(c, res.pages.interstitial, http.StatusOK, struct {
+			ShortDomain string
+			URL         string
+			Domain      string
+		}{requestHost(c), redirect.URL, hostname(redirect.URL)})
+		return
+	}
+
+	// Clients must not keep redirects of links that can still change.
+	if seconds := int(redirect.MaxAge.Seconds()); seconds > 0 {
+		c.Header("Cache-Control", "public, max-age="+strconv.Itoa(seconds))
+	} else {
+		c.Header("Cache-Control", "no-store")
+	}
+	c.Redirect(redirect.Status, redirect.URL)
 }
 
-// isValidCode checks if the code contains only valid characters
-func isValidCode(code string) bool {
-	if len(code) == 0 || len(code) > 20 { // reasonable length limit
-		return false
+// preview renders the preview page of the link instead of redirecting.
+func (res resource) preview(c *gin.Context, visit service.Visit) {
+	preview, err := res.svc.Preview(c.Request.Context(), visit)
+	if err != nil {
+		res.resolveError(c, err)
+		return
 	}
+	res.render(c, res.pages.preview, http.StatusOK, struct {
+		ShortURL  string
+		URL       string
+		Domain    string
+		CreatedAt time.Time
+		Varies    bool
+		// QR is a data url, which html/template only allows in src as a
+		// template.URL.
+		QR template.URL
+	}{
+		ShortURL:  preview.ShortURL,
+		URL:       preview.URL,
+		Domain:    preview.Domain,
+		CreatedAt: preview.CreatedAt,
+		Varies:    preview.Varies,
+		QR:        template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(preview.QR)),
+	})
+}
 
-	for _, char := range code {
-		if !((char >= 'a' && char <= 'z') ||
-			(char >= 'A' && char <= 'Z') ||
-			(char >= '0' && char <= '9')) {
-			return false
+// resolveError answers a failed resolve or preview, asking for the password
+// of protected links.
+func (res resource) resolveError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrLinkNotFound):
+		problem.Write(c, problem.New(http.StatusNotFound, problem.CodeNotFound, "short url not found"))
+	case errors.Is(err, service.ErrPasswordRequired):
+		res.passwordForm(c, http.StatusOK, "")
+	case errors.Is(err, service.ErrPasswordIncorrect):
+		res.passwordForm(c, http.StatusForbidden, "Incorrect password.")
+	case errors.Is(err, service.ErrTooManyAttempts):
+		res.passwordForm(c, http.StatusTooManyRequests, "Too many incorrect passwords. Try again later.")
+	default:
+		problem.Write(c, problemFromError(err))
+	}
+}
+
+// passwordForm renders the password form with an optional error message.
+// It posts the password back to the short url.
+func (res resource) passwordForm(c *gin.Context, status int, message string) {
+	res.render(c, res.pages.password, status, struct{ Error string }{message})
+}
+
+// render writes an uncached html page.
+func (res resource) render(c *gin.Context, tmpl *template.Template, status int, data any) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	_ = tmpl.Execute(c.Writer, data)
+}
+
+// requestHost returns the host of the request without port.
+func requestHost(c *gin.Context) string {
+	return hostname("//" + c.Request.Host)
+}
+
+// purposeHeaders are the headers browsers send with prefetches and
+// previews.
+var purposeHeaders = []string{"Sec-Purpose", "Purpose", "X-Purpose", "X-Moz"}
+
+// purpose returns the first prefetch header of the request, if any.
+func purpose(c *gin.Context) string {
+	for _, name := range purposeHeaders {
+		if v := c.GetHeader(name); v != "" {
+			return v
 		}
 	}
-	return true
+	return ""
+}
+
+// hostname returns the host of rawURL without port.
+func hostname(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// isValidCode checks if the code contains only valid characters
+func isValidCode(code string) bool {
+	return shortener.ValidCode(code)
 }
@@ -1,13 +1,61 @@
 package v1
 
 import (
+	"fmt"
 	"net/http"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/problem"
+	"github.com/parikshitg/urlshortener/internal/service"
 
 	"github.com/gin-gonic/gin"
 )
 
 type ShortenRequest struct {
 	URL string `json:"url"`
+	// Domain is the short domain to create the link on. Defaults to BASE_URL.
+	Domain string `json:"domain,omitempty"`
+	// Alias is a custom short code.
+	Alias string `json:"alias,omitempty"`
+	// TTL is a Go duration overriding the default expiry, e.g. "24h".
+	TTL string `json:"ttl,omitempty"`
+	// Password protects the link; visitors must enter it before the redirect.
+	Password string `json:"password,omitempty"`
+	// MaxClicks is the number of redirects before the link is used up, 1
+	// for a one-time link.
+	MaxClicks int `json:"maxClicks,omitempty"`
+	// NotBefore and NotAfter schedule the window in which the link
+	// redirects, independent of the TTL.
+	NotBefore time.Time `json:"notBefore,omitzero"`
+	NotAfter  time.Time `json:"notAfter,omitzero"`
+	// FallbackURL is redirected to outside the window.
+	FallbackURL string `json:"fallbackUrl,omitempty"`
+	// RedirectStatus is 301, 302, 307 or 308. Defaults to REDIRECT_STATUS.
+	RedirectStatus int `json:"redirectStatus,omitempty"`
+	// Passthrough is "none", "query" or "path_query": what of the short url
+	// is passed on to the url.
+	Passthrough string `json:"passthrough,omitempty"`
+	// UTM are utm parameters added to the url on redirect, replacing the
+	// defaults of the short domain.
+	UTM common.UTM `json:"utm,omitzero"`
+	// Targets redirect visitors matching a rule to its url instead, tried
+	// in order.
+	Targets []common.TargetRule `json:"targets,omitempty"`
+	// Variants split the other visitors between their urls by weight.
+	Variants []common.Variant `json:"variants,omitempty"`
+	// Interstitial shows visitors a warning page with the destination
+	// before they continue, unless it is allowlisted.
+	Interstitial bool `json:"interstitial,omitempty"`
+	// Title and Description describe the link to its managers.
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Tags label the link for filtering.
+	Tags []string `json:"tags,omitempty"`
+	// Metadata are free-form key/value pairs.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Campaign is the id of a campaign to add the link to.
+	Campaign string `json:"campaign,omitempty"`
 }
 
 type ShortenResponse struct {
@@ -18,23 +66,62 @@ func (r resource) shorten(c *gin.Context) {
 	req := &ShortenRequest{}
 
 	// parse request
-	err := c.BindJSON(req)
+	err := c.ShouldBindJSON(req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, NewErrorResponse("failed to parse request", err))
+		problem.Write(c, invalidRequest("failed to parse request: "+err.Error()))
 		return
 	}
 
 	// validate request
 	if req.URL == "" {
-		c.JSON(http.StatusBadRequest, NewErrorResponse("url is required", nil))
+		problem.Write(c, invalidRequest("url is required"))
+		return
+	}
+	opts, err := req.options()
+	if err != nil {
+		problem.Write(c, problem.New(http.StatusBadRequest, problem.CodeTTLInvalid, err.Error()))
 		return
 	}
 
-	short, err := r.svc.Shorten(c.Request.Context(), req.URL)
+	short, err := r.svc.Shorten(c.Request.Context(), req.URL, opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, NewErrorResponse("failed to shorten url", err))
+		problem.Write(c, problemFromError(err))
 		return
 	}
 
 	c.JSON(http.StatusOK, &ShortenResponse{short})
 }
+
+// options converts the optional request fields to service options.
+func (req *ShortenRequest) options() (service.ShortenOptions, error) {
+	opts := service.ShortenOptions{
+		Domain:         req.Domain,
+		Alias:          req.Alias,
+		Password:       req.Password,
+		MaxClicks:      req.MaxClicks,
+		NotBefore:      req.NotBefore,
+		NotAfter:       req.NotAfter,
+		FallbackURL:    req.FallbackURL,
+		RedirectStatus: req.RedirectStatus,
+		Passthrough:    req.Passthrough,
+		UTM:            req.UTM,
+		Targets:        req.Targets,
+		Variants:       req.Variants,
+		Interstitial:   req.Interstitial,
+		Details: common.LinkDetails{
+			Title:       req.Title,
+			Description: req.Description,
+			Tags:        req.Tags,
+			Metadata:    req.Metadata,
+		},
+		Campaign: req.Campaign,
+	}
+	if req.TTL != "" {
+		ttl, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			return opts, fmt.Errorf("failed to parse ttl: %w", err)
+		}
+		opts.TTL = ttl
+	}
+	return opts, nil
+}
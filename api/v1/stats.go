@@ -0,0 +1,186 @@
+package v1
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/problem"
+	"github.com/parikshitg/urlshortener/internal/service"
+	"github.com/parikshitg/urlshortener/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LinkStatsResponse struct {
+	Code   string `json:"code"`
+	Clicks int64  `json:"clicks"`
+	// Rules counts the clicks by the targeting rule that picked the
+	// destination, "default" for the url of the link.
+	Rules map[string]int64 `json:"rules,omitempty"`
+	// Variants counts the clicks by the variant the visitor was assigned.
+	Variants map[string]int64 `json:"variants,omitempty"`
+	// Days counts the clicks by UTC day, formatted as 2006-01-02.
+	Days map[string]int64 `json:"days,omitempty"`
+	// Referrers counts the clicks by the host of the referring page.
+	Referrers map[string]int64 `json:"referrers,omitempty"`
+	// Countries and Regions count the clicks by ISO 3166 country and
+	// region code, when a GeoIP database is configured.
+	Countries map[string]int64 `json:"countries,omitempty"`
+	Regions   map[string]int64 `json:"regions,omitempty"`
+	// Bots is how many of the clicks are from bots, only counted with
+	// bots=true.
+	Bots int64 `json:"bots,omitempty"`
+}
+
+// linkStats returns the click stats of a link. The clicks of bots are left
+// out unless the bots query parameter is true.
+func (r resource) linkStats(c *gin.Context) {
+	code, ok := linkCode(c)
+	if !ok {
+		return
+	}
+
+	stats, err := r.svc.LinkStats(c.Request.Context(), c.Query("domain"), code, c.Query("bots") == "true")
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	resp := &LinkStatsResponse{
+		Code:      code,
+		Clicks:    stats.Clicks,
+		Rules:     stats.Rules,
+		Variants:  stats.Variants,
+		Days:      stats.Days,
+		Referrers: stats.Referrers,
+		Countries: stats.Countries,
+		Regions:   stats.Regions,
+	}
+	if stats.Bots != nil {
+		resp.Bots = stats.Bots.Clicks
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+type AnalyticsResponse struct {
+	Code string `json:"code"`
+	// Interval is the width of the buckets: "minute", "hour" or "day".
+	Interval string    `json:"interval"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	// Clicks is the total of the buckets.
+	Clicks int64 `json:"clicks"`
+	// Bots is how many of the clicks are from bots, only counted with
+	// bots=true.
+	Bots int64 `json:"bots,omitempty"`
+	// Buckets are every bucket between from and to, oldest first.
+	Buckets []BucketResponse `json:"buckets"`
+}
+
+type BucketResponse struct {
+	Start  time.Time `json:"start"`
+	Clicks int64     `json:"clicks"`
+	Bots   int64     `json:"bots,omitempty"`
+}
+
+// linkAnalytics returns the clicks of a link per interval between the from
+// and to query parameters. The clicks of bots are counted with bots=true.
+func (r resource) linkAnalytics(c *gin.Context) {
+	code, ok := linkCode(c)
+	if !ok {
+		return
+	}
+	from, ok := queryTime(c, "from")
+	if !ok {
+		return
+	}
+	to, ok := queryTime(c, "to")
+	if !ok {
+		return
+	}
+
+	q := service.AnalyticsQuery{From: from, To: to, Interval: storage.Granularity(c.Query("interval")), Bots: c.Query("bots") == "true"}
+	analytics, err := r.svc.Analytics(c.Request.Context(), c.Query("domain"), code, q)
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+
+	resp := &AnalyticsResponse{
+		Code:     code,
+		Interval: string(analytics.Interval),
+		From:     analytics.From,
+		To:       analytics.To,
+		Clicks:   analytics.Clicks,
+		Bots:     analytics.Bots,
+		Buckets:  make([]BucketResponse, 0, len(analytics.Buckets)),
+	}
+	for _, b := range analytics.Buckets {
+		resp.Buckets = append(resp.Buckets, BucketResponse(b))
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+type UniquesResponse struct {
+	// Interval is the period the days are grouped by: "day", "week" or
+	// "month".
+	Interval string    `json:"interval"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	// Visitors are the estimated unique visitors of the whole range.
+	Visitors uint64 `json:"visitors"`
+	// Periods are every period between from and to, oldest first.
+	Periods []PeriodUniquesResponse `json:"periods"`
+}
+
+type PeriodUniquesResponse struct {
+	Start    time.Time `json:"start"`
+	Visitors uint64    `json:"visitors"`
+}
+
+func newUniquesResponse(uniques service.Uniques) *UniquesResponse {
+	resp := &UniquesResponse{
+		Interval: uniques.Interval,
+		From:     uniques.From,
+		To:       uniques.To,
+		Visitors: uniques.Visitors,
+		Periods:  make([]PeriodUniquesResponse, 0, len(uniques.Periods)),
+	}
+	for _, p := range uniques.Periods {
+		resp.Periods = append(resp.Periods, PeriodUniquesResponse(p))
+	}
+	return resp
+}
+
+// uniquesQuery parses the from, to and interval query parameters.
+func uniquesQuery(c *gin.Context) (service.UniquesQuery, bool) {
+	from, ok := queryTime(c, "from")
+	if !ok {
+		return service.UniquesQuery{}, false
+	}
+	to, ok := queryTime(c, "to")
+	if !ok {
+		return service.UniquesQuery{}, false
+	}
+	return service.UniquesQuery{From: from, To: to, Interval: c.Query("interval")}, true
+}
+
+// linkUniques returns the unique visitors of a link per interval between
+// the from and to query parameters.
+func (r resource) linkUniques(c *gin.Context) {
+	code, ok := linkCode(c)
+	if !ok {
+		return
+	}
+	q, ok := uniquesQuery(c)
+	if !ok {
+		return
+	}
+
+	uniques, err := r.svc.LinkUniques(c.Request.Context(), c.Query("domain"), code, q)
+	if err != nil {
+		problem.Write(c, problemFromError(err))
+		return
+	}
+	c.JSON(http.StatusOK, newUniquesResponse(uniques))
+}
@@ -0,0 +1,69 @@
+package v1
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// pages are the html pages served on short urls: the password form of
+// protected links, the link preview and the interstitial warning.
+//
+//go:embed password.html preview.html interstitial.html
+var pages embed.FS
+
+// Templates are the parsed html pages served on short urls.
+type Templates struct {
+	password     *template.Template
+	preview      *template.Template
+	interstitial *template.Template
+}
+
+// LoadTemplates parses the embedded pages. Pages with the same file name in
+// dir replace them, so deployments can brand the pages without a rebuild.
+// An empty dir keeps every embedded page.
+func LoadTemplates(dir string) (*Templates, error) {
+	var t Templates
+	for name, tmpl := range map[string]**template.Template{
+		"password.html":     &t.password,
+		"preview.html":      &t.preview,
+		"interstitial.html": &t.interstitial,
+	} {
+		page, err := loadPage(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		if *tmpl, err = template.New(name).Parse(string(page)); err != nil {
+			return nil, fmt.Errorf("failed to parse template %s: %w", name, err)
+		}
+	}
+	return &t, nil
+}
+
+// loadPage reads the page name from dir if it is there, otherwise the
+// embedded one.
+func loadPage(dir, name string) ([]byte, error) {
+	if dir != "" {
+		page, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return page, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read template %s: %w", name, err)
+		}
+	}
+	return pages.ReadFile(name)
+}
+
+// defaultTemplates are the embedded pages, which always parse.
+func defaultTemplates() *Templates {
+	t, err := LoadTemplates("")
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
@@ -41,7 +41,11 @@ func main() {
 	defer cancel()
 
 	// Initialize storage based on config
-	var store storage.Storage
+	var (
+		store            storage.Storage
+		idempotencyStore storage.IdempotencyStore
+		apiKeyStore      storage.APIKeyStore
+	)
 	switch cfg.StorageBackend {
 	case "badger":
 		appLogger.Info("Using BadgerDB storage", "path", cfg.DataDir)
@@ -49,11 +53,12 @@ func main() {
 		if err != nil {
 			appLogger.Fatal("Failed to open BadgerDB", "error", err)
 		}
-		store = st
+		store, idempotencyStore, apiKeyStore = st, st, st
 		defer st.Close()
 	default:
 		appLogger.Info("Using in-memory storage")
-		store = memory.NewMemStore(cfg.Expiry)
+		st := memory.NewMemStore(cfg.Expiry)
+		store, idempotencyStore, apiKeyStore = st, st, st
 	}
 
 	// Initialize health service
@@ -67,7 +72,11 @@ func main() {
 
 	// Setup HTTP server
 	r := gin.New()
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		appLogger.Fatal("Invalid trusted proxies", "error", err)
+	}
 	r.Use(gin.Recovery())
+	r.Use(middleware.RequestID())
 	r.Use(gin.Logger())
 
 	// Setup CORS middleware
@@ -92,7 +101,48 @@ func main() {
 		appLogger.Fatal("Failed to initialize service")
 	}
 
-	api.RegisterHandlers(r, svc, healthService)
+	// Start background job for deleting ended campaigns
+	go job.Job(ctx, cfg.Expiry, svc.PurgeCampaigns, appLogger)
+
+	// Start background job for forgetting wrong link passwords of ended windows
+	if cfg.Password.AttemptWindow > 0 {
+		go job.Job(ctx, cfg.Password.AttemptWindow, svc.PurgePasswordAttempts, appLogger)
+	}
+
+	// Start background job for purging audit events past the retention
+	if cfg.Audit.Retention > 0 && cfg.Audit.PurgeInterval > 0 {
+		go job.Job(ctx, cfg.Audit.PurgeInterval, svc.PurgeAuditLog, appLogger)
+	}
+
+	// Start background job for rolling up and purging click analytics
+	if cfg.Analytics.RollupInterval > 0 {
+		go job.Job(ctx, cfg.Analytics.RollupInterval, svc.RollupAnalytics, appLogger)
+	}
+
+	// Initialize auth service when credentials are required
+	var authService *service.AuthService
+	if cfg.Auth.Enabled {
+		jwtVerifier, err := service.NewJWTVerifier(cfg.Auth.JWT)
+		if err != nil {
+			appLogger.Fatal("Failed to load JWT keys", "error", err)
+		}
+		appLogger.Info("API authentication enabled", "admin_key", cfg.Auth.AdminKey != "", "jwt", jwtVerifier != nil)
+		authService = service.NewAuthService(apiKeyStore, jwtVerifier, cfg, appLogger)
+	} else {
+		appLogger.Warn("API authentication disabled, /v1 endpoints are public")
+	}
+
+	templates, err := api.LoadTemplates(cfg.Preview.TemplatesDir)
+	if err != nil {
+		appLogger.Fatal("Failed to load templates", "error", err)
+	}
+
+	api.RegisterHandlers(r, svc, healthService, api.Options{
+		Idempotency: middleware.Idempotency(idempotencyStore, cfg.IdempotencyTTL, appLogger),
+		Docs:        cfg.DocsEnabled,
+		Auth:        authService,
+		Templates:   templates,
+	})
 
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%s", cfg.Port),
@@ -0,0 +1,106 @@
+// Package auth defines the identity of an authenticated caller and the
+// scopes and roles it can be granted.
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+// ErrInvalidCredentials is returned when credentials are missing, unknown,
+// revoked or otherwise not acceptable.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Scopes grant access to groups of endpoints.
+const (
+	// ScopeLinksRead allows reading links.
+	ScopeLinksRead = "links:read"
+	// ScopeLinksWrite allows creating, updating and deleting links.
+	ScopeLinksWrite = "links:write"
+	// ScopeMetricsRead allows reading metrics.
+	ScopeMetricsRead = "metrics:read"
+	// ScopeKeysManage allows creating, listing and revoking api keys.
+	ScopeKeysManage = "keys:manage"
+	// ScopeAuditRead allows reading the audit log.
+	ScopeAuditRead = "audit:read"
+)
+
+// Scopes lists every known scope.
+var Scopes = []string{ScopeLinksRead, ScopeLinksWrite, ScopeMetricsRead, ScopeKeysManage, ScopeAuditRead}
+
+// ValidScope reports whether scope is a known scope.
+func ValidScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+// Role is the level of access of a caller. Scopes restrict which endpoints a
+// credential can call; the role decides which operations the caller may
+// perform on them.
+type Role string
+
+// Roles, from least to most privileged.
+const (
+	// RoleViewer can read links and stats of its tenant.
+	RoleViewer Role = "viewer"
+	// RoleEditor can also create, change and delete links of its tenant.
+	RoleEditor Role = "editor"
+	// RoleAdmin can also access every tenant, take down any link, purge,
+	// export and manage keys.
+	RoleAdmin Role = "admin"
+)
+
+// DefaultRole is the role of credentials that do not carry one, such as api
+// keys created before roles existed.
+const DefaultRole = RoleEditor
+
+// Roles lists every role, from least to most privileged.
+var Roles = []Role{RoleViewer, RoleEditor, RoleAdmin}
+
+// ValidRole reports whether role is a known role.
+func ValidRole(role Role) bool {
+	return slices.Contains(Roles, role)
+}
+
+// Includes reports whether r grants at least the access of min.
+func (r Role) Includes(min Role) bool {
+	i, j := slices.Index(Roles, r), slices.Index(Roles, min)
+	return i >= 0 && j >= 0 && i >= j
+}
+
+// Identity is the authenticated caller of a request.
+type Identity struct {
+	// Subject identifies the caller, e.g. "apikey:<id>".
+	Subject string
+	// Tenant is who the links created by the caller belong to. Callers only
+	// see the links of their own tenant.
+	Tenant string
+	// Role is the caller's level of access.
+	Role Role
+	// Scopes are the permissions granted to the caller.
+	Scopes []string
+}
+
+// IsAdmin reports whether the identity has the admin role, which can access
+// the links and metrics of every tenant.
+func (id Identity) IsAdmin() bool {
+	return id.Role == RoleAdmin
+}
+
+// HasScope reports whether the identity was granted scope.
+func (id Identity) HasScope(scope string) bool {
+	return slices.Contains(id.Scopes, scope)
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity carried by ctx, if any.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(Identity)
+	return id, ok
+}
@@ -0,0 +1,25 @@
+package auth
+
+import "testing"
+
+func TestRoleIncludes(t *testing.T) {
+	tests := []struct {
+		role, min Role
+		want      bool
+	}{
+		{RoleViewer, RoleViewer, true},
+		{RoleViewer, RoleEditor, false},
+		{RoleEditor, RoleViewer, true},
+		{RoleEditor, RoleAdmin, false},
+		{RoleAdmin, RoleEditor, true},
+		{RoleAdmin, RoleAdmin, true},
+		{"", RoleViewer, false},
+		{"root", RoleViewer, false},
+		{RoleAdmin, "root", false},
+	}
+	for _, tt := range tests {
+		if got := tt.role.Includes(tt.min); got != tt.want {
+			t.Errorf("%q.Includes(%q) = %v, want %v", tt.role, tt.min, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Supported JWT signing algorithms.
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgHS256 = "HS256"
+)
+
+// defaultScopeClaim is the claim holding the scopes, a space separated
+// string as in RFC 8693 or an array of strings.
+const defaultScopeClaim = "scope"
+
+// defaultTenantClaim is the claim holding the caller's tenant.
+const defaultTenantClaim = "tenant"
+
+// defaultRoleClaim is the claim holding the caller's role.
+const defaultRoleClaim = "role"
+
+// JWTOptions configures the claims a JWTVerifier accepts.
+type JWTOptions struct {
+	// Issuer is the required "iss" claim, not checked when empty.
+	Issuer string
+	// Audience must be one of the "aud" claim values, not checked when empty.
+	Audience string
+	// ScopeClaim is the claim holding the scopes. (default is "scope")
+	ScopeClaim string
+	// TenantClaim is the claim holding the tenant; tokens without it are
+	// their own tenant. (default is "tenant")
+	TenantClaim string
+	// RoleClaim is the claim holding the role; tokens without it get
+	// DefaultRole. (default is "role")
+	RoleClaim string
+	// Leeway is the allowed clock skew for "exp" and "nbf".
+	Leeway time.Duration
+}
+
+// verificationKey is a key tokens can be signed with.
+type verificationKey struct {
+	// kid is the key id, matched against the token's "kid" header if both are set.
+	kid string
+	// alg restricts the key to one algorithm when set.
+	alg string
+	// key is a *rsa.PublicKey, *ecdsa.PublicKey or []byte HMAC secret.
+	key any
+}
+
+// JWTVerifier verifies bearer JWTs against a fixed set of keys and maps
+// their claims to an Identity.
+type JWTVerifier struct {
+	opts JWTOptions
+	keys []verificationKey
+	now  func() time.Time
+}
+
+// NewJWTVerifier creates a verifier without keys; add them with AddJWKS,
+// AddPEM or AddHMAC.
+func NewJWTVerifier(opts JWTOptions) *JWTVerifier {
+	if opts.ScopeClaim == "" {
+		opts.ScopeClaim = defaultScopeClaim
+	}
+	if opts.TenantClaim == "" {
+		opts.TenantClaim = defaultTenantClaim
+	}
+	if opts.RoleClaim == "" {
+		opts.RoleClaim = defaultRoleClaim
+	}
+	return &JWTVerifier{opts: opts, now: time.Now}
+}
+
+// AddHMAC adds an HS256 secret.
+func (v *JWTVerifier) AddHMAC(secret []byte) {
+	v.keys = append(v.keys, verificationKey{alg: AlgHS256, key: secret})
+}
+
+// IsJWT reports whether credential has the shape of a compact JWT, so it can
+// be told apart from an api key.
+func IsJWT(credential string) bool {
+	return strings.Count(credential, ".") == 2
+}
+
+// jwtHeader is the JOSE header of a token.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// Verify checks the token's signature and registered claims and returns the
+// caller's identity. All failures wrap ErrInvalidCredentials.
+func (v *JWTVerifier) Verify(token string) (Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Identity{}, invalid("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Identity{}, invalid("malformed header")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, invalid("malformed signature")
+	}
+	if !v.verifySignature(header, []byte(parts[0]+"."+parts[1]), sig) {
+		return Identity{}, invalid("signature verification failed")
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Identity{}, invalid("malformed claims")
+	}
+	return v.identity(claims)
+}
+
+// verifySignature reports whether any key matching the header verifies sig.
+func (v *JWTVerifier) verifySignature(header jwtHeader, signed, sig []byte) bool {
+	switch header.Alg {
+	case AlgRS256, AlgES256, AlgHS256:
+	default:
+		// Rejects "none" and every algorithm not explicitly supported.
+		return false
+	}
+
+	digest := sha256.Sum256(signed)
+	for _, k := range v.keys {
+		if header.Kid != "" && k.kid != "" && header.Kid != k.kid {
+			continue
+		}
+		if k.alg != "" && k.alg != header.Alg {
+			continue
+		}
+		switch key := k.key.(type) {
+		case *rsa.PublicKey:
+			if header.Alg == AlgRS256 && rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) == nil {
+				return true
+			}
+		case *ecdsa.PublicKey:
+			if header.Alg == AlgES256 && len(sig) == 64 {
+				r := new(big.Int).SetBytes(sig[:32])
+				s := new(big.Int).SetBytes(sig[32:])
+				if ecdsa.Verify(key, digest[:], r, s) {
+					return true
+				}
+			}
+		case []byte:
+			if header.Alg == AlgHS256 {
+				mac := hmac.New(sha256.New, key)
+				mac.Write(signed)
+				if hmac.Equal(mac.Sum(nil), sig) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// identity validates the registered claims and maps them to an identity.
+func (v *JWTVerifier) identity(claims map[string]any) (Identity, error) {
+	now := v.now()
+
+	exp, ok := numericClaim(claims, "exp")
+	if !ok {
+		return Identity{}, invalid("missing exp claim")
+	}
+	if !now.Before(exp.Add(v.opts.Leeway)) {
+		return Identity{}, invalid("token expired")
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(v.opts.Leeway).Before(nbf) {
+		return Identity{}, invalid("token not yet valid")
+	}
+	if v.opts.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.opts.Issuer {
+			return Identity{}, invalid("unexpected issuer")
+		}
+	}
+	if v.opts.Audience != "" && !slices.Contains(stringsClaim(claims["aud"]), v.opts.Audience) {
+		return Identity{}, invalid("unexpected audience")
+	}
+
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return Identity{}, invalid("missing sub claim")
+	}
+
+	var scopes []string
+	for _, scope := range stringsClaim(claims[v.opts.ScopeClaim]) {
+		if ValidScope(scope) && !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	id := Identity{Subject: "jwt:" + sub, Tenant: "jwt:" + sub, Role: DefaultRole, Scopes: scopes}
+	if tenant, _ := claims[v.opts.TenantClaim].(string); tenant != "" {
+		id.Tenant = tenant
+	}
+	if role, _ := claims[v.opts.RoleClaim].(string); role != "" {
+		if !ValidRole(Role(role)) {
+			return Identity{}, invalid("unknown role")
+		}
+		id.Role = Role(role)
+	}
+	return id, nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a token.
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// numericClaim returns a NumericDate claim as a time.
+func numericClaim(claims map[string]any, name string) (time.Time, bool) {
+	n, ok := claims[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(f*float64(time.Second))), true
+}
+
+// stringsClaim returns a claim that is either a space separated string or
+// an array of strings.
+func stringsClaim(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func invalid(reason string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidCredentials, reason)
+}
@@ -0,0 +1,216 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// signToken builds a compact JWT signed with key, which is an
+// *rsa.PrivateKey, *ecdsa.PrivateKey or []byte HMAC secret.
+func signToken(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case nil:
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherRSA, _ := rsa.GenerateKey(rand.Reader, 2048)
+	secret := []byte("shared-secret")
+
+	jwks := fmt.Sprintf(`{"keys":[
+		{"kty":"RSA","kid":"rsa1","alg":"RS256","use":"sig","n":%q,"e":%q},
+		{"kty":"EC","kid":"ec1","crv":"P-256","x":%q,"y":%q},
+		{"kty":"RSA","kid":"enc","use":"enc","n":%q,"e":%q},
+		{"kty":"OKP","kid":"ed","crv":"Ed25519","x":"AAAA"}
+	]}`,
+		b64(rsaKey.N.Bytes()), b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+		b64(ecKey.X.FillBytes(make([]byte, 32))), b64(ecKey.Y.FillBytes(make([]byte, 32))),
+		b64(otherRSA.N.Bytes()), b64(big.NewInt(int64(otherRSA.E)).Bytes()),
+	)
+
+	now := time.Unix(1_700_000_000, 0)
+	v := NewJWTVerifier(JWTOptions{Issuer: "https://idp.example", Audience: "shortener", Leeway: time.Minute})
+	v.now = func() time.Time { return now }
+	if err := v.AddJWKS([]byte(jwks)); err != nil {
+		t.Fatalf("AddJWKS: %v", err)
+	}
+	v.AddHMAC(secret)
+
+	claims := func(extra map[string]any) map[string]any {
+		c := map[string]any{
+			"sub":   "user-1",
+			"iss":   "https://idp.example",
+			"aud":   []string{"other", "shortener"},
+			"exp":   now.Add(time.Hour).Unix(),
+			"scope": "links:write metrics:read unknown:scope",
+		}
+		for k, val := range extra {
+			c[k] = val
+		}
+		return c
+	}
+
+	valid := []struct {
+		name  string
+		token string
+	}{
+		{"RS256 with kid", signToken(t, AlgRS256, "rsa1", rsaKey, claims(nil))},
+		{"RS256 without kid", signToken(t, AlgRS256, "", rsaKey, claims(nil))},
+		{"ES256", signToken(t, AlgES256, "ec1", ecKey, claims(nil))},
+		{"HS256", signToken(t, AlgHS256, "", secret, claims(nil))},
+		{"expired within leeway", signToken(t, AlgHS256, "", secret, claims(map[string]any{"exp": now.Add(-30 * time.Second).Unix()}))},
+	}
+	for _, tc := range valid {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := v.Verify(tc.token)
+			if err != nil {
+				t.Fatalf("expected valid token, got %v", err)
+			}
+			if id.Subject != "jwt:user-1" {
+				t.Errorf("expected subject jwt:user-1, got %q", id.Subject)
+			}
+			if !id.HasScope(ScopeLinksWrite) || !id.HasScope(ScopeMetricsRead) || len(id.Scopes) != 2 {
+				t.Errorf("expected known scopes only, got %v", id.Scopes)
+			}
+			if id.Role != DefaultRole {
+				t.Errorf("expected default role, got %q", id.Role)
+			}
+		})
+	}
+
+	invalidTokens := []struct {
+		name  string
+		token string
+	}{
+		{"malformed", "a.b"},
+		{"alg none", signToken(t, "none", "", nil, claims(nil))},
+		{"unknown signer", signToken(t, AlgRS256, "", otherRSA, claims(nil))},
+		{"encryption key", signToken(t, AlgRS256, "enc", otherRSA, claims(nil))},
+		{"kid mismatch", signToken(t, AlgRS256, "ec1", rsaKey, claims(nil))},
+		{"wrong hmac secret", signToken(t, AlgHS256, "", []byte("other"), claims(nil))},
+		{"expired", signToken(t, AlgHS256, "", secret, claims(map[string]any{"exp": now.Add(-2 * time.Minute).Unix()}))},
+		{"missing exp", signToken(t, AlgHS256, "", secret, claims(map[string]any{"exp": nil}))},
+		{"not yet valid", signToken(t, AlgHS256, "", secret, claims(map[string]any{"nbf": now.Add(time.Hour).Unix()}))},
+		{"wrong issuer", signToken(t, AlgHS256, "", secret, claims(map[string]any{"iss": "https://evil.example"}))},
+		{"wrong audience", signToken(t, AlgHS256, "", secret, claims(map[string]any{"aud": "other"}))},
+		{"missing sub", signToken(t, AlgHS256, "", secret, claims(map[string]any{"sub": ""}))},
+		{"unknown role", signToken(t, AlgHS256, "", secret, claims(map[string]any{"role": "root"}))},
+	}
+	for _, tc := range invalidTokens {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := v.Verify(tc.token); !errors.Is(err, ErrInvalidCredentials) {
+				t.Fatalf("expected ErrInvalidCredentials, got %v", err)
+			}
+		})
+	}
+
+	t.Run("scope array claim", func(t *testing.T) {
+		v := NewJWTVerifier(JWTOptions{ScopeClaim: "scp"})
+		v.now = func() time.Time { return now }
+		v.AddHMAC(secret)
+		id, err := v.Verify(signToken(t, AlgHS256, "", secret, claims(map[string]any{"scp": []string{"keys:manage"}})))
+		if err != nil || len(id.Scopes) != 1 || !id.HasScope(ScopeKeysManage) {
+			t.Fatalf("expected keys:manage from scp, got %v err=%v", id.Scopes, err)
+		}
+	})
+
+	t.Run("role claim", func(t *testing.T) {
+		id, err := v.Verify(signToken(t, AlgHS256, "", secret, claims(map[string]any{"role": "viewer"})))
+		if err != nil || id.Role != RoleViewer || id.IsAdmin() {
+			t.Fatalf("expected viewer role, got %q err=%v", id.Role, err)
+		}
+	})
+}
+
+func TestJWTVerifier_AddPEM(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	encode := func(pub any) []byte {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	}
+
+	v := NewJWTVerifier(JWTOptions{})
+	if err := v.AddPEM(encode(&rsaKey.PublicKey)); err != nil {
+		t.Fatalf("AddPEM rsa: %v", err)
+	}
+	if err := v.AddPEM(encode(&ecKey.PublicKey)); err != nil {
+		t.Fatalf("AddPEM ec: %v", err)
+	}
+	if err := v.AddPEM(encode(&p384.PublicKey)); err == nil {
+		t.Fatalf("expected P-384 key to be rejected")
+	}
+	if err := v.AddPEM([]byte("not pem")); err == nil {
+		t.Fatalf("expected invalid pem to be rejected")
+	}
+
+	claims := map[string]any{"sub": "svc", "exp": time.Now().Add(time.Hour).Unix()}
+	for alg, key := range map[string]any{AlgRS256: rsaKey, AlgES256: ecKey} {
+		if _, err := v.Verify(signToken(t, alg, "", key, claims)); err != nil {
+			t.Errorf("%s: expected valid token, got %v", alg, err)
+		}
+	}
+	// A PEM RSA key must not be usable as an HMAC secret.
+	if _, err := v.Verify(signToken(t, AlgHS256, "", x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey), claims)); err == nil {
+		t.Errorf("expected HS256 token signed with the public key to be rejected")
+	}
+}
+
+func TestIsJWT(t *testing.T) {
+	if !IsJWT("a.b.c") || IsJWT("usk_abc") || IsJWT("a.b") {
+		t.Fatalf("unexpected IsJWT result")
+	}
+}
@@ -0,0 +1,17 @@
+package common
+
+// LinkDetails describe a link to the people managing it. They do not change
+// where the link redirects.
+type LinkDetails struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	// Tags label the link for filtering. They are lower-cased.
+	Tags []string `json:"tags,omitempty"`
+	// Metadata are free-form key/value pairs.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// IsZero reports whether no detail is set.
+func (d LinkDetails) IsZero() bool {
+	return d.Title == "" && d.Description == "" && len(d.Tags) == 0 && len(d.Metadata) == 0
+}
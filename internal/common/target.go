@@ -0,0 +1,17 @@
+package common
+
+// TargetRule sends the visitors it matches to URL instead of the url of
+// the link. A rule matches when all of its set conditions do.
+type TargetRule struct {
+	// Name identifies the rule in the link stats.
+	Name string `json:"name"`
+	// Device is the device of the visitor: ios, android, windows, macos,
+	// linux, mobile or desktop.
+	Device string `json:"device,omitempty"`
+	// UserAgent is matched case-insensitively as part of the User-Agent.
+	UserAgent string `json:"userAgent,omitempty"`
+	// Language is matched against the preferred language of the visitor's
+	// Accept-Language; "de" matches "de-AT" too.
+	Language string `json:"language,omitempty"`
+	URL      string `json:"url"`
+}
@@ -0,0 +1,11 @@
+package common
+
+// UTM holds the utm parameters added to the destination of a link when it
+// is resolved. Empty fields are not added.
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
@@ -0,0 +1,13 @@
+package common
+
+// Variant is one of the destinations of a link split between visitors by
+// weight, e.g. for landing page experiments.
+type Variant struct {
+	// Name identifies the variant in the assignment cookie and the link
+	// stats.
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Weight is the share of visitors assigned to the variant relative to
+	// the others; zero pauses it.
+	Weight int `json:"weight"`
+}
@@ -1,26 +1,42 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/parikshitg/urlshortener/internal/common"
 	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/useragent"
 )
 
 type Config struct {
 	// Port is the port of the server. (default is 8080)
 	Port string
+	// TrustedProxies are the addresses or CIDR ranges of the reverse
+	// proxies whose X-Forwarded-For header gives the client IP. Without
+	// any, the client IP is the remote address. (default is every address)
+	TrustedProxies []string
 	// BaseURL is used for making the final shortend url.
 	BaseURL string
+	// ShortDomains is the list of additional branded domains links can be
+	// created on. Each domain is its own code namespace.
+	ShortDomains []string
 	// CodeLength is the length of the shortened uri. (default is 7)
 	CodeLength int
 	// TopN is top n shortened domains. (default is 3)
 	TopN int
 	// Expiry is the duration to live for the shortened url. (default is 1h)
 	Expiry time.Duration
+	// NotActiveURL is redirected to when a scheduled link without fallback
+	// is visited before its start time. Such visits get a 404 when empty.
+	NotActiveURL string
+	// UTMDefaults are the utm parameters added to the links of a short
+	// domain, keyed by domain. Links override them with their own.
+	UTMDefaults map[string]common.UTM
 	// Simple logging configuration
 	LogLevel  string
 	LogFormat string
@@ -32,6 +48,139 @@ type Config struct {
 	CORS CORSConfig
 	// Rate Limiter configuration
 	RateLimiter RateLimiterConfig
+	// Batch shortening configuration
+	Batch BatchConfig
+	// IdempotencyTTL is how long responses to requests with an
+	// Idempotency-Key are kept for replay. (default is 24h)
+	IdempotencyTTL time.Duration
+	// DocsEnabled serves the interactive api documentation at /v1/docs. (default is false)
+	DocsEnabled bool
+	// Auth configuration
+	Auth AuthConfig
+	// Audit log configuration
+	Audit AuditConfig
+	// Password protected links configuration
+	Password PasswordConfig
+	// Redirect configuration
+	Redirect RedirectConfig
+	// Preview and interstitial pages configuration
+	Preview PreviewConfig
+	// Click analytics configuration
+	Analytics AnalyticsConfig
+	// Bot detection configuration
+	Bots BotConfig
+	// Click location configuration
+	GeoIP GeoIPConfig
+}
+
+type GeoIPConfig struct {
+	// Database is the path of a local MaxMind DB file (GeoLite2 or GeoIP2
+	// Country or City) clicks are located with. Empty, missing or invalid
+	// files leave clicks without a country.
+	Database string
+}
+
+type BotConfig struct {
+	// Patterns are lower-case parts of the User-Agent of bots, whose clicks
+	// are left out of stats unless asked for. (default is
+	// useragent.BotPatterns)
+	Patterns []string
+}
+
+type AnalyticsConfig struct {
+	// RollupInterval is the interval to roll minute buckets up into hours
+	// and hours into days, and to purge buckets past their retention.
+	// (default is 1m)
+	RollupInterval time.Duration
+	// MinuteRetention, HourRetention and DayRetention are how long the
+	// buckets of each granularity are kept; zero keeps them forever.
+	// DayRetention also applies to the daily unique visitor sketches.
+	// (defaults are 48h, 2160h and zero)
+	MinuteRetention time.Duration
+	HourRetention   time.Duration
+	DayRetention    time.Duration
+}
+
+type PreviewConfig struct {
+	// TemplatesDir is a directory whose password.html, preview.html and
+	// interstitial.html replace the embedded pages. Missing files keep the
+	// embedded ones.
+	TemplatesDir string
+	// Interstitial shows a warning page instead of redirecting every link
+	// to a destination outside the Allowlist. Links can also enable it on
+	// their own. (default is false)
+	Interstitial bool
+	// Allowlist are the destination domains, with their subdomains, that
+	// never get the interstitial page.
+	Allowlist []string
+}
+
+type RedirectConfig struct {
+	// Status is the status code of links without their own; one of 301,
+	// 302, 307 or 308. (default is 302)
+	Status int
+	// PermanentMaxAge is how long clients may cache 301 and 308 redirects,
+	// zero to forbid it. Links can still be edited, so it is kept short.
+	// (default is 1h)
+	PermanentMaxAge time.Duration
+}
+
+type PasswordConfig struct {
+	// MaxAttempts is the number of wrong passwords allowed per link and
+	// client IP in a window. (default is 5)
+	MaxAttempts int
+	// AttemptWindow is the duration of the window. (default is 15m)
+	AttemptWindow time.Duration
+}
+
+type AuditConfig struct {
+	// Retention is how long audit events are kept; zero keeps them forever. (default is 2160h)
+	Retention time.Duration
+	// PurgeInterval is the interval to purge events past the retention. (default is 1h)
+	PurgeInterval time.Duration
+}
+
+type AuthConfig struct {
+	// Enabled requires credentials on the /v1 endpoints. (default is false)
+	Enabled bool
+	// AdminKey is a bootstrap api key granted every scope, used to create
+	// the first keys. It is never stored.
+	AdminKey string
+	// JWT configures bearer token authentication
+	JWT JWTConfig
+}
+
+type JWTConfig struct {
+	// JWKSFile is a local JWKS document with the token signing keys.
+	JWKSFile string
+	// PublicKeyFile is a PEM encoded RSA or P-256 EC public key or certificate.
+	PublicKeyFile string
+	// HMACSecret is a shared HS256 secret.
+	HMACSecret string
+	// Issuer is the required "iss" claim, not checked when empty.
+	Issuer string
+	// Audience is the required "aud" claim, not checked when empty.
+	Audience string
+	// ScopeClaim is the claim holding the caller's scopes. (default is scope)
+	ScopeClaim string
+	// TenantClaim is the claim holding the caller's tenant. (default is tenant)
+	TenantClaim string
+	// RoleClaim is the claim holding the caller's role. (default is role)
+	RoleClaim string
+	// Leeway is the allowed clock skew. (default is 1m)
+	Leeway time.Duration
+}
+
+// Enabled reports whether any token signing key is configured.
+func (c JWTConfig) Enabled() bool {
+	return c.JWKSFile != "" || c.PublicKeyFile != "" || c.HMACSecret != ""
+}
+
+type BatchConfig struct {
+	// MaxItems is the maximum number of urls in one batch request. (default is 1000)
+	MaxItems int
+	// Concurrency is the number of items validated concurrently. (default is 8)
+	Concurrency int
 }
 
 type RateLimiterConfig struct {
@@ -89,21 +238,96 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
+	shortDomains := splitList(getenv("SHORT_DOMAINS", ""))
+
+	batchConfig, err := loadBatchConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	idempotencyTTL, err := time.ParseDuration(getenv("IDEMPOTENCY_TTL", "24h"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse IDEMPOTENCY_TTL: %w", err)
+	}
+
+	jwtConfig, err := loadJWTConfig()
+	if err != nil {
+		return nil, err
+	}
+	authConfig := AuthConfig{
+		Enabled:  getenv("AUTH_ENABLED", "false") == "true",
+		AdminKey: os.Getenv("AUTH_ADMIN_KEY"),
+		JWT:      jwtConfig,
+	}
+
+	auditConfig, err := loadAuditConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	passwordConfig, err := loadPasswordConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	redirectConfig, err := loadRedirectConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	utmDefaults, err := loadUTMDefaults()
+	if err != nil {
+		return nil, err
+	}
+
+	analyticsConfig, err := loadAnalyticsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	botConfig := BotConfig{Patterns: useragent.BotPatterns}
+	if patterns := os.Getenv("BOT_USER_AGENTS"); patterns != "" {
+		botConfig.Patterns = splitList(patterns)
+	}
+
+	geoIPConfig := GeoIPConfig{Database: os.Getenv("GEOIP_DATABASE")}
+
+	previewConfig := PreviewConfig{
+		TemplatesDir: os.Getenv("TEMPLATES_DIR"),
+		Interstitial: getenv("INTERSTITIAL_ENABLED", "false") == "true",
+		Allowlist:    splitList(getenv("INTERSTITIAL_ALLOWLIST", "")),
+	}
+
 	dataDir := getenv("DATA_DIR", "./data")
 	storageBackend := getenv("STORAGE_BACKEND", "memory")
 
 	return &Config{
 		Port:           port,
+		TrustedProxies: loadTrustedProxies(),
 		BaseURL:        baseURL,
+		ShortDomains:   shortDomains,
 		CodeLength:     length,
 		TopN:           n,
 		Expiry:         duration,
+		NotActiveURL:   os.Getenv("LINK_NOT_ACTIVE_URL"),
+		UTMDefaults:    utmDefaults,
 		LogLevel:       logLevel,
 		LogFormat:      logFormat,
 		DataDir:        dataDir,
 		StorageBackend: strings.ToLower(storageBackend),
 		CORS:           corsConfig,
 		RateLimiter:    rlConfig,
+		Batch:          batchConfig,
+		IdempotencyTTL: idempotencyTTL,
+		DocsEnabled:    getenv("API_DOCS_ENABLED", "false") == "true",
+		Auth:           authConfig,
+		Audit:          auditConfig,
+		Password:       passwordConfig,
+		Redirect:       redirectConfig,
+		Preview:        previewConfig,
+		Analytics:      analyticsConfig,
+		Bots:           botConfig,
+		GeoIP:          geoIPConfig,
 	}, nil
 }
 
@@ -114,6 +338,30 @@ func getenv(key, def string) string {
 	return def
 }
 
+// loadTrustedProxies loads the trusted proxies. Every address is trusted
+// by default, as before the setting existed; "none" trusts no proxy.
+func loadTrustedProxies() []string {
+	proxies := splitList(getenv("TRUSTED_PROXIES", "0.0.0.0/0,::/0"))
+	if len(proxies) == 1 && proxies[0] == "none" {
+		return nil
+	}
+	return proxies
+}
+
+// splitList splits a comma-separated list of hosts or patterns, trimming spaces
+// and dropping empty entries. Entries are lower-cased as they are matched
+// case-insensitively.
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
 // loadCORSConfig loads CORS configuration from environment variables
 func loadCORSConfig() CORSConfig {
 	// Default CORS configuration - permissive for development
@@ -193,3 +441,149 @@ func loadRateLimiterConfig() (RateLimiterConfig, error) {
 		PurgeInterval: purgeInterval,
 	}, nil
 }
+
+// loadBatchConfig loads batch shortening configuration from environment variables
+func loadBatchConfig() (BatchConfig, error) {
+	maxItems, err := strconv.Atoi(getenv("BATCH_MAX_ITEMS", "1000"))
+	if err != nil {
+		return BatchConfig{}, fmt.Errorf("failed to parse BATCH_MAX_ITEMS: %w", err)
+	}
+
+	concurrency, err := strconv.Atoi(getenv("BATCH_CONCURRENCY", "8"))
+	if err != nil {
+		return BatchConfig{}, fmt.Errorf("failed to parse BATCH_CONCURRENCY: %w", err)
+	}
+
+	return BatchConfig{
+		MaxItems:    maxItems,
+		Concurrency: concurrency,
+	}, nil
+}
+
+// loadJWTConfig loads JWT authentication configuration from environment variables
+func loadJWTConfig() (JWTConfig, error) {
+	leeway, err := time.ParseDuration(getenv("AUTH_JWT_LEEWAY", "1m"))
+	if err != nil {
+		return JWTConfig{}, fmt.Errorf("failed to parse AUTH_JWT_LEEWAY: %w", err)
+	}
+
+	return JWTConfig{
+		JWKSFile:      os.Getenv("AUTH_JWT_JWKS_FILE"),
+		PublicKeyFile: os.Getenv("AUTH_JWT_PUBLIC_KEY_FILE"),
+		HMACSecret:    os.Getenv("AUTH_JWT_HMAC_SECRET"),
+		Issuer:        os.Getenv("AUTH_JWT_ISSUER"),
+		Audience:      os.Getenv("AUTH_JWT_AUDIENCE"),
+		ScopeClaim:    getenv("AUTH_JWT_SCOPE_CLAIM", "scope"),
+		TenantClaim:   getenv("AUTH_JWT_TENANT_CLAIM", "tenant"),
+		RoleClaim:     getenv("AUTH_JWT_ROLE_CLAIM", "role"),
+		Leeway:        leeway,
+	}, nil
+}
+
+// loadPasswordConfig loads password protected links configuration from environment variables
+func loadPasswordConfig() (PasswordConfig, error) {
+	maxAttempts, err := strconv.Atoi(getenv("PASSWORD_MAX_ATTEMPTS", "5"))
+	if err != nil {
+		return PasswordConfig{}, fmt.Errorf("failed to parse PASSWORD_MAX_ATTEMPTS: %w", err)
+	}
+
+	window, err := time.ParseDuration(getenv("PASSWORD_ATTEMPT_WINDOW", "15m"))
+	if err != nil {
+		return PasswordConfig{}, fmt.Errorf("failed to parse PASSWORD_ATTEMPT_WINDOW: %w", err)
+	}
+
+	return PasswordConfig{
+		MaxAttempts:   maxAttempts,
+		AttemptWindow: window,
+	}, nil
+}
+
+// loadAuditConfig loads audit log configuration from environment variables
+func loadAuditConfig() (AuditConfig, error) {
+	retention, err := time.ParseDuration(getenv("AUDIT_RETENTION", "2160h"))
+	if err != nil {
+		return AuditConfig{}, fmt.Errorf("failed to parse AUDIT_RETENTION: %w", err)
+	}
+
+	purgeInterval, err := time.ParseDuration(getenv("AUDIT_PURGE_INTERVAL", "1h"))
+	if err != nil {
+		return AuditConfig{}, fmt.Errorf("failed to parse AUDIT_PURGE_INTERVAL: %w", err)
+	}
+
+	return AuditConfig{
+		Retention:     retention,
+		PurgeInterval: purgeInterval,
+	}, nil
+}
+
+// loadAnalyticsConfig loads click analytics configuration from environment variables
+func loadAnalyticsConfig() (AnalyticsConfig, error) {
+	rollupInterval, err := time.ParseDuration(getenv("ANALYTICS_ROLLUP_INTERVAL", "1m"))
+	if err != nil {
+		return AnalyticsConfig{}, fmt.Errorf("failed to parse ANALYTICS_ROLLUP_INTERVAL: %w", err)
+	}
+
+	minuteRetention, err := time.ParseDuration(getenv("ANALYTICS_MINUTE_RETENTION", "48h"))
+	if err != nil {
+		return AnalyticsConfig{}, fmt.Errorf("failed to parse ANALYTICS_MINUTE_RETENTION: %w", err)
+	}
+
+	hourRetention, err := time.ParseDuration(getenv("ANALYTICS_HOUR_RETENTION", "2160h"))
+	if err != nil {
+		return AnalyticsConfig{}, fmt.Errorf("failed to parse ANALYTICS_HOUR_RETENTION: %w", err)
+	}
+
+	dayRetention, err := time.ParseDuration(getenv("ANALYTICS_DAY_RETENTION", "0"))
+	if err != nil {
+		return AnalyticsConfig{}, fmt.Errorf("failed to parse ANALYTICS_DAY_RETENTION: %w", err)
+	}
+
+	return AnalyticsConfig{
+		RollupInterval:  rollupInterval,
+		MinuteRetention: minuteRetention,
+		HourRetention:   hourRetention,
+		DayRetention:    dayRetention,
+	}, nil
+}
+
+// loadRedirectConfig loads redirect configuration from environment variables
+func loadRedirectConfig() (RedirectConfig, error) {
+	status, err := strconv.Atoi(getenv("REDIRECT_STATUS", "302"))
+	if err != nil {
+		return RedirectConfig{}, fmt.Errorf("failed to parse REDIRECT_STATUS: %w", err)
+	}
+	switch status {
+	case 301, 302, 307, 308:
+	default:
+		return RedirectConfig{}, fmt.Errorf("invalid REDIRECT_STATUS %d: must be 301, 302, 307 or 308", status)
+	}
+
+	maxAge, err := time.ParseDuration(getenv("REDIRECT_PERMANENT_MAX_AGE", "1h"))
+	if err != nil {
+		return RedirectConfig{}, fmt.Errorf("failed to parse REDIRECT_PERMANENT_MAX_AGE: %w", err)
+	}
+
+	return RedirectConfig{
+		Status:          status,
+		PermanentMaxAge: maxAge,
+	}, nil
+}
+
+// loadUTMDefaults loads the per domain utm defaults from the UTM_DEFAULTS
+// json object, e.g. {"go.brand-a.com":{"source":"brand-a"}}.
+func loadUTMDefaults() (map[string]common.UTM, error) {
+	raw := os.Getenv("UTM_DEFAULTS")
+	if raw == "" {
+		return nil, nil
+	}
+	var defaults map[string]common.UTM
+	if err := json.Unmarshal([]byte(raw), &defaults); err != nil {
+		return nil, fmt.Errorf("failed to parse UTM_DEFAULTS: %w", err)
+	}
+	// domains are matched case-insensitively
+	lower := make(map[string]common.UTM, len(defaults))
+	for domain, utm := range defaults {
+		lower[strings.ToLower(strings.TrimSpace(domain))] = utm
+	}
+	return lower, nil
+}
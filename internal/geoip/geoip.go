@@ -0,0 +1,75 @@
+// Package geoip locates client addresses with a local MaxMind DB file such
+// as GeoLite2 Country or City. Nothing is looked up over the network.
+package geoip
+
+import (
+	"net/netip"
+
+	"github.com/parikshitg/urlshortener/pkg/mmdb"
+)
+
+// Location is where an address is, as ISO 3166 codes. Fields are empty when
+// unknown.
+type Location struct {
+	// Country is the ISO 3166-1 alpha-2 country code, e.g. "DE".
+	Country string
+	// Region is the ISO 3166-2 code of the first level subdivision, e.g.
+	// "US-CA". Only City databases have regions.
+	Region string
+}
+
+// DB is a GeoIP database. A nil DB locates nothing.
+type DB struct {
+	reader *mmdb.Reader
+}
+
+// Open opens the database at path.
+func Open(path string) (*DB, error) {
+	reader, err := mmdb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{reader: reader}, nil
+}
+
+// Locate returns the location of ip. Invalid addresses, addresses missing
+// from the database and records without a country have no location.
+func (db *DB) Locate(ip string) Location {
+	if db == nil {
+		return Location{}
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Location{}
+	}
+	v, err := db.reader.Lookup(addr)
+	if err != nil {
+		return Location{}
+	}
+	record, _ := v.(map[string]any)
+
+	var loc Location
+	// anonymous proxies and satellite providers have no country, only the
+	// registered one
+	for _, field := range []string{"country", "registered_country"} {
+		if loc.Country = isoCode(record[field]); loc.Country != "" {
+			break
+		}
+	}
+	if loc.Country == "" {
+		return Location{}
+	}
+	if subdivisions, _ := record["subdivisions"].([]any); len(subdivisions) > 0 {
+		if region := isoCode(subdivisions[0]); region != "" {
+			loc.Region = loc.Country + "-" + region
+		}
+	}
+	return loc
+}
+
+// isoCode returns the iso_code of a country or subdivision record.
+func isoCode(v any) string {
+	record, _ := v.(map[string]any)
+	code, _ := record["iso_code"].(string)
+	return code
+}
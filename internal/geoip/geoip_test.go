@@ -0,0 +1,66 @@
+package geoip
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/parikshitg/urlshortener/internal/mmdbtest"
+)
+
+func TestLocate(t *testing.T) {
+	w := mmdbtest.NewWriter("GeoIP2-City")
+	networks := map[string]any{
+		"81.2.69.0/24": map[string]any{
+			"country":      map[string]any{"iso_code": "GB"},
+			"subdivisions": []any{map[string]any{"iso_code": "ENG"}, map[string]any{"iso_code": "WBK"}},
+		},
+		"2a02:8100::/32":  map[string]any{"country": map[string]any{"iso_code": "DE"}},
+		"192.0.2.0/24":    map[string]any{"registered_country": map[string]any{"iso_code": "US"}},
+		"198.51.100.0/24": map[string]any{"continent": map[string]any{"code": "EU"}},
+	}
+	for prefix, record := range networks {
+		if err := w.Insert(netip.MustParsePrefix(prefix), record); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+	buf, err := w.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	if err := os.WriteFile(path, buf, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want Location
+	}{
+		{"81.2.69.142", Location{Country: "GB", Region: "GB-ENG"}},
+		{"2a02:8100::1", Location{Country: "DE"}},
+		{"192.0.2.1", Location{Country: "US"}},
+		{"198.51.100.1", Location{}},
+		{"10.0.0.1", Location{}},
+		{"not an ip", Location{}},
+		{"", Location{}},
+	}
+	for _, tt := range tests {
+		if got := db.Locate(tt.ip); got != tt.want {
+			t.Errorf("Locate(%q): expected %+v, got %+v", tt.ip, tt.want, got)
+		}
+	}
+
+	var none *DB
+	if got := none.Locate("81.2.69.142"); got != (Location{}) {
+		t.Errorf("expected a nil database to locate nothing, got %+v", got)
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Error("expected opening a missing database to fail")
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/parikshitg/urlshortener/internal/auth"
+	"github.com/parikshitg/urlshortener/internal/problem"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader is the request header carrying an api key. Keys and JWTs can
+// also be sent as "Authorization: Bearer <credential>".
+const APIKeyHeader = "X-API-Key"
+
+// Authenticator resolves request credentials to an identity.
+type Authenticator interface {
+	Authenticate(ctx context.Context, credential string) (auth.Identity, error)
+}
+
+// Authenticate rejects requests without valid credentials with 401 and
+// stores the caller's identity in the request context for the handlers and
+// the service layer. Other authenticator errors, which the authenticator is
+// expected to log, fail the request with 500.
+func Authenticate(a Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		credential := credentials(c)
+		if credential == "" {
+			unauthorized(c, "missing credentials")
+			return
+		}
+
+		id, err := a.Authenticate(c.Request.Context(), credential)
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			unauthorized(c, "invalid credentials")
+			return
+		}
+		if err != nil {
+			problem.Write(c, problem.New(http.StatusInternalServerError, problem.CodeInternal, "failed to authenticate request"))
+			return
+		}
+
+		c.Request = c.Request.WithContext(auth.NewContext(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// RequireScope rejects requests whose identity lacks scope with 403. It must
+// run after Authenticate.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, ok := auth.FromContext(c.Request.Context())
+		if !ok {
+			unauthorized(c, "missing credentials")
+			return
+		}
+		if !id.HasScope(scope) {
+			problem.Write(c, problem.New(http.StatusForbidden, problem.CodeForbidden, "missing scope "+scope))
+			return
+		}
+		c.Next()
+	}
+}
+
+// credentials returns the api key or token sent with the request, if any.
+func credentials(c *gin.Context) string {
+	if key := c.GetHeader(APIKeyHeader); key != "" {
+		return key
+	}
+	scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+func unauthorized(c *gin.Context, detail string) {
+	c.Header("WWW-Authenticate", `Bearer realm="urlshortener"`)
+	problem.Write(c, problem.New(http.StatusUnauthorized, problem.CodeUnauthorized, detail))
+}
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/auth"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/problem"
+	"github.com/parikshitg/urlshortener/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// IdempotencyHeader is the request header carrying the idempotency key.
+	IdempotencyHeader = "Idempotency-Key"
+	// IdempotentReplayHeader is set on responses replayed from the store.
+	IdempotentReplayHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// Idempotency makes write endpoints safe to retry. The first response to a
+// request with an Idempotency-Key header is stored for ttl, keyed by caller
+// and key; later requests with the same key get that response replayed
+// verbatim. Reusing a key with a different request is rejected with 422, and
+// a request whose key is still in flight with 409. Server errors are not
+// stored, so they can be retried.
+func Idempotency(store storage.IdempotencyStore, ttl time.Duration, logger *logger.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			problem.Write(c, problem.New(http.StatusBadRequest, problem.CodeInvalidRequest, "idempotency key too long"))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			problem.Write(c, problem.New(http.StatusBadRequest, problem.CodeInvalidRequest, "failed to read request"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		storeKey := caller(c) + ":" + key
+		hash := requestHash(c.Request.Method, c.FullPath(), body)
+
+		record, reserved, err := store.ReserveIdempotencyKey(storeKey, hash, ttl)
+		if err != nil {
+			logger.Error("Failed to reserve idempotency key", "error", err)
+			problem.Write(c, problem.New(http.StatusInternalServerError, problem.CodeInternal, "failed to process idempotency key"))
+			return
+		}
+		if !reserved {
+			replay(c, record, hash)
+			return
+		}
+
+		// Release the key if the handler panics, so the request can be retried.
+		completed := false
+		defer func() {
+			if !completed {
+				_ = store.ReleaseIdempotencyKey(storeKey)
+			}
+		}()
+
+		w := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+		completed = true
+
+		if w.Status() >= http.StatusInternalServerError {
+			if err := store.ReleaseIdempotencyKey(storeKey); err != nil {
+				logger.Error("Failed to release idempotency key", "error", err)
+			}
+			return
+		}
+		record = storage.IdempotencyRecord{
+			RequestHash: hash,
+			Status:      w.Status(),
+			ContentType: w.Header().Get("Content-Type"),
+			Body:        w.body.Bytes(),
+		}
+		if err := store.SaveIdempotencyResponse(storeKey, record, ttl); err != nil {
+			logger.Error("Failed to save idempotent response", "error", err)
+		}
+	}
+}
+
+// caller identifies who sent the request, so keys of different callers
+// never collide: the authenticated subject, or the client ip without auth.
+func caller(c *gin.Context) string {
+	if id, ok := auth.FromContext(c.Request.Context()); ok {
+		return id.Subject
+	}
+	return c.ClientIP()
+}
+
+// replay answers a request whose key is already known.
+func replay(c *gin.Context, record storage.IdempotencyRecord, hash string) {
+	switch {
+	case record.RequestHash != hash:
+		problem.Write(c, problem.New(http.StatusUnprocessableEntity, problem.CodeIdempotencyKeyReused, "idempotency key already used for a different request"))
+	case record.Status == 0:
+		problem.Write(c, problem.New(http.StatusConflict, problem.CodeIdempotencyInProgress, "request with this idempotency key is in progress"))
+	default:
+		c.Header(IdempotentReplayHeader, "true")
+		c.Data(record.Status, record.ContentType, record.Body)
+		c.Abort()
+	}
+}
+
+// requestHash fingerprints a request so a key cannot be reused for another one.
+func requestHash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingWriter copies the response body while writing it.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	calls := 0
+	router.POST("/v1/shorten", Idempotency(memory.NewMemStore(time.Hour), time.Hour, logger.New("error", "text")), func(c *gin.Context) {
+		calls++
+		if c.Query("fail") != "" {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "boom"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"call": calls})
+	})
+
+	send := func(key, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+		if key != "" {
+			req.Header.Set(IdempotencyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := send("key-1", "/v1/shorten", `{"url":"https://a.com"}`)
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.JSONEq(t, `{"call":1}`, first.Body.String())
+
+	replayed := send("key-1", "/v1/shorten", `{"url":"https://a.com"}`)
+	assert.Equal(t, http.StatusOK, replayed.Code)
+	assert.Equal(t, first.Body.String(), replayed.Body.String())
+	assert.Equal(t, "true", replayed.Header().Get(IdempotentReplayHeader))
+	assert.Equal(t, 1, calls)
+
+	mismatch := send("key-1", "/v1/shorten", `{"url":"https://b.com"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, mismatch.Code)
+	assert.Equal(t, 1, calls)
+
+	noKey := send("", "/v1/shorten", `{"url":"https://a.com"}`)
+	assert.JSONEq(t, `{"call":2}`, noKey.Body.String())
+
+	// server errors are not stored, so the same key can be retried
+	failed := send("key-2", "/v1/shorten?fail=1", `{}`)
+	assert.Equal(t, http.StatusInternalServerError, failed.Code)
+	retried := send("key-2", "/v1/shorten?fail=1", `{}`)
+	assert.Equal(t, http.StatusInternalServerError, retried.Code)
+	assert.Empty(t, retried.Header().Get(IdempotentReplayHeader))
+	assert.Equal(t, 4, calls)
+}
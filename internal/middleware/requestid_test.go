@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/parikshitg/urlshortener/internal/requestid"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID())
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, requestid.FromContext(c.Request.Context()))
+	})
+
+	send := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		if id != "" {
+			req.Header.Set(requestid.Header, id)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("req-123")
+	assert.Equal(t, "req-123", w.Header().Get(requestid.Header))
+	assert.Equal(t, "req-123", w.Body.String())
+
+	for _, id := range []string{"", "has space", strings.Repeat("x", 129)} {
+		w = send(id)
+		generated := w.Header().Get(requestid.Header)
+		assert.Len(t, generated, 32, "id %q", id)
+		assert.Equal(t, generated, w.Body.String())
+	}
+	assert.NotEqual(t, send("").Body.String(), send("").Body.String())
+}
@@ -0,0 +1,218 @@
+// Package mmdbtest writes small MaxMind DB files for tests of the mmdb
+// reader and of the code using it.
+package mmdbtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"sort"
+	"time"
+)
+
+// MetadataMarker starts the metadata at the end of the file.
+var MetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// DataSeparator is the number of zero bytes between the search tree and the
+// data section.
+const DataSeparator = 16
+
+// Data types written by Encode.
+const (
+	typeString = 2
+	typeMap    = 7
+	typeUint64 = 9
+	typeArray  = 11
+	typeBool   = 14
+)
+
+// Writer builds small IPv6 databases with 32-bit records. Values are
+// strings, bools, unsigned integers, map[string]any and []any of them.
+type Writer struct {
+	databaseType string
+	root         *writerNode
+	values       []any
+}
+
+type writerNode struct {
+	children [2]*writerNode
+	// value is the index of the data of a network plus one, zero for inner
+	// nodes and empty networks.
+	value int
+}
+
+// NewWriter returns a writer of a database of the type, e.g.
+// "GeoLite2-Country".
+func NewWriter(databaseType string) *Writer {
+	return &Writer{databaseType: databaseType, root: &writerNode{}}
+}
+
+// Insert sets the data of a network, replacing that of the networks it
+// contains. IPv4 networks are stored under ::/96.
+func (w *Writer) Insert(prefix netip.Prefix, value any) error {
+	if !prefix.IsValid() || prefix.Bits() == 0 {
+		return fmt.Errorf("invalid network %v", prefix)
+	}
+	addr, bits := prefix.Addr().As16(), prefix.Bits()
+	if prefix.Addr().Is4() {
+		addr = [16]byte{}
+		a := prefix.Addr().As4()
+		copy(addr[12:], a[:])
+		bits += 96
+	}
+	w.values = append(w.values, value)
+
+	node := w.root
+	for i := range bits {
+		bit := addr[i/8] >> (7 - i%8) & 1
+		if node.value != 0 {
+			// split the network, both halves keep its data
+			node.children = [2]*writerNode{{value: node.value}, {value: node.value}}
+			node.value = 0
+		}
+		if node.children[bit] == nil {
+			node.children[bit] = &writerNode{}
+		}
+		node = node.children[bit]
+	}
+	*node = writerNode{value: len(w.values)}
+	return nil
+}
+
+// Bytes returns the database.
+func (w *Writer) Bytes() ([]byte, error) {
+	var data bytes.Buffer
+	offsets := make([]int, len(w.values))
+	for i, v := range w.values {
+		offsets[i] = data.Len()
+		if err := Encode(&data, v); err != nil {
+			return nil, err
+		}
+	}
+
+	// number the inner nodes breadth first, the root is node 0
+	var nodes []*writerNode
+	index := make(map[*writerNode]int)
+	for queue := []*writerNode{w.root}; len(queue) > 0; queue = queue[1:] {
+		n := queue[0]
+		index[n] = len(nodes)
+		nodes = append(nodes, n)
+		for _, c := range n.children {
+			if c != nil && c.value == 0 && (c.children[0] != nil || c.children[1] != nil) {
+				queue = append(queue, c)
+			}
+		}
+	}
+	count := len(nodes)
+	var out bytes.Buffer
+	for _, n := range nodes {
+		for _, c := range n.children {
+			record := count
+			switch {
+			case c == nil:
+			case c.value != 0:
+				record = count + DataSeparator + offsets[c.value-1]
+			case c.children[0] != nil || c.children[1] != nil:
+				record = index[c]
+			}
+			out.Write(binary.BigEndian.AppendUint32(nil, uint32(record)))
+		}
+	}
+	out.Write(make([]byte, DataSeparator))
+	out.Write(data.Bytes())
+	out.Write(MetadataMarker)
+	err := Encode(&out, map[string]any{
+		"node_count":                  uint64(count),
+		"record_size":                 uint64(32),
+		"ip_version":                  uint64(6),
+		"database_type":               w.databaseType,
+		"binary_format_major_version": uint64(2),
+		"binary_format_minor_version": uint64(0),
+		"build_epoch":                 uint64(time.Now().Unix()),
+		"languages":                   []any{},
+		"description":                 map[string]any{},
+	})
+	return out.Bytes(), err
+}
+
+// Encode appends the encoding of v to buf.
+func Encode(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case string:
+		writeControl(buf, typeString, len(v))
+		buf.WriteString(v)
+	case bool:
+		n := 0
+		if v {
+			n = 1
+		}
+		writeControl(buf, typeBool, n)
+	case int:
+		if v < 0 {
+			return fmt.Errorf("unsupported negative integer %d", v)
+		}
+		return Encode(buf, uint64(v))
+	case uint32:
+		return Encode(buf, uint64(v))
+	case uint64:
+		b := binary.BigEndian.AppendUint64(nil, v)
+		b = bytes.TrimLeft(b, "\x00")
+		writeControl(buf, typeUint64, len(b))
+		buf.Write(b)
+	case map[string]any:
+		writeControl(buf, typeMap, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := Encode(buf, k); err != nil {
+				return err
+			}
+			if err := Encode(buf, v[k]); err != nil {
+				return err
+			}
+		}
+	case []any:
+		writeControl(buf, typeArray, len(v))
+		for _, item := range v {
+			if err := Encode(buf, item); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported value type %T", v)
+	}
+	return nil
+}
+
+// writeControl writes the control byte of a value of the type and size.
+func writeControl(buf *bytes.Buffer, typ, size int) {
+	var ctrl byte
+	var ext []byte
+	if typ > 7 {
+		ext = []byte{byte(typ - 7)}
+	} else {
+		ctrl = byte(typ) << 5
+	}
+	var extra []byte
+	switch {
+	case size < 29:
+		ctrl |= byte(size)
+	case size < 285:
+		ctrl |= 29
+		extra = []byte{byte(size - 29)}
+	case size < 65821:
+		ctrl |= 30
+		extra = binary.BigEndian.AppendUint16(nil, uint16(size-285))
+	default:
+		ctrl |= 31
+		n := size - 65821
+		extra = []byte{byte(n >> 16), byte(n >> 8), byte(n)}
+	}
+	buf.WriteByte(ctrl)
+	buf.Write(ext)
+	buf.Write(extra)
+}
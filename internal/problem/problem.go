@@ -0,0 +1,95 @@
+package problem
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is the media type of problem responses.
+const ContentType = "application/problem+json"
+
+// typePrefix prefixes Code to build the problem type URI.
+const typePrefix = "urn:urlshortener:problem:"
+
+// Stable, machine-readable error codes. Clients match on these, so existing
+// codes must never change meaning.
+const (
+	CodeInvalidRequest        = "invalid_request"
+	CodeURLInvalid            = "url_invalid"
+	CodeURLTooLong            = "url_too_long"
+	CodeDomainBlocked         = "domain_blocked"
+	CodeDomainNotAllowed      = "domain_not_allowed"
+	CodeAliasInvalid          = "alias_invalid"
+	CodeTTLInvalid            = "ttl_invalid"
+	CodePasswordInvalid       = "password_invalid"
+	CodeMaxClicksInvalid      = "max_clicks_invalid"
+	CodeScheduleInvalid       = "schedule_invalid"
+	CodeRedirectStatusInvalid = "redirect_status_invalid"
+	CodePassthroughInvalid    = "passthrough_invalid"
+	CodeTargetsInvalid        = "targets_invalid"
+	CodeVariantsInvalid       = "variants_invalid"
+	CodeDetailsInvalid        = "details_invalid"
+	CodeCampaignInvalid       = "campaign_invalid"
+	CodeRangeInvalid          = "range_invalid"
+	CodeCodeInvalid           = "code_invalid"
+	CodeCodeTaken             = "code_taken"
+	CodeScopeInvalid          = "scope_invalid"
+	CodeRoleInvalid           = "role_invalid"
+	CodeUnauthorized          = "unauthorized"
+	CodeForbidden             = "forbidden"
+	CodeNotFound              = "not_found"
+	CodeLinkExhausted         = "link_exhausted"
+	CodeLinkNotActive         = "link_not_active"
+	CodeBatchTooLarge         = "batch_too_large"
+	CodeRateLimited           = "rate_limited"
+	CodeIdempotencyKeyReused  = "idempotency_key_reused"
+	CodeIdempotencyInProgress = "idempotency_in_progress"
+	CodeNotImplemented        = "not_implemented"
+	CodeInternal              = "internal_error"
+)
+
+// Problem is an RFC 7807 problem details object, extended with a stable
+// error code and an optional validation reason.
+type Problem struct {
+	// Type is a URI identifying the problem type, derived from Code.
+	Type string `json:"type"`
+	// Title is a short summary of the problem type.
+	Title string `json:"title"`
+	// Status is the HTTP status code.
+	Status int `json:"status"`
+	// Detail explains this occurrence of the problem.
+	Detail string `json:"detail,omitempty"`
+	// Instance is the request path the problem occurred on.
+	Instance string `json:"instance,omitempty"`
+	// Code is the stable, machine-readable error code.
+	Code string `json:"code"`
+	// Reason is the url validator's reason, for url validation problems.
+	Reason string `json:"reason,omitempty"`
+}
+
+// New creates a problem with the status text as title.
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   typePrefix + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// WithReason sets the validation reason.
+func (p *Problem) WithReason(reason string) *Problem {
+	p.Reason = reason
+	return p
+}
+
+// Write aborts the request with p as an application/problem+json response.
+func Write(c *gin.Context, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+	c.Header("Content-Type", ContentType)
+	c.AbortWithStatusJSON(p.Status, p)
+}
@@ -0,0 +1,21 @@
+// Package requestid carries the id of the current request through contexts,
+// so that logs and audit events can be tied to a request.
+package requestid
+
+import "context"
+
+// Header is the request and response header carrying the request id.
+const Header = "X-Request-ID"
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request id carried by ctx, or "".
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
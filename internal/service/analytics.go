@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+)
+
+const (
+	// defaultAnalyticsRange is the time range of analytics without from,
+	// for minute and hour intervals. Day intervals default to
+	// defaultStatsDays.
+	defaultAnalyticsRange = 24 * time.Hour
+	// maxAnalyticsBuckets is the maximum number of buckets of a query, a
+	// day of minutes.
+	maxAnalyticsBuckets = 1440
+)
+
+// AnalyticsQuery selects the clicks returned by Analytics.
+type AnalyticsQuery struct {
+	// From and To bound the buckets, inclusive and exclusive. From is
+	// rounded down and To up to the interval. To defaults to the end of the
+	// current bucket and From to defaultAnalyticsRange before To.
+	From time.Time
+	To   time.Time
+	// Interval is the width of the buckets, storage.Hour when empty.
+	Interval storage.Granularity
+	// Bots adds the clicks of bots to the clicks, and reports them in the
+	// Bots of the buckets.
+	Bots bool
+}
+
+// Analytics are the clicks of a link in a time range.
+type Analytics struct {
+	Interval storage.Granularity
+	From     time.Time
+	To       time.Time
+	// Clicks is the total of the buckets.
+	Clicks int64
+	// Bots is the total of the clicks of bots, only counted with
+	// AnalyticsQuery.Bots.
+	Bots int64
+	// Buckets are every bucket of the range, oldest first, including the
+	// ones without clicks.
+	Buckets []storage.Bucket
+}
+
+// Analytics returns the clicks of the link for code on the short domain per
+// bucket of the query interval. Clicks count as soon as they are recorded;
+// buckets that were not rolled up yet are added in. The clicks of bots are
+// left out unless the query asks for them. Stores without analytics report
+// no clicks.
+func (s *Service) Analytics(ctx context.Context, shortDomain, code string, q AnalyticsQuery) (Analytics, error) {
+	record, err := s.ownedLink(ctx, shortDomain, code, ActionReadMetrics)
+	if err != nil {
+		return Analytics{}, err
+	}
+	g := q.Interval
+	if g == "" {
+		g = storage.Hour
+	}
+	width := g.Duration()
+	if width == 0 {
+		return Analytics{}, fmt.Errorf("%w: interval must be minute, hour or day", ErrInvalidRange)
+	}
+	to := q.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if start := g.Truncate(to); start.Equal(to) {
+		to = start
+	} else {
+		to = start.Add(width)
+	}
+	from := q.From
+	if from.IsZero() {
+		from = to.Add(-defaultAnalyticsRange)
+		if g == storage.Day {
+			from = to.Add(-defaultStatsDays * day)
+		}
+	}
+	from = g.Truncate(from)
+	if !to.After(from) {
+		return Analytics{}, fmt.Errorf("%w: to must be after from", ErrInvalidRange)
+	}
+	if to.Sub(from) > maxAnalyticsBuckets*width {
+		return Analytics{}, fmt.Errorf("%w: at most %d buckets", ErrInvalidRange, maxAnalyticsBuckets)
+	}
+
+	clicks, err := s.bucketClicks(record, g, from, to)
+	if err != nil {
+		s.logger.Error("Failed to read analytics", "code", code, "namespace", record.Namespace, "error", err)
+		return Analytics{}, fmt.Errorf("failed to read analytics: %w", err)
+	}
+	analytics := Analytics{Interval: g, From: from, To: to, Buckets: []storage.Bucket{}}
+	for start := from; start.Before(to); start = start.Add(width) {
+		b := storage.Bucket{Start: start, Clicks: clicks[start].Clicks}
+		if q.Bots {
+			b.Bots = clicks[start].Bots
+			b.Clicks += b.Bots
+		}
+		analytics.Buckets = append(analytics.Buckets, b)
+		analytics.Clicks += b.Clicks
+		analytics.Bots += b.Bots
+	}
+	return analytics, nil
+}
+
+// bucketClicks returns the clicks and bot clicks of a link per bucket of g
+// in [from, to).
+// The buckets of g hold the finer buckets before their roll up time; the
+// finer buckets after it are added in. Buckets before the link was created
+// are left out, they were counted for an earlier link with the same code.
+func (s *Service) bucketClicks(link storage.LinkRecord, g storage.Granularity, from, to time.Time) (map[time.Time]storage.Bucket, error) {
+	clicks := make(map[time.Time]storage.Bucket)
+	if s.analytics == nil {
+		return clicks, nil
+	}
+	for _, fine := range storage.Granularities {
+		start := from
+		if fine != g {
+			rolled, err := s.analytics.RolledUp(fine)
+			if err != nil {
+				return nil, err
+			}
+			start = later(start, rolled)
+		}
+		start = later(start, fine.Truncate(link.CreatedAt))
+		if start.Before(to) {
+			buckets, err := s.analytics.Buckets(link.Namespace, link.Code, fine, start, to)
+			if err != nil {
+				return nil, err
+			}
+			for _, b := range buckets {
+				start := g.Truncate(b.Start)
+				sum := clicks[start]
+				sum.Clicks += b.Clicks
+				sum.Bots += b.Bots
+				clicks[start] = sum
+			}
+		}
+		if fine == g {
+			break
+		}
+	}
+	return clicks, nil
+}
+
+func later(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+// RollupAnalytics rolls the analytics buckets up into coarser ones and
+// purges the buckets past their retention, as well as the visitor sketches
+// past the day retention and old visitor salts. The last complete minute is
+// left for clicks still being counted, and a bucket is only rolled up once
+// all its finer buckets are, so every click is rolled up exactly once.
+func (s *Service) RollupAnalytics() {
+	now := time.Now()
+	s.purgeVisitors(now)
+	if s.analytics == nil {
+		return
+	}
+	before := storage.Minute.Truncate(now).Add(-time.Minute)
+	for _, g := range storage.Granularities {
+		coarser := g.Coarser()
+		if coarser == "" {
+			break
+		}
+		if err := s.analytics.Rollup(g, before); err != nil {
+			s.logger.Error("Failed to roll up analytics", "granularity", g, "error", err)
+			return
+		}
+		before = coarser.Truncate(before)
+	}
+
+	for _, g := range storage.Granularities {
+		retention := s.analyticsRetention(g)
+		if retention <= 0 {
+			continue
+		}
+		cutoff := now.Add(-retention)
+		if g.Coarser() != "" {
+			// never purge buckets that were not rolled up yet
+			rolled, err := s.analytics.RolledUp(g)
+			if err != nil {
+				s.logger.Error("Failed to purge analytics", "granularity", g, "error", err)
+				continue
+			}
+			if rolled.Before(cutoff) {
+				cutoff = rolled
+			}
+		}
+		n, err := s.analytics.PurgeBuckets(g, cutoff)
+		if err != nil {
+			s.logger.Error("Failed to purge analytics", "granularity", g, "error", err)
+			continue
+		}
+		if n > 0 {
+			s.logger.Info("Analytics purged", "granularity", g, "buckets", n, "before", cutoff.Format(time.RFC3339))
+		}
+	}
+}
+
+// analyticsRetention returns how long the buckets of g are kept, zero for
+// ever.
+func (s *Service) analyticsRetention(g storage.Granularity) time.Duration {
+	switch g {
+	case storage.Minute:
+		return s.cfg.Analytics.MinuteRetention
+	case storage.Hour:
+		return s.cfg.Analytics.HourRetention
+	case storage.Day:
+		return s.cfg.Analytics.DayRetention
+	}
+	return 0
+}
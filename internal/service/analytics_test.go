@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+)
+
+func TestService_Analytics(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7, TopN: 3}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+
+	if _, err := s.Shorten(ctx, "https://example.com", ShortenOptions{Alias: "app"}); err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	for range 3 {
+		if _, err := s.Resolve(ctx, Visit{Code: "app"}); err != nil {
+			t.Fatalf("Resolve failed: %v", err)
+		}
+	}
+	// clicks before the link was created belong to an earlier link
+	_ = store.CountClick(storage.Click{Code: "app", Time: time.Now().Add(-48 * time.Hour)})
+
+	clicks := func(interval storage.Granularity) int64 {
+		t.Helper()
+		a, err := s.Analytics(ctx, "", "app", AnalyticsQuery{Interval: interval})
+		if err != nil {
+			t.Fatalf("Analytics failed: %v", err)
+		}
+		return a.Clicks
+	}
+	a, err := s.Analytics(ctx, "", "app", AnalyticsQuery{})
+	if err != nil || a.Interval != storage.Hour || len(a.Buckets) != 24 || a.Clicks != 3 || a.Buckets[23].Clicks != 3 {
+		t.Fatalf("expected 3 clicks in the last of 24 hours, got %+v err=%v", a, err)
+	}
+	if !a.To.After(time.Now()) || !a.To.Equal(a.From.Add(24*time.Hour)) {
+		t.Fatalf("expected the range to end with the current hour, got %v to %v", a.From, a.To)
+	}
+	for _, interval := range storage.Granularities {
+		if n := clicks(interval); n != 3 {
+			t.Fatalf("expected 3 clicks by %s before the rollup, got %d", interval, n)
+		}
+	}
+
+	// rolled up clicks count once; purged minutes stay counted in hours
+	next := time.Now().Add(time.Hour)
+	_ = store.Rollup(storage.Minute, next)
+	_ = store.Rollup(storage.Hour, storage.Hour.Truncate(next))
+	_, _ = store.PurgeBuckets(storage.Minute, next)
+	if n := clicks(storage.Minute); n != 0 {
+		t.Fatalf("expected the purged minutes to have no clicks, got %d", n)
+	}
+	for _, interval := range []storage.Granularity{storage.Hour, storage.Day} {
+		if n := clicks(interval); n != 3 {
+			t.Fatalf("expected 3 clicks by %s after the rollup, got %d", interval, n)
+		}
+	}
+
+	from := time.Date(2025, 3, 1, 10, 30, 0, 0, time.UTC)
+	a, err = s.Analytics(ctx, "", "app", AnalyticsQuery{From: from, To: from.Add(2 * time.Hour)})
+	if err != nil || !a.From.Equal(from.Add(-30*time.Minute)) || !a.To.Equal(from.Add(150*time.Minute)) || len(a.Buckets) != 3 {
+		t.Fatalf("expected the range to be rounded to whole hours, got %+v err=%v", a, err)
+	}
+
+	for name, q := range map[string]AnalyticsQuery{
+		"unknown interval": {Interval: "week"},
+		"empty range":      {From: from, To: from.Add(-2 * time.Hour)},
+		"too many buckets": {Interval: storage.Minute, From: from, To: from.Add(48 * time.Hour)},
+	} {
+		if _, err := s.Analytics(ctx, "", "app", q); !errors.Is(err, ErrInvalidRange) {
+			t.Fatalf("%s: expected ErrInvalidRange, got %v", name, err)
+		}
+	}
+	if _, err := s.Analytics(ctx, "", "missing", AnalyticsQuery{}); !errors.Is(err, ErrLinkNotFound) {
+		t.Fatalf("expected ErrLinkNotFound, got %v", err)
+	}
+}
+
+func TestService_RollupAnalytics(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7, TopN: 3, Analytics: config.AnalyticsConfig{MinuteRetention: time.Hour}}
+	s := NewService(store, cfg, logger.New("error", "text"))
+
+	clicked := time.Now().Add(-3 * time.Hour)
+	_ = store.CountClick(storage.Click{Code: "app", Time: clicked})
+	_ = store.CountClick(storage.Click{Code: "app", Time: time.Now()})
+	s.RollupAnalytics()
+
+	rolled, _ := store.RolledUp(storage.Minute)
+	if want := storage.Minute.Truncate(time.Now()).Add(-time.Minute); rolled.After(want) || rolled.Before(want.Add(-time.Minute)) {
+		t.Fatalf("expected minutes rolled up to the last complete minute, got %v", rolled)
+	}
+	if rolled, _ := store.RolledUp(storage.Hour); !rolled.Equal(storage.Hour.Truncate(rolled)) || rolled.After(time.Now()) {
+		t.Fatalf("expected hours rolled up to a whole hour, got %v", rolled)
+	}
+	far := time.Now().Add(24 * time.Hour)
+	if minutes, _ := store.Buckets("", "app", storage.Minute, time.Time{}, far); len(minutes) != 1 || minutes[0].Start.Before(time.Now().Add(-time.Hour)) {
+		t.Fatalf("expected only the recent minute to be kept, got %+v", minutes)
+	}
+	if hours, _ := store.Buckets("", "app", storage.Hour, time.Time{}, far); len(hours) != 1 || !hours[0].Start.Equal(storage.Hour.Truncate(clicked)) {
+		t.Fatalf("expected the old click rolled up into its hour, got %+v", hours)
+	}
+}
@@ -0,0 +1,235 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/auth"
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/requestid"
+	"github.com/parikshitg/urlshortener/internal/storage"
+)
+
+// Audit event outcomes.
+const (
+	OutcomeSuccess = "success"
+	OutcomeDenied  = "denied"
+)
+
+// Audited actions, besides the denied policy actions.
+const (
+	AuditLinkCreate   = "link.create"
+	AuditLinkUpdate   = "link.update"
+	AuditLinkDelete   = "link.delete"
+	AuditLinkTakeDown = "link.take_down"
+	AuditKeyCreate    = "key.create"
+	AuditKeyRevoke    = "key.revoke"
+	AuditPurge        = "storage.purge"
+	AuditExport       = "links.export"
+	AuditPurgeLog     = "audit.purge"
+
+	AuditCampaignCreate = "campaign.create"
+	AuditCampaignUpdate = "campaign.update"
+	AuditCampaignDelete = "campaign.delete"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// auditor appends events to the audit log, if the store keeps one. Events
+// are also logged when they cannot be stored.
+type auditor struct {
+	store  storage.AuditStore
+	logger *logger.Logger
+}
+
+// newAuditor returns an auditor writing to store if it is a
+// storage.AuditStore, otherwise only to the log.
+func newAuditor(store any, logger *logger.Logger) *auditor {
+	as, _ := store.(storage.AuditStore)
+	return &auditor{store: as, logger: logger}
+}
+
+// record appends an event for action on target by the caller in ctx. before
+// and after are the json encoded states of the target, omitted when nil.
+func (a *auditor) record(ctx context.Context, action, target, outcome string, before, after any) {
+	now := time.Now().UTC()
+	event := storage.AuditEvent{
+		ID:        auditID(now),
+		Time:      now,
+		RequestID: requestid.FromContext(ctx),
+		Action:    action,
+		Target:    target,
+		Outcome:   outcome,
+		Before:    auditValue(before),
+		After:     auditValue(after),
+	}
+	if id, ok := auth.FromContext(ctx); ok {
+		event.Actor, event.Tenant, event.Role = id.Subject, id.Tenant, string(id.Role)
+	}
+
+	if outcome == OutcomeDenied {
+		a.logger.Warn("Access denied", "action", action, "actor", event.Actor, "role", event.Role, "tenant", event.Tenant, "request_id", event.RequestID)
+	}
+	if a.store == nil {
+		return
+	}
+	if err := a.store.AppendAudit(event); err != nil {
+		a.logger.Error("Failed to append audit event", "action", action, "target", target, "actor", event.Actor, "request_id", event.RequestID, "error", err)
+	}
+}
+
+// list returns the events matching filter, newest first.
+func (a *auditor) list(filter storage.AuditFilter) ([]storage.AuditEvent, error) {
+	if a.store == nil {
+		return []storage.AuditEvent{}, nil
+	}
+	return a.store.ListAudit(filter)
+}
+
+// AuditLog returns a page of the audit events matching filter, newest first,
+// and the cursor of the next page, which is empty on the last page. Pass the
+// cursor as filter.Before to get the next page.
+func (s *Service) AuditLog(ctx context.Context, filter storage.AuditFilter) ([]storage.AuditEvent, string, error) {
+	if err := authorize(ctx, s.audit, ActionReadAudit); err != nil {
+		return nil, "", err
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if filter.Limit > maxAuditLimit {
+		filter.Limit = maxAuditLimit
+	}
+
+	// Ask for one more event to know whether there is a next page.
+	limit := filter.Limit
+	filter.Limit++
+	events, err := s.audit.list(filter)
+	if err != nil {
+		s.logger.Error("Failed to list audit events", "error", err)
+		return nil, "", fmt.Errorf("failed to list audit events: %w", err)
+	}
+	if len(events) > limit {
+		events = events[:limit]
+		return events, events[limit-1].ID, nil
+	}
+	return events, "", nil
+}
+
+// PurgeAuditLog deletes the audit events older than the configured
+// retention. It is run by a background job; a zero retention keeps events
+// forever.
+func (s *Service) PurgeAuditLog() {
+	if s.cfg.Audit.Retention <= 0 || s.audit.store == nil {
+		return
+	}
+	before := time.Now().Add(-s.cfg.Audit.Retention)
+	n, err := s.audit.store.PurgeAudit(before)
+	if err != nil {
+		s.logger.Error("Failed to purge audit log", "error", err)
+		return
+	}
+	if n > 0 {
+		s.logger.Info("Audit log purged", "events", n, "before", before.Format(time.RFC3339))
+		s.audit.record(context.Background(), AuditPurgeLog, "", OutcomeSuccess, nil, map[string]any{"before": before.UTC(), "events": n})
+	}
+}
+
+// auditID returns a unique id that sorts by time.
+func auditID(t time.Time) string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%016x%s", t.UnixNano(), hex.EncodeToString(b))
+}
+
+func auditValue(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// auditCreate records the creation of link.
+func (s *Service) auditCreate(ctx context.Context, link storage.Link) {
+	after := linkState{
+		URL:            link.URL,
+		Domain:         link.Domain,
+		Owner:          link.Owner,
+		Protected:      link.PasswordHash != "",
+		MaxClicks:      link.MaxClicks,
+		NotBefore:      link.NotBefore,
+		NotAfter:       link.NotAfter,
+		FallbackURL:    link.FallbackURL,
+		RedirectStatus: link.RedirectStatus,
+		Passthrough:    link.Passthrough,
+		UTM:            link.UTM,
+		Targets:        link.Targets,
+		Variants:       link.Variants,
+		Interstitial:   link.Interstitial,
+		Details:        link.Details,
+		Campaign:       link.Campaign,
+	}
+	if link.TTL > 0 {
+		after.ExpiresAt = time.Now().Add(link.TTL).UTC()
+	}
+	s.audit.record(ctx, AuditLinkCreate, linkTarget(link.Namespace, link.Code), OutcomeSuccess, nil, after)
+}
+
+// linkTarget names a link in audit events.
+func linkTarget(namespace, code string) string {
+	return "link:" + namespace + "/" + code
+}
+
+// linkState is the audited state of a link.
+type linkState struct {
+	URL            string              `json:"url"`
+	Domain         string              `json:"domain"`
+	Owner          string              `json:"owner,omitempty"`
+	ExpiresAt      time.Time           `json:"expiresAt,omitzero"`
+	Protected      bool                `json:"protected,omitempty"`
+	MaxClicks      int                 `json:"maxClicks,omitempty"`
+	NotBefore      time.Time           `json:"notBefore,omitzero"`
+	NotAfter       time.Time           `json:"notAfter,omitzero"`
+	FallbackURL    string              `json:"fallbackUrl,omitempty"`
+	RedirectStatus int                 `json:"redirectStatus,omitempty"`
+	Passthrough    string              `json:"passthrough,omitempty"`
+	UTM            common.UTM          `json:"utm,omitzero"`
+	Targets        []common.TargetRule `json:"targets,omitempty"`
+	Variants       []common.Variant    `json:"variants,omitempty"`
+	Interstitial   bool                `json:"interstitial,omitempty"`
+	Details        common.LinkDetails  `json:"details,omitzero"`
+	Campaign       string              `json:"campaign,omitempty"`
+}
+
+func stateOf(record storage.LinkRecord) linkState {
+	return linkState{
+		URL:            record.URL,
+		Domain:         record.Domain,
+		Owner:          record.Owner,
+		ExpiresAt:      record.ExpiresAt,
+		Protected:      record.PasswordHash != "",
+		MaxClicks:      record.MaxClicks,
+		NotBefore:      record.NotBefore,
+		NotAfter:       record.NotAfter,
+		FallbackURL:    record.FallbackURL,
+		RedirectStatus: record.RedirectStatus,
+		Passthrough:    record.Passthrough,
+		UTM:            record.UTM,
+		Targets:        record.Targets,
+		Variants:       record.Variants,
+		Interstitial:   record.Interstitial,
+		Details:        record.Details,
+		Campaign:       record.Campaign,
+	}
+}
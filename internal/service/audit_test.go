@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/auth"
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/requestid"
+	"github.com/parikshitg/urlshortener/internal/storage"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+)
+
+func TestService_AuditLog(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7, TopN: 3, Audit: config.AuditConfig{Retention: time.Hour}}
+	s := NewService(store, cfg, logger.New("error", "text"))
+
+	editor := requestid.NewContext(auth.NewContext(context.Background(), auth.Identity{Subject: "apikey:e", Tenant: "acme", Role: auth.RoleEditor}), "req-1")
+	viewer := auth.NewContext(context.Background(), auth.Identity{Subject: "apikey:v", Tenant: "acme", Role: auth.RoleViewer})
+	admin := auth.NewContext(context.Background(), auth.Identity{Subject: adminSubject, Tenant: adminSubject, Role: auth.RoleAdmin})
+
+	if _, err := s.Shorten(editor, "https://example.com", ShortenOptions{Alias: "promo"}); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if _, err := s.UpdateLink(editor, "", "promo", LinkUpdate{URL: "https://example.org"}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if _, err := s.Shorten(viewer, "https://example.com", ShortenOptions{}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden, got %v", err)
+	}
+	if err := s.DeleteLink(admin, "", "promo"); err != nil {
+		t.Fatalf("take down: %v", err)
+	}
+
+	if _, _, err := s.AuditLog(editor, storage.AuditFilter{}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected the audit log to be for admins, got %v", err)
+	}
+	events, next, err := s.AuditLog(admin, storage.AuditFilter{})
+	if err != nil || next != "" {
+		t.Fatalf("audit log: next=%q err=%v", next, err)
+	}
+	// newest first: the editor's denied read of the log, the takedown, the
+	// viewer's denied shorten, the update and the create
+	want := []struct{ action, actor, outcome string }{
+		{string(ActionReadAudit), "apikey:e", OutcomeDenied},
+		{AuditLinkTakeDown, adminSubject, OutcomeSuccess},
+		{string(ActionWriteLinks), "apikey:v", OutcomeDenied},
+		{AuditLinkUpdate, "apikey:e", OutcomeSuccess},
+		{AuditLinkCreate, "apikey:e", OutcomeSuccess},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected %d events, got %+v", len(want), events)
+	}
+	for i, w := range want {
+		if events[i].Action != w.action || events[i].Actor != w.actor || events[i].Outcome != w.outcome {
+			t.Errorf("event %d: expected %+v, got %+v", i, w, events[i])
+		}
+	}
+
+	update := events[3]
+	if update.RequestID != "req-1" || update.Tenant != "acme" || update.Role != "editor" || update.Target != "link:/promo" {
+		t.Errorf("expected the caller and target of the update, got %+v", update)
+	}
+	var before, after linkState
+	_ = json.Unmarshal(update.Before, &before)
+	_ = json.Unmarshal(update.After, &after)
+	if before.URL != "https://example.com" || after.URL != "https://example.org" {
+		t.Errorf("expected before and after urls, got %s and %s", update.Before, update.After)
+	}
+
+	// paging
+	page, next, _ := s.AuditLog(admin, storage.AuditFilter{Limit: 2})
+	if len(page) != 2 || next != page[1].ID {
+		t.Fatalf("expected a page of 2 and a cursor, got %d events, next=%q", len(page), next)
+	}
+	page, _, _ = s.AuditLog(admin, storage.AuditFilter{Limit: 2, Before: next})
+	if len(page) != 2 || page[0].ID != events[2].ID {
+		t.Fatalf("expected the second page, got %+v", page)
+	}
+	filtered, _, _ := s.AuditLog(admin, storage.AuditFilter{Action: AuditLinkUpdate})
+	if len(filtered) != 1 || filtered[0].ID != update.ID {
+		t.Fatalf("expected the update only, got %+v", filtered)
+	}
+
+	// events older than the retention are purged, and the purge is recorded
+	_ = store.AppendAudit(storage.AuditEvent{ID: "0", Time: time.Now().Add(-2 * time.Hour), Action: AuditLinkCreate})
+	s.PurgeAuditLog()
+	events, _, _ = s.AuditLog(admin, storage.AuditFilter{})
+	if len(events) != len(want)+1 || events[0].Action != AuditPurgeLog || events[len(events)-1].ID == "0" {
+		t.Fatalf("expected the old event to be purged, got %+v", events)
+	}
+}
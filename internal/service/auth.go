@@ -0,0 +1,275 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/auth"
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage"
+)
+
+const (
+	// apiKeyPrefix marks api key secrets, so they are recognizable in
+	// configuration and logs.
+	apiKeyPrefix = "usk_"
+
+	maxKeyNameLength = 100
+
+	// adminSubject is the subject and tenant of the bootstrap admin key.
+	adminSubject = "admin"
+)
+
+// AuthService authenticates callers and manages api keys.
+type AuthService struct {
+	store  storage.APIKeyStore
+	jwt    *auth.JWTVerifier
+	logger *logger.Logger
+	audit  *auditor
+	// adminHash is the hash of the bootstrap admin key, empty if none is configured.
+	adminHash string
+}
+
+// NewAuthService creates a new auth service. Bearer JWTs are accepted when
+// jwt is non-nil.
+func NewAuthService(store storage.APIKeyStore, jwt *auth.JWTVerifier, cfg *config.Config, logger *logger.Logger) *AuthService {
+	a := &AuthService{store: store, jwt: jwt, logger: logger, audit: newAuditor(store, logger)}
+	if cfg.Auth.AdminKey != "" {
+		a.adminHash = hashAPIKey(cfg.Auth.AdminKey)
+	}
+	return a
+}
+
+// Authenticate returns the identity of an api key or, if configured, a JWT.
+// It fails with auth.ErrInvalidCredentials for unknown and revoked keys and
+// for invalid tokens.
+func (a *AuthService) Authenticate(ctx context.Context, credential string) (auth.Identity, error) {
+	if credential == "" {
+		return auth.Identity{}, auth.ErrInvalidCredentials
+	}
+	if a.jwt != nil && auth.IsJWT(credential) {
+		id, err := a.jwt.Verify(credential)
+		if err != nil {
+			a.logger.Debug("Rejected bearer token", "error", err)
+			return auth.Identity{}, err
+		}
+		return id, nil
+	}
+
+	hash := hashAPIKey(credential)
+
+	if a.adminHash != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(a.adminHash)) == 1 {
+		return auth.Identity{Subject: adminSubject, Tenant: adminSubject, Role: auth.RoleAdmin, Scopes: auth.Scopes}, nil
+	}
+
+	key, ok, err := a.store.APIKeyByHash(hash)
+	if err != nil {
+		a.logger.Error("Failed to look up api key", "error", err)
+		return auth.Identity{}, fmt.Errorf("failed to look up api key: %w", err)
+	}
+	if !ok || key.Revoked() {
+		return auth.Identity{}, auth.ErrInvalidCredentials
+	}
+	role := auth.Role(key.Role)
+	if role == "" {
+		role = auth.DefaultRole
+	}
+	return auth.Identity{Subject: "apikey:" + key.ID, Tenant: key.Tenant, Role: role, Scopes: key.Scopes}, nil
+}
+
+// CreateAPIKey creates a key with the given role and scopes and returns it
+// together with its secret. The secret is only available here; just its hash
+// is stored. Keys act for tenant; without a tenant, the key is its own
+// tenant. Without a role, the key gets auth.DefaultRole.
+func (a *AuthService) CreateAPIKey(ctx context.Context, name, tenant string, role auth.Role, scopes []string) (storage.APIKey, string, error) {
+	if err := authorize(ctx, a.audit, ActionManageKeys); err != nil {
+		return storage.APIKey{}, "", err
+	}
+	if len(name) > maxKeyNameLength {
+		return storage.APIKey{}, "", fmt.Errorf("%w: longer than %d characters", ErrInvalidKeyName, maxKeyNameLength)
+	}
+	if role == "" {
+		role = auth.DefaultRole
+	}
+	if !auth.ValidRole(role) {
+		return storage.APIKey{}, "", fmt.Errorf("%w: %q", ErrInvalidRole, role)
+	}
+	if len(scopes) == 0 {
+		return storage.APIKey{}, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	var unique []string
+	for _, scope := range scopes {
+		if !auth.ValidScope(scope) {
+			return storage.APIKey{}, "", fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		if !slices.Contains(unique, scope) {
+			unique = append(unique, scope)
+		}
+	}
+
+	id, err := randomString(8)
+	if err != nil {
+		return storage.APIKey{}, "", err
+	}
+	if tenant == "" {
+		tenant = "apikey:" + id
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return storage.APIKey{}, "", err
+	}
+	secret = apiKeyPrefix + secret
+
+	key := storage.APIKey{
+		ID:        id,
+		Name:      name,
+		Hash:      hashAPIKey(secret),
+		Scopes:    unique,
+		Tenant:    tenant,
+		Role:      string(role),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := a.store.SaveAPIKey(key); err != nil {
+		a.logger.Error("Failed to save api key", "id", id, "error", err)
+		return storage.APIKey{}, "", fmt.Errorf("failed to save api key: %w", err)
+	}
+
+	a.audit.record(ctx, AuditKeyCreate, "key:"+id, OutcomeSuccess, nil, keyState{ID: id, Name: name, Tenant: tenant, Role: string(role), Scopes: unique})
+	a.logger.Info("API key created", "id", id, "name", name, "tenant", tenant, "role", string(role), "scopes", strings.Join(unique, ","), "by", subject(ctx))
+	return key, secret, nil
+}
+
+// ListAPIKeys returns all api keys, including revoked ones.
+func (a *AuthService) ListAPIKeys(ctx context.Context) ([]storage.APIKey, error) {
+	if err := authorize(ctx, a.audit, ActionManageKeys); err != nil {
+		return nil, err
+	}
+	keys, err := a.store.ListAPIKeys()
+	if err != nil {
+		a.logger.Error("Failed to list api keys", "error", err)
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes the key with the given id. Revoked keys stop
+// authenticating immediately.
+func (a *AuthService) RevokeAPIKey(ctx context.Context, id string) error {
+	if err := authorize(ctx, a.audit, ActionManageKeys); err != nil {
+		return err
+	}
+	if err := a.store.RevokeAPIKey(id, time.Now().UTC()); err != nil {
+		if errors.Is(err, storage.ErrAPIKeyNotFound) {
+			return fmt.Errorf("%w: %s", ErrAPIKeyNotFound, id)
+		}
+		a.logger.Error("Failed to revoke api key", "id", id, "error", err)
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+
+	a.audit.record(ctx, AuditKeyRevoke, "key:"+id, OutcomeSuccess, nil, nil)
+	a.logger.Info("API key revoked", "id", id, "by", subject(ctx))
+	return nil
+}
+
+// keyState is the audited state of an api key, without its hash.
+type keyState struct {
+	ID     string   `json:"id"`
+	Name   string   `json:"name,omitempty"`
+	Tenant string   `json:"tenant"`
+	Role   string   `json:"role"`
+	Scopes []string `json:"scopes"`
+}
+
+// NewJWTVerifier loads the token signing keys configured in cfg. It returns
+// nil if no key is configured.
+func NewJWTVerifier(cfg config.JWTConfig) (*auth.JWTVerifier, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	v := auth.NewJWTVerifier(auth.JWTOptions{
+		Issuer:      cfg.Issuer,
+		Audience:    cfg.Audience,
+		ScopeClaim:  cfg.ScopeClaim,
+		TenantClaim: cfg.TenantClaim,
+		RoleClaim:   cfg.RoleClaim,
+		Leeway:      cfg.Leeway,
+	})
+	if cfg.JWKSFile != "" {
+		data, err := os.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read jwks file: %w", err)
+		}
+		if err := v.AddJWKS(data); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.PublicKeyFile != "" {
+		data, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read jwt public key file: %w", err)
+		}
+		if err := v.AddPEM(data); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.HMACSecret != "" {
+		v.AddHMAC([]byte(cfg.HMACSecret))
+	}
+	return v, nil
+}
+
+// hashAPIKey returns the hex encoded sha256 of an api key secret. Secrets
+// are random, so a fast unsalted hash is sufficient.
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomString returns n random bytes, base64url encoded.
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// subject returns the subject of the caller in ctx, for logging.
+func subject(ctx context.Context) string {
+	if id, ok := auth.FromContext(ctx); ok {
+		return id.Subject
+	}
+	return ""
+}
+
+// tenant returns the tenant of the caller in ctx, which owns the links it
+// creates. It is empty without auth.
+func tenant(ctx context.Context) string {
+	if id, ok := auth.FromContext(ctx); ok {
+		return id.Tenant
+	}
+	return ""
+}
+
+// isAdmin reports whether the caller in ctx may access every tenant. Without
+// auth there is no tenant isolation, so every caller is.
+func isAdmin(ctx context.Context) bool {
+	id, ok := auth.FromContext(ctx)
+	return !ok || id.IsAdmin()
+}
+
+// canAccess reports whether the caller in ctx may access the links of owner.
+func canAccess(ctx context.Context, owner string) bool {
+	return isAdmin(ctx) || tenant(ctx) == owner
+}
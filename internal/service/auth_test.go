@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/auth"
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+)
+
+func TestAuthService_APIKeys(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewMemStore(0)
+	cfg := &config.Config{Auth: config.AuthConfig{Enabled: true, AdminKey: "bootstrap"}}
+	a := NewAuthService(store, nil, cfg, logger.New("error", "text"))
+
+	id, err := a.Authenticate(ctx, "bootstrap")
+	if err != nil || id.Subject != adminSubject || !id.HasScope(auth.ScopeKeysManage) {
+		t.Fatalf("expected admin identity, got %+v err=%v", id, err)
+	}
+
+	key, secret, err := a.CreateAPIKey(ctx, "ci", "", "", []string{auth.ScopeLinksWrite, auth.ScopeLinksWrite})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if !strings.HasPrefix(secret, apiKeyPrefix) || key.Hash == secret || key.Hash != hashAPIKey(secret) {
+		t.Fatalf("expected prefixed secret stored as hash, got secret=%q hash=%q", secret, key.Hash)
+	}
+	if len(key.Scopes) != 1 {
+		t.Fatalf("expected duplicate scopes removed, got %v", key.Scopes)
+	}
+
+	id, err = a.Authenticate(ctx, secret)
+	if err != nil || id.Subject != "apikey:"+key.ID || !id.HasScope(auth.ScopeLinksWrite) || id.HasScope(auth.ScopeMetricsRead) {
+		t.Fatalf("expected key identity, got %+v err=%v", id, err)
+	}
+
+	if err := a.RevokeAPIKey(ctx, key.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := a.Authenticate(ctx, secret); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("expected revoked key rejected, got %v", err)
+	}
+	if err := a.RevokeAPIKey(ctx, "missing"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Fatalf("expected ErrAPIKeyNotFound, got %v", err)
+	}
+
+	keys, err := a.ListAPIKeys(ctx)
+	if err != nil || len(keys) != 1 || !keys[0].Revoked() {
+		t.Fatalf("expected one revoked key, got %+v err=%v", keys, err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		scopes []string
+		err    error
+	}{
+		{"no scopes", nil, ErrInvalidScope},
+		{"unknown scope", []string{"links:delete"}, ErrInvalidScope},
+	} {
+		if _, _, err := a.CreateAPIKey(ctx, tc.name, "", "", tc.scopes); !errors.Is(err, tc.err) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.err, err)
+		}
+	}
+	if _, _, err := a.CreateAPIKey(ctx, strings.Repeat("x", maxKeyNameLength+1), "", "", []string{auth.ScopeLinksWrite}); !errors.Is(err, ErrInvalidKeyName) {
+		t.Errorf("expected ErrInvalidKeyName, got %v", err)
+	}
+
+	if _, err := a.Authenticate(ctx, "usk_unknown"); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Errorf("expected unknown key rejected, got %v", err)
+	}
+}
+
+func TestAuthService_APIKeyRoles(t *testing.T) {
+	store := memory.NewMemStore(0)
+	a := NewAuthService(store, nil, &config.Config{}, logger.New("error", "text"))
+	admin := auth.NewContext(context.Background(), auth.Identity{Subject: adminSubject, Tenant: adminSubject, Role: auth.RoleAdmin})
+
+	own, _, err := a.CreateAPIKey(admin, "own", "", "", []string{auth.ScopeLinksWrite})
+	if err != nil || own.Tenant != "apikey:"+own.ID || own.Role != string(auth.RoleEditor) {
+		t.Fatalf("expected editor key in its own tenant, got %+v err=%v", own, err)
+	}
+	if _, _, err := a.CreateAPIKey(admin, "root", "", "root", []string{auth.ScopeLinksWrite}); !errors.Is(err, ErrInvalidRole) {
+		t.Fatalf("expected ErrInvalidRole, got %v", err)
+	}
+	acme, secret, err := a.CreateAPIKey(admin, "acme", "acme", auth.RoleViewer, []string{auth.ScopeKeysManage})
+	if err != nil || acme.Tenant != "acme" {
+		t.Fatalf("expected acme key, got %+v err=%v", acme, err)
+	}
+
+	id, err := a.Authenticate(context.Background(), secret)
+	if err != nil || id.Tenant != "acme" || id.Role != auth.RoleViewer || id.IsAdmin() {
+		t.Fatalf("expected acme viewer identity, got %+v err=%v", id, err)
+	}
+	ctx := auth.NewContext(context.Background(), id)
+
+	// keys are managed by admins only, whatever the scopes of the key
+	if _, _, err := a.CreateAPIKey(ctx, "child", "", "", []string{auth.ScopeLinksWrite}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden creating a key, got %v", err)
+	}
+	if _, err := a.ListAPIKeys(ctx); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden listing keys, got %v", err)
+	}
+	if err := a.RevokeAPIKey(ctx, own.ID); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden revoking a key, got %v", err)
+	}
+	if keys, _ := a.ListAPIKeys(admin); len(keys) != 2 {
+		t.Fatalf("expected admin to list every key, got %+v", keys)
+	}
+
+	// keys saved before roles existed are editors
+	legacy := storage.APIKey{ID: "legacy", Hash: hashAPIKey("usk_legacy"), Scopes: []string{auth.ScopeLinksWrite}}
+	_ = store.SaveAPIKey(legacy)
+	if id, err := a.Authenticate(context.Background(), "usk_legacy"); err != nil || id.Role != auth.DefaultRole {
+		t.Fatalf("expected legacy key with the default role, got %+v err=%v", id, err)
+	}
+}
+
+func TestAuthService_JWT(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{Auth: config.AuthConfig{Enabled: true, JWT: config.JWTConfig{HMACSecret: "secret", Leeway: time.Minute}}}
+	jwt, err := NewJWTVerifier(cfg.Auth.JWT)
+	if err != nil || jwt == nil {
+		t.Fatalf("expected verifier, got %v err=%v", jwt, err)
+	}
+	a := NewAuthService(memory.NewMemStore(0), jwt, cfg, logger.New("error", "text"))
+
+	token := hs256(t, "secret", map[string]any{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix(), "scope": "links:write"})
+	id, err := a.Authenticate(ctx, token)
+	if err != nil || id.Subject != "jwt:alice" || !id.HasScope(auth.ScopeLinksWrite) {
+		t.Fatalf("expected jwt identity, got %+v err=%v", id, err)
+	}
+
+	forged := hs256(t, "other", map[string]any{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})
+	if _, err := a.Authenticate(ctx, forged); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("expected forged token rejected, got %v", err)
+	}
+
+	if v, err := NewJWTVerifier(config.JWTConfig{}); v != nil || err != nil {
+		t.Fatalf("expected no verifier without keys, got %v err=%v", v, err)
+	}
+	if _, err := NewJWTVerifier(config.JWTConfig{JWKSFile: "/does/not/exist.json"}); err == nil {
+		t.Fatalf("expected missing jwks file to fail")
+	}
+}
+
+// hs256 signs claims as an HS256 JWT.
+func hs256(t *testing.T, secret string, claims map[string]any) string {
+	t.Helper()
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshal claims: %v", err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
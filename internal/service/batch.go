@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+)
+
+const (
+	defaultBatchMaxItems    = 1000
+	defaultBatchConcurrency = 8
+)
+
+// BatchItem is one url of a ShortenBatch call.
+type BatchItem struct {
+	URL     string
+	Options ShortenOptions
+}
+
+// BatchResult is the outcome of the BatchItem at the same index.
+type BatchResult struct {
+	ShortURL string
+	Err      error
+}
+
+// ShortenBatch shortens all items and returns their results in input order.
+// Items are validated with bounded concurrency and the new links are written
+// in a single batch when the storage backend supports it.
+func (s *Service) ShortenBatch(ctx context.Context, items []BatchItem) ([]BatchResult, error) {
+	if err := authorize(ctx, s.audit, ActionWriteLinks); err != nil {
+		return nil, err
+	}
+	maxItems := s.cfg.Batch.MaxItems
+	if maxItems <= 0 {
+		maxItems = defaultBatchMaxItems
+	}
+	if len(items) > maxItems {
+		return nil, fmt.Errorf("%w: %d items (max %d)", ErrBatchTooLarge, len(items), maxItems)
+	}
+	concurrency := s.cfg.Batch.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+
+	s.logger.Info("Shortening batch", "items", len(items), "concurrency", concurrency)
+
+	results := make([]BatchResult, len(items))
+	links := make([]storage.Link, len(items))
+	claims := newCodeClaims(s.store)
+	claims.reserveAliases(s, items)
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, item := range items {
+		if err := ctx.Err(); err != nil {
+			results[i].Err = err
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, item BatchItem) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			claim := claims.claim
+			if item.Options.Alias != "" {
+				claim = claims.claimAlias
+			}
+			links[i], results[i].ShortURL, results[i].Err = s.prepare(ctx, item.URL, item.Options, claim)
+		}(i, item)
+	}
+	wg.Wait()
+
+	// Items sharing an alias were prepared concurrently, so the first of
+	// them in input order keeps it.
+	aliases := make(map[[2]string]bool)
+	for i, item := range items {
+		if results[i].Err != nil || item.Options.Alias == "" {
+			continue
+		}
+		key := [2]string{links[i].Namespace, links[i].Code}
+		if aliases[key] {
+			s.logger.Warn("Alias already taken", "alias", links[i].Code, "namespace", links[i].Namespace)
+			results[i].Err = fmt.Errorf("%w: %s", ErrCodeTaken, links[i].Code)
+			continue
+		}
+		aliases[key] = true
+	}
+
+	// Collect the new links, sharing one code between duplicate urls that
+	// would otherwise each get their own.
+	var pending []int
+	shared := make(map[[2]string]int)
+	sharing := make(map[int]int)
+	for i := range items {
+		if results[i].Err != nil || results[i].ShortURL != "" {
+			continue
+		}
+		link := links[i]
+		if items[i].Options.Alias == "" && link.Indexed() {
+			key := [2]string{link.Namespace, link.URL}
+			if first, ok := shared[key]; ok {
+				links[i] = links[first]
+				sharing[i] = first
+				continue
+			}
+			shared[key] = i
+		}
+		pending = append(pending, i)
+	}
+
+	toSave := make([]storage.Link, len(pending))
+	for j, i := range pending {
+		toSave[j] = links[i]
+	}
+	saveErrs := s.saveLinks(toSave)
+	for j, i := range pending {
+		if saveErrs[j] != nil {
+			results[i].Err = saveErrs[j]
+			continue
+		}
+		s.auditCreate(ctx, links[i])
+	}
+	// items sharing a link that was not saved fail with it
+	for i, first := range sharing {
+		results[i].Err = results[first].Err
+	}
+
+	failed := 0
+	for i := range items {
+		if results[i].Err != nil {
+			failed++
+			continue
+		}
+		if results[i].ShortURL == "" {
+			results[i].ShortURL = s.shortURL(links[i].Namespace, links[i].Code)
+		}
+	}
+
+	s.logger.Info("Batch shortened", "items", len(items), "saved", len(toSave), "failed", failed)
+	return results, nil
+}
+
+// saveLinks persists links, in one write if the store is a storage.BatchSaver,
+// and returns the error for each link. A code taken since it was claimed
+// fails the whole write, so the links are then saved one by one to fail
+// only the link that lost its code.
+func (s *Service) saveLinks(links []storage.Link) []error {
+	errs := make([]error, len(links))
+	if len(links) == 0 {
+		return errs
+	}
+
+	if bs, ok := s.store.(storage.BatchSaver); ok {
+		err := bs.SaveBatch(links)
+		if err == nil {
+			return errs
+		}
+		if !errors.Is(err, storage.ErrCodeExists) {
+			s.logger.Error("Failed to save batch", "links", len(links), "error", err)
+			for i := range errs {
+				errs[i] = fmt.Errorf("failed to save link: %w", err)
+			}
+			return errs
+		}
+		s.logger.Warn("Batch code taken, saving links one by one", "links", len(links))
+	}
+
+	for i, link := range links {
+		if err := s.store.Save(link); err != nil {
+			s.logger.Error("Failed to save link", "url", link.URL, "code", link.Code, "error", err)
+			if errors.Is(err, storage.ErrCodeExists) {
+				errs[i] = fmt.Errorf("%w: %s", ErrCodeTaken, link.Code)
+			} else {
+				errs[i] = fmt.Errorf("failed to save link: %w", err)
+			}
+		}
+	}
+	return errs
+}
+
+// codeClaims reserves codes for the links of one batch, so that concurrently
+// prepared items never pick the same code before anything is saved. The
+// aliases of the batch are reserved up front, so no generated code takes
+// them; items sharing an alias are settled in input order after preparing.
+type codeClaims struct {
+	mu      sync.Mutex
+	store   storage.Storage
+	claimed map[[2]string]bool
+}
+
+func newCodeClaims(store storage.Storage) *codeClaims {
+	return &codeClaims{store: store, claimed: make(map[[2]string]bool)}
+}
+
+// reserveAliases reserves the aliases of items.
+func (c *codeClaims) reserveAliases(s *Service, items []BatchItem) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, item := range items {
+		if item.Options.Alias == "" {
+			continue
+		}
+		if namespace, err := s.namespaceFor(item.Options.Domain); err == nil {
+			c.claimed[[2]string{namespace, item.Options.Alias}] = true
+		}
+	}
+}
+
+// claimAlias reports whether an alias of the batch is free in the store.
+func (c *codeClaims) claimAlias(namespace, code string) bool {
+	return !c.store.CodeExists(namespace, code)
+}
+
+// claim reports whether code is free in the namespace and reserves it.
+func (c *codeClaims) claim(namespace, code string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := [2]string{namespace, code}
+	if c.claimed[key] || c.store.CodeExists(namespace, code) {
+		return false
+	}
+	c.claimed[key] = true
+	return true
+}
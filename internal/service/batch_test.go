@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+)
+
+func TestService_ShortenBatch(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{
+		BaseURL:    "http://localhost:8080",
+		CodeLength: 7,
+		Batch:      config.BatchConfig{MaxItems: 10, Concurrency: 2},
+	}
+	service := NewService(store, cfg, logger.New("error", "text"))
+
+	if err := store.Save(storage.Link{URL: "https://taken.com", Code: "taken", Domain: "taken.com"}); err != nil {
+		t.Fatalf("failed to seed store: %v", err)
+	}
+
+	items := []BatchItem{
+		{URL: "https://example.com/a"},
+		{URL: "not-a-url"},
+		{URL: "https://example.com/b", Options: ShortenOptions{Alias: "promo"}},
+		{URL: "https://example.com/c", Options: ShortenOptions{Alias: "promo"}},
+		{URL: "https://example.com/a"},
+		{URL: "https://example.com/d", Options: ShortenOptions{Alias: "taken"}},
+		{URL: "https://example.com/e", Options: ShortenOptions{TTL: time.Minute}},
+	}
+
+	results, err := service.ShortenBatch(context.Background(), items)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(results) != len(items) {
+		t.Fatalf("Expected %d results, got %d", len(items), len(results))
+	}
+
+	if results[0].Err != nil || !strings.HasPrefix(results[0].ShortURL, "http://localhost:8080/") {
+		t.Errorf("item 0: unexpected result %+v", results[0])
+	}
+	if results[1].Err == nil {
+		t.Errorf("item 1: expected validation error")
+	}
+	if results[2].Err != nil || results[2].ShortURL != "http://localhost:8080/promo" {
+		t.Errorf("item 2: unexpected result %+v", results[2])
+	}
+	if !errors.Is(results[3].Err, ErrCodeTaken) {
+		t.Errorf("item 3: expected ErrCodeTaken for duplicate alias, got %v", results[3].Err)
+	}
+	if results[4].ShortURL != results[0].ShortURL {
+		t.Errorf("item 4: expected duplicate url to share %s, got %s", results[0].ShortURL, results[4].ShortURL)
+	}
+	if !errors.Is(results[5].Err, ErrCodeTaken) {
+		t.Errorf("item 5: expected ErrCodeTaken for stored alias, got %v", results[5].Err)
+	}
+	if results[6].Err != nil {
+		t.Errorf("item 6: unexpected error %v", results[6].Err)
+	}
+
+	code := strings.TrimPrefix(results[0].ShortURL, "http://localhost:8080/")
+	if got := store.GetURL("", code); got != "https://example.com/a" {
+		t.Errorf("Expected saved url https://example.com/a, got %q", got)
+	}
+	if got := store.GetURL("", "promo"); got != "https://example.com/b" {
+		t.Errorf("Expected alias to resolve to https://example.com/b, got %q", got)
+	}
+}
+
+func TestService_ShortenBatchTooLarge(t *testing.T) {
+	cfg := &config.Config{BaseURL: "http://localhost:8080", CodeLength: 7, Batch: config.BatchConfig{MaxItems: 1}}
+	service := NewService(memory.NewMemStore(time.Hour), cfg, logger.New("error", "text"))
+
+	_, err := service.ShortenBatch(context.Background(), []BatchItem{{URL: "https://a.com"}, {URL: "https://b.com"}})
+	if !errors.Is(err, ErrBatchTooLarge) {
+		t.Errorf("Expected ErrBatchTooLarge, got %v", err)
+	}
+}
+
+func TestService_SaveLinksCodeRace(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "http://localhost:8080", CodeLength: 7}
+	service := NewService(store, cfg, logger.New("error", "text"))
+
+	// a code saved after the batch claimed it
+	_ = store.Save(storage.Link{URL: "https://alice.com", Code: "raced", Domain: "alice.com", Owner: "alice"})
+	errs := service.saveLinks([]storage.Link{
+		{URL: "https://example.com/a", Code: "first", Domain: "example.com", Owner: "bob"},
+		{URL: "https://example.com/b", Code: "raced", Domain: "example.com", Owner: "bob"},
+	})
+	if errs[0] != nil || !errors.Is(errs[1], ErrCodeTaken) {
+		t.Fatalf("expected only the raced link to fail with ErrCodeTaken, got %v", errs)
+	}
+	if got := store.GetURL("", "first"); got != "https://example.com/a" {
+		t.Errorf("expected the other link saved, got %q", got)
+	}
+	if got := store.GetURL("", "raced"); got != "https://alice.com" {
+		t.Errorf("expected the raced code to keep its link, got %q", got)
+	}
+}
+
+// failingBatchStore fails every batch write.
+type failingBatchStore struct {
+	*memory.MemStore
+}
+
+func (failingBatchStore) SaveBatch([]storage.Link) error {
+	return errors.New("disk full")
+}
+
+func TestService_ShortenBatchSharedLinkFails(t *testing.T) {
+	cfg := &config.Config{BaseURL: "http://localhost:8080", CodeLength: 7}
+	service := NewService(failingBatchStore{memory.NewMemStore(time.Hour)}, cfg, logger.New("error", "text"))
+
+	results, err := service.ShortenBatch(context.Background(), []BatchItem{
+		{URL: "https://example.com/a"},
+		{URL: "https://example.com/a"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// the duplicate shares the link that was never saved
+	for i, result := range results {
+		if result.Err == nil || result.ShortURL != "" {
+			t.Errorf("item %d: expected the failed save, got %+v", i, result)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/parikshitg/urlshortener/internal/useragent"
+)
+
+// isBot reports whether visit comes from a bot: a link unfurler, uptime
+// checker or crawler. Bots are recognized by a User-Agent matching
+// Config.Bots.Patterns, HEAD requests, which only check the link, and
+// prefetches, which resolve it before anyone clicked.
+func (s *Service) isBot(visit Visit) bool {
+	if visit.Method == http.MethodHead {
+		return true
+	}
+	purpose := strings.ToLower(visit.Purpose)
+	if strings.Contains(purpose, "prefetch") || strings.Contains(purpose, "preview") {
+		return true
+	}
+	patterns := s.cfg.Bots.Patterns
+	if patterns == nil {
+		patterns = useragent.BotPatterns
+	}
+	return useragent.IsBot(visit.UserAgent, patterns)
+}
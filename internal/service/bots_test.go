@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+)
+
+func TestService_Bots(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7, TopN: 3}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+
+	if _, err := s.Shorten(ctx, "https://example.com", ShortenOptions{Alias: "app"}); err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	visits := []struct {
+		name  string
+		visit Visit
+		bot   bool
+	}{
+		{"browser", Visit{Code: "app", IP: "192.0.2.1", UserAgent: "Mozilla/5.0 (Windows NT 10.0; Win64; x64)"}, false},
+		{"no user agent", Visit{Code: "app", IP: "192.0.2.2"}, false},
+		{"slack", Visit{Code: "app", IP: "192.0.2.3", UserAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"}, true},
+		{"twitter", Visit{Code: "app", IP: "192.0.2.4", UserAgent: "Twitterbot/1.0"}, true},
+		{"facebook", Visit{Code: "app", IP: "192.0.2.5", UserAgent: "facebookexternalhit/1.1"}, true},
+		{"head", Visit{Code: "app", IP: "192.0.2.6", Method: http.MethodHead}, true},
+		{"prefetch", Visit{Code: "app", IP: "192.0.2.7", Purpose: "prefetch;prerender"}, true},
+	}
+	for _, tt := range visits {
+		if got := s.isBot(tt.visit); got != tt.bot {
+			t.Errorf("%s: expected bot %v, got %v", tt.name, tt.bot, got)
+		}
+		// bots are still redirected
+		if redirect, err := s.Resolve(ctx, tt.visit); err != nil || redirect.URL != "https://example.com" {
+			t.Fatalf("%s: expected a redirect, got %+v err=%v", tt.name, redirect, err)
+		}
+	}
+
+	stats, err := s.LinkStats(ctx, "", "app", false)
+	if err != nil || stats.Clicks != 2 || stats.Bots != nil {
+		t.Fatalf("expected 2 clicks without the bots, got %+v err=%v", stats, err)
+	}
+	if stats, _ = s.LinkStats(ctx, "", "app", true); stats.Clicks != 7 || stats.Bots == nil || stats.Bots.Clicks != 5 {
+		t.Fatalf("expected 7 clicks with 5 bots, got %+v", stats)
+	}
+	if a, _ := s.Analytics(ctx, "", "app", AnalyticsQuery{}); a.Clicks != 2 || a.Bots != 0 {
+		t.Fatalf("expected 2 clicks in the analytics, got %+v", a)
+	}
+	if a, _ := s.Analytics(ctx, "", "app", AnalyticsQuery{Bots: true}); a.Clicks != 7 || a.Bots != 5 {
+		t.Fatalf("expected 7 clicks with 5 bots in the analytics, got %+v", a)
+	}
+	if u, _ := s.LinkUniques(ctx, "", "app", UniquesQuery{}); u.Visitors != 2 {
+		t.Fatalf("expected only the 2 people as visitors, got %d", u.Visitors)
+	}
+
+	// the patterns are configurable
+	cfg.Bots.Patterns = []string{"mozilla"}
+	if !s.isBot(visits[0].visit) || s.isBot(visits[3].visit) {
+		t.Fatal("expected the configured patterns to replace the defaults")
+	}
+}
+
+func TestService_BotsUseClicks(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7, TopN: 3}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+
+	if _, err := s.Shorten(ctx, "https://example.com", ShortenOptions{Alias: "once", MaxClicks: 1}); err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	if _, err := s.Shorten(ctx, "https://example.com", ShortenOptions{Alias: "twice", MaxClicks: 1}); err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	// a HEAD request or a bot User-Agent cannot read the destination of a
+	// one-time link again and again
+	for _, visit := range []Visit{
+		{Code: "once", Method: http.MethodHead},
+		{Code: "twice", UserAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"},
+	} {
+		if _, err := s.Resolve(ctx, visit); err != nil {
+			t.Fatalf("expected %+v to be redirected, got %v", visit, err)
+		}
+		if link, _ := s.GetLink(ctx, "", visit.Code); link.ClicksLeft != 0 {
+			t.Fatalf("expected %+v to use the click, got %d left", visit, link.ClicksLeft)
+		}
+		for _, again := range []Visit{visit, {Code: visit.Code}} {
+			if _, err := s.Resolve(ctx, again); !errors.Is(err, ErrLinkExhausted) {
+				t.Fatalf("expected ErrLinkExhausted for %+v, got %v", again, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/storage"
+)
+
+const (
+	maxCampaignNameLength = 100
+
+	// defaultStatsDays is the range of campaign stats without bounds.
+	defaultStatsDays = 30
+	// maxStatsDays bounds the range of campaign stats, which lists every day.
+	maxStatsDays = 366
+
+	day = 24 * time.Hour
+)
+
+// CampaignOptions are the settings of a new campaign.
+type CampaignOptions struct {
+	Name string
+	// ExpiresAt ends the campaign, which is then deleted. Zero never ends it.
+	ExpiresAt time.Time
+	// Cascade deletes the links of the campaign when it ends; otherwise
+	// they are only moved out of it.
+	Cascade bool
+}
+
+// CampaignUpdate is a change of a campaign. Nil fields are kept.
+type CampaignUpdate struct {
+	Name *string
+	// ExpiresAt ends the campaign; the zero time keeps it forever.
+	ExpiresAt *time.Time
+	Cascade   *bool
+}
+
+// CampaignStats are the aggregated stats of the links of a campaign over a
+// range of UTC days.
+type CampaignStats struct {
+	Campaign string
+	// From and To are the first and the day after the last day of the range.
+	From time.Time
+	To   time.Time
+	// Links is the number of live links of the campaign.
+	Links int
+	// Created is the number of those links created in the range.
+	Created int
+	// Clicks is the number of their clicks in the range.
+	Clicks int64
+	// Days are the links created and clicked on each day of the range.
+	Days []DayStats
+}
+
+// DayStats are the links created and clicked on a UTC day.
+type DayStats struct {
+	// Day is formatted as storage.DayFormat.
+	Day     string
+	Created int
+	Clicks  int64
+}
+
+// CreateCampaign creates a campaign of the caller's tenant.
+func (s *Service) CreateCampaign(ctx context.Context, opts CampaignOptions) (storage.Campaign, error) {
+	if err := authorize(ctx, s.audit, ActionWriteLinks); err != nil {
+		return storage.Campaign{}, err
+	}
+	if s.campaigns == nil {
+		return storage.Campaign{}, ErrCampaignsUnsupported
+	}
+	id, err := randomString(8)
+	if err != nil {
+		return storage.Campaign{}, err
+	}
+	campaign := storage.Campaign{
+		ID:        id,
+		Name:      strings.TrimSpace(opts.Name),
+		Owner:     tenant(ctx),
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: opts.ExpiresAt.UTC(),
+		Cascade:   opts.Cascade,
+	}
+	if err := validateCampaign(campaign); err != nil {
+		return storage.Campaign{}, err
+	}
+	if err := s.campaigns.SaveCampaign(campaign); err != nil {
+		s.logger.Error("Failed to save campaign", "id", id, "error", err)
+		return storage.Campaign{}, fmt.Errorf("failed to save campaign: %w", err)
+	}
+
+	s.audit.record(ctx, AuditCampaignCreate, campaignTarget(id), OutcomeSuccess, nil, campaign)
+	s.logger.Info("Campaign created", "id", id, "name", campaign.Name, "caller", subject(ctx))
+	return campaign, nil
+}
+
+// GetCampaign returns the campaign with the given id. Campaigns of other
+// tenants are reported as not found, unless the caller is an admin.
+func (s *Service) GetCampaign(ctx context.Context, id string) (storage.Campaign, error) {
+	return s.ownedCampaign(ctx, id, ActionReadLinks)
+}
+
+// ListCampaigns returns the campaigns of the caller's tenant, or of all
+// tenants if all is set, which requires an admin.
+func (s *Service) ListCampaigns(ctx context.Context, all bool) ([]storage.Campaign, error) {
+	action := ActionReadLinks
+	if all {
+		action = ActionReadAllLinks
+	}
+	if err := authorize(ctx, s.audit, action); err != nil {
+		return nil, err
+	}
+	if s.campaigns == nil {
+		return []storage.Campaign{}, nil
+	}
+	campaigns, err := s.campaigns.ListCampaigns(tenant(ctx), all)
+	if err != nil {
+		s.logger.Error("Failed to list campaigns", "error", err)
+		return nil, fmt.Errorf("failed to list campaigns: %w", err)
+	}
+	now := time.Now()
+	live := campaigns[:0]
+	for _, campaign := range campaigns {
+		if !campaign.Expired(now) {
+			live = append(live, campaign)
+		}
+	}
+	return live, nil
+}
+
+// UpdateCampaign renames a campaign or changes when and how it ends.
+func (s *Service) UpdateCampaign(ctx context.Context, id string, update CampaignUpdate) (storage.Campaign, error) {
+	campaign, err := s.ownedCampaign(ctx, id, ActionWriteLinks)
+	if err != nil {
+		return storage.Campaign{}, err
+	}
+	before := campaign
+	if update.Name != nil {
+		campaign.Name = strings.TrimSpace(*update.Name)
+	}
+	if update.ExpiresAt != nil {
+		campaign.ExpiresAt = update.ExpiresAt.UTC()
+	}
+	if update.Cascade != nil {
+		campaign.Cascade = *update.Cascade
+	}
+	if err := validateCampaign(campaign); err != nil {
+		return storage.Campaign{}, err
+	}
+	if err := s.campaigns.SaveCampaign(campaign); err != nil {
+		s.logger.Error("Failed to update campaign", "id", id, "error", err)
+		return storage.Campaign{}, fmt.Errorf("failed to update campaign: %w", err)
+	}
+
+	s.audit.record(ctx, AuditCampaignUpdate, campaignTarget(id), OutcomeSuccess, before, campaign)
+	s.logger.Info("Campaign updated", "id", id, "caller", subject(ctx))
+	return campaign, nil
+}
+
+// DeleteCampaign deletes a campaign. With cascade its links are deleted
+// too, otherwise they are moved out of it.
+func (s *Service) DeleteCampaign(ctx context.Context, id string, cascade bool) error {
+	campaign, err := s.ownedCampaign(ctx, id, ActionWriteLinks)
+	if err != nil {
+		return err
+	}
+	return s.removeCampaign(ctx, campaign, cascade)
+}
+
+// PurgeCampaigns deletes the campaigns that ended, with their links if the
+// campaign cascades.
+func (s *Service) PurgeCampaigns() {
+	if s.campaigns == nil {
+		return
+	}
+	campaigns, err := s.campaigns.ListCampaigns("", true)
+	if err != nil {
+		s.logger.Error("Failed to list campaigns", "error", err)
+		return
+	}
+	now := time.Now()
+	for _, campaign := range campaigns {
+		if campaign.Expired(now) {
+			_ = s.removeCampaign(context.Background(), campaign, campaign.Cascade)
+		}
+	}
+}
+
+// CampaignStats returns the links created and clicked in a campaign from
+// the day of from until the day before to. Zero times default to the last
+// defaultStatsDays days. Clicks are counted per day, so the range is in
+// whole UTC days. The clicks of bots are only counted with bots.
+func (s *Service) CampaignStats(ctx context.Context, id string, from, to time.Time, bots bool) (CampaignStats, error) {
+	campaign, err := s.ownedCampaign(ctx, id, ActionReadMetrics)
+	if err != nil {
+		return CampaignStats{}, err
+	}
+	from, to, err = dayRange(from, to)
+	if err != nil {
+		return CampaignStats{}, err
+	}
+
+	links, err := s.campaignLinks(campaign)
+	if err != nil {
+		return CampaignStats{}, err
+	}
+	stats := CampaignStats{Campaign: campaign.ID, From: from, To: to, Links: len(links)}
+	index := make(map[string]int)
+	for d := from; d.Before(to); d = d.Add(day) {
+		index[d.Format(storage.DayFormat)] = len(stats.Days)
+		stats.Days = append(stats.Days, DayStats{Day: d.Format(storage.DayFormat)})
+	}
+	for _, link := range links {
+		if i, ok := index[link.CreatedAt.UTC().Format(storage.DayFormat)]; ok {
+			stats.Days[i].Created++
+			stats.Created++
+		}
+		if s.stats == nil {
+			continue
+		}
+		clicks, err := s.stats.LinkStats(link.Namespace, link.Code)
+		if err != nil {
+			s.logger.Error("Failed to read link stats", "code", link.Code, "namespace", link.Namespace, "error", err)
+			return CampaignStats{}, fmt.Errorf("failed to read link stats: %w", err)
+		}
+		if bots {
+			clicks = clicks.WithBots()
+		}
+		for d, n := range clicks.Days {
+			if i, ok := index[d]; ok {
+				stats.Days[i].Clicks += n
+				stats.Clicks += n
+			}
+		}
+	}
+	return stats, nil
+}
+
+// dayRange returns the whole UTC days from the day of from until the day
+// before to. Zero times default to the last defaultStatsDays days.
+func dayRange(from, to time.Time) (time.Time, time.Time, error) {
+	if to.IsZero() {
+		// include today
+		to = time.Now().Add(day)
+	}
+	to = to.UTC().Truncate(day)
+	if from.IsZero() {
+		from = to.Add(-defaultStatsDays * day)
+	}
+	from = from.UTC().Truncate(day)
+	if !to.After(from) {
+		return from, to, fmt.Errorf("%w: to must be at least a day after from", ErrInvalidRange)
+	}
+	if to.Sub(from) > maxStatsDays*day {
+		return from, to, fmt.Errorf("%w: at most %d days", ErrInvalidRange, maxStatsDays)
+	}
+	return from, to, nil
+}
+
+// campaignMetrics returns the top n domains of the links of a campaign.
+func (s *Service) campaignMetrics(ctx context.Context, id string, n int) ([]common.TopN, error) {
+	campaign, err := s.ownedCampaign(ctx, id, ActionReadMetrics)
+	if err != nil {
+		return nil, err
+	}
+	links, err := s.campaignLinks(campaign)
+	if err != nil {
+		return nil, err
+	}
+	hits := make(map[string]int)
+	for _, link := range links {
+		hits[link.Domain]++
+	}
+	domains := make([]string, 0, len(hits))
+	for domain := range hits {
+		domains = append(domains, domain)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		if hits[domains[i]] != hits[domains[j]] {
+			return hits[domains[i]] > hits[domains[j]]
+		}
+		return domains[i] < domains[j]
+	})
+	if n > len(domains) {
+		n = len(domains)
+	}
+	top := make([]common.TopN, n)
+	for i := range top {
+		top[i] = common.TopN{Rank: i + 1, Domain: domains[i], Shortened: hits[domains[i]]}
+	}
+	return top, nil
+}
+
+// removeCampaign deletes campaign and, with cascade, its links. Without
+// cascade the links are moved out of it.
+func (s *Service) removeCampaign(ctx context.Context, campaign storage.Campaign, cascade bool) error {
+	links, err := s.campaignLinks(campaign)
+	if err != nil {
+		return err
+	}
+	none := ""
+	for _, link := range links {
+		target := linkTarget(link.Namespace, link.Code)
+		if cascade {
+			err = s.store.DeleteLink(link.Namespace, link.Code)
+		} else {
+			err = s.store.UpdateLink(link.Namespace, link.Code, storage.LinkPatch{Campaign: &none})
+		}
+		if errors.Is(err, storage.ErrLinkNotFound) {
+			continue
+		}
+		if err != nil {
+			return s.linkError(err, link.Namespace, link.Code)
+		}
+		if cascade {
+			s.audit.record(ctx, AuditLinkDelete, target, OutcomeSuccess, stateOf(link), nil)
+		} else {
+			before := stateOf(link)
+			link.Campaign = ""
+			s.audit.record(ctx, AuditLinkUpdate, target, OutcomeSuccess, before, stateOf(link))
+		}
+	}
+
+	if err := s.campaigns.DeleteCampaign(campaign.ID); err != nil && !errors.Is(err, storage.ErrCampaignNotFound) {
+		s.logger.Error("Failed to delete campaign", "id", campaign.ID, "error", err)
+		return fmt.Errorf("failed to delete campaign: %w", err)
+	}
+	s.audit.record(ctx, AuditCampaignDelete, campaignTarget(campaign.ID), OutcomeSuccess, campaign, nil)
+	s.logger.Info("Campaign deleted", "id", campaign.ID, "links", len(links), "cascade", cascade, "caller", subject(ctx))
+	return nil
+}
+
+// campaignLinks returns the live links of campaign.
+func (s *Service) campaignLinks(campaign storage.Campaign) ([]storage.LinkRecord, error) {
+	links, err := s.store.ListLinks(storage.LinkFilter{Owner: campaign.Owner, Campaign: campaign.ID})
+	if err != nil {
+		s.logger.Error("Failed to list campaign links", "id", campaign.ID, "error", err)
+		return nil, fmt.Errorf("failed to list campaign links: %w", err)
+	}
+	return links, nil
+}
+
+// ownedCampaign authorizes action and looks up a live campaign the caller
+// may access.
+func (s *Service) ownedCampaign(ctx context.Context, id string, action Action) (storage.Campaign, error) {
+	if err := authorize(ctx, s.audit, action); err != nil {
+		return storage.Campaign{}, err
+	}
+	campaign, err := s.liveCampaign(id)
+	if err != nil {
+		return storage.Campaign{}, err
+	}
+	if !canAccess(ctx, campaign.Owner) {
+		return storage.Campaign{}, fmt.Errorf("%w: %s", ErrCampaignNotFound, id)
+	}
+	return campaign, nil
+}
+
+// campaignFor returns the live campaign a link of owner can be added to.
+func (s *Service) campaignFor(id, owner string) (storage.Campaign, error) {
+	campaign, err := s.liveCampaign(id)
+	if err != nil {
+		return storage.Campaign{}, err
+	}
+	if campaign.Owner != owner {
+		return storage.Campaign{}, fmt.Errorf("%w: %s", ErrCampaignNotFound, id)
+	}
+	return campaign, nil
+}
+
+// liveCampaign returns the campaign with the given id unless it ended.
+func (s *Service) liveCampaign(id string) (storage.Campaign, error) {
+	if s.campaigns == nil {
+		return storage.Campaign{}, ErrCampaignsUnsupported
+	}
+	campaign, ok, err := s.campaigns.GetCampaign(id)
+	if err != nil {
+		s.logger.Error("Failed to get campaign", "id", id, "error", err)
+		return storage.Campaign{}, fmt.Errorf("failed to get campaign: %w", err)
+	}
+	if !ok || campaign.Expired(time.Now()) {
+		return storage.Campaign{}, fmt.Errorf("%w: %s", ErrCampaignNotFound, id)
+	}
+	return campaign, nil
+}
+
+func validateCampaign(campaign storage.Campaign) error {
+	if campaign.Name == "" || utf8.RuneCountInString(campaign.Name) > maxCampaignNameLength {
+		return fmt.Errorf("%w: name must be 1-%d characters", ErrInvalidCampaign, maxCampaignNameLength)
+	}
+	if campaign.Expired(time.Now()) {
+		return fmt.Errorf("%w: expiresAt must be in the future", ErrInvalidCampaign)
+	}
+	return nil
+}
+
+func campaignTarget(id string) string { return "campaign:" + id }
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/auth"
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+)
+
+func TestService_Campaigns(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7, TopN: 3}
+	s := NewService(store, cfg, logger.New("error", "text"))
+
+	alice := auth.NewContext(context.Background(), auth.Identity{Subject: "apikey:a", Tenant: "alice", Role: auth.RoleEditor})
+	bob := auth.NewContext(context.Background(), auth.Identity{Subject: "apikey:b", Tenant: "bob", Role: auth.RoleEditor})
+
+	if _, err := s.CreateCampaign(alice, CampaignOptions{Name: " "}); !errors.Is(err, ErrInvalidCampaign) {
+		t.Fatalf("expected ErrInvalidCampaign for an empty name, got %v", err)
+	}
+	if _, err := s.CreateCampaign(alice, CampaignOptions{Name: "Old", ExpiresAt: time.Now().Add(-time.Hour)}); !errors.Is(err, ErrInvalidCampaign) {
+		t.Fatalf("expected ErrInvalidCampaign for a past end, got %v", err)
+	}
+	spring, err := s.CreateCampaign(alice, CampaignOptions{Name: "Spring"})
+	if err != nil || spring.Owner != "alice" || spring.ID == "" {
+		t.Fatalf("CreateCampaign failed: %+v err=%v", spring, err)
+	}
+	summer, _ := s.CreateCampaign(alice, CampaignOptions{Name: "Summer"})
+
+	if _, err := s.GetCampaign(bob, spring.ID); !errors.Is(err, ErrCampaignNotFound) {
+		t.Fatalf("expected other tenants not to see the campaign, got %v", err)
+	}
+	if _, err := s.Shorten(bob, "https://example.com", ShortenOptions{Campaign: spring.ID}); !errors.Is(err, ErrCampaignNotFound) {
+		t.Fatalf("expected other tenants not to add links to the campaign, got %v", err)
+	}
+	for _, alias := range []string{"a", "b"} {
+		if _, err := s.Shorten(alice, "https://example.com/"+alias, ShortenOptions{Alias: alias, Campaign: spring.ID}); err != nil {
+			t.Fatalf("Shorten failed: %v", err)
+		}
+	}
+	if _, err := s.Shorten(alice, "https://other.org/c", ShortenOptions{Alias: "c", Campaign: spring.ID}); err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	for range 2 {
+		if _, err := s.Resolve(alice, Visit{Code: "a"}); err != nil {
+			t.Fatalf("Resolve failed: %v", err)
+		}
+	}
+
+	stats, err := s.CampaignStats(alice, spring.ID, time.Time{}, time.Time{}, false)
+	if err != nil || stats.Links != 3 || stats.Created != 3 || stats.Clicks != 2 || len(stats.Days) != defaultStatsDays {
+		t.Fatalf("expected 3 links and 2 clicks over %d days, got %+v err=%v", defaultStatsDays, stats, err)
+	}
+	if today := stats.Days[len(stats.Days)-1]; today.Day != time.Now().UTC().Format(storage.DayFormat) || today.Clicks != 2 {
+		t.Fatalf("expected the clicks on the last day, got %+v", today)
+	}
+	yesterday := time.Now().Add(-day)
+	if stats, _ := s.CampaignStats(alice, spring.ID, yesterday.Add(-day), yesterday, false); stats.Created != 0 || stats.Clicks != 0 {
+		t.Fatalf("expected nothing before today, got %+v", stats)
+	}
+	if _, err := s.CampaignStats(alice, spring.ID, time.Now(), time.Now(), false); !errors.Is(err, ErrInvalidRange) {
+		t.Fatalf("expected ErrInvalidRange, got %v", err)
+	}
+
+	top, err := s.Metrics(alice, MetricsQuery{Campaign: spring.ID})
+	if err != nil || len(top) != 2 || top[0].Domain != "example.com" || top[0].Shortened != 2 {
+		t.Fatalf("expected the campaign domains, got %+v err=%v", top, err)
+	}
+
+	// links move between campaigns and out of them
+	link, err := s.UpdateLink(alice, "", "b", LinkUpdate{Campaign: &summer.ID})
+	if err != nil || link.Campaign != summer.ID {
+		t.Fatalf("expected the link to move, got %+v err=%v", link, err)
+	}
+	if links, _ := s.ListLinks(alice, LinkQuery{Campaign: spring.ID}); len(links) != 2 {
+		t.Fatalf("expected 2 links left in the campaign, got %+v", links)
+	}
+
+	if err := s.DeleteCampaign(alice, summer.ID, false); err != nil {
+		t.Fatalf("DeleteCampaign failed: %v", err)
+	}
+	if link, err := s.GetLink(alice, "", "b"); err != nil || link.Campaign != "" {
+		t.Fatalf("expected the link to be kept out of a campaign, got %+v err=%v", link, err)
+	}
+	if err := s.DeleteCampaign(alice, spring.ID, true); err != nil {
+		t.Fatalf("DeleteCampaign failed: %v", err)
+	}
+	if _, err := s.GetLink(alice, "", "a"); !errors.Is(err, ErrLinkNotFound) {
+		t.Fatalf("expected the links to be deleted with the campaign, got %v", err)
+	}
+	if campaigns, _ := s.ListCampaigns(alice, false); len(campaigns) != 0 {
+		t.Fatalf("expected no campaigns left, got %+v", campaigns)
+	}
+}
+
+func TestService_PurgeCampaigns(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+
+	ended := time.Now().Add(-time.Minute)
+	_ = store.SaveCampaign(storage.Campaign{ID: "keep", Name: "Keep", CreatedAt: ended, ExpiresAt: ended})
+	_ = store.SaveCampaign(storage.Campaign{ID: "cascade", Name: "Cascade", CreatedAt: ended, ExpiresAt: ended, Cascade: true})
+	_ = store.Save(storage.Link{URL: "https://example.com/a", Code: "a", Domain: "example.com", Campaign: "keep"})
+	_ = store.Save(storage.Link{URL: "https://example.com/b", Code: "b", Domain: "example.com", Campaign: "cascade"})
+
+	// ended campaigns are gone before they are purged
+	if _, err := s.GetCampaign(ctx, "keep"); !errors.Is(err, ErrCampaignNotFound) {
+		t.Fatalf("expected ErrCampaignNotFound, got %v", err)
+	}
+	s.PurgeCampaigns()
+	if campaigns, _ := store.ListCampaigns("", true); len(campaigns) != 0 {
+		t.Fatalf("expected the ended campaigns to be deleted, got %+v", campaigns)
+	}
+	if link, err := s.GetLink(ctx, "", "a"); err != nil || link.Campaign != "" {
+		t.Fatalf("expected the link to be moved out of the campaign, got %+v err=%v", link, err)
+	}
+	if _, err := s.GetLink(ctx, "", "b"); !errors.Is(err, ErrLinkNotFound) {
+		t.Fatalf("expected the link of the cascading campaign to be deleted, got %v", err)
+	}
+}
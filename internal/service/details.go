@@ -0,0 +1,65 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/parikshitg/urlshortener/internal/common"
+)
+
+// Limits of the details of a link.
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 1000
+	maxTags              = 20
+	maxTagLength         = 50
+	maxMetadataKeys      = 20
+	maxMetadataValue     = 500
+)
+
+var metadataKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,64}$`)
+
+// prepareDetails validates the details of a link and returns them with
+// trimmed text and lower-cased, sorted and deduplicated tags.
+func prepareDetails(details common.LinkDetails) (common.LinkDetails, error) {
+	details.Title = strings.TrimSpace(details.Title)
+	details.Description = strings.TrimSpace(details.Description)
+	switch {
+	case utf8.RuneCountInString(details.Title) > maxTitleLength:
+		return details, fmt.Errorf("%w: title must be at most %d characters", ErrInvalidDetails, maxTitleLength)
+	case utf8.RuneCountInString(details.Description) > maxDescriptionLength:
+		return details, fmt.Errorf("%w: description must be at most %d characters", ErrInvalidDetails, maxDescriptionLength)
+	case len(details.Tags) > maxTags:
+		return details, fmt.Errorf("%w: at most %d tags", ErrInvalidDetails, maxTags)
+	case len(details.Metadata) > maxMetadataKeys:
+		return details, fmt.Errorf("%w: at most %d metadata keys", ErrInvalidDetails, maxMetadataKeys)
+	}
+
+	var tags []string
+	for _, tag := range details.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		// tags are passed in query parameters, so they cannot hold a comma
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength || strings.Contains(tag, ",") {
+			return details, fmt.Errorf("%w: tags must be 1-%d characters without commas", ErrInvalidDetails, maxTagLength)
+		}
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+	details.Tags = slices.Compact(tags)
+
+	for key, value := range details.Metadata {
+		if !metadataKeyPattern.MatchString(key) {
+			return details, fmt.Errorf("%w: metadata key %q must be 1-64 letters, digits, '.', '-' or '_'", ErrInvalidDetails, key)
+		}
+		if utf8.RuneCountInString(value) > maxMetadataValue {
+			return details, fmt.Errorf("%w: metadata value of %q must be at most %d characters", ErrInvalidDetails, key, maxMetadataValue)
+		}
+	}
+	if len(details.Metadata) == 0 {
+		details.Metadata = nil
+	}
+	return details, nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+)
+
+func TestService_Details(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+
+	invalid := map[string]common.LinkDetails{
+		"long title":    {Title: strings.Repeat("a", 201)},
+		"empty tag":     {Tags: []string{" "}},
+		"comma tag":     {Tags: []string{"a,b"}},
+		"bad key":       {Metadata: map[string]string{"a b": "c"}},
+		"long value":    {Metadata: map[string]string{"a": strings.Repeat("v", 501)}},
+		"too many tags": {Tags: strings.Split(strings.Repeat("t,", 21), ",")},
+	}
+	for name, details := range invalid {
+		if _, err := s.Shorten(ctx, "https://example.com", ShortenOptions{Details: details}); !errors.Is(err, ErrInvalidDetails) {
+			t.Errorf("%s: expected ErrInvalidDetails, got %v", name, err)
+		}
+	}
+
+	_, err := s.Shorten(ctx, "https://example.com/sale", ShortenOptions{Alias: "sale", Details: common.LinkDetails{
+		Title:    " Spring Sale ",
+		Tags:     []string{"Promo", "spring", "promo"},
+		Metadata: map[string]string{"team": "growth"},
+	}})
+	if err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	if _, err := s.Shorten(ctx, "https://example.com/docs", ShortenOptions{Alias: "docs"}); err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	link, _ := s.GetLink(ctx, "", "sale")
+	want := common.LinkDetails{Title: "Spring Sale", Tags: []string{"promo", "spring"}, Metadata: map[string]string{"team": "growth"}}
+	if !reflect.DeepEqual(link.Details, want) {
+		t.Fatalf("expected trimmed and normalized details, got %+v", link.Details)
+	}
+
+	queries := map[string]LinkQuery{
+		"tag":      {Tag: "promo"},
+		"search":   {Search: "sale"},
+		"metadata": {Metadata: map[string]string{"team": "growth"}},
+	}
+	for name, query := range queries {
+		links, err := s.ListLinks(ctx, query)
+		if err != nil || len(links) != 1 || links[0].Code != "sale" {
+			t.Fatalf("%s: expected only the sale link, got %+v err=%v", name, links, err)
+		}
+	}
+
+	// updating the details keeps the url, and unset fields are kept
+	description := "Runs until May"
+	link, err = s.UpdateLink(ctx, "", "sale", LinkUpdate{Description: &description, Tags: []string{}})
+	if err != nil {
+		t.Fatalf("UpdateLink failed: %v", err)
+	}
+	if link.URL != "https://example.com/sale" || link.Details.Title != "Spring Sale" || link.Details.Description != description || link.Details.Tags != nil {
+		t.Fatalf("expected only the description and tags to change, got %+v", link)
+	}
+	link, err = s.UpdateLink(ctx, "", "sale", LinkUpdate{URL: "https://example.com/summer"})
+	if err != nil || link.URL != "https://example.com/summer" || link.Details.Description != description {
+		t.Fatalf("expected only the url to change, got %+v err=%v", link, err)
+	}
+	if _, err := s.UpdateLink(ctx, "", "sale", LinkUpdate{Metadata: map[string]string{"": "x"}}); !errors.Is(err, ErrInvalidDetails) {
+		t.Fatalf("expected ErrInvalidDetails, got %v", err)
+	}
+
+	// a failed update changes nothing, even the fields that were valid
+	title := "Autumn Sale"
+	if _, err := s.UpdateLink(ctx, "", "sale", LinkUpdate{Title: &title, URL: "not a url"}); err == nil {
+		t.Fatalf("expected an invalid url to fail the update")
+	}
+	if link, _ := s.GetLink(ctx, "", "sale"); link.Details.Title != "Spring Sale" || link.URL != "https://example.com/summer" {
+		t.Fatalf("expected the link to be kept, got %+v", link)
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/parikshitg/urlshortener/internal/validator"
+)
+
+var (
+	// ErrInvalidURL is returned when the url to shorten fails validation. The
+	// returned error is a *URLError carrying the validator's reason.
+	ErrInvalidURL = errors.New("invalid url")
+	// ErrDomainNotAllowed is returned when a link is requested on a short
+	// domain that is not configured.
+	ErrDomainNotAllowed = errors.New("domain not allowed")
+	// ErrInvalidAlias is returned when a custom alias is not a valid code.
+	ErrInvalidAlias = errors.New("invalid alias")
+	// ErrInvalidTTL is returned when a custom TTL is not positive.
+	ErrInvalidTTL = errors.New("invalid ttl")
+	// ErrCodeTaken is returned when a custom alias is already in use.
+	ErrCodeTaken = errors.New("code already taken")
+	// ErrBatchTooLarge is returned when a batch exceeds Config.Batch.MaxItems.
+	ErrBatchTooLarge = errors.New("batch too large")
+	// ErrInvalidScope is returned when an api key is requested with an
+	// unknown scope or without any scope.
+	ErrInvalidScope = errors.New("invalid scope")
+	// ErrInvalidRole is returned when an api key is requested with an
+	// unknown role.
+	ErrInvalidRole = errors.New("invalid role")
+	// ErrInvalidKeyName is returned when an api key name is too long.
+	ErrInvalidKeyName = errors.New("invalid api key name")
+	// ErrAPIKeyNotFound is returned when an api key id is unknown.
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrLinkNotFound is returned when a link does not exist, has expired or
+	// belongs to another tenant.
+	ErrLinkNotFound = errors.New("link not found")
+	// ErrForbidden is returned when the caller may not perform an operation.
+	ErrForbidden = errors.New("forbidden")
+	// ErrInvalidMaxClicks is returned when a click limit is negative.
+	ErrInvalidMaxClicks = errors.New("invalid max clicks")
+	// ErrLinkExhausted is returned when a click-limited link is resolved
+	// after its last click.
+	ErrLinkExhausted = errors.New("link clicks exhausted")
+	// ErrInvalidSchedule is returned when a link's activation window is
+	// empty or already over.
+	ErrInvalidSchedule = errors.New("invalid schedule")
+	// ErrLinkNotActive is returned when a scheduled link without fallback is
+	// resolved before its start time.
+	ErrLinkNotActive = errors.New("link not active yet")
+	// ErrInvalidRedirectStatus is returned when a link redirect status is
+	// not a redirect code.
+	ErrInvalidRedirectStatus = errors.New("invalid redirect status")
+	// ErrInvalidPassthrough is returned when a link passthrough mode is
+	// unknown.
+	ErrInvalidPassthrough = errors.New("invalid passthrough")
+	// ErrInvalidTargets is returned when the targeting rules of a link are
+	// invalid.
+	ErrInvalidTargets = errors.New("invalid targeting rules")
+	// ErrInvalidVariants is returned when the variants of a link are
+	// invalid.
+	ErrInvalidVariants = errors.New("invalid variants")
+	// ErrInvalidDetails is returned when the title, description, tags or
+	// metadata of a link are invalid.
+	ErrInvalidDetails = errors.New("invalid link details")
+	// ErrInvalidCampaign is returned when a campaign name or end is invalid.
+	ErrInvalidCampaign = errors.New("invalid campaign")
+	// ErrCampaignNotFound is returned when a campaign does not exist, has
+	// ended or belongs to another tenant.
+	ErrCampaignNotFound = errors.New("campaign not found")
+	// ErrCampaignsUnsupported is returned when the store does not keep
+	// campaigns.
+	ErrCampaignsUnsupported = errors.New("campaigns not supported by storage")
+	// ErrInvalidRange is returned when a stats time range is empty or too
+	// long, or an analytics interval is unknown.
+	ErrInvalidRange = errors.New("invalid time range")
+	// ErrInvalidPassword is returned when a link password is too long.
+	ErrInvalidPassword = errors.New("invalid password")
+	// ErrPasswordRequired is returned when a protected link is resolved
+	// without a password.
+	ErrPasswordRequired = errors.New("password required")
+	// ErrPasswordIncorrect is returned when a protected link is resolved
+	// with the wrong password.
+	ErrPasswordIncorrect = errors.New("password incorrect")
+	// ErrTooManyAttempts is returned when a client sent too many wrong
+	// passwords for a link.
+	ErrTooManyAttempts = errors.New("too many password attempts")
+)
+
+// URLError is returned when a url fails validation.
+type URLError struct {
+	Reason  validator.Reason
+	Message string
+}
+
+func (e *URLError) Error() string { return "URL validation failed: " + e.Message }
+
+// Unwrap makes errors.Is(err, ErrInvalidURL) match.
+func (e *URLError) Unwrap() error { return ErrInvalidURL }
@@ -0,0 +1,21 @@
+package service
+
+import (
+	"github.com/parikshitg/urlshortener/internal/geoip"
+	"github.com/parikshitg/urlshortener/internal/logger"
+)
+
+// openGeoIP opens the GeoIP database at path. Without one clicks are not
+// located, so a missing or invalid file is only logged.
+func openGeoIP(path string, logger *logger.Logger) *geoip.DB {
+	if path == "" {
+		return nil
+	}
+	db, err := geoip.Open(path)
+	if err != nil {
+		logger.Warn("GeoIP database unavailable, clicks are not located", "path", path, "error", err)
+		return nil
+	}
+	logger.Info("GeoIP database loaded", "path", path)
+	return db
+}
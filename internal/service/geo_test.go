@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/mmdbtest"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+)
+
+func TestService_ClickLocation(t *testing.T) {
+	w := mmdbtest.NewWriter("GeoIP2-City")
+	_ = w.Insert(netip.MustParsePrefix("81.2.69.0/24"), map[string]any{
+		"country":      map[string]any{"iso_code": "GB"},
+		"subdivisions": []any{map[string]any{"iso_code": "ENG"}},
+	})
+	_ = w.Insert(netip.MustParsePrefix("2a02:8100::/32"), map[string]any{"country": map[string]any{"iso_code": "DE"}})
+	buf, err := w.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "city.mmdb")
+	if err := os.WriteFile(path, buf, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7, TopN: 3, GeoIP: config.GeoIPConfig{Database: path}}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+
+	if _, err := s.Shorten(ctx, "https://example.com", ShortenOptions{Alias: "app"}); err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	for _, visit := range []Visit{
+		{Code: "app", Host: "sho.rt", IP: "81.2.69.142", Referrer: "https://News.ycombinator.com/item?id=1"},
+		{Code: "app", Host: "sho.rt", IP: "81.2.69.7", Referrer: "https://news.ycombinator.com:443/"},
+		{Code: "app", Host: "sho.rt", IP: "2a02:8100::1", Referrer: "android-app://com.slack/"},
+		{Code: "app", Host: "sho.rt:8080", IP: "10.0.0.1", Referrer: "http://sho.rt:8080/app"},
+		{Code: "app", Host: "sho.rt", IP: "192.0.2.1"},
+	} {
+		if _, err := s.Resolve(ctx, visit); err != nil {
+			t.Fatalf("Resolve failed: %v", err)
+		}
+	}
+
+	stats, err := s.LinkStats(ctx, "", "app", false)
+	if err != nil {
+		t.Fatalf("LinkStats failed: %v", err)
+	}
+	if want := map[string]int64{"news.ycombinator.com": 2, "com.slack": 1}; !reflect.DeepEqual(stats.Referrers, want) {
+		t.Errorf("expected referrers %v, got %v", want, stats.Referrers)
+	}
+	if want := map[string]int64{"GB": 2, "DE": 1}; !reflect.DeepEqual(stats.Countries, want) {
+		t.Errorf("expected countries %v, got %v", want, stats.Countries)
+	}
+	if want := map[string]int64{"GB-ENG": 2}; !reflect.DeepEqual(stats.Regions, want) {
+		t.Errorf("expected regions %v, got %v", want, stats.Regions)
+	}
+
+	// without the database clicks are still counted, just not located
+	cfg.GeoIP.Database = filepath.Join(t.TempDir(), "missing.mmdb")
+	s = NewService(store, cfg, logger.New("error", "text"))
+	if _, err := s.Resolve(ctx, Visit{Code: "app", IP: "81.2.69.142"}); err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if stats, _ := s.LinkStats(ctx, "", "app", false); stats.Clicks != 6 || stats.Countries["GB"] != 2 {
+		t.Fatalf("expected the click counted without a country, got %+v", stats)
+	}
+}
@@ -52,7 +52,7 @@ func (h *HealthService) Check(ctx context.Context) HealthResponse {
 
 	// Simple storage check - just try to access storage
 	start := time.Now()
-	h.storage.CodeExists("health-check")
+	h.storage.CodeExists("", "health-check")
 	duration := time.Since(start)
 
 	status := StatusHealthy
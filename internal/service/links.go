@@ -0,0 +1,291 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/storage"
+)
+
+// LinkInfo describes a stored link.
+type LinkInfo struct {
+	Code     string
+	ShortURL string
+	// URL is the original url.
+	URL string
+	// ShortDomain is the short domain the link was created on.
+	ShortDomain string
+	Owner       string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	// Protected is set when resolving the link requires a password.
+	Protected bool
+	// MaxClicks is the click limit, zero when unlimited.
+	MaxClicks int
+	// ClicksLeft is the number of resolves left of a click-limited link.
+	ClicksLeft int
+	// NotBefore and NotAfter bound the window in which the link redirects.
+	NotBefore time.Time
+	NotAfter  time.Time
+	// FallbackURL is redirected to outside the window.
+	FallbackURL string
+	// RedirectStatus is the status code the link redirects with.
+	RedirectStatus int
+	// Passthrough is what of the short url is passed on to URL, empty for
+	// nothing.
+	Passthrough string
+	// UTM are the utm parameters of the link, without the domain defaults.
+	UTM common.UTM
+	// Targets are the targeting rules of the link, tried in order.
+	Targets []common.TargetRule
+	// Variants are the weighted destinations of the link.
+	Variants []common.Variant
+	// Interstitial is set when the link shows a warning page before
+	// redirecting.
+	Interstitial bool
+	// Details are the title, description, tags and metadata of the link.
+	Details common.LinkDetails
+	// Campaign is the id of the campaign of the link, if any.
+	Campaign string
+}
+
+// LinkQuery selects the links returned by ListLinks.
+type LinkQuery struct {
+	// All returns the links of all tenants, which requires an admin.
+	All bool
+	// Tag only returns links with the tag.
+	Tag string
+	// Search only returns links whose code, url, title or description
+	// contain it.
+	Search string
+	// Metadata only returns links with all of these key/value pairs.
+	Metadata map[string]string
+	// Campaign only returns the links of the campaign with this id.
+	Campaign string
+}
+
+// LinkUpdate is a change of a link. Unset fields are kept.
+type LinkUpdate struct {
+	// URL is the new destination, unchanged when empty.
+	URL         string
+	Title       *string
+	Description *string
+	// Tags and Metadata replace those of the link when not nil; empty ones
+	// remove them.
+	Tags     []string
+	Metadata map[string]string
+	// Campaign moves the link to the campaign with this id when not nil;
+	// empty moves it out of its campaign.
+	Campaign *string
+}
+
+// GetLink returns the link for code on the short domain. Links of other
+// tenants are reported as not found, unless the caller is an admin.
+func (s *Service) GetLink(ctx context.Context, shortDomain, code string) (LinkInfo, error) {
+	record, err := s.ownedLink(ctx, shortDomain, code, ActionReadLinks)
+	if err != nil {
+		return LinkInfo{}, err
+	}
+	return s.linkInfo(record), nil
+}
+
+// ListLinks returns the links of the caller's tenant, or of all tenants if
+// query.All is set, matching query.
+func (s *Service) ListLinks(ctx context.Context, query LinkQuery) ([]LinkInfo, error) {
+	action := ActionReadLinks
+	if query.All {
+		action = ActionReadAllLinks
+	}
+	if err := authorize(ctx, s.audit, action); err != nil {
+		return nil, err
+	}
+
+	filter := storage.LinkFilter{
+		Owner:     tenant(ctx),
+		AllOwners: query.All,
+		Tag:       query.Tag,
+		Search:    query.Search,
+		Metadata:  query.Metadata,
+		Campaign:  query.Campaign,
+	}
+	records, err := s.store.ListLinks(filter)
+	if err != nil {
+		s.logger.Error("Failed to list links", "error", err)
+		return nil, fmt.Errorf("failed to list links: %w", err)
+	}
+
+	links := make([]LinkInfo, len(records))
+	for i, record := range records {
+		links[i] = s.linkInfo(record)
+	}
+	return links, nil
+}
+
+// Export returns the links of every tenant, oldest first.
+func (s *Service) Export(ctx context.Context) ([]LinkInfo, error) {
+	if err := authorize(ctx, s.audit, ActionExport); err != nil {
+		return nil, err
+	}
+
+	records, err := s.store.ListLinks(storage.LinkFilter{AllOwners: true})
+	if err != nil {
+		s.logger.Error("Failed to export links", "error", err)
+		return nil, fmt.Errorf("failed to export links: %w", err)
+	}
+	s.audit.record(ctx, AuditExport, "", OutcomeSuccess, nil, map[string]int{"links": len(records)})
+	s.logger.Info("Links exported", "count", len(records), "caller", subject(ctx))
+
+	links := make([]LinkInfo, len(records))
+	for i, record := range records {
+		links[i] = s.linkInfo(record)
+	}
+	return links, nil
+}
+
+// UpdateLink changes the destination or details of the link for code on
+// the short domain. Every change is validated first and then stored at
+// once, so a failed update leaves the link as it was.
+func (s *Service) UpdateLink(ctx context.Context, shortDomain, code string, update LinkUpdate) (LinkInfo, error) {
+	record, err := s.ownedLink(ctx, shortDomain, code, ActionWriteLinks)
+	if err != nil {
+		return LinkInfo{}, err
+	}
+	before := stateOf(record)
+
+	details := record.Details
+	if update.Title != nil {
+		details.Title = *update.Title
+	}
+	if update.Description != nil {
+		details.Description = *update.Description
+	}
+	if update.Tags != nil {
+		details.Tags = update.Tags
+	}
+	if update.Metadata != nil {
+		details.Metadata = update.Metadata
+	}
+	details, err = prepareDetails(details)
+	if err != nil {
+		return LinkInfo{}, err
+	}
+	normalized, domain := record.URL, record.Domain
+	if update.URL != "" {
+		if normalized, domain, err = s.normalize(update.URL); err != nil {
+			return LinkInfo{}, err
+		}
+	}
+	campaign := record.Campaign
+	if update.Campaign != nil && *update.Campaign != record.Campaign {
+		campaign = *update.Campaign
+		if campaign != "" {
+			if _, err := s.campaignFor(campaign, record.Owner); err != nil {
+				return LinkInfo{}, err
+			}
+		}
+	}
+
+	var patch storage.LinkPatch
+	if !reflect.DeepEqual(details, record.Details) {
+		patch.Details = &details
+	}
+	if campaign != record.Campaign {
+		patch.Campaign = &campaign
+	}
+	if update.URL != "" {
+		patch.URL, patch.Domain = &normalized, domain
+	}
+	if patch != (storage.LinkPatch{}) {
+		if err := s.store.UpdateLink(record.Namespace, code, patch); err != nil {
+			return LinkInfo{}, s.linkError(err, record.Namespace, code)
+		}
+		record.URL, record.Domain = normalized, domain
+		record.Details = details
+		record.Campaign = campaign
+	}
+	s.logger.Info("Link updated", "code", code, "namespace", record.Namespace, "url", record.URL, "caller", subject(ctx))
+
+	s.audit.record(ctx, AuditLinkUpdate, linkTarget(record.Namespace, code), OutcomeSuccess, before, stateOf(record))
+	return s.linkInfo(record), nil
+}
+
+// DeleteLink deletes the link for code on the short domain. Admins deleting
+// the link of another tenant take it down.
+func (s *Service) DeleteLink(ctx context.Context, shortDomain, code string) error {
+	record, err := s.ownedLink(ctx, shortDomain, code, ActionWriteLinks)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.DeleteLink(record.Namespace, code); err != nil {
+		return s.linkError(err, record.Namespace, code)
+	}
+	target := linkTarget(record.Namespace, code)
+	if record.Owner != tenant(ctx) {
+		s.audit.record(ctx, AuditLinkTakeDown, target, OutcomeSuccess, stateOf(record), nil)
+		s.logger.Info("Link taken down", "code", code, "namespace", record.Namespace, "owner", record.Owner, "caller", subject(ctx))
+		return nil
+	}
+	s.audit.record(ctx, AuditLinkDelete, target, OutcomeSuccess, stateOf(record), nil)
+	s.logger.Info("Link deleted", "code", code, "namespace", record.Namespace, "caller", subject(ctx))
+	return nil
+}
+
+// ownedLink authorizes action and looks up a link the caller may access.
+func (s *Service) ownedLink(ctx context.Context, shortDomain, code string, action Action) (storage.LinkRecord, error) {
+	if err := authorize(ctx, s.audit, action); err != nil {
+		return storage.LinkRecord{}, err
+	}
+	namespace, err := s.namespaceFor(shortDomain)
+	if err != nil {
+		return storage.LinkRecord{}, err
+	}
+	record, ok := s.store.GetLink(namespace, code)
+	if !ok || !canAccess(ctx, record.Owner) {
+		return storage.LinkRecord{}, fmt.Errorf("%w: %s", ErrLinkNotFound, code)
+	}
+	return record, nil
+}
+
+// linkError maps storage errors of link updates.
+func (s *Service) linkError(err error, namespace, code string) error {
+	if errors.Is(err, storage.ErrLinkNotFound) {
+		return fmt.Errorf("%w: %s", ErrLinkNotFound, code)
+	}
+	s.logger.Error("Failed to update link", "code", code, "namespace", namespace, "error", err)
+	return fmt.Errorf("failed to update link: %w", err)
+}
+
+func (s *Service) linkInfo(record storage.LinkRecord) LinkInfo {
+	shortDomain := record.Namespace
+	if shortDomain == "" {
+		shortDomain = s.defaultDomain()
+	}
+	return LinkInfo{
+		Code:           record.Code,
+		ShortURL:       s.shortURL(record.Namespace, record.Code),
+		URL:            record.URL,
+		ShortDomain:    shortDomain,
+		Owner:          record.Owner,
+		CreatedAt:      record.CreatedAt,
+		ExpiresAt:      record.ExpiresAt,
+		Protected:      record.PasswordHash != "",
+		MaxClicks:      record.MaxClicks,
+		ClicksLeft:     record.ClicksLeft,
+		NotBefore:      record.NotBefore,
+		NotAfter:       record.NotAfter,
+		FallbackURL:    record.FallbackURL,
+		RedirectStatus: s.redirectStatus(record),
+		Passthrough:    record.Passthrough,
+		UTM:            record.UTM,
+		Targets:        record.Targets,
+		Variants:       record.Variants,
+		Interstitial:   record.Interstitial,
+		Details:        record.Details,
+		Campaign:       record.Campaign,
+	}
+}
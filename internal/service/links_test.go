@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/auth"
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+)
+
+func TestService_TenantIsolation(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7, TopN: 3}
+	s := NewService(store, cfg, logger.New("error", "text"))
+
+	alice := auth.NewContext(context.Background(), auth.Identity{Subject: "apikey:a", Tenant: "alice", Role: auth.RoleEditor})
+	bob := auth.NewContext(context.Background(), auth.Identity{Subject: "apikey:b", Tenant: "bob", Role: auth.RoleEditor})
+	admin := auth.NewContext(context.Background(), auth.Identity{Subject: adminSubject, Tenant: adminSubject, Role: auth.RoleAdmin})
+
+	aliceURL, err := s.Shorten(alice, "https://example.com", ShortenOptions{})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	bobURL, err := s.Shorten(bob, "https://example.com", ShortenOptions{})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if aliceURL == bobURL {
+		t.Fatalf("expected tenants not to share a deduped code, got %s", aliceURL)
+	}
+	again, _ := s.Shorten(alice, "https://example.com", ShortenOptions{})
+	if again != aliceURL {
+		t.Fatalf("expected dedupe within a tenant, got %s and %s", aliceURL, again)
+	}
+	aliceCode := aliceURL[strings.LastIndexByte(aliceURL, '/')+1:]
+
+	link, err := s.GetLink(alice, "", aliceCode)
+	if err != nil || link.Owner != "alice" || link.URL != "https://example.com" {
+		t.Fatalf("expected alice's link, got %+v err=%v", link, err)
+	}
+	if _, err := s.GetLink(bob, "", aliceCode); !errors.Is(err, ErrLinkNotFound) {
+		t.Fatalf("expected other tenant's link to be not found, got %v", err)
+	}
+	if _, err := s.UpdateLink(bob, "", aliceCode, LinkUpdate{URL: "https://evil.com"}); !errors.Is(err, ErrLinkNotFound) {
+		t.Fatalf("expected update of other tenant's link to be not found, got %v", err)
+	}
+	if err := s.DeleteLink(bob, "", aliceCode); !errors.Is(err, ErrLinkNotFound) {
+		t.Fatalf("expected delete of other tenant's link to be not found, got %v", err)
+	}
+
+	links, _ := s.ListLinks(bob, LinkQuery{})
+	if len(links) != 1 || links[0].Owner != "bob" {
+		t.Fatalf("expected bob's link only, got %+v", links)
+	}
+	if _, err := s.ListLinks(bob, LinkQuery{All: true}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden listing all links, got %v", err)
+	}
+	links, _ = s.ListLinks(admin, LinkQuery{All: true})
+	if len(links) != 2 {
+		t.Fatalf("expected admin to list every link, got %+v", links)
+	}
+
+	top, _ := s.Metrics(bob, MetricsQuery{})
+	if len(top) != 1 || top[0].Shortened != 1 {
+		t.Fatalf("expected bob's metrics only, got %+v", top)
+	}
+	if _, err := s.Metrics(bob, MetricsQuery{Global: true}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("expected ErrForbidden for global metrics, got %v", err)
+	}
+	top, _ = s.Metrics(admin, MetricsQuery{Global: true})
+	if len(top) != 1 || top[0].Shortened != 2 {
+		t.Fatalf("expected global metrics, got %+v", top)
+	}
+
+	updated, err := s.UpdateLink(admin, "", aliceCode, LinkUpdate{URL: "https://example.org"})
+	if err != nil || updated.URL != "https://example.org" || updated.Owner != "alice" {
+		t.Fatalf("expected admin to update alice's link, got %+v err=%v", updated, err)
+	}
+	if err := s.DeleteLink(alice, "", aliceCode); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.GetLink(alice, "", aliceCode); !errors.Is(err, ErrLinkNotFound) {
+		t.Fatalf("expected deleted link to be not found, got %v", err)
+	}
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Passthrough modes select what of the short url a link passes on to its
+// destination.
+const (
+	// PassthroughNone ignores anything appended to the short url.
+	PassthroughNone = "none"
+	// PassthroughQuery merges the query of the short url into the
+	// destination query.
+	PassthroughQuery = "query"
+	// PassthroughPathQuery also appends the path after the code to the
+	// destination path.
+	PassthroughPathQuery = "path_query"
+)
+
+// mergeQuery appends the raw query extra to the raw query base, dropping the
+// parameters of base that extra sets again. Both keep their order and
+// encoding.
+func mergeQuery(base, extra string) string {
+	if extra == "" {
+		return base
+	}
+	override := queryNames(extra)
+	var pairs []string
+	for _, pair := range splitQuery(base) {
+		if !override[pairName(pair)] {
+			pairs = append(pairs, pair)
+		}
+	}
+	return strings.Join(append(pairs, extra), "&")
+}
+
+// fillQuery appends the parameters of the raw query extra that the raw query
+// base does not set yet.
+func fillQuery(base, extra string) string {
+	present := queryNames(base)
+	pairs := splitQuery(base)
+	for _, pair := range splitQuery(extra) {
+		if !present[pairName(pair)] {
+			pairs = append(pairs, pair)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// splitQuery splits a raw query into its non-empty key=value pairs.
+func splitQuery(query string) []string {
+	var pairs []string
+	for _, pair := range strings.Split(query, "&") {
+		if pair != "" {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs
+}
+
+// queryNames returns the set of parameter names of a raw query.
+func queryNames(query string) map[string]bool {
+	names := make(map[string]bool)
+	for _, pair := range splitQuery(query) {
+		names[pairName(pair)] = true
+	}
+	return names
+}
+
+// pairName returns the unescaped name of a key=value pair, or the raw name
+// if it cannot be unescaped.
+func pairName(pair string) string {
+	key, _, _ := strings.Cut(pair, "=")
+	if name, err := url.QueryUnescape(key); err == nil {
+		return name
+	}
+	return key
+}
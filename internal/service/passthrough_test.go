@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+)
+
+func TestService_Passthrough(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+
+	if _, err := s.Shorten(ctx, "https://example.com", ShortenOptions{Passthrough: "all"}); !errors.Is(err, ErrInvalidPassthrough) {
+		t.Fatalf("expected ErrInvalidPassthrough, got %v", err)
+	}
+	_, _ = s.Shorten(ctx, "https://example.com/docs?lang=en#intro", ShortenOptions{Alias: "none", Passthrough: PassthroughNone})
+	_, _ = s.Shorten(ctx, "https://example.com/docs?lang=en&utm_source=site#intro", ShortenOptions{Alias: "query", Passthrough: PassthroughQuery})
+	_, _ = s.Shorten(ctx, "https://example.com/docs/?lang=en#intro", ShortenOptions{Alias: "path", Passthrough: PassthroughPathQuery})
+	if link, _ := s.GetLink(ctx, "", "none"); link.Passthrough != "" {
+		t.Fatalf("expected no passthrough to be stored as empty, got %q", link.Passthrough)
+	}
+
+	tests := []struct {
+		name  string
+		visit Visit
+		url   string
+		err   error
+	}{
+		{"none ignores the query", Visit{Code: "none", Query: "utm_source=mail"}, "https://example.com/docs?lang=en#intro", nil},
+		{"none has no subpaths", Visit{Code: "none", Path: "/v2"}, "", ErrLinkNotFound},
+		{"query merges before the fragment", Visit{Code: "query", Query: "ref=a%20b"}, "https://example.com/docs?lang=en&utm_source=site&ref=a%20b#intro", nil},
+		{"query replaces parameters", Visit{Code: "query", Query: "utm_source=mail&utm_source=news"}, "https://example.com/docs?lang=en&utm_source=mail&utm_source=news#intro", nil},
+		{"query has no subpaths", Visit{Code: "query", Path: "/v2"}, "", ErrLinkNotFound},
+		{"path and query", Visit{Code: "path", Path: "/v2/api", Query: "lang=de"}, "https://example.com/docs/v2/api?lang=de#intro", nil},
+		{"path cannot climb", Visit{Code: "path", Path: "/../../admin"}, "https://example.com/docs/admin?lang=en#intro", nil},
+		{"merged url is validated", Visit{Code: "query", Query: "next=javascript:alert(1)"}, "", ErrInvalidURL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirect, err := s.Resolve(ctx, tt.visit)
+			if redirect.URL != tt.url || !errors.Is(err, tt.err) {
+				t.Errorf("expected %q, %v; got %q, %v", tt.url, tt.err, redirect.URL, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/parikshitg/urlshortener/internal/auth"
+)
+
+// Action is an operation gated by the policy.
+type Action string
+
+const (
+	ActionReadLinks      Action = "links.read"
+	ActionWriteLinks     Action = "links.write"
+	ActionReadAllLinks   Action = "links.read_all"
+	ActionReadMetrics    Action = "metrics.read"
+	ActionReadAllMetrics Action = "metrics.read_all"
+	ActionManageKeys     Action = "keys.manage"
+	ActionPurge          Action = "storage.purge"
+	ActionExport         Action = "links.export"
+	ActionReadAudit      Action = "audit.read"
+)
+
+// policy is the least privileged role allowed to perform each action.
+// Viewers read their tenant's links and stats, editors manage their
+// tenant's links and admins do everything, across tenants. Only admins can
+// reach the links of other tenants, so changing or deleting one is a
+// takedown.
+var policy = map[Action]auth.Role{
+	ActionReadLinks:      auth.RoleViewer,
+	ActionReadMetrics:    auth.RoleViewer,
+	ActionWriteLinks:     auth.RoleEditor,
+	ActionReadAllLinks:   auth.RoleAdmin,
+	ActionReadAllMetrics: auth.RoleAdmin,
+	ActionManageKeys:     auth.RoleAdmin,
+	ActionPurge:          auth.RoleAdmin,
+	ActionExport:         auth.RoleAdmin,
+	ActionReadAudit:      auth.RoleAdmin,
+}
+
+// authorize returns ErrForbidden if the caller in ctx may not perform
+// action. Denials are written to the audit log. Without auth there is no
+// caller and every action is allowed.
+func authorize(ctx context.Context, audit *auditor, action Action) error {
+	id, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	min, known := policy[action]
+	if known && id.Role.Includes(min) {
+		return nil
+	}
+
+	audit.record(ctx, string(action), "", OutcomeDenied, nil, nil)
+	return fmt.Errorf("%w: %s requires the %s role", ErrForbidden, action, min)
+}
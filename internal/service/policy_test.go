@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/auth"
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+)
+
+func TestService_Policy(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7, TopN: 3}
+	s := NewService(store, cfg, logger.New("error", "text"))
+
+	as := func(role auth.Role) context.Context {
+		return auth.NewContext(context.Background(), auth.Identity{Subject: "apikey:" + string(role), Tenant: "acme", Role: role})
+	}
+	if _, err := s.Shorten(as(auth.RoleEditor), "https://example.com", ShortenOptions{Alias: "promo"}); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	operations := []struct {
+		name string
+		min  auth.Role
+		call func(ctx context.Context) error
+	}{
+		{"read metrics", auth.RoleViewer, func(ctx context.Context) error { _, err := s.Metrics(ctx, MetricsQuery{}); return err }},
+		{"read link", auth.RoleViewer, func(ctx context.Context) error { _, err := s.GetLink(ctx, "", "promo"); return err }},
+		{"list links", auth.RoleViewer, func(ctx context.Context) error { _, err := s.ListLinks(ctx, LinkQuery{}); return err }},
+		{"shorten", auth.RoleEditor, func(ctx context.Context) error {
+			_, err := s.Shorten(ctx, "https://example.org", ShortenOptions{})
+			return err
+		}},
+		{"shorten batch", auth.RoleEditor, func(ctx context.Context) error {
+			_, err := s.ShortenBatch(ctx, []BatchItem{{URL: "https://example.net"}})
+			return err
+		}},
+		{"update link", auth.RoleEditor, func(ctx context.Context) error {
+			_, err := s.UpdateLink(ctx, "", "promo", LinkUpdate{URL: "https://example.com/spring"})
+			return err
+		}},
+		{"global metrics", auth.RoleAdmin, func(ctx context.Context) error { _, err := s.Metrics(ctx, MetricsQuery{Global: true}); return err }},
+		{"list all links", auth.RoleAdmin, func(ctx context.Context) error { _, err := s.ListLinks(ctx, LinkQuery{All: true}); return err }},
+		{"export", auth.RoleAdmin, func(ctx context.Context) error { _, err := s.Export(ctx); return err }},
+		{"purge", auth.RoleAdmin, func(ctx context.Context) error { return s.Purge(ctx) }},
+	}
+	for _, op := range operations {
+		for _, role := range auth.Roles {
+			err := op.call(as(role))
+			if role.Includes(op.min) && err != nil {
+				t.Errorf("%s as %s: unexpected error %v", op.name, role, err)
+			}
+			if !role.Includes(op.min) && !errors.Is(err, ErrForbidden) {
+				t.Errorf("%s as %s: expected ErrForbidden, got %v", op.name, role, err)
+			}
+		}
+	}
+
+	if _, err := s.Shorten(as(""), "https://example.com", ShortenOptions{}); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected callers without a role to be denied, got %v", err)
+	}
+	if err := s.Purge(context.Background()); err != nil {
+		t.Errorf("expected every operation to be allowed without auth, got %v", err)
+	}
+
+	// admins take down the links of other tenants
+	other := auth.NewContext(context.Background(), auth.Identity{Subject: "apikey:other", Tenant: "globex", Role: auth.RoleAdmin})
+	if err := s.DeleteLink(other, "", "promo"); err != nil {
+		t.Fatalf("take down: %v", err)
+	}
+	if _, err := s.GetLink(as(auth.RoleViewer), "", "promo"); !errors.Is(err, ErrLinkNotFound) {
+		t.Errorf("expected taken down link to be gone, got %v", err)
+	}
+}
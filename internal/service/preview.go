@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+	"github.com/parikshitg/urlshortener/pkg/qr"
+)
+
+// previewQRSize is the size in pixels of the QR code on preview pages.
+const previewQRSize = 200
+
+// Preview describes a link on its preview page.
+type Preview struct {
+	Code     string
+	ShortURL string
+	// URL is where the link redirects visitors by default and Domain its
+	// host. URL is empty for click-limited links.
+	URL    string
+	Domain string
+	// CreatedAt is when the link was created.
+	CreatedAt time.Time
+	// Varies is set when targeting rules or variants may send visitors
+	// elsewhere.
+	Varies bool
+	// QR is a PNG QR code of ShortURL.
+	QR []byte
+}
+
+// Preview returns the preview of the link visit resolves to, without
+// redirecting or counting a click. Links that would not redirect visit
+// fail like in Resolve, and protected links need their password. Previews
+// of click-limited links only show the domain, since they use no click, so
+// a preview never reveals more than the redirect would.
+func (s *Service) Preview(ctx context.Context, visit Visit) (Preview, error) {
+	namespace := s.namespaceForHost(visit.Host)
+	record, ok := s.store.GetLink(namespace, visit.Code)
+	if !ok {
+		return Preview{}, fmt.Errorf("%w: %s", ErrLinkNotFound, visit.Code)
+	}
+
+	dest := record.URL
+	if fallback, outside, err := s.outsideWindow(record, time.Now()); outside {
+		if err != nil {
+			return Preview{}, err
+		}
+		dest = fallback
+	} else {
+		if record.PasswordHash != "" {
+			if err := s.checkPassword(record, visit); err != nil {
+				return Preview{}, err
+			}
+		}
+		if record.MaxClicks > 0 && record.ClicksLeft <= 0 {
+			return Preview{}, fmt.Errorf("%w: %s", ErrLinkExhausted, record.Code)
+		}
+		// the url as tagged on redirect, without anything of the visit
+		tagged, err := s.destination(record, record.URL, Visit{})
+		if err != nil {
+			return Preview{}, err
+		}
+		dest = tagged
+	}
+	domain := hostname(dest)
+	if record.MaxClicks > 0 {
+		dest = ""
+	}
+
+	shortURL := s.shortURL(namespace, record.Code)
+	img, err := qr.PNG(shortURL, previewQRSize)
+	if err != nil {
+		s.logger.Error("Failed to generate preview QR code", "code", record.Code, "namespace", namespace, "error", err)
+		return Preview{}, fmt.Errorf("failed to generate QR code: %w", err)
+	}
+	return Preview{
+		Code:      record.Code,
+		ShortURL:  shortURL,
+		URL:       dest,
+		Domain:    domain,
+		CreatedAt: record.CreatedAt,
+		Varies:    len(record.Targets) > 0 || len(record.Variants) > 0,
+		QR:        img,
+	}, nil
+}
+
+// interstitial reports whether record shows the interstitial page before
+// redirecting to dest: when the link or Config.Preview asks for it and the
+// host of dest is not on Config.Preview.Allowlist.
+func (s *Service) interstitial(record storage.LinkRecord, dest string) bool {
+	if !record.Interstitial && !s.cfg.Preview.Interstitial {
+		return false
+	}
+	host := hostname(dest)
+	for _, allowed := range s.cfg.Preview.Allowlist {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return false
+		}
+	}
+	return true
+}
+
+// hostname returns the lower-cased host of rawURL without port.
+func hostname(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+)
+
+func TestService_Preview(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+
+	_, _ = s.Shorten(ctx, "https://example.com/sale", ShortenOptions{Alias: "sale", UTM: common.UTM{Source: "news"}, MaxClicks: 1})
+	_, _ = s.Shorten(ctx, "https://example.com/secret", ShortenOptions{Alias: "secret", Password: "hunter2"})
+	_, _ = s.Shorten(ctx, "https://example.com/docs", ShortenOptions{Alias: "docs", UTM: common.UTM{Source: "news"}})
+
+	preview, err := s.Preview(ctx, Visit{Code: "docs", Query: "preview=1"})
+	if err != nil || preview.URL != "https://example.com/docs?utm_source=news" || preview.Domain != "example.com" {
+		t.Fatalf("expected the tagged destination without the visit query, got %+v err=%v", preview, err)
+	}
+
+	for range 2 {
+		preview, err := s.Preview(ctx, Visit{Code: "sale", Query: "preview=1"})
+		if err != nil {
+			t.Fatalf("Preview failed: %v", err)
+		}
+		// the destination of a one-time link is left out
+		if preview.URL != "" || preview.Domain != "example.com" || preview.ShortURL != "https://sho.rt/sale" {
+			t.Fatalf("expected only the domain of the one-time link, got %s on %s", preview.URL, preview.Domain)
+		}
+		if preview.CreatedAt.IsZero() || !bytes.HasPrefix(preview.QR, []byte("\x89PNG")) {
+			t.Fatalf("expected the creation time and a png QR code, got %+v", preview)
+		}
+	}
+	// previews use no clicks
+	if _, err := s.Resolve(ctx, Visit{Code: "sale"}); err != nil {
+		t.Fatalf("expected the one-time link to still redirect, got %v", err)
+	}
+	if _, err := s.Preview(ctx, Visit{Code: "sale"}); !errors.Is(err, ErrLinkExhausted) {
+		t.Fatalf("expected ErrLinkExhausted, got %v", err)
+	}
+
+	if _, err := s.Preview(ctx, Visit{Code: "secret"}); !errors.Is(err, ErrPasswordRequired) {
+		t.Fatalf("expected the destination of a protected link to need the password, got %v", err)
+	}
+	if preview, err := s.Preview(ctx, Visit{Code: "secret", Password: "hunter2"}); err != nil || preview.URL != "https://example.com/secret" {
+		t.Fatalf("expected the preview with the password, got %+v err=%v", preview, err)
+	}
+	if _, err := s.Preview(ctx, Visit{Code: "missing"}); !errors.Is(err, ErrLinkNotFound) {
+		t.Fatalf("expected ErrLinkNotFound, got %v", err)
+	}
+}
+
+func TestService_Interstitial(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7, Preview: config.PreviewConfig{Allowlist: []string{"example.com"}}}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+
+	_, _ = s.Shorten(ctx, "https://docs.example.com", ShortenOptions{Alias: "docs", Interstitial: true})
+	_, _ = s.Shorten(ctx, "https://elsewhere.net", ShortenOptions{Alias: "away", Interstitial: true})
+	_, _ = s.Shorten(ctx, "https://other.org", ShortenOptions{Alias: "plain"})
+
+	tests := []struct {
+		code         string
+		global       bool
+		interstitial bool
+	}{
+		{"docs", false, false},
+		{"away", false, true},
+		{"plain", false, false},
+		{"plain", true, true},
+		{"docs", true, false},
+	}
+	for _, tt := range tests {
+		cfg.Preview.Interstitial = tt.global
+		redirect, err := s.Resolve(ctx, Visit{Code: tt.code})
+		if err != nil || redirect.Interstitial != tt.interstitial {
+			t.Errorf("%s (global %v): expected interstitial %v, got %+v err=%v", tt.code, tt.global, tt.interstitial, redirect, err)
+		}
+	}
+}
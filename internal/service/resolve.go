@@ -0,0 +1,313 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/storage"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// maxPasswordLength is the longest password bcrypt can hash.
+	maxPasswordLength       = 72
+	defaultPasswordAttempts = 5
+	defaultPasswordWindow   = 15 * time.Minute
+)
+
+// Visit is a request to resolve a short link.
+type Visit struct {
+	// Host is the request host, which selects the namespace.
+	Host string
+	Code string
+	// Password is the password submitted for a protected link.
+	Password string
+	// IP is the client address. Wrong passwords are counted per link and IP.
+	IP string
+	// Path is the rest of the short url path after the code and Query its
+	// raw query, passed on to links that allow it.
+	Path  string
+	Query string
+	// UserAgent and AcceptLanguage are the request headers targeting rules
+	// are matched against.
+	UserAgent      string
+	AcceptLanguage string
+	// Variant is the variant the client was assigned on an earlier visit.
+	Variant string
+	// Method is the request method and Purpose the prefetch header, if
+	// any, which tell bots apart from people.
+	Method  string
+	Purpose string
+	// Referrer is the Referer header, counted by host in the link stats.
+	Referrer string
+}
+
+// Redirect is where a resolved link sends the client.
+type Redirect struct {
+	URL string
+	// Status is the redirect status code.
+	Status int
+	// MaxAge is how long clients may cache the redirect; zero forbids it.
+	MaxAge time.Duration
+	// Variant is the variant the client was assigned, to be sent back on
+	// the next visit.
+	Variant string
+	// Interstitial is set when the client must be shown a warning page with
+	// URL instead of being redirected.
+	Interstitial bool
+}
+
+// Resolve looks up the code of visit in the namespace of the request host
+// and returns the redirect to it. Hosts that are not configured short
+// domains resolve against the default namespace.
+//
+// Links redirect with their own status or Config.Redirect.Status. Only
+// permanent redirects of links that resolve the same way every time may be
+// cached, for at most Config.Redirect.PermanentMaxAge as links can still be
+// edited.
+//
+// Scheduled links redirect to their fallback url outside their window. If
+// they have none, they return ErrLinkNotActive before the window, or
+// redirect to Config.NotActiveURL if set, and ErrLinkNotFound after it.
+// Protected links return ErrPasswordRequired until the visit carries their
+// password, and click-limited links ErrLinkExhausted once their clicks are
+// used up. Bots use clicks like everyone else, so spoofing a bot cannot get
+// past the limit. A path after the code is only found for links passing it
+// through. Links with targeting rules redirect to the url of the first rule
+// matching the visit. Visitors no rule matches are assigned one of the
+// variants of the link, if any. Each redirect is counted in the link stats
+// with the rule, variant, referrer host and country, and whether it came
+// from a bot. Links with an interstitial, or all links if
+// Config.Preview.Interstitial is set, ask to show a warning page instead of
+// redirecting to destinations off Config.Preview.Allowlist.
+func (s *Service) Resolve(ctx context.Context, visit Visit) (Redirect, error) {
+	namespace := s.namespaceForHost(visit.Host)
+	s.logger.Info("Resolving code", "code", visit.Code, "namespace", namespace)
+
+	record, ok := s.store.GetLink(namespace, visit.Code)
+	if !ok {
+		s.logger.Warn("Code not found", "code", visit.Code, "namespace", namespace)
+		return Redirect{}, fmt.Errorf("%w: %s", ErrLinkNotFound, visit.Code)
+	}
+	if strings.Trim(visit.Path, "/") != "" && record.Passthrough != PassthroughPathQuery {
+		return Redirect{}, fmt.Errorf("%w: %s%s", ErrLinkNotFound, visit.Code, visit.Path)
+	}
+	now := time.Now()
+	if dest, outside, err := s.outsideWindow(record, now); outside {
+		if err != nil {
+			return Redirect{}, err
+		}
+		// the link redirects elsewhere once its window opens or closes
+		return Redirect{URL: dest, Status: temporaryStatus(s.redirectStatus(record)), Interstitial: s.interstitial(record, dest)}, nil
+	}
+	if record.PasswordHash != "" {
+		if err := s.checkPassword(record, visit); err != nil {
+			return Redirect{}, err
+		}
+	}
+	rule := target(record, visit)
+	base := rule.URL
+	var variant common.Variant
+	if rule.Name == storage.DefaultRule {
+		if variant = assign(record, visit); variant.Name != "" {
+			base = variant.URL
+		}
+	}
+	dest, err := s.destination(record, base, visit)
+	if err != nil {
+		return Redirect{}, err
+	}
+	if record.MaxClicks > 0 {
+		if err := s.useClick(record); err != nil {
+			return Redirect{}, err
+		}
+	}
+
+	redirect := Redirect{URL: dest, Status: s.redirectStatus(record), Variant: variant.Name, Interstitial: s.interstitial(record, dest)}
+	switch {
+	case record.PasswordHash != "":
+		// the password is posted from a form, answered with a GET of the url
+		redirect.Status = http.StatusSeeOther
+	case record.MaxClicks == 0 && len(record.Targets) == 0 && len(record.Variants) == 0 && !temporary(redirect.Status):
+		redirect.MaxAge = s.maxAge(record, now)
+	}
+	loc := s.geo.Locate(visit.IP)
+	click := storage.Click{
+		Namespace: namespace,
+		Code:      record.Code,
+		Time:      now,
+		Rule:      rule.Name,
+		Variant:   variant.Name,
+		Bot:       s.isBot(visit),
+		Referrer:  referrerHost(visit),
+		Country:   loc.Country,
+		Region:    loc.Region,
+	}
+	if !click.Bot {
+		// bots are no visitors
+		click.Visitor = s.visitorHash(visit, now)
+	}
+	s.recordClick(click)
+	s.logger.Info("Code resolved", "code", visit.Code, "namespace", namespace, "url", dest, "status", redirect.Status)
+	return redirect, nil
+}
+
+// destination returns the url record redirects visit to: base, the url of
+// the link, a targeting rule or a variant, tagged with utm parameters and,
+// as its passthrough mode allows, with the path and query of visit merged
+// in. Parameters of the visit replace those of the url with the same name,
+// and the fragment of the url is kept. A changed url must pass validation
+// like a new link.
+func (s *Service) destination(record storage.LinkRecord, base string, visit Visit) (string, error) {
+	dest, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse link url: %w", err)
+	}
+	rest := strings.Trim(visit.Path, "/")
+	query := s.tag(dest.RawQuery, record)
+	if record.Passthrough != "" {
+		query = mergeQuery(query, visit.Query)
+	}
+	if rest == "" && query == dest.RawQuery {
+		return base, nil
+	}
+	if rest != "" {
+		// only path_query links get here with a path. It is cleaned as a
+		// rooted path, so it cannot climb above the url path.
+		dest = dest.JoinPath(path.Clean("/" + rest))
+	}
+	dest.RawQuery = query
+
+	merged := dest.String()
+	if result := s.validator.Validate(merged); !result.IsValid {
+		s.logger.Warn("Destination url failed validation", "code", record.Code, "namespace", record.Namespace, "url", merged, "error", result.Error)
+		return "", &URLError{Reason: result.Reason, Message: "destination url: " + result.Error}
+	}
+	return merged, nil
+}
+
+// validRedirectStatus reports whether status is a redirect status links
+// can use.
+func validRedirectStatus(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// temporary reports whether status is a temporary redirect status.
+func temporary(status int) bool {
+	return status != http.StatusMovedPermanently && status != http.StatusPermanentRedirect
+}
+
+// temporaryStatus returns the temporary counterpart of a redirect status,
+// keeping whether the request method is preserved.
+func temporaryStatus(status int) int {
+	switch status {
+	case http.StatusMovedPermanently:
+		return http.StatusFound
+	case http.StatusPermanentRedirect:
+		return http.StatusTemporaryRedirect
+	}
+	return status
+}
+
+// redirectStatus returns the status code record redirects with.
+func (s *Service) redirectStatus(record storage.LinkRecord) int {
+	switch {
+	case record.RedirectStatus != 0:
+		return record.RedirectStatus
+	case s.cfg.Redirect.Status != 0:
+		return s.cfg.Redirect.Status
+	}
+	return http.StatusFound
+}
+
+// maxAge returns how long a permanent redirect of record may be cached:
+// Config.Redirect.PermanentMaxAge, but not past the expiry or the end of the
+// window of the link.
+func (s *Service) maxAge(record storage.LinkRecord, now time.Time) time.Duration {
+	maxAge := s.cfg.Redirect.PermanentMaxAge
+	for _, end := range []time.Time{record.ExpiresAt, record.NotAfter} {
+		if !end.IsZero() && end.Sub(now) < maxAge {
+			maxAge = end.Sub(now)
+		}
+	}
+	return max(maxAge, 0)
+}
+
+// outsideWindow reports whether now is outside the activation window of
+// record and, if so, returns the url to redirect to instead or the error.
+func (s *Service) outsideWindow(record storage.LinkRecord, now time.Time) (string, bool, error) {
+	early := !record.NotBefore.IsZero() && now.Before(record.NotBefore)
+	late := !record.NotAfter.IsZero() && !now.Before(record.NotAfter)
+	switch {
+	case !early && !late:
+		return "", false, nil
+	case record.FallbackURL != "":
+		s.logger.Info("Link outside its window, using fallback", "code", record.Code, "namespace", record.Namespace, "url", record.FallbackURL)
+		return record.FallbackURL, true, nil
+	case early && s.cfg.NotActiveURL != "":
+		return s.cfg.NotActiveURL, true, nil
+	case early:
+		s.logger.Info("Link not active yet", "code", record.Code, "namespace", record.Namespace, "not_before", record.NotBefore)
+		return "", true, fmt.Errorf("%w: %s is active from %s", ErrLinkNotActive, record.Code, record.NotBefore.UTC().Format(time.RFC3339))
+	default:
+		s.logger.Info("Link window closed", "code", record.Code, "namespace", record.Namespace, "not_after", record.NotAfter)
+		return "", true, fmt.Errorf("%w: %s", ErrLinkNotFound, record.Code)
+	}
+}
+
+// checkPassword verifies the password of a visit to a protected link. Once a
+// client sent too many wrong passwords for the link, every attempt fails
+// until the window ends, so passwords cannot be guessed. The attempt is
+// counted before the password is compared, so parallel guesses cannot get
+// past the limit, and given back when the password is correct.
+func (s *Service) checkPassword(record storage.LinkRecord, visit Visit) error {
+	if visit.Password == "" {
+		return ErrPasswordRequired
+	}
+	key := record.Namespace + "/" + record.Code + " " + visit.IP
+	if !s.attempts.Allowed(key) {
+		s.logger.Warn("Password attempts exceeded", "code", record.Code, "namespace", record.Namespace, "ip", visit.IP)
+		return ErrTooManyAttempts
+	}
+	if bcrypt.CompareHashAndPassword([]byte(record.PasswordHash), []byte(visit.Password)) != nil {
+		s.logger.Warn("Wrong link password", "code", record.Code, "namespace", record.Namespace, "ip", visit.IP)
+		return ErrPasswordIncorrect
+	}
+	s.attempts.Refund(key)
+	return nil
+}
+
+// useClick takes one of the clicks left of a click-limited link.
+func (s *Service) useClick(record storage.LinkRecord) error {
+	err := s.store.UseClick(record.Namespace, record.Code)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, storage.ErrClicksExhausted):
+		s.logger.Warn("Link clicks exhausted", "code", record.Code, "namespace", record.Namespace)
+		return fmt.Errorf("%w: %s", ErrLinkExhausted, record.Code)
+	case errors.Is(err, storage.ErrLinkNotFound):
+		return fmt.Errorf("%w: %s", ErrLinkNotFound, record.Code)
+	default:
+		s.logger.Error("Failed to use link click", "code", record.Code, "namespace", record.Namespace, "error", err)
+		return fmt.Errorf("failed to use link click: %w", err)
+	}
+}
+
+// PurgePasswordAttempts forgets the wrong password counts of ended windows.
+// It is run by a background job.
+func (s *Service) PurgePasswordAttempts() {
+	s.attempts.Purge()
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+)
+
+func TestService_PasswordProtectedLinks(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{
+		BaseURL:    "https://sho.rt",
+		CodeLength: 7,
+		Password:   config.PasswordConfig{MaxAttempts: 2, AttemptWindow: time.Minute},
+	}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+
+	public, _ := s.Shorten(ctx, "https://example.com/doc", ShortenOptions{})
+	protected, err := s.Shorten(ctx, "https://example.com/doc", ShortenOptions{Password: "hunter2"})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if protected == public {
+		t.Fatalf("expected a protected link not to reuse the public code")
+	}
+	code := protected[strings.LastIndexByte(protected, '/')+1:]
+	if link, _ := s.GetLink(ctx, "", code); !link.Protected {
+		t.Fatalf("expected link to be protected, got %+v", link)
+	}
+	if again, _ := s.Shorten(ctx, "https://example.com/doc", ShortenOptions{Password: "hunter2"}); again == protected {
+		t.Fatalf("expected protected links never to be deduped")
+	}
+	if _, err := s.Shorten(ctx, "https://example.com", ShortenOptions{Password: strings.Repeat("x", 73)}); !errors.Is(err, ErrInvalidPassword) {
+		t.Fatalf("expected ErrInvalidPassword, got %v", err)
+	}
+
+	resolve := func(password, ip string) (string, error) {
+		redirect, err := s.Resolve(ctx, Visit{Code: code, Password: password, IP: ip})
+		return redirect.URL, err
+	}
+	if _, err := resolve("", "1.2.3.4"); !errors.Is(err, ErrPasswordRequired) {
+		t.Fatalf("expected ErrPasswordRequired, got %v", err)
+	}
+	if url, err := resolve("hunter2", "1.2.3.4"); err != nil || url != "https://example.com/doc" {
+		t.Fatalf("expected the correct password to resolve, got %q err=%v", url, err)
+	}
+
+	// wrong passwords are throttled per client, even when the next one is right
+	for i := 0; i < 2; i++ {
+		if _, err := resolve("guess", "1.2.3.4"); !errors.Is(err, ErrPasswordIncorrect) {
+			t.Fatalf("attempt %d: expected ErrPasswordIncorrect, got %v", i+1, err)
+		}
+	}
+	if _, err := resolve("hunter2", "1.2.3.4"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("expected ErrTooManyAttempts, got %v", err)
+	}
+	if _, err := resolve("hunter2", "5.6.7.8"); err != nil {
+		t.Fatalf("expected other clients not to be throttled, got %v", err)
+	}
+
+	// parallel guesses cannot get more wrong passwords past the limit
+	var wg sync.WaitGroup
+	var wrong atomic.Int32
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := resolve("guess", "9.9.9.9"); errors.Is(err, ErrPasswordIncorrect) {
+				wrong.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := wrong.Load(); n != 2 {
+		t.Fatalf("expected 2 guesses to be compared, got %d", n)
+	}
+	if _, err := s.Resolve(ctx, Visit{Code: public[strings.LastIndexByte(public, '/')+1:], IP: "1.2.3.4"}); err != nil {
+		t.Fatalf("expected public links to need no password, got %v", err)
+	}
+}
+
+func TestService_ClickLimitedLinks(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+
+	if _, err := s.Shorten(ctx, "https://example.com/reset", ShortenOptions{Alias: "reset", MaxClicks: 1, Password: "hunter2"}); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if _, err := s.Shorten(ctx, "https://example.com", ShortenOptions{MaxClicks: -1}); !errors.Is(err, ErrInvalidMaxClicks) {
+		t.Fatalf("expected ErrInvalidMaxClicks, got %v", err)
+	}
+
+	// failed resolves do not use the click
+	if _, err := s.Resolve(ctx, Visit{Code: "reset"}); !errors.Is(err, ErrPasswordRequired) {
+		t.Fatalf("expected ErrPasswordRequired, got %v", err)
+	}
+	if redirect, err := s.Resolve(ctx, Visit{Code: "reset", Password: "hunter2"}); err != nil || redirect.URL != "https://example.com/reset" {
+		t.Fatalf("expected the one-time link to resolve once, got %q err=%v", redirect.URL, err)
+	}
+	if _, err := s.Resolve(ctx, Visit{Code: "reset", Password: "hunter2"}); !errors.Is(err, ErrLinkExhausted) {
+		t.Fatalf("expected ErrLinkExhausted, got %v", err)
+	}
+	if link, _ := s.GetLink(ctx, "", "reset"); link.MaxClicks != 1 || link.ClicksLeft != 0 {
+		t.Fatalf("expected the link to report no clicks left, got %+v", link)
+	}
+}
+
+func TestService_ScheduledLinks(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+	now := time.Now()
+
+	if _, err := s.Shorten(ctx, "https://example.com", ShortenOptions{NotBefore: now.Add(time.Hour), NotAfter: now}); !errors.Is(err, ErrInvalidSchedule) {
+		t.Fatalf("expected ErrInvalidSchedule for an empty window, got %v", err)
+	}
+	if _, err := s.Shorten(ctx, "https://example.com", ShortenOptions{NotAfter: now.Add(-time.Hour)}); !errors.Is(err, ErrInvalidSchedule) {
+		t.Fatalf("expected ErrInvalidSchedule for a past window, got %v", err)
+	}
+	if _, err := s.Shorten(ctx, "https://example.com", ShortenOptions{FallbackURL: "ftp://example.com"}); !errors.Is(err, ErrInvalidURL) {
+		t.Fatalf("expected ErrInvalidURL for the fallback, got %v", err)
+	}
+
+	_, _ = s.Shorten(ctx, "https://example.com/sale", ShortenOptions{Alias: "soon", NotBefore: now.Add(time.Hour)})
+	_, _ = s.Shorten(ctx, "https://example.com/sale", ShortenOptions{Alias: "teaser", NotBefore: now.Add(time.Hour), FallbackURL: "https://example.com/teaser"})
+	_, _ = s.Shorten(ctx, "https://example.com/sale", ShortenOptions{Alias: "live", NotBefore: now.Add(-time.Hour), NotAfter: now.Add(time.Hour)})
+	// windows that already closed cannot be created, so store them directly
+	_ = store.Save(storage.Link{URL: "https://example.com/sale", Domain: "example.com", Code: "over", NotAfter: now.Add(-time.Minute), FallbackURL: "https://example.com/next"})
+	_ = store.Save(storage.Link{URL: "https://example.com/sale", Domain: "example.com", Code: "closed", NotAfter: now.Add(-time.Minute)})
+
+	tests := []struct {
+		code string
+		url  string
+		err  error
+	}{
+		{"soon", "", ErrLinkNotActive},
+		{"teaser", "https://example.com/teaser", nil},
+		{"live", "https://example.com/sale", nil},
+		{"over", "https://example.com/next", nil},
+		{"closed", "", ErrLinkNotFound},
+	}
+	for _, tt := range tests {
+		redirect, err := s.Resolve(ctx, Visit{Code: tt.code})
+		if redirect.URL != tt.url || !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %q, %v; got %q, %v", tt.code, tt.url, tt.err, redirect.URL, err)
+		}
+	}
+
+	cfg.NotActiveURL = "https://example.com/coming-soon"
+	if redirect, err := s.Resolve(ctx, Visit{Code: "soon"}); err != nil || redirect.URL != cfg.NotActiveURL {
+		t.Errorf("expected the configured not active url, got %q err=%v", redirect.URL, err)
+	}
+}
+
+func TestService_RedirectStatus(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{
+		BaseURL:    "https://sho.rt",
+		CodeLength: 7,
+		Redirect:   config.RedirectConfig{Status: http.StatusTemporaryRedirect, PermanentMaxAge: 2 * time.Hour},
+	}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+	now := time.Now()
+
+	if _, err := s.Shorten(ctx, "https://example.com", ShortenOptions{RedirectStatus: http.StatusOK}); !errors.Is(err, ErrInvalidRedirectStatus) {
+		t.Fatalf("expected ErrInvalidRedirectStatus, got %v", err)
+	}
+	plain, _ := s.Shorten(ctx, "https://example.com/docs", ShortenOptions{})
+	if moved, _ := s.Shorten(ctx, "https://example.com/docs", ShortenOptions{RedirectStatus: http.StatusMovedPermanently}); moved == plain {
+		t.Fatalf("expected links with a redirect status never to be deduped")
+	}
+	_, _ = s.Shorten(ctx, "https://example.com/docs", ShortenOptions{Alias: "perm", RedirectStatus: http.StatusPermanentRedirect})
+	_, _ = s.Shorten(ctx, "https://example.com/docs", ShortenOptions{Alias: "once", RedirectStatus: http.StatusPermanentRedirect, MaxClicks: 5})
+	_, _ = s.Shorten(ctx, "https://example.com/docs", ShortenOptions{Alias: "later", RedirectStatus: http.StatusMovedPermanently, NotBefore: now.Add(time.Hour), FallbackURL: "https://example.com"})
+	_, _ = s.Shorten(ctx, "https://example.com/docs", ShortenOptions{Alias: "locked", RedirectStatus: http.StatusMovedPermanently, Password: "hunter2"})
+
+	tests := []struct {
+		code     string
+		password string
+		status   int
+		// cached reports whether the redirect may be cached, for at most
+		// the memory store expiry of an hour
+		cached bool
+	}{
+		{plain[strings.LastIndexByte(plain, '/')+1:], "", http.StatusTemporaryRedirect, false},
+		{"perm", "", http.StatusPermanentRedirect, true},
+		{"once", "", http.StatusPermanentRedirect, false},
+		{"later", "", http.StatusFound, false},
+		{"locked", "hunter2", http.StatusSeeOther, false},
+	}
+	for _, tt := range tests {
+		redirect, err := s.Resolve(ctx, Visit{Code: tt.code, Password: tt.password})
+		if err != nil || redirect.Status != tt.status {
+			t.Errorf("%s: expected status %d, got %+v err=%v", tt.code, tt.status, redirect, err)
+		}
+		if cached := redirect.MaxAge > 0; cached != tt.cached || redirect.MaxAge > time.Hour {
+			t.Errorf("%s: expected cached=%v up to the expiry, got max age %v", tt.code, tt.cached, redirect.MaxAge)
+		}
+	}
+
+	if link, _ := s.GetLink(ctx, "", "perm"); link.RedirectStatus != http.StatusPermanentRedirect {
+		t.Errorf("expected the link redirect status, got %d", link.RedirectStatus)
+	}
+	if link, _ := s.GetLink(ctx, "", plain[strings.LastIndexByte(plain, '/')+1:]); link.RedirectStatus != http.StatusTemporaryRedirect {
+		t.Errorf("expected the configured redirect status, got %d", link.RedirectStatus)
+	}
+}
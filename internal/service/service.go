@@ -2,16 +2,24 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/url"
+	"strings"
+	"time"
 
 	"github.com/parikshitg/urlshortener/internal/common"
 	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/geoip"
 	"github.com/parikshitg/urlshortener/internal/logger"
 	"github.com/parikshitg/urlshortener/internal/shortener"
 	"github.com/parikshitg/urlshortener/internal/storage"
 	"github.com/parikshitg/urlshortener/internal/validator"
 	"github.com/parikshitg/urlshortener/pkg/qr"
+	"github.com/parikshitg/urlshortener/pkg/ratelimiter"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Service struct {
@@ -19,93 +27,341 @@ type Service struct {
 	cfg       *config.Config
 	logger    *logger.Logger
 	validator *validator.URLValidator
+	audit     *auditor
+	// attempts counts wrong passwords per link and client IP.
+	attempts *ratelimiter.RateStore
+	// stats keeps the click stats of links, nil if the store does not.
+	stats storage.StatsStore
+	// campaigns keeps the campaigns, nil if the store does not.
+	campaigns storage.CampaignStore
+	// analytics keeps the time bucketed clicks, nil if the store does not.
+	analytics storage.AnalyticsStore
+	// visitors keeps the unique visitor sketches, nil if the store does not.
+	visitors storage.VisitorStore
+	salt     visitorSalt
+	// geo locates clicks, nil without a GeoIP database.
+	geo *geoip.DB
 }
 
 func NewService(store storage.Storage, cfg *config.Config, logger *logger.Logger) *Service {
+	maxAttempts, window := cfg.Password.MaxAttempts, cfg.Password.AttemptWindow
+	if maxAttempts <= 0 {
+		maxAttempts = defaultPasswordAttempts
+	}
+	if window <= 0 {
+		window = defaultPasswordWindow
+	}
+	stats, _ := store.(storage.StatsStore)
+	campaigns, _ := store.(storage.CampaignStore)
+	analytics, _ := store.(storage.AnalyticsStore)
+	visitors, _ := store.(storage.VisitorStore)
 	return &Service{
 		store:     store,
 		cfg:       cfg,
 		logger:    logger,
 		validator: validator.NewURLValidator(),
+		audit:     newAuditor(store, logger),
+		attempts:  ratelimiter.NewRateStore(maxAttempts, window),
+		stats:     stats,
+		campaigns: campaigns,
+		analytics: analytics,
+		visitors:  visitors,
+		geo:       openGeoIP(cfg.GeoIP.Database, logger),
 	}
 }
 
-func (s *Service) Shorten(ctx context.Context, inputURL string) (string, error) {
-	s.logger.Info("Shortening URL", "url", inputURL)
+// ShortenOptions are the optional per-link settings of Shorten.
+type ShortenOptions struct {
+	// Domain is the short domain to create the link on. Empty uses Config.BaseURL.
+	Domain string
+	// Alias is a custom code to use instead of a generated one.
+	Alias string
+	// TTL overrides the configured expiry when non-zero.
+	TTL time.Duration
+	// Password protects the link; resolving it then requires the password.
+	Password string
+	// MaxClicks limits the number of resolves, 1 for a one-time link.
+	// Unlimited when zero.
+	MaxClicks int
+	// NotBefore and NotAfter schedule the window in which the link
+	// redirects, independent of its TTL. Zero times leave it open.
+	NotBefore time.Time
+	NotAfter  time.Time
+	// FallbackURL is redirected to outside the window instead of failing.
+	FallbackURL string
+	// RedirectStatus is the status code to redirect with, one of 301, 302,
+	// 307 or 308. Zero uses Config.Redirect.Status.
+	RedirectStatus int
+	// Passthrough is PassthroughQuery or PassthroughPathQuery to pass the
+	// query, or the path and query, of the short url on to the
+	// destination. Empty is PassthroughNone.
+	Passthrough string
+	// UTM are utm parameters added to the url on redirect, replacing the
+	// defaults of the short domain. The stored url stays untagged.
+	UTM common.UTM
+	// Targets send the visitors matching a rule to its url instead. Rules
+	// are tried in order.
+	Targets []common.TargetRule
+	// Variants split the visitors no targeting rule matches between their
+	// urls by weight, each visitor keeping its variant.
+	Variants []common.Variant
+	// Interstitial shows a warning page with the destination instead of
+	// redirecting, unless it is on Config.Preview.Allowlist.
+	Interstitial bool
+	// Details are the title, description, tags and metadata of the link.
+	Details common.LinkDetails
+	// Campaign is the id of a campaign of the caller's tenant to add the
+	// link to.
+	Campaign string
+}
+
+// Shorten shortens inputURL. Only requests without any of the optional
+// link settings but the domain reuse the existing code for the url.
+func (s *Service) Shorten(ctx context.Context, inputURL string, opts ShortenOptions) (string, error) {
+	s.logger.Info("Shortening URL", "url", inputURL, "short_domain", opts.Domain, "alias", opts.Alias, "caller", subject(ctx))
+	if err := authorize(ctx, s.audit, ActionWriteLinks); err != nil {
+		return "", err
+	}
+
+	claim := func(namespace, code string) bool { return !s.store.CodeExists(namespace, code) }
+	link, shortURL, err := s.prepare(ctx, inputURL, opts, claim)
+	if err != nil {
+		return "", err
+	}
+	if shortURL != "" {
+		return shortURL, nil
+	}
+
+	if err := s.store.Save(link); err != nil {
+		s.logger.Error("Failed to save link", "url", link.URL, "code", link.Code, "error", err)
+		if errors.Is(err, storage.ErrCodeExists) {
+			return "", fmt.Errorf("%w: %s", ErrCodeTaken, link.Code)
+		}
+		return "", fmt.Errorf("failed to save link: %w", err)
+	}
+	shortURL = s.shortURL(link.Namespace, link.Code)
+	s.auditCreate(ctx, link)
+
+	s.logger.Info("URL shortened successfully", "url", link.URL, "code", link.Code, "short_url", shortURL)
+
+	return shortURL, nil
+}
+
+// prepare validates inputURL and opts and builds the link to save for the
+// caller's tenant. If the tenant already shortened the url, the existing
+// short url is returned instead. claim reports whether a code is free and
+// reserves it for this link.
+func (s *Service) prepare(ctx context.Context, inputURL string, opts ShortenOptions, claim func(namespace, code string) bool) (storage.Link, string, error) {
+	namespace, err := s.namespaceFor(opts.Domain)
+	if err != nil {
+		s.logger.Error("Short domain not allowed", "short_domain", opts.Domain)
+		return storage.Link{}, "", err
+	}
+	if opts.Alias != "" && !shortener.ValidCode(opts.Alias) {
+		return storage.Link{}, "", fmt.Errorf("%w: must be 1-%d letters or digits", ErrInvalidAlias, shortener.MaxCodeLength)
+	}
+	if opts.TTL < 0 {
+		return storage.Link{}, "", fmt.Errorf("%w: must be positive", ErrInvalidTTL)
+	}
+	if opts.MaxClicks < 0 {
+		return storage.Link{}, "", fmt.Errorf("%w: must be positive", ErrInvalidMaxClicks)
+	}
+	if !opts.NotBefore.IsZero() && !opts.NotAfter.IsZero() && !opts.NotAfter.After(opts.NotBefore) {
+		return storage.Link{}, "", fmt.Errorf("%w: notAfter must be after notBefore", ErrInvalidSchedule)
+	}
+	if !opts.NotAfter.IsZero() && !opts.NotAfter.After(time.Now()) {
+		return storage.Link{}, "", fmt.Errorf("%w: notAfter must be in the future", ErrInvalidSchedule)
+	}
+	if opts.RedirectStatus != 0 && !validRedirectStatus(opts.RedirectStatus) {
+		return storage.Link{}, "", fmt.Errorf("%w: must be 301, 302, 307 or 308", ErrInvalidRedirectStatus)
+	}
+	switch opts.Passthrough {
+	case "", PassthroughNone, PassthroughQuery, PassthroughPathQuery:
+	default:
+		return storage.Link{}, "", fmt.Errorf("%w: must be %s, %s or %s", ErrInvalidPassthrough, PassthroughNone, PassthroughQuery, PassthroughPathQuery)
+	}
+	if len(opts.Password) > maxPasswordLength {
+		return storage.Link{}, "", fmt.Errorf("%w: must be at most %d bytes", ErrInvalidPassword, maxPasswordLength)
+	}
+
+	normalized, domain, err := s.normalize(inputURL)
+	if err != nil {
+		return storage.Link{}, "", err
+	}
+	if err := s.validateUTM(normalized, opts.UTM); err != nil {
+		return storage.Link{}, "", err
+	}
+	targets, err := s.prepareTargets(opts.Targets)
+	if err != nil {
+		return storage.Link{}, "", err
+	}
+	variants, err := s.prepareVariants(opts.Variants)
+	if err != nil {
+		return storage.Link{}, "", err
+	}
+	details, err := prepareDetails(opts.Details)
+	if err != nil {
+		return storage.Link{}, "", err
+	}
+
+	owner := tenant(ctx)
+	if opts.Campaign != "" {
+		if _, err := s.campaignFor(opts.Campaign, owner); err != nil {
+			return storage.Link{}, "", err
+		}
+	}
+	link := storage.Link{
+		Namespace:      namespace,
+		URL:            normalized,
+		Domain:         domain,
+		TTL:            opts.TTL,
+		Owner:          owner,
+		MaxClicks:      opts.MaxClicks,
+		NotBefore:      opts.NotBefore,
+		NotAfter:       opts.NotAfter,
+		RedirectStatus: opts.RedirectStatus,
+		UTM:            opts.UTM,
+		Variants:       variants,
+		Interstitial:   opts.Interstitial,
+		Details:        details,
+		Campaign:       opts.Campaign,
+	}
+	if len(targets) > 0 {
+		link.Targets = targets
+	}
+	if opts.Passthrough != PassthroughNone {
+		link.Passthrough = opts.Passthrough
+	}
+	if opts.FallbackURL != "" {
+		fallback, _, err := s.normalize(opts.FallbackURL)
+		if err != nil {
+			var urlErr *URLError
+			if errors.As(err, &urlErr) {
+				urlErr.Message = "fallback url: " + urlErr.Message
+			}
+			return storage.Link{}, "", err
+		}
+		link.FallbackURL = fallback
+	}
+	if opts.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(opts.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return storage.Link{}, "", fmt.Errorf("failed to hash password: %w", err)
+		}
+		link.PasswordHash = string(hash)
+	}
+
+	if opts.Alias != "" {
+		if !claim(namespace, opts.Alias) {
+			s.logger.Warn("Alias already taken", "alias", opts.Alias, "namespace", namespace)
+			return storage.Link{}, "", fmt.Errorf("%w: %s", ErrCodeTaken, opts.Alias)
+		}
+		link.Code = opts.Alias
+		return link, "", nil
+	}
+
+	// Check if URL already exists, unless the link has its own settings
+	if link.Indexed() {
+		if code, ok := s.store.GetCode(namespace, owner, normalized); ok {
+			shortURL := s.shortURL(namespace, code)
+			s.logger.Info("URL already exists", "url", normalized, "code", code)
+			return storage.Link{}, shortURL, nil
+		}
+	}
+
+	// Generate a unique shortcode with collision detection
+	exists := func(code string) bool { return !claim(namespace, code) }
+	code, err := shortener.ShortCodeWithRetry(s.cfg.CodeLength, 10, exists)
+	if err != nil {
+		s.logger.Error("Failed to generate shortcode", "url", normalized, "error", err)
+		return storage.Link{}, "", fmt.Errorf("failed to generate unique shortcode: %w", err)
+	}
+	link.Code = code
+
+	return link, "", nil
+}
 
+// normalize validates inputURL and returns its normalized form and host.
+func (s *Service) normalize(inputURL string) (string, string, error) {
 	// Validate URL using comprehensive validator
 	validationResult := s.validator.Validate(inputURL)
 	if !validationResult.IsValid {
 		s.logger.Error("URL validation failed", "url", inputURL, "error", validationResult.Error)
-		return "", fmt.Errorf("URL validation failed: %s", validationResult.Error)
+		return "", "", &URLError{Reason: validationResult.Reason, Message: validationResult.Error}
 	}
 
 	// Normalize URL
 	normalized, err := s.validator.NormalizeURL(inputURL)
 	if err != nil {
 		s.logger.Error("Failed to normalize URL", "url", inputURL, "error", err)
-		return "", fmt.Errorf("failed to normalize URL: %w", err)
+		return "", "", fmt.Errorf("failed to normalize URL: %w", err)
 	}
 
 	// Extract domain from normalized URL
 	parsedURL, err := url.Parse(normalized)
 	if err != nil {
 		s.logger.Error("Failed to parse normalized URL", "url", normalized, "error", err)
-		return "", fmt.Errorf("failed to parse normalized URL: %w", err)
+		return "", "", fmt.Errorf("failed to parse normalized URL: %w", err)
 	}
-	domain := parsedURL.Hostname()
-
-	// Check if URL already exists
-	if code, ok := s.store.GetCode(normalized); ok {
-		shortURL := s.cfg.BaseURL + "/" + code
-		s.logger.Info("URL already exists", "url", normalized, "code", code)
-		return shortURL, nil
-	}
-
-	// Generate a unique shortcode with collision detection
-	code, err := shortener.ShortCodeWithRetry(s.cfg.CodeLength, 10, s.store.CodeExists)
-	if err != nil {
-		s.logger.Error("Failed to generate shortcode", "url", normalized, "error", err)
-		return "", fmt.Errorf("failed to generate unique shortcode: %w", err)
-	}
-
-	s.store.Save(normalized, code, domain)
-	shortURL := s.cfg.BaseURL + "/" + code
-
-	s.logger.Info("URL shortened successfully", "url", normalized, "code", code, "short_url", shortURL)
+	return normalized, parsedURL.Hostname(), nil
+}
 
-	return shortURL, nil
+// MetricsQuery selects the domains ranked by Metrics.
+type MetricsQuery struct {
+	// TopN is the number of domains, Config.TopN when zero.
+	TopN int
+	// Global ranks the domains of all tenants, which requires an admin.
+	Global bool
+	// Campaign ranks the domains of the links of a campaign instead.
+	Campaign string
 }
 
-func (s *Service) Metrics(ctx context.Context, n int) ([]common.TopN, error) {
+// Metrics returns the top shortened domains of the caller's tenant, of all
+// tenants or of a campaign.
+func (s *Service) Metrics(ctx context.Context, query MetricsQuery) ([]common.TopN, error) {
+	n := query.TopN
 	if n <= 0 {
 		n = s.cfg.TopN
 	}
+	if query.Campaign != "" {
+		return s.campaignMetrics(ctx, query.Campaign, n)
+	}
+	action := ActionReadMetrics
+	if query.Global {
+		action = ActionReadAllMetrics
+	}
+	if err := authorize(ctx, s.audit, action); err != nil {
+		return nil, err
+	}
+	owner := tenant(ctx)
+	if query.Global {
+		owner = ""
+	}
 
-	s.logger.Info("Retrieving metrics", "top_n", n)
-	metrics := s.store.TopDomains(n)
+	s.logger.Info("Retrieving metrics", "top_n", n, "tenant", owner)
+	metrics := s.store.TopDomains(owner, n)
 	s.logger.Info("Metrics retrieved", "count", len(metrics))
 
 	return metrics, nil
 }
 
-func (s *Service) Resolve(ctx context.Context, code string) (string, bool) {
-	s.logger.Info("Resolving code", "code", code)
-
-	resolvedURL := s.store.GetURL(code)
-	if resolvedURL == "" {
-		s.logger.Warn("Code not found", "code", code)
-		return "", false
+// Purge deletes the expired links now instead of waiting for the background
+// purge job.
+func (s *Service) Purge(ctx context.Context) error {
+	if err := authorize(ctx, s.audit, ActionPurge); err != nil {
+		return err
 	}
-
-	s.logger.Info("Code resolved", "code", code, "url", resolvedURL)
-	return resolvedURL, true
+	s.store.Purge()
+	s.PurgeCampaigns()
+	s.audit.record(ctx, AuditPurge, "", OutcomeSuccess, nil, nil)
+	s.logger.Info("Storage purged", "caller", subject(ctx))
+	return nil
 }
 
 // QR takes an input URL, follows the same validation/shortening flow as Shorten,
 // then generates a PNG QR image encoding the resulting short URL.
-func (s *Service) QR(ctx context.Context, inputURL string, size int) ([]byte, error) {
-	shortURL, err := s.Shorten(ctx, inputURL)
+func (s *Service) QR(ctx context.Context, inputURL string, opts ShortenOptions, size int) ([]byte, error) {
+	shortURL, err := s.Shorten(ctx, inputURL, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -118,3 +374,61 @@ func (s *Service) QR(ctx context.Context, inputURL string, size int) ([]byte, er
 	}
 	return img, nil
 }
+
+// namespaceFor maps a requested short domain to its storage namespace. The
+// default domain maps to the empty namespace.
+func (s *Service) namespaceFor(shortDomain string) (string, error) {
+	shortDomain = strings.ToLower(strings.TrimSpace(shortDomain))
+	if shortDomain == "" || shortDomain == s.defaultDomain() {
+		return "", nil
+	}
+	for _, d := range s.cfg.ShortDomains {
+		if d == shortDomain {
+			return d, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrDomainNotAllowed, shortDomain)
+}
+
+// namespaceForHost maps a request Host header to its storage namespace,
+// ignoring the port unless the configured domain includes one. Like
+// namespaceFor, the default domain maps to the empty namespace even when it
+// is also listed in Config.ShortDomains.
+func (s *Service) namespaceForHost(host string) string {
+	host = strings.ToLower(host)
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if d := s.defaultDomain(); d == host || d == hostname {
+		return ""
+	}
+	for _, d := range s.cfg.ShortDomains {
+		if d == host || d == hostname {
+			return d
+		}
+	}
+	return ""
+}
+
+// defaultDomain returns the host of Config.BaseURL.
+func (s *Service) defaultDomain() string {
+	u, err := url.Parse(s.cfg.BaseURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+// shortURL builds the short url for code in the namespace, keeping the scheme
+// of Config.BaseURL for branded domains.
+func (s *Service) shortURL(namespace, code string) string {
+	if namespace == "" {
+		return s.cfg.BaseURL + "/" + code
+	}
+	scheme := "https"
+	if u, err := url.Parse(s.cfg.BaseURL); err == nil && u.Scheme != "" {
+		scheme = u.Scheme
+	}
+	return scheme + "://" + namespace + "/" + code
+}
@@ -2,12 +2,15 @@ package service
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/parikshitg/urlshortener/internal/common"
 	"github.com/parikshitg/urlshortener/internal/config"
 	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
 	"github.com/parikshitg/urlshortener/internal/storage/mocks"
 	"go.uber.org/mock/gomock"
 )
@@ -38,11 +41,13 @@ func TestService_Shorten(t *testing.T) {
 			inputURL: "https://example.com",
 			setupMocks: func() {
 				// URL doesn't exist yet
-				mockStorage.EXPECT().GetCode("https://example.com").Return("", false)
+				mockStorage.EXPECT().GetCode("", "", "https://example.com").Return("", false)
 				// Code doesn't exist (for collision detection)
-				mockStorage.EXPECT().CodeExists(gomock.Any()).Return(false).AnyTimes()
+				mockStorage.EXPECT().CodeExists("", gomock.Any()).Return(false).AnyTimes()
 				// Save the new URL
-				mockStorage.EXPECT().Save("https://example.com", gomock.Any(), "example.com")
+				mockStorage.EXPECT().Save(gomock.Cond(func(link storage.Link) bool {
+					return link.URL == "https://example.com" && link.Domain == "example.com" && link.Code != ""
+				})).Return(nil)
 			},
 			expectedResult: "http://localhost:8080/",
 			expectedError:  false,
@@ -52,7 +57,7 @@ func TestService_Shorten(t *testing.T) {
 			inputURL: "https://example.com",
 			setupMocks: func() {
 				// URL already exists
-				mockStorage.EXPECT().GetCode("https://example.com").Return("abc123", true)
+				mockStorage.EXPECT().GetCode("", "", "https://example.com").Return("abc123", true)
 			},
 			expectedResult: "http://localhost:8080/abc123",
 			expectedError:  false,
@@ -72,7 +77,7 @@ func TestService_Shorten(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.setupMocks()
 
-			result, err := service.Shorten(context.Background(), tt.inputURL)
+			result, err := service.Shorten(context.Background(), tt.inputURL, ShortenOptions{})
 
 			if tt.expectedError {
 				if err == nil {
@@ -120,7 +125,7 @@ func TestService_Resolve(t *testing.T) {
 			name: "successful resolution",
 			code: "abc123",
 			setupMocks: func() {
-				mockStorage.EXPECT().GetURL("abc123").Return("https://example.com")
+				mockStorage.EXPECT().GetLink("", "abc123").Return(storage.LinkRecord{Code: "abc123", URL: "https://example.com"}, true)
 			},
 			expectedURL:    "https://example.com",
 			expectedExists: true,
@@ -129,7 +134,7 @@ func TestService_Resolve(t *testing.T) {
 			name: "code not found",
 			code: "nonexistent",
 			setupMocks: func() {
-				mockStorage.EXPECT().GetURL("nonexistent").Return("")
+				mockStorage.EXPECT().GetLink("", "nonexistent").Return(storage.LinkRecord{}, false)
 			},
 			expectedURL:    "",
 			expectedExists: false,
@@ -140,18 +145,135 @@ func TestService_Resolve(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.setupMocks()
 
-			url, exists := service.Resolve(context.Background(), tt.code)
+			redirect, err := service.Resolve(context.Background(), Visit{Code: tt.code})
 
-			if url != tt.expectedURL {
-				t.Errorf("Expected URL %s, got %s", tt.expectedURL, url)
+			if redirect.URL != tt.expectedURL {
+				t.Errorf("Expected URL %s, got %s", tt.expectedURL, redirect.URL)
 			}
-			if exists != tt.expectedExists {
+			if exists := err == nil; exists != tt.expectedExists {
 				t.Errorf("Expected exists %v, got %v", tt.expectedExists, exists)
 			}
+			if !tt.expectedExists && !errors.Is(err, ErrLinkNotFound) {
+				t.Errorf("Expected ErrLinkNotFound, got %v", err)
+			}
 		})
 	}
 }
 
+func TestService_ShortDomains(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mocks.NewMockStorage(ctrl)
+	logger := logger.New("debug", "text")
+	cfg := &config.Config{
+		BaseURL:      "https://sho.rt",
+		CodeLength:   7,
+		ShortDomains: []string{"go.brand-a.com", "go.brand-b.com"},
+	}
+
+	service := NewService(mockStorage, cfg, logger)
+
+	t.Run("shorten on branded domain", func(t *testing.T) {
+		mockStorage.EXPECT().GetCode("go.brand-a.com", "", "https://example.com").Return("promo", true)
+
+		result, err := service.Shorten(context.Background(), "https://example.com", ShortenOptions{Domain: "Go.Brand-A.com"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result != "https://go.brand-a.com/promo" {
+			t.Errorf("Expected https://go.brand-a.com/promo, got %s", result)
+		}
+	})
+
+	t.Run("shorten on default domain by name", func(t *testing.T) {
+		mockStorage.EXPECT().GetCode("", "", "https://example.com").Return("abc123", true)
+
+		result, err := service.Shorten(context.Background(), "https://example.com", ShortenOptions{Domain: "sho.rt"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result != "https://sho.rt/abc123" {
+			t.Errorf("Expected https://sho.rt/abc123, got %s", result)
+		}
+	})
+
+	t.Run("shorten on unknown domain", func(t *testing.T) {
+		_, err := service.Shorten(context.Background(), "https://example.com", ShortenOptions{Domain: "evil.com"})
+		if !errors.Is(err, ErrDomainNotAllowed) {
+			t.Errorf("Expected ErrDomainNotAllowed, got %v", err)
+		}
+	})
+
+	t.Run("resolve by host with port", func(t *testing.T) {
+		mockStorage.EXPECT().GetLink("go.brand-b.com", "promo").Return(storage.LinkRecord{Namespace: "go.brand-b.com", Code: "promo", URL: "https://b.com"}, true)
+
+		redirect, err := service.Resolve(context.Background(), Visit{Host: "go.brand-b.com:443", Code: "promo"})
+		if err != nil || redirect.URL != "https://b.com" {
+			t.Errorf("Expected https://b.com, got %s (err=%v)", redirect.URL, err)
+		}
+	})
+
+	t.Run("resolve unknown host uses default namespace", func(t *testing.T) {
+		mockStorage.EXPECT().GetLink("", "promo").Return(storage.LinkRecord{Code: "promo", URL: "https://default.com"}, true)
+
+		redirect, err := service.Resolve(context.Background(), Visit{Host: "sho.rt", Code: "promo"})
+		if err != nil || redirect.URL != "https://default.com" {
+			t.Errorf("Expected https://default.com, got %s (err=%v)", redirect.URL, err)
+		}
+	})
+}
+
+func TestService_DefaultDomainInShortDomains(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{
+		BaseURL:      "https://sho.rt",
+		CodeLength:   7,
+		ShortDomains: []string{"sho.rt", "go.brand-a.com"},
+	}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+
+	// links created on the default domain, by name or not, resolve on it
+	for domain, alias := range map[string]string{"": "promo", "sho.rt": "launch"} {
+		if _, err := s.Shorten(ctx, "https://example.com/"+alias, ShortenOptions{Domain: domain, Alias: alias}); err != nil {
+			t.Fatalf("shorten on %q: %v", domain, err)
+		}
+		for _, host := range []string{"sho.rt", "sho.rt:443"} {
+			redirect, err := s.Resolve(ctx, Visit{Host: host, Code: alias})
+			if err != nil || redirect.URL != "https://example.com/"+alias {
+				t.Errorf("resolve %s on %s: expected https://example.com/%s, got %q (err=%v)", alias, host, alias, redirect.URL, err)
+			}
+		}
+	}
+}
+
+func TestService_UpdateLinkAtOnce(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mocks.NewMockStorage(ctrl)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7}
+	service := NewService(mockStorage, cfg, logger.New("error", "text"))
+
+	record := storage.LinkRecord{Code: "promo", URL: "https://example.com", Domain: "example.com"}
+	mockStorage.EXPECT().GetLink("", "promo").Return(record, true).Times(2)
+	url, details := "https://example.org", common.LinkDetails{Title: "Promo"}
+	mockStorage.EXPECT().UpdateLink("", "promo", storage.LinkPatch{URL: &url, Domain: "example.org", Details: &details}).Return(nil)
+	mockStorage.EXPECT().UpdateLink("", "promo", gomock.Any()).Return(errors.New("disk full"))
+
+	title := "Promo"
+	link, err := service.UpdateLink(context.Background(), "", "promo", LinkUpdate{URL: url, Title: &title})
+	if err != nil || link.URL != url || link.Details.Title != "Promo" {
+		t.Fatalf("expected the url and title to change, got %+v err=%v", link, err)
+	}
+
+	// a failing store rejects the whole update
+	if _, err := service.UpdateLink(context.Background(), "", "promo", LinkUpdate{URL: url, Title: &title}); err == nil {
+		t.Fatalf("expected the store error to be returned")
+	}
+}
+
 func TestService_Metrics(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -177,7 +299,7 @@ func TestService_Metrics(t *testing.T) {
 					{Rank: 2, Domain: "google.com", Shortened: 50},
 					{Rank: 3, Domain: "github.com", Shortened: 25},
 				}
-				mockStorage.EXPECT().TopDomains(3).Return(expected)
+				mockStorage.EXPECT().TopDomains("", 3).Return(expected)
 			},
 			expectedResult: []common.TopN{
 				{Rank: 1, Domain: "example.com", Shortened: 100},
@@ -192,7 +314,7 @@ func TestService_Metrics(t *testing.T) {
 				expected := []common.TopN{
 					{Rank: 1, Domain: "example.com", Shortened: 100},
 				}
-				mockStorage.EXPECT().TopDomains(3).Return(expected)
+				mockStorage.EXPECT().TopDomains("", 3).Return(expected)
 			},
 			expectedResult: []common.TopN{
 				{Rank: 1, Domain: "example.com", Shortened: 100},
@@ -204,7 +326,7 @@ func TestService_Metrics(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			tt.setupMocks()
 
-			result, err := service.Metrics(context.Background(), tt.n)
+			result, err := service.Metrics(context.Background(), MetricsQuery{TopN: tt.n})
 
 			if err != nil {
 				t.Errorf("Unexpected error: %v", err)
@@ -239,7 +361,7 @@ func TestHealthService_Check(t *testing.T) {
 			name: "healthy storage response",
 			setupMocks: func() {
 				// Mock a fast response
-				mockStorage.EXPECT().CodeExists("health-check").Return(false)
+				mockStorage.EXPECT().CodeExists("", "health-check").Return(false)
 			},
 			expectedStatus: StatusHealthy,
 		},
@@ -247,7 +369,7 @@ func TestHealthService_Check(t *testing.T) {
 			name: "degraded storage response",
 			setupMocks: func() {
 				// Mock a slow response by adding delay
-				mockStorage.EXPECT().CodeExists("health-check").DoAndReturn(func(code string) bool {
+				mockStorage.EXPECT().CodeExists("", "health-check").DoAndReturn(func(namespace, code string) bool {
 					time.Sleep(150 * time.Millisecond) // Simulate slow response
 					return false
 				})
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+)
+
+// LinkStats returns the click stats of the link for code on the short
+// domain. The clicks of bots are left out unless bots is set, then they are
+// added in and also reported in Bots. Stores without stats report none.
+func (s *Service) LinkStats(ctx context.Context, shortDomain, code string, bots bool) (storage.LinkStats, error) {
+	record, err := s.ownedLink(ctx, shortDomain, code, ActionReadLinks)
+	if err != nil {
+		return storage.LinkStats{}, err
+	}
+	if s.stats == nil {
+		return storage.LinkStats{}, nil
+	}
+	stats, err := s.stats.LinkStats(record.Namespace, record.Code)
+	if err != nil {
+		s.logger.Error("Failed to read link stats", "code", code, "namespace", record.Namespace, "error", err)
+		return storage.LinkStats{}, fmt.Errorf("failed to read link stats: %w", err)
+	}
+	if bots {
+		return stats.WithBots(), nil
+	}
+	stats.Bots = nil
+	return stats, nil
+}
+
+// recordClick counts a redirect in the link stats, analytics and unique
+// visitors. Failures are only logged, the visitor is redirected anyway.
+func (s *Service) recordClick(click storage.Click) {
+	if s.stats != nil {
+		if err := s.stats.RecordClick(click); err != nil {
+			s.logger.Error("Failed to record click", "code", click.Code, "namespace", click.Namespace, "error", err)
+		}
+	}
+	if s.analytics != nil {
+		if err := s.analytics.CountClick(click); err != nil {
+			s.logger.Error("Failed to count click", "code", click.Code, "namespace", click.Namespace, "error", err)
+		}
+	}
+	if s.visitors != nil && click.Visitor != 0 {
+		if err := s.visitors.AddVisitor(click); err != nil {
+			s.logger.Error("Failed to count visitor", "code", click.Code, "namespace", click.Namespace, "error", err)
+		}
+	}
+}
+
+// referrerHost returns the lower-cased host of the Referer header of visit,
+// without port. Only the host is kept, the path and query may identify the
+// visitor. Pages of the short domain itself, such as the password form,
+// are no referrers.
+func referrerHost(visit Visit) string {
+	u, err := url.Parse(visit.Referrer)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	if own, _, err := net.SplitHostPort(visit.Host); err == nil {
+		visit.Host = own
+	}
+	if strings.EqualFold(host, visit.Host) {
+		return ""
+	}
+	return host
+}
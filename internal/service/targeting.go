@@ -0,0 +1,114 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/storage"
+	"github.com/parikshitg/urlshortener/internal/useragent"
+)
+
+// maxTargetRules is the maximum number of targeting rules of a link.
+const maxTargetRules = 20
+
+var (
+	ruleNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+	languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{1,8})*$`)
+)
+
+// prepareTargets validates the targeting rules of a new link and returns
+// them with normalized urls and lower-cased conditions.
+func (s *Service) prepareTargets(rules []common.TargetRule) ([]common.TargetRule, error) {
+	if len(rules) > maxTargetRules {
+		return nil, fmt.Errorf("%w: at most %d rules", ErrInvalidTargets, maxTargetRules)
+	}
+	names := make(map[string]bool, len(rules))
+	prepared := make([]common.TargetRule, len(rules))
+	for i, rule := range rules {
+		rule.Device = strings.ToLower(rule.Device)
+		rule.Language = strings.ToLower(rule.Language)
+		switch {
+		case !ruleNamePattern.MatchString(rule.Name):
+			return nil, fmt.Errorf("%w: rule %d: name must be 1-32 letters, digits, - or _", ErrInvalidTargets, i+1)
+		case rule.Name == storage.DefaultRule:
+			return nil, fmt.Errorf("%w: rule name %q is reserved", ErrInvalidTargets, rule.Name)
+		case names[rule.Name]:
+			return nil, fmt.Errorf("%w: duplicate rule name %q", ErrInvalidTargets, rule.Name)
+		case rule.Device == "" && rule.UserAgent == "" && rule.Language == "":
+			return nil, fmt.Errorf("%w: rule %q needs a device, userAgent or language", ErrInvalidTargets, rule.Name)
+		case rule.Device != "" && !useragent.Valid(rule.Device):
+			return nil, fmt.Errorf("%w: rule %q: device must be one of %s", ErrInvalidTargets, rule.Name, strings.Join(useragent.Devices, ", "))
+		case rule.Language != "" && !languagePattern.MatchString(rule.Language):
+			return nil, fmt.Errorf("%w: rule %q: invalid language tag", ErrInvalidTargets, rule.Name)
+		}
+		names[rule.Name] = true
+
+		normalized, _, err := s.normalize(rule.URL)
+		if err != nil {
+			var urlErr *URLError
+			if errors.As(err, &urlErr) {
+				urlErr.Message = "target " + rule.Name + ": " + urlErr.Message
+			}
+			return nil, err
+		}
+		rule.URL = normalized
+		prepared[i] = rule
+	}
+	return prepared, nil
+}
+
+// target returns the first targeting rule of record matching visit, or a
+// rule named storage.DefaultRule with the url of the link.
+func target(record storage.LinkRecord, visit Visit) common.TargetRule {
+	for _, rule := range record.Targets {
+		if matches(rule, visit) {
+			return rule
+		}
+	}
+	return common.TargetRule{Name: storage.DefaultRule, URL: record.URL}
+}
+
+// matches reports whether all set conditions of rule match visit.
+func matches(rule common.TargetRule, visit Visit) bool {
+	if rule.Device != "" && !useragent.Is(visit.UserAgent, rule.Device) {
+		return false
+	}
+	if rule.UserAgent != "" && !strings.Contains(strings.ToLower(visit.UserAgent), strings.ToLower(rule.UserAgent)) {
+		return false
+	}
+	if rule.Language != "" {
+		lang := preferredLanguage(visit.AcceptLanguage)
+		return lang == rule.Language || strings.HasPrefix(lang, rule.Language+"-")
+	}
+	return true
+}
+
+// preferredLanguage returns the lower-cased language tag with the highest
+// quality in an Accept-Language header, the first one on ties. It is empty
+// when the header names no language.
+func preferredLanguage(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > bestQ {
+			best, bestQ = tag, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+)
+
+const (
+	iPhoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148"
+	androidUA = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36"
+	windowsUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36"
+)
+
+func TestService_Targeting(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+
+	invalid := []struct {
+		name  string
+		rules []common.TargetRule
+	}{
+		{"no name", []common.TargetRule{{Device: "ios", URL: "https://apps.apple.com"}}},
+		{"reserved name", []common.TargetRule{{Name: "default", Device: "ios", URL: "https://apps.apple.com"}}},
+		{"duplicate name", []common.TargetRule{{Name: "app", Device: "ios", URL: "https://apps.apple.com"}, {Name: "app", Device: "android", URL: "https://play.google.com"}}},
+		{"no condition", []common.TargetRule{{Name: "app", URL: "https://apps.apple.com"}}},
+		{"unknown device", []common.TargetRule{{Name: "app", Device: "toaster", URL: "https://apps.apple.com"}}},
+		{"bad language", []common.TargetRule{{Name: "de", Language: "de_DE!", URL: "https://example.de"}}},
+	}
+	for _, tt := range invalid {
+		if _, err := s.Shorten(ctx, "https://example.com", ShortenOptions{Targets: tt.rules}); !errors.Is(err, ErrInvalidTargets) {
+			t.Errorf("%s: expected ErrInvalidTargets, got %v", tt.name, err)
+		}
+	}
+	_, err := s.Shorten(ctx, "https://example.com", ShortenOptions{Targets: []common.TargetRule{{Name: "app", Device: "ios", URL: "javascript:alert(1)"}}})
+	var urlErr *URLError
+	if !errors.As(err, &urlErr) || !strings.HasPrefix(urlErr.Message, "target app: ") {
+		t.Fatalf("expected the target url to be validated, got %v", err)
+	}
+
+	_, err = s.Shorten(ctx, "https://example.com", ShortenOptions{Alias: "app", Targets: []common.TargetRule{
+		{Name: "ios", Device: "ios", URL: "https://apps.apple.com/app/id1"},
+		{Name: "android", Device: "android", URL: "https://play.google.com/store/apps/details?id=app"},
+		{Name: "german-desktop", Device: "desktop", Language: "de", URL: "https://example.de"},
+		{Name: "curl", UserAgent: "CURL/", URL: "https://example.com/raw"},
+	}})
+	if err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+	if link, _ := s.GetLink(ctx, "", "app"); len(link.Targets) != 4 || link.URL != "https://example.com" {
+		t.Fatalf("expected the link to keep its rules, got %+v", link)
+	}
+
+	tests := []struct {
+		name     string
+		ua       string
+		language string
+		url      string
+	}{
+		{"ios", iPhoneUA, "", "https://apps.apple.com/app/id1"},
+		{"android", androidUA, "de-DE", "https://play.google.com/store/apps/details?id=app"},
+		{"language", windowsUA, "fr;q=0.5, de-AT;q=0.9", "https://example.de"},
+		{"all conditions", windowsUA, "en-US", "https://example.com"},
+		{"user agent", "curl/8.4.0", "", "https://example.com/raw"},
+		{"default", "", "", "https://example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirect, err := s.Resolve(ctx, Visit{Code: "app", UserAgent: tt.ua, AcceptLanguage: tt.language})
+			if err != nil || redirect.URL != tt.url {
+				t.Errorf("expected %q, got %q err=%v", tt.url, redirect.URL, err)
+			}
+			if redirect.MaxAge != 0 {
+				t.Errorf("expected targeted redirects not to be cached, got %v", redirect.MaxAge)
+			}
+		})
+	}
+
+	// curl is a bot, its click is only counted with the bots
+	stats, err := s.LinkStats(ctx, "", "app", true)
+	if err != nil {
+		t.Fatalf("LinkStats failed: %v", err)
+	}
+	want := map[string]int64{"ios": 1, "android": 1, "german-desktop": 1, "curl": 1, storage.DefaultRule: 2}
+	if stats.Clicks != 6 || len(stats.Rules) != len(want) {
+		t.Fatalf("expected 6 clicks by rule %v, got %+v", want, stats)
+	}
+	for rule, clicks := range want {
+		if stats.Rules[rule] != clicks {
+			t.Errorf("expected %d clicks for %s, got %d", clicks, rule, stats.Rules[rule])
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/storage"
+)
+
+// utmQuery encodes the set fields of utm as a raw query of utm_ parameters.
+func utmQuery(utm common.UTM) string {
+	var pairs []string
+	for _, param := range []struct{ name, value string }{
+		{"utm_source", utm.Source},
+		{"utm_medium", utm.Medium},
+		{"utm_campaign", utm.Campaign},
+		{"utm_term", utm.Term},
+		{"utm_content", utm.Content},
+	} {
+		if param.value != "" {
+			pairs = append(pairs, param.name+"="+url.QueryEscape(param.value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// tag adds the utm parameters of record to the raw query. The parameters of
+// the link replace those of the query, while the defaults of its short
+// domain only fill in the ones still missing.
+func (s *Service) tag(query string, record storage.LinkRecord) string {
+	domain := record.Namespace
+	if domain == "" {
+		domain = s.defaultDomain()
+	}
+	query = mergeQuery(query, utmQuery(record.UTM))
+	return fillQuery(query, utmQuery(s.cfg.UTMDefaults[domain]))
+}
+
+// validateUTM checks that rawURL still passes validation once tagged with
+// utm.
+func (s *Service) validateUTM(rawURL string, utm common.UTM) error {
+	if utm == (common.UTM{}) {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse normalized URL: %w", err)
+	}
+	u.RawQuery = mergeQuery(u.RawQuery, utmQuery(utm))
+	if result := s.validator.Validate(u.String()); !result.IsValid {
+		return &URLError{Reason: result.Reason, Message: "utm: " + result.Error}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+)
+
+func TestService_UTMTagging(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{
+		BaseURL:      "https://sho.rt",
+		CodeLength:   7,
+		ShortDomains: []string{"go.brand-a.com"},
+		UTMDefaults: map[string]common.UTM{
+			"sho.rt":         {Source: "shortener"},
+			"go.brand-a.com": {Source: "brand-a", Medium: "social"},
+		},
+	}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+	code := func(shortURL string) string { return shortURL[strings.LastIndexByte(shortURL, '/')+1:] }
+
+	if _, err := s.Shorten(ctx, "https://example.com", ShortenOptions{UTM: common.UTM{Campaign: "javascript:alert(1)"}}); !errors.Is(err, ErrInvalidURL) {
+		t.Fatalf("expected ErrInvalidURL for a suspicious utm value, got %v", err)
+	}
+
+	plain, _ := s.Shorten(ctx, "https://example.com/sale", ShortenOptions{})
+	spring, _ := s.Shorten(ctx, "https://example.com/sale", ShortenOptions{UTM: common.UTM{Campaign: "spring sale"}})
+	if spring == plain {
+		t.Fatalf("expected tagged links not to reuse the plain link")
+	}
+	if again, _ := s.Shorten(ctx, "https://example.com/sale", ShortenOptions{}); again != plain {
+		t.Fatalf("expected the plain link to be reused, got %s and %s", plain, again)
+	}
+	if link, _ := s.GetLink(ctx, "", code(spring)); link.URL != "https://example.com/sale" || link.UTM.Campaign != "spring sale" {
+		t.Fatalf("expected the url to be stored untagged, got %+v", link)
+	}
+	_, _ = s.Shorten(ctx, "https://example.com/sale?utm_source=print&ref=1", ShortenOptions{Alias: "flyer", Domain: "go.brand-a.com", UTM: common.UTM{Medium: "email"}, Passthrough: PassthroughQuery})
+
+	tests := []struct {
+		name  string
+		visit Visit
+		url   string
+	}{
+		{"domain defaults", Visit{Code: code(plain)}, "https://example.com/sale?utm_source=shortener"},
+		{"link parameters", Visit{Code: code(spring)}, "https://example.com/sale?utm_campaign=spring+sale&utm_source=shortener"},
+		{"url parameters beat defaults", Visit{Host: "go.brand-a.com", Code: "flyer"}, "https://example.com/sale?utm_source=print&ref=1&utm_medium=email"},
+		{"visitors beat everything", Visit{Host: "go.brand-a.com", Code: "flyer", Query: "utm_medium=qr"}, "https://example.com/sale?utm_source=print&ref=1&utm_medium=qr"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirect, err := s.Resolve(ctx, tt.visit)
+			if err != nil || redirect.URL != tt.url {
+				t.Errorf("expected %q, got %q err=%v", tt.url, redirect.URL, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/storage"
+)
+
+const (
+	// maxVariants is the maximum number of variants of a link.
+	maxVariants = 10
+	// maxVariantWeight is the maximum weight of a variant.
+	maxVariantWeight = 1000
+)
+
+// prepareVariants validates the variants of a link and returns them with
+// normalized urls. A link has none or 2 to maxVariants variants.
+func (s *Service) prepareVariants(variants []common.Variant) ([]common.Variant, error) {
+	if len(variants) == 0 {
+		return nil, nil
+	}
+	if len(variants) < 2 || len(variants) > maxVariants {
+		return nil, fmt.Errorf("%w: a link has 2 to %d variants", ErrInvalidVariants, maxVariants)
+	}
+
+	prepared := make([]common.Variant, len(variants))
+	names := make(map[string]bool, len(variants))
+	for i, variant := range variants {
+		switch {
+		case !ruleNamePattern.MatchString(variant.Name):
+			return nil, fmt.Errorf("%w: variant %d: name must be 1-32 letters, digits, - or _", ErrInvalidVariants, i+1)
+		case names[variant.Name]:
+			return nil, fmt.Errorf("%w: duplicate variant name %q", ErrInvalidVariants, variant.Name)
+		case variant.Weight < 0 || variant.Weight > maxVariantWeight:
+			return nil, fmt.Errorf("%w: variant %q: weight must be 0-%d", ErrInvalidVariants, variant.Name, maxVariantWeight)
+		}
+		names[variant.Name] = true
+
+		normalized, _, err := s.normalize(variant.URL)
+		if err != nil {
+			var urlErr *URLError
+			if errors.As(err, &urlErr) {
+				urlErr.Message = "variant " + variant.Name + ": " + urlErr.Message
+			}
+			return nil, err
+		}
+		variant.URL = normalized
+		prepared[i] = variant
+	}
+	return prepared, nil
+}
+
+// UpdateVariants replaces the variants of the link for code on the short
+// domain, e.g. to change their weights while an experiment runs. Visitors
+// keep their variant as long as it has a weight. Empty variants end the
+// experiment.
+func (s *Service) UpdateVariants(ctx context.Context, shortDomain, code string, variants []common.Variant) (LinkInfo, error) {
+	record, err := s.ownedLink(ctx, shortDomain, code, ActionWriteLinks)
+	if err != nil {
+		return LinkInfo{}, err
+	}
+	prepared, err := s.prepareVariants(variants)
+	if err != nil {
+		return LinkInfo{}, err
+	}
+
+	if err := s.store.UpdateLink(record.Namespace, code, storage.LinkPatch{Variants: &prepared}); err != nil {
+		return LinkInfo{}, s.linkError(err, record.Namespace, code)
+	}
+	s.logger.Info("Link variants updated", "code", code, "namespace", record.Namespace, "variants", len(prepared), "caller", subject(ctx))
+
+	before := stateOf(record)
+	record.Variants = prepared
+	s.audit.record(ctx, AuditLinkUpdate, linkTarget(record.Namespace, code), OutcomeSuccess, before, stateOf(record))
+	return s.linkInfo(record), nil
+}
+
+// assign returns the variant of record for visit: the variant it was
+// assigned before if that still has a weight, otherwise one picked by
+// weight from a hash of the client, so the same client keeps getting the
+// same variant without a cookie too. It returns the zero variant when no
+// variant has a weight.
+func assign(record storage.LinkRecord, visit Visit) common.Variant {
+	total := 0
+	for _, variant := range record.Variants {
+		if variant.Weight > 0 && variant.Name == visit.Variant {
+			return variant
+		}
+		total += variant.Weight
+	}
+	if total == 0 {
+		return common.Variant{}
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(record.Namespace + "/" + record.Code + " " + visit.IP + " " + visit.UserAgent))
+	n := int(h.Sum64() % uint64(total))
+	for _, variant := range record.Variants {
+		if n < variant.Weight {
+			return variant
+		}
+		n -= variant.Weight
+	}
+	return common.Variant{}
+}
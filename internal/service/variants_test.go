@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+)
+
+func TestService_Variants(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+
+	invalid := map[string][]common.Variant{
+		"one variant":    {{Name: "a", URL: "https://example.com/a", Weight: 1}},
+		"duplicate name": {{Name: "a", URL: "https://example.com/a", Weight: 1}, {Name: "a", URL: "https://example.com/b", Weight: 1}},
+		"bad name":       {{Name: "a b", URL: "https://example.com/a", Weight: 1}, {Name: "b", URL: "https://example.com/b", Weight: 1}},
+		"negative":       {{Name: "a", URL: "https://example.com/a", Weight: -1}, {Name: "b", URL: "https://example.com/b", Weight: 1}},
+	}
+	for name, variants := range invalid {
+		if _, err := s.Shorten(ctx, "https://example.com", ShortenOptions{Variants: variants}); !errors.Is(err, ErrInvalidVariants) {
+			t.Errorf("%s: expected ErrInvalidVariants, got %v", name, err)
+		}
+	}
+
+	_, err := s.Shorten(ctx, "https://example.com", ShortenOptions{Alias: "ab", Variants: []common.Variant{
+		{Name: "a", URL: "https://example.com/a", Weight: 3},
+		{Name: "b", URL: "https://example.com/b", Weight: 1},
+	}})
+	if err != nil {
+		t.Fatalf("Shorten failed: %v", err)
+	}
+
+	assigned := map[string]int{}
+	for i := range 400 {
+		visit := Visit{Code: "ab", IP: fmt.Sprintf("10.0.%d.%d", i/256, i%256)}
+		first, err := s.Resolve(ctx, visit)
+		if err != nil {
+			t.Fatalf("Resolve failed: %v", err)
+		}
+		if again, _ := s.Resolve(ctx, visit); again.Variant != first.Variant || again.URL != first.URL {
+			t.Fatalf("expected the client to keep variant %s, got %s", first.Variant, again.Variant)
+		}
+		if first.URL != "https://example.com/"+first.Variant || first.MaxAge != 0 {
+			t.Fatalf("expected an uncached redirect to the variant url, got %+v", first)
+		}
+		assigned[first.Variant]++
+	}
+	if assigned["a"] < 250 || assigned["b"] < 50 {
+		t.Fatalf("expected visitors split about 3:1, got %v", assigned)
+	}
+
+	// the cookie wins over the hash while the variant has a weight
+	if redirect, _ := s.Resolve(ctx, Visit{Code: "ab", Variant: "b"}); redirect.Variant != "b" {
+		t.Fatalf("expected the assigned variant to be kept, got %+v", redirect)
+	}
+	link, err := s.UpdateVariants(ctx, "", "ab", []common.Variant{
+		{Name: "a", URL: "https://example.com/a", Weight: 1},
+		{Name: "b", URL: "https://example.com/b", Weight: 0},
+	})
+	if err != nil || link.Code != "ab" || link.Variants[1].Weight != 0 {
+		t.Fatalf("UpdateVariants failed: %+v err=%v", link, err)
+	}
+	if redirect, _ := s.Resolve(ctx, Visit{Code: "ab", Variant: "b"}); redirect.Variant != "a" {
+		t.Fatalf("expected visitors of a paused variant to be reassigned, got %+v", redirect)
+	}
+
+	stats, _ := s.LinkStats(ctx, "", "ab", false)
+	if stats.Clicks != 802 || stats.Variants["a"]+stats.Variants["b"] != 802 {
+		t.Fatalf("expected every click to be counted by variant, got %+v", stats)
+	}
+
+	if _, err := s.UpdateVariants(ctx, "", "ab", nil); err != nil {
+		t.Fatalf("UpdateVariants failed: %v", err)
+	}
+	if redirect, _ := s.Resolve(ctx, Visit{Code: "ab"}); redirect.URL != "https://example.com" || redirect.Variant != "" {
+		t.Fatalf("expected the link url without variants, got %+v", redirect)
+	}
+	if _, err := s.UpdateVariants(ctx, "", "missing", nil); !errors.Is(err, ErrLinkNotFound) {
+		t.Fatalf("expected ErrLinkNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+	"github.com/parikshitg/urlshortener/pkg/hll"
+)
+
+// Intervals group the days of unique visitor counts.
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+)
+
+// UniquesQuery selects the unique visitors returned by LinkUniques and
+// CampaignUniques.
+type UniquesQuery struct {
+	// From and To select the UTC days from the day of From until the day
+	// before To, rounded out to whole periods. Zero times default to the
+	// last defaultStatsDays days.
+	From time.Time
+	To   time.Time
+	// Interval is the period the days are grouped by: IntervalDay,
+	// IntervalWeek, starting on Monday, or IntervalMonth. Days when empty.
+	Interval string
+}
+
+// Uniques are the estimated unique visitors of a range.
+type Uniques struct {
+	Interval string
+	From     time.Time
+	To       time.Time
+	// Visitors are the unique visitors of the whole range.
+	Visitors uint64
+	// Periods are every period of the range, oldest first.
+	Periods []PeriodUniques
+}
+
+// PeriodUniques are the estimated unique visitors of a period.
+type PeriodUniques struct {
+	Start    time.Time
+	Visitors uint64
+}
+
+// visitorSalt caches the salt of the current day.
+type visitorSalt struct {
+	mu    sync.Mutex
+	day   string
+	value []byte
+}
+
+// LinkUniques returns the estimated unique visitors of the link for code on
+// the short domain per period. Visitors are counted once per day; the salt
+// of their hash changes every day, so a visitor coming back on another day
+// counts again in weeks and months. Stores without visitor sketches report
+// none.
+func (s *Service) LinkUniques(ctx context.Context, shortDomain, code string, q UniquesQuery) (Uniques, error) {
+	record, err := s.ownedLink(ctx, shortDomain, code, ActionReadMetrics)
+	if err != nil {
+		return Uniques{}, err
+	}
+	return s.uniques([]storage.LinkRecord{record}, q)
+}
+
+// CampaignUniques returns the estimated unique visitors of the links of a
+// campaign per period. A visitor of several links counts once a day.
+func (s *Service) CampaignUniques(ctx context.Context, id string, q UniquesQuery) (Uniques, error) {
+	campaign, err := s.ownedCampaign(ctx, id, ActionReadMetrics)
+	if err != nil {
+		return Uniques{}, err
+	}
+	links, err := s.campaignLinks(campaign)
+	if err != nil {
+		return Uniques{}, err
+	}
+	return s.uniques(links, q)
+}
+
+// uniques merges the daily visitor sketches of links into the sketches of
+// the periods of q. Days before a link was created are left out, they were
+// counted for an earlier link with the same code.
+func (s *Service) uniques(links []storage.LinkRecord, q UniquesQuery) (Uniques, error) {
+	interval := q.Interval
+	if interval == "" {
+		interval = IntervalDay
+	}
+	if interval != IntervalDay && interval != IntervalWeek && interval != IntervalMonth {
+		return Uniques{}, fmt.Errorf("%w: interval must be day, week or month", ErrInvalidRange)
+	}
+	from, to, err := dayRange(q.From, q.To)
+	if err != nil {
+		return Uniques{}, err
+	}
+	from = periodStart(interval, from)
+	to = nextPeriod(interval, periodStart(interval, to.Add(-day)))
+
+	total := hll.New()
+	periods := make(map[time.Time]*hll.Sketch)
+	for _, link := range links {
+		sketches, err := s.visitorSketches(link, from, to)
+		if err != nil {
+			return Uniques{}, err
+		}
+		created := link.CreatedAt.UTC().Format(storage.DayFormat)
+		for d, sketch := range sketches {
+			t, err := time.Parse(storage.DayFormat, d)
+			if err != nil || d < created {
+				continue
+			}
+			start := periodStart(interval, t)
+			if periods[start] == nil {
+				periods[start] = hll.New()
+			}
+			periods[start].Merge(sketch)
+			total.Merge(sketch)
+		}
+	}
+
+	uniques := Uniques{Interval: interval, From: from, To: to, Visitors: total.Count()}
+	for start := from; start.Before(to); start = nextPeriod(interval, start) {
+		p := PeriodUniques{Start: start}
+		if sketch := periods[start]; sketch != nil {
+			p.Visitors = sketch.Count()
+		}
+		uniques.Periods = append(uniques.Periods, p)
+	}
+	return uniques, nil
+}
+
+// visitorSketches returns the daily visitor sketches of link in [from, to),
+// none if the store keeps no visitors.
+func (s *Service) visitorSketches(link storage.LinkRecord, from, to time.Time) (map[string]*hll.Sketch, error) {
+	if s.visitors == nil {
+		return nil, nil
+	}
+	sketches, err := s.visitors.VisitorSketches(link.Namespace, link.Code, from, to)
+	if err != nil {
+		s.logger.Error("Failed to read visitors", "code", link.Code, "namespace", link.Namespace, "error", err)
+		return nil, fmt.Errorf("failed to read visitors: %w", err)
+	}
+	return sketches, nil
+}
+
+// periodStart returns the start of the period of interval the UTC day t
+// falls in.
+func periodStart(interval string, t time.Time) time.Time {
+	switch interval {
+	case IntervalWeek:
+		sinceMonday := (int(t.Weekday()) + 6) % 7
+		return t.AddDate(0, 0, -sinceMonday)
+	case IntervalMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return t
+}
+
+// nextPeriod returns the start of the period of interval after the one
+// starting at start.
+func nextPeriod(interval string, start time.Time) time.Time {
+	switch interval {
+	case IntervalWeek:
+		return start.AddDate(0, 0, 7)
+	case IntervalMonth:
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// visitorHash identifies the visitor of visit for unique counts with a hash
+// of the client ip and user agent, salted with the salt of the day so the
+// ip cannot be recovered and visitors cannot be followed across days. It is
+// zero when the visitor is unknown or the store keeps no visitors.
+func (s *Service) visitorHash(visit Visit, now time.Time) uint64 {
+	if s.visitors == nil || visit.IP == "" {
+		return 0
+	}
+	salt, err := s.visitorSalt(now)
+	if err != nil {
+		s.logger.Error("Failed to read visitor salt", "error", err)
+		return 0
+	}
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(visit.IP))
+	h.Write([]byte{0})
+	h.Write([]byte(visit.UserAgent))
+	return binary.BigEndian.Uint64(h.Sum(nil))
+}
+
+// visitorSalt returns the salt of the day of now, cached until the day ends.
+func (s *Service) visitorSalt(now time.Time) ([]byte, error) {
+	s.salt.mu.Lock()
+	defer s.salt.mu.Unlock()
+
+	d := now.UTC().Format(storage.DayFormat)
+	if s.salt.day == d {
+		return s.salt.value, nil
+	}
+	salt, err := s.visitors.VisitorSalt(now)
+	if err != nil {
+		return nil, err
+	}
+	s.salt.day, s.salt.value = d, salt
+	return salt, nil
+}
+
+// purgeVisitors deletes the visitor sketches past the day retention and the
+// salts of the days before today.
+func (s *Service) purgeVisitors(now time.Time) {
+	if s.visitors == nil {
+		return
+	}
+	if n, err := s.visitors.PurgeVisitorSalts(now); err != nil {
+		s.logger.Error("Failed to purge visitor salts", "error", err)
+	} else if n > 0 {
+		s.logger.Info("Visitor salts purged", "salts", n)
+	}
+	if s.cfg.Analytics.DayRetention <= 0 {
+		return
+	}
+	before := now.Add(-s.cfg.Analytics.DayRetention)
+	if n, err := s.visitors.PurgeVisitorSketches(before); err != nil {
+		s.logger.Error("Failed to purge visitor sketches", "error", err)
+	} else if n > 0 {
+		s.logger.Info("Visitor sketches purged", "sketches", n, "before", before.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/config"
+	"github.com/parikshitg/urlshortener/internal/logger"
+	"github.com/parikshitg/urlshortener/internal/storage"
+	"github.com/parikshitg/urlshortener/internal/storage/memory"
+)
+
+func TestService_Uniques(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	cfg := &config.Config{BaseURL: "https://sho.rt", CodeLength: 7, TopN: 3}
+	s := NewService(store, cfg, logger.New("error", "text"))
+	ctx := context.Background()
+
+	spring, err := s.CreateCampaign(ctx, CampaignOptions{Name: "Spring"})
+	if err != nil {
+		t.Fatalf("CreateCampaign failed: %v", err)
+	}
+	for _, alias := range []string{"a", "b"} {
+		if _, err := s.Shorten(ctx, "https://example.com/"+alias, ShortenOptions{Alias: alias, Campaign: spring.ID}); err != nil {
+			t.Fatalf("Shorten failed: %v", err)
+		}
+	}
+	visits := []Visit{
+		{Code: "a", IP: "192.0.2.1", UserAgent: "Firefox"},
+		{Code: "a", IP: "192.0.2.1", UserAgent: "Firefox"},
+		{Code: "a", IP: "192.0.2.1", UserAgent: "Safari"},
+		{Code: "a", IP: "192.0.2.2", UserAgent: "Firefox"},
+		{Code: "b", IP: "192.0.2.2", UserAgent: "Firefox"},
+		{Code: "b", IP: "192.0.2.3", UserAgent: "Firefox"},
+		// unknown visitors are not counted
+		{Code: "b"},
+	}
+	for _, visit := range visits {
+		if _, err := s.Resolve(ctx, visit); err != nil {
+			t.Fatalf("Resolve failed: %v", err)
+		}
+	}
+
+	u, err := s.LinkUniques(ctx, "", "a", UniquesQuery{})
+	if err != nil || u.Interval != IntervalDay || len(u.Periods) != defaultStatsDays || u.Visitors != 3 {
+		t.Fatalf("expected 3 visitors over %d days, got %+v err=%v", defaultStatsDays, u, err)
+	}
+	if today := u.Periods[len(u.Periods)-1]; !today.Start.Equal(time.Now().UTC().Truncate(day)) || today.Visitors != 3 {
+		t.Fatalf("expected the visitors today, got %+v", today)
+	}
+	u, err = s.CampaignUniques(ctx, spring.ID, UniquesQuery{Interval: IntervalMonth})
+	if err != nil || u.Visitors != 4 || u.Periods[len(u.Periods)-1].Visitors != 4 {
+		t.Fatalf("expected 4 visitors of the campaign, counted once across links, got %+v err=%v", u, err)
+	}
+	if u.From.Day() != 1 || u.To.Day() != 1 || !u.To.After(time.Now()) {
+		t.Fatalf("expected whole months, got %v to %v", u.From, u.To)
+	}
+
+	// 2025-03-05 is a Wednesday
+	from := time.Date(2025, 3, 5, 12, 0, 0, 0, time.UTC)
+	u, err = s.LinkUniques(ctx, "", "a", UniquesQuery{From: from, To: from.Add(7 * day), Interval: IntervalWeek})
+	if err != nil || len(u.Periods) != 2 || !u.From.Equal(time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)) || !u.To.Equal(time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("expected 2 weeks from Monday, got %+v err=%v", u, err)
+	}
+	if _, err := s.LinkUniques(ctx, "", "a", UniquesQuery{Interval: "year"}); !errors.Is(err, ErrInvalidRange) {
+		t.Fatalf("expected ErrInvalidRange, got %v", err)
+	}
+	if _, err := s.LinkUniques(ctx, "", "missing", UniquesQuery{}); !errors.Is(err, ErrLinkNotFound) {
+		t.Fatalf("expected ErrLinkNotFound, got %v", err)
+	}
+}
+
+func TestService_VisitorHash(t *testing.T) {
+	store := memory.NewMemStore(time.Hour)
+	s := NewService(store, &config.Config{BaseURL: "https://sho.rt"}, logger.New("error", "text"))
+
+	visit := Visit{IP: "192.0.2.1", UserAgent: "Firefox"}
+	now := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	h := s.visitorHash(visit, now)
+	if h == 0 || s.visitorHash(visit, now.Add(time.Hour)) != h {
+		t.Fatalf("expected the same hash within a day")
+	}
+	if s.visitorHash(Visit{IP: "192.0.2.1", UserAgent: "Safari"}, now) == h {
+		t.Fatalf("expected another user agent to hash differently")
+	}
+	if s.visitorHash(visit, now.Add(24*time.Hour)) == h {
+		t.Fatalf("expected the salt to change with the day")
+	}
+	if s.visitorHash(Visit{UserAgent: "Firefox"}, now) != 0 {
+		t.Fatalf("expected no hash without an ip")
+	}
+
+	// old salts and sketches past the day retention are purged
+	s.cfg.Analytics.DayRetention = 24 * time.Hour
+	_ = store.AddVisitor(storage.Click{Code: "a", Time: time.Now().Add(-72 * time.Hour), Visitor: h})
+	s.RollupAnalytics()
+	if n, _ := store.PurgeVisitorSalts(time.Now()); n != 0 {
+		t.Fatalf("expected the old salts to be purged already, %d were left", n)
+	}
+	if sketches, _ := store.VisitorSketches("", "a", time.Now().Add(-96*time.Hour), time.Now()); len(sketches) != 0 {
+		t.Fatalf("expected the old sketch to be purged, got %+v", sketches)
+	}
+}
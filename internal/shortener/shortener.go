@@ -16,8 +16,8 @@ func ShortCode(n int) (string, error) {
 	}
 
 	// Set reasonable limits to prevent abuse
-	if n > 20 {
-		return "", fmt.Errorf("shortcode length too large, got %d (max 20)", n)
+	if n > MaxCodeLength {
+		return "", fmt.Errorf("shortcode length too large, got %d (max %d)", n, MaxCodeLength)
 	}
 
 	// Generate random bytes - need 8 bytes per character
@@ -65,3 +65,22 @@ func ShortCodeWithRetry(n int, maxRetries int, exists func(string) bool) (string
 
 	return "", fmt.Errorf("failed to generate unique shortcode after %d attempts", maxRetries)
 }
+
+// MaxCodeLength is the longest code accepted, generated or user supplied.
+const MaxCodeLength = 20
+
+// ValidCode reports whether code is a usable short code: 1 to MaxCodeLength
+// ASCII letters and digits.
+func ValidCode(code string) bool {
+	if len(code) == 0 || len(code) > MaxCodeLength {
+		return false
+	}
+	for _, char := range code {
+		if !((char >= 'a' && char <= 'z') ||
+			(char >= 'A' && char <= 'Z') ||
+			(char >= '0' && char <= '9')) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,221 @@
+package badgerdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Analytics buckets are keyed "analytics:<granularity>:<link>:" followed by
+// the big endian unix time of the bucket start, so the buckets of a link are
+// one prefix, ordered by time. Their values are the big endian clicks and
+// bot clicks.
+func analyticsPrefix(g storage.Granularity) []byte {
+	return []byte("analytics:" + string(g) + ":")
+}
+
+func bucketPrefix(g storage.Granularity, namespace, code string) []byte {
+	return append(analyticsPrefix(g), linkKey(namespace, code)+":"...)
+}
+
+// linkKey identifies a link in the keys of its analytics. The namespace is
+// hex encoded, as it may contain ':' and a port, so the prefix of one link
+// never matches the keys of another.
+func linkKey(namespace, code string) string {
+	return hex.EncodeToString([]byte(namespace)) + ":" + code
+}
+
+func keyBucket(prefix []byte, start time.Time) []byte {
+	return binary.BigEndian.AppendUint64(bytes.Clone(prefix), uint64(start.Unix()))
+}
+
+// bucketStart returns the bucket start of a bucket key.
+func bucketStart(key []byte) time.Time {
+	return time.Unix(int64(binary.BigEndian.Uint64(key[len(key)-8:])), 0).UTC()
+}
+
+func keyRolledUp(g storage.Granularity) []byte { return []byte("analytics_rolled_up:" + string(g)) }
+
+func encodeBucket(b storage.Bucket) []byte {
+	val := binary.BigEndian.AppendUint64(nil, uint64(b.Clicks))
+	return binary.BigEndian.AppendUint64(val, uint64(b.Bots))
+}
+
+// decodeBucket decodes the counts of a bucket value. Values without bot
+// clicks hold the clicks only.
+func decodeBucket(val []byte) storage.Bucket {
+	var b storage.Bucket
+	if len(val) >= 8 {
+		b.Clicks = int64(binary.BigEndian.Uint64(val))
+	}
+	if len(val) >= 16 {
+		b.Bots = int64(binary.BigEndian.Uint64(val[8:]))
+	}
+	return b
+}
+
+// addBucket adds the counts of b to the bucket at key.
+func addBucket(txn *badger.Txn, key []byte, b storage.Bucket) error {
+	if item, err := txn.Get(key); err == nil {
+		var sum storage.Bucket
+		if err := item.Value(func(val []byte) error {
+			sum = decodeBucket(val)
+			return nil
+		}); err != nil {
+			return err
+		}
+		b.Clicks += sum.Clicks
+		b.Bots += sum.Bots
+	} else if !errors.Is(err, badger.ErrKeyNotFound) {
+		return err
+	}
+	return txn.Set(key, encodeBucket(b))
+}
+
+// CountClick adds click to the minute bucket of its time.
+func (s *Store) CountClick(click storage.Click) error {
+	key := keyBucket(bucketPrefix(storage.Minute, click.Namespace, click.Code), storage.Minute.Truncate(click.Time))
+	b := storage.Bucket{Clicks: 1}
+	if click.Bot {
+		b = storage.Bucket{Bots: 1}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Update(func(txn *badger.Txn) error {
+		return addBucket(txn, key, b)
+	})
+}
+
+// Buckets returns the buckets of a link that start in [from, to).
+func (s *Store) Buckets(namespace, code string, g storage.Granularity, from, to time.Time) ([]storage.Bucket, error) {
+	buckets := []storage.Bucket{}
+	prefix := bucketPrefix(g, namespace, code)
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(keyBucket(prefix, from)); it.Valid(); it.Next() {
+			start := bucketStart(it.Item().Key())
+			if !start.Before(to) {
+				break
+			}
+			var b storage.Bucket
+			if err := it.Item().Value(func(val []byte) error {
+				b = decodeBucket(val)
+				return nil
+			}); err != nil {
+				return err
+			}
+			b.Start = start
+			buckets = append(buckets, b)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+// Rollup adds the buckets of g that were not rolled up yet and start before
+// before to the buckets of the next coarser granularity. The counts and the
+// new roll up time are written in one transaction, so a failed rollup can
+// be retried without counting clicks twice.
+func (s *Store) Rollup(g storage.Granularity, before time.Time) error {
+	coarser := g.Coarser()
+	if coarser == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Update(func(txn *badger.Txn) error {
+		from, err := getRolledUp(txn, g)
+		if err != nil {
+			return err
+		}
+		if !before.After(from) {
+			return nil
+		}
+
+		// sum the buckets first, as the transaction cannot be written to
+		// while it is iterated
+		prefix := analyticsPrefix(g)
+		sums := make(map[string]storage.Bucket)
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		for it.Rewind(); it.Valid(); it.Next() {
+			key := it.Item().Key()
+			start := bucketStart(key)
+			if start.Before(from) || !start.Before(before) {
+				continue
+			}
+			var b storage.Bucket
+			if err := it.Item().Value(func(val []byte) error {
+				b = decodeBucket(val)
+				return nil
+			}); err != nil {
+				it.Close()
+				return err
+			}
+			link := key[len(prefix) : len(key)-8]
+			target := string(keyBucket(append(analyticsPrefix(coarser), link...), coarser.Truncate(start)))
+			sum := sums[target]
+			sum.Clicks += b.Clicks
+			sum.Bots += b.Bots
+			sums[target] = sum
+		}
+		it.Close()
+
+		for key, b := range sums {
+			if err := addBucket(txn, []byte(key), b); err != nil {
+				return err
+			}
+		}
+		val, err := before.UTC().MarshalBinary()
+		if err != nil {
+			return err
+		}
+		return txn.Set(keyRolledUp(g), val)
+	})
+}
+
+// RolledUp returns the time the buckets of g are rolled up to.
+func (s *Store) RolledUp(g storage.Granularity) (time.Time, error) {
+	var t time.Time
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		t, err = getRolledUp(txn, g)
+		return err
+	})
+	return t, err
+}
+
+func getRolledUp(txn *badger.Txn, g storage.Granularity) (time.Time, error) {
+	var t time.Time
+	item, err := txn.Get(keyRolledUp(g))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return t, nil
+	}
+	if err != nil {
+		return t, err
+	}
+	err = item.Value(func(val []byte) error {
+		return t.UnmarshalBinary(val)
+	})
+	return t, err
+}
+
+// PurgeBuckets deletes the buckets of g starting before before.
+func (s *Store) PurgeBuckets(g storage.Granularity, before time.Time) (int, error) {
+	return s.deleteKeys(analyticsPrefix(g), func(key []byte) bool {
+		return bucketStart(key).Before(before)
+	})
+}
@@ -0,0 +1,124 @@
+package badgerdb
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const apiKeyPrefix = "apikey:"
+
+func keyAPIKey(id string) []byte       { return []byte(apiKeyPrefix + id) }
+func keyAPIKeyHash(hash string) []byte { return []byte("apikey_hash:" + hash) }
+
+// SaveAPIKey stores a new api key and indexes it by hash.
+func (s *Store) SaveAPIKey(key storage.APIKey) error {
+	val, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		if err := txn.Set(keyAPIKey(key.ID), val); err != nil {
+			return err
+		}
+		return txn.Set(keyAPIKeyHash(key.Hash), []byte(key.ID))
+	})
+}
+
+// APIKeyByHash returns the key with the given secret hash.
+func (s *Store) APIKeyByHash(hash string) (storage.APIKey, bool, error) {
+	var key storage.APIKey
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(keyAPIKeyHash(hash))
+		if err != nil {
+			return err
+		}
+		id, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+		key, err = getAPIKey(txn, string(id))
+		return err
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return storage.APIKey{}, false, nil
+	}
+	if err != nil {
+		return storage.APIKey{}, false, err
+	}
+	return key, true, nil
+}
+
+// ListAPIKeys returns all keys, oldest first.
+func (s *Store) ListAPIKeys() ([]storage.APIKey, error) {
+	keys := []storage.APIKey{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(apiKeyPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var key storage.APIKey
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &key)
+			}); err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+// RevokeAPIKey marks the key as revoked.
+func (s *Store) RevokeAPIKey(id string, at time.Time) error {
+	var err error
+	for i := 0; i < conflictRetries; i++ {
+		err = s.db.Update(func(txn *badger.Txn) error {
+			key, err := getAPIKey(txn, id)
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				return storage.ErrAPIKeyNotFound
+			}
+			if err != nil || key.Revoked() {
+				return err
+			}
+			key.RevokedAt = at
+			val, err := json.Marshal(key)
+			if err != nil {
+				return err
+			}
+			return txn.Set(keyAPIKey(id), val)
+		})
+		if !errors.Is(err, badger.ErrConflict) {
+			break
+		}
+	}
+	return err
+}
+
+func getAPIKey(txn *badger.Txn, id string) (storage.APIKey, error) {
+	var key storage.APIKey
+	item, err := txn.Get(keyAPIKey(id))
+	if err != nil {
+		return key, err
+	}
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &key)
+	})
+	return key, err
+}
@@ -0,0 +1,110 @@
+package badgerdb
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// auditPrefix keeps the audit log apart from the links; ids sort by time, so
+// keys do too.
+const auditPrefix = "audit:"
+
+func keyAudit(id string) []byte { return []byte(auditPrefix + id) }
+
+// AppendAudit stores a new event.
+func (s *Store) AppendAudit(event storage.AuditEvent) error {
+	val, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(keyAudit(event.ID), val)
+	})
+}
+
+// ListAudit returns the events matching filter, newest first.
+func (s *Store) ListAudit(filter storage.AuditFilter) ([]storage.AuditEvent, error) {
+	events := []storage.AuditEvent{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(auditPrefix)
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		// Reverse iteration starts at the greatest key <= the seek key.
+		seek := append([]byte(auditPrefix), 0xff)
+		if filter.Before != "" {
+			seek = keyAudit(filter.Before)
+		}
+		for it.Seek(seek); it.Valid(); it.Next() {
+			if filter.Limit > 0 && len(events) == filter.Limit {
+				break
+			}
+			var event storage.AuditEvent
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &event)
+			}); err != nil {
+				return err
+			}
+			if filter.Before != "" && event.ID >= filter.Before {
+				continue
+			}
+			if !filter.From.IsZero() && event.Time.Before(filter.From) {
+				// Older events cannot match either.
+				break
+			}
+			if filter.Matches(event) {
+				events = append(events, event)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// PurgeAudit deletes the events older than before.
+func (s *Store) PurgeAudit(before time.Time) (int, error) {
+	var keys [][]byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(auditPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var event storage.AuditEvent
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &event)
+			}); err != nil {
+				return err
+			}
+			if !event.Time.Before(before) {
+				break
+			}
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		return nil
+	})
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, key := range keys {
+		if err := wb.Delete(key); err != nil {
+			return 0, err
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
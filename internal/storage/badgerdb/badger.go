@@ -3,9 +3,14 @@ package badgerdb
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync"
 	"time"
 
 	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/storage"
 
 	"github.com/dgraph-io/badger/v4"
 )
@@ -13,6 +18,8 @@ import (
 type Store struct {
 	db     *badger.DB
 	expiry time.Duration
+	// mu serializes writers, which read-modify-write domain hit counters.
+	mu sync.Mutex
 }
 
 type Options struct {
@@ -32,28 +39,66 @@ func Open(opts Options) (*Store, error) {
 func (s *Store) Close() error { return s.db.Close() }
 
 // Keys
-func keyCode(code string) []byte   { return []byte("code:" + code) }
-func keyURL(url string) []byte     { return []byte("url:" + url) }
-func keyHits(domain string) []byte { return []byte("domain_hits:" + domain) }
+//
+// Links in the default (empty) namespace keep their unprefixed keys so that
+// existing databases resolve unchanged; other namespaces are prefixed with
+// "ns:<namespace>:". Owners are hex encoded in keys, so they can contain any
+// character; links without owner keep the legacy url keys.
+func keyCode(namespace, code string) []byte { return nsKey(namespace, "code:"+code) }
+func keyHits(domain string) []byte          { return []byte("domain_hits:" + domain) }
 
-func (s *Store) CodeExists(code string) bool {
+func keyURL(namespace, owner, url string) []byte {
+	if owner == "" {
+		return nsKey(namespace, "url:"+url)
+	}
+	return nsKey(namespace, "owner:"+hex.EncodeToString([]byte(owner))+":url:"+url)
+}
+
+func keyOwnerHits(owner, domain string) []byte {
+	return []byte(ownerHitsPrefix(owner) + domain)
+}
+
+func ownerHitsPrefix(owner string) string {
+	return "owner_hits:" + hex.EncodeToString([]byte(owner)) + ":"
+}
+
+// keyOwnerLink indexes the links of an owner for ListLinks.
+func keyOwnerLink(owner, namespace, code string) []byte {
+	return []byte(ownerLinksPrefix(owner, false) + namespace + ":" + code)
+}
+
+func ownerLinksPrefix(owner string, allOwners bool) string {
+	if allOwners {
+		return "owner_links:"
+	}
+	return "owner_links:" + hex.EncodeToString([]byte(owner)) + ":"
+}
+
+func nsKey(namespace, key string) []byte {
+	if namespace == "" {
+		return []byte(key)
+	}
+	return []byte("ns:" + namespace + ":" + key)
+}
+
+func (s *Store) CodeExists(namespace, code string) bool {
 	if code == "" {
 		return false
 	}
 	err := s.db.View(func(txn *badger.Txn) error {
-		_, err := txn.Get(keyCode(code))
+		_, err := txn.Get(keyCode(namespace, code))
 		return err
 	})
 	return err == nil
 }
 
-func (s *Store) GetCode(url string) (string, bool) {
+func (s *Store) GetCode(namespace, owner, url string) (string, bool) {
 	if url == "" {
 		return "", false
 	}
 	var code string
 	err := s.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(keyURL(url))
+		item, err := txn.Get(keyURL(namespace, owner, url))
 		if err != nil {
 			return err
 		}
@@ -68,18 +113,18 @@ func (s *Store) GetCode(url string) (string, bool) {
 	return code, true
 }
 
-func (s *Store) GetURL(code string) string {
+func (s *Store) GetURL(namespace, code string) string {
 	if code == "" {
 		return ""
 	}
 	var url string
 	err := s.db.View(func(txn *badger.Txn) error {
-		item, err := txn.Get(keyCode(code))
+		item, err := txn.Get(keyCode(namespace, code))
 		if err != nil {
 			return err
 		}
 		return item.Value(func(val []byte) error {
-			url = string(val)
+			url = decodeLink(val).URL
 			return nil
 		})
 	})
@@ -89,39 +134,217 @@ func (s *Store) GetURL(code string) string {
 	return url
 }
 
-func (s *Store) Save(url, code, domain string) {
-	if url == "" || code == "" || domain == "" {
-		return
+func (s *Store) Save(link storage.Link) error {
+	if link.URL == "" || link.Code == "" || link.Domain == "" {
+		return nil
 	}
-	_ = s.db.Update(func(txn *badger.Txn) error {
-		e := badger.NewEntry(keyURL(url), []byte(code)).WithTTL(s.expiry)
-		if err := txn.SetEntry(e); err != nil {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Update(func(txn *badger.Txn) error {
+		if saved, err := codeTaken(txn, link); err != nil || saved {
 			return err
 		}
-		e2 := badger.NewEntry(keyCode(code), []byte(url)).WithTTL(s.expiry)
-		if err := txn.SetEntry(e2); err != nil {
+		indexURL := link.Indexed()
+		if indexURL {
+			_, err := txn.Get(keyURL(link.Namespace, link.Owner, link.URL))
+			indexURL = errors.Is(err, badger.ErrKeyNotFound)
+		}
+		entries, err := s.linkEntries(link, indexURL, time.Now())
+		if err != nil {
 			return err
 		}
+		for _, e := range entries {
+			if err := txn.SetEntry(e); err != nil {
+				return err
+			}
+		}
 		// increment domain hits (no TTL)
-		k := keyHits(domain)
-		var count uint64
-		if item, err := txn.Get(k); err == nil {
-			_ = item.Value(func(val []byte) error {
-				count = binary.BigEndian.Uint64(val)
-				return nil
-			})
+		for _, k := range hitKeys(link) {
+			if err := txn.Set(k, encodeCount(readCount(txn, k)+1)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// codeTaken returns ErrCodeExists if the code of link is used by another
+// link, and reports whether link itself is already saved under it, with the
+// same url and owner.
+func codeTaken(txn *badger.Txn, link storage.Link) (bool, error) {
+	item, err := txn.Get(keyCode(link.Namespace, link.Code))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var existing linkValue
+	_ = item.Value(func(val []byte) error {
+		existing = decodeLink(val)
+		return nil
+	})
+	if existing.URL == link.URL && existing.Owner == link.Owner {
+		return true, nil
+	}
+	return false, storage.ErrCodeExists
+}
+
+// SaveBatch writes all links with a single badger WriteBatch. Codes, url
+// index and domain hit counters are read beforehand under the writer lock,
+// since a WriteBatch cannot read. A code used by another link, saved or
+// earlier in the batch, fails the batch with ErrCodeExists before anything
+// is written; links saved already are skipped like by Save.
+func (s *Store) SaveBatch(links []storage.Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var save []storage.Link
+	batch := make(map[string]storage.Link)
+	indexed := make(map[string]bool)
+	hits := make(map[string]uint64)
+	err := s.db.View(func(txn *badger.Txn) error {
+		for _, link := range links {
+			if link.URL == "" || link.Code == "" || link.Domain == "" {
+				continue
+			}
+			codeKey := string(keyCode(link.Namespace, link.Code))
+			if other, ok := batch[codeKey]; ok {
+				if other.URL != link.URL || other.Owner != link.Owner {
+					return storage.ErrCodeExists
+				}
+				continue
+			}
+			if saved, err := codeTaken(txn, link); err != nil || saved {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			batch[codeKey] = link
+			save = append(save, link)
+
+			for _, k := range hitKeys(link) {
+				if _, ok := hits[string(k)]; !ok {
+					hits[string(k)] = readCount(txn, k)
+				}
+				hits[string(k)]++
+			}
+			urlKey := string(keyURL(link.Namespace, link.Owner, link.URL))
+			if _, seen := indexed[urlKey]; link.Indexed() && !seen {
+				_, err := txn.Get([]byte(urlKey))
+				indexed[urlKey] = errors.Is(err, badger.ErrKeyNotFound)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+	now := time.Now()
+	for _, link := range save {
+		urlKey := string(keyURL(link.Namespace, link.Owner, link.URL))
+		indexURL := link.Indexed() && indexed[urlKey]
+		if indexURL {
+			indexed[urlKey] = false // first link wins
+		}
+		entries, err := s.linkEntries(link, indexURL, now)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := wb.SetEntry(e); err != nil {
+				return err
+			}
+		}
+	}
+	for key, count := range hits {
+		if err := wb.Set([]byte(key), encodeCount(count)); err != nil {
+			return err
 		}
-		count++
-		buf := make([]byte, 8)
-		binary.BigEndian.PutUint64(buf, count)
-		return txn.Set(k, buf)
+	}
+	return wb.Flush()
+}
+
+// linkEntries returns the code entry, the owner index entry and, if indexURL
+// is set, the url index entry for link.
+func (s *Store) linkEntries(link storage.Link, indexURL bool, now time.Time) ([]*badger.Entry, error) {
+	ttl := s.expiry
+	if link.TTL > 0 {
+		ttl = link.TTL
+	}
+	val, err := json.Marshal(linkValue{
+		URL:            link.URL,
+		Domain:         link.Domain,
+		Owner:          link.Owner,
+		CreatedAt:      now.UTC(),
+		Unindexed:      !indexURL,
+		PasswordHash:   link.PasswordHash,
+		MaxClicks:      link.MaxClicks,
+		ClicksLeft:     link.MaxClicks,
+		NotBefore:      link.NotBefore.UTC(),
+		NotAfter:       link.NotAfter.UTC(),
+		FallbackURL:    link.FallbackURL,
+		RedirectStatus: link.RedirectStatus,
+		Passthrough:    link.Passthrough,
+		UTM:            link.UTM,
+		Targets:        link.Targets,
+		Variants:       link.Variants,
+		Interstitial:   link.Interstitial,
+		Details:        link.Details,
+		Campaign:       link.Campaign,
 	})
+	if err != nil {
+		return nil, err
+	}
+	entries := []*badger.Entry{
+		badger.NewEntry(keyCode(link.Namespace, link.Code), val).WithTTL(ttl),
+		badger.NewEntry(keyOwnerLink(link.Owner, link.Namespace, link.Code), nil).WithTTL(ttl),
+	}
+	if indexURL {
+		entries = append(entries, badger.NewEntry(keyURL(link.Namespace, link.Owner, link.URL), []byte(link.Code)).WithTTL(ttl))
+	}
+	return entries, nil
+}
+
+// hitKeys returns the global and, for owned links, the owner domain hit
+// counters incremented by saving link.
+func hitKeys(link storage.Link) [][]byte {
+	keys := [][]byte{keyHits(link.Domain)}
+	if link.Owner != "" {
+		keys = append(keys, keyOwnerHits(link.Owner, link.Domain))
+	}
+	return keys
+}
+
+func readCount(txn *badger.Txn, key []byte) uint64 {
+	var count uint64
+	if item, err := txn.Get(key); err == nil {
+		_ = item.Value(func(val []byte) error {
+			count = binary.BigEndian.Uint64(val)
+			return nil
+		})
+	}
+	return count
 }
 
-func (s *Store) TopDomains(n int) []common.TopN {
+func encodeCount(count uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, count)
+	return buf
+}
+
+func (s *Store) TopDomains(owner string, n int) []common.TopN {
 	if n <= 0 {
 		return nil
 	}
+	prefix := []byte("domain_hits:")
+	if owner != "" {
+		prefix = []byte(ownerHitsPrefix(owner))
+	}
 	type kv struct {
 		domain string
 		hits   uint64
@@ -130,7 +353,6 @@ func (s *Store) TopDomains(n int) []common.TopN {
 	_ = s.db.View(func(txn *badger.Txn) error {
 		it := txn.NewIterator(badger.DefaultIteratorOptions)
 		defer it.Close()
-		prefix := []byte("domain_hits:")
 		for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
 			item := it.Item()
 			domain := string(bytes.TrimPrefix(item.Key(), prefix))
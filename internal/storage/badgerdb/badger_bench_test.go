@@ -5,6 +5,8 @@ import (
 	"os"
 	"testing"
 	"time"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
 )
 
 func openTestStore(b *testing.B) *Store {
@@ -22,11 +24,11 @@ func openTestStore(b *testing.B) *Store {
 
 func BenchmarkBadger_GetURL(b *testing.B) {
 	st := openTestStore(b)
-	st.Save("https://example.com", "abc1234", "example.com")
+	st.Save(storage.Link{URL: "https://example.com", Code: "abc1234", Domain: "example.com"})
 	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = st.GetURL("abc1234")
+		_ = st.GetURL("", "abc1234")
 	}
 }
 
@@ -35,7 +37,7 @@ func BenchmarkBadger_Save(b *testing.B) {
 	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		st.Save("https://example.com", generateCode(i), "example.com")
+		st.Save(storage.Link{URL: "https://example.com", Code: generateCode(i), Domain: "example.com"})
 	}
 }
 
@@ -1,9 +1,17 @@
 package badgerdb
 
 import (
+	"bytes"
+	"errors"
 	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/storage"
 )
 
 func withStore(t *testing.T, expiry time.Duration, fn func(*Store)) {
@@ -26,12 +34,12 @@ func TestBadger_SaveGetResolve(t *testing.T) {
 		code := "abc123"
 		domain := "example.com"
 
-		st.Save(url, code, domain)
+		st.Save(storage.Link{URL: url, Code: code, Domain: domain})
 
-		if got, ok := st.GetCode(url); !ok || got != code {
+		if got, ok := st.GetCode("", "", url); !ok || got != code {
 			t.Fatalf("GetCode: want %q ok=true, got %q ok=%v", code, got, ok)
 		}
-		if got := st.GetURL(code); got != url {
+		if got := st.GetURL("", code); got != url {
 			t.Fatalf("GetURL: want %q, got %q", url, got)
 		}
 	})
@@ -42,20 +50,20 @@ func TestBadger_Expiry(t *testing.T) {
 		url := "https://example.com"
 		code := "abc123"
 		domain := "example.com"
-		st.Save(url, code, domain)
+		st.Save(storage.Link{URL: url, Code: code, Domain: domain})
 		// Initially present
-		if _, ok := st.GetCode(url); !ok {
+		if _, ok := st.GetCode("", "", url); !ok {
 			t.Fatalf("expected code to exist")
 		}
-		if st.GetURL(code) == "" {
+		if st.GetURL("", code) == "" {
 			t.Fatalf("expected url to exist")
 		}
 		// Wait for TTL
 		time.Sleep(1200 * time.Millisecond)
-		if _, ok := st.GetCode(url); ok {
+		if _, ok := st.GetCode("", "", url); ok {
 			t.Fatalf("expected code to expire")
 		}
-		if st.GetURL(code) != "" {
+		if st.GetURL("", code) != "" {
 			t.Fatalf("expected url to expire")
 		}
 	})
@@ -63,11 +71,11 @@ func TestBadger_Expiry(t *testing.T) {
 
 func TestBadger_TopDomains(t *testing.T) {
 	withStore(t, 1*time.Hour, func(st *Store) {
-		st.Save("https://a.com", "a1", "a.com")
-		st.Save("https://a.com/x", "a2", "a.com")
-		st.Save("https://b.com", "b1", "b.com")
+		st.Save(storage.Link{URL: "https://a.com", Code: "a1", Domain: "a.com"})
+		st.Save(storage.Link{URL: "https://a.com/x", Code: "a2", Domain: "a.com"})
+		st.Save(storage.Link{URL: "https://b.com", Code: "b1", Domain: "b.com"})
 
-		got := st.TopDomains(2)
+		got := st.TopDomains("", 2)
 		if len(got) != 2 {
 			t.Fatalf("expected 2 results, got %d", len(got))
 		}
@@ -82,11 +90,11 @@ func TestBadger_TopDomains(t *testing.T) {
 
 func TestBadger_CodeExists(t *testing.T) {
 	withStore(t, 1*time.Hour, func(st *Store) {
-		if st.CodeExists("nope") {
+		if st.CodeExists("", "nope") {
 			t.Fatalf("expected false for non-existent code")
 		}
-		st.Save("https://x.com", "xy1", "x.com")
-		if !st.CodeExists("xy1") {
+		st.Save(storage.Link{URL: "https://x.com", Code: "xy1", Domain: "x.com"})
+		if !st.CodeExists("", "xy1") {
 			t.Fatalf("expected true after save")
 		}
 	})
@@ -94,8 +102,709 @@ func TestBadger_CodeExists(t *testing.T) {
 
 func TestBadger_GCDoesNotPanic(t *testing.T) {
 	withStore(t, 500*time.Millisecond, func(st *Store) {
-		st.Save("https://gc.com", "gc1", "gc.com")
+		st.Save(storage.Link{URL: "https://gc.com", Code: "gc1", Domain: "gc.com"})
 		time.Sleep(600 * time.Millisecond)
 		st.Purge() // run GC; should not panic
 	})
 }
+
+func TestBadger_Namespaces(t *testing.T) {
+	withStore(t, 1*time.Hour, func(st *Store) {
+		st.Save(storage.Link{URL: "https://default.com", Code: "promo", Domain: "default.com"})
+		st.Save(storage.Link{Namespace: "go.brand-a.com", URL: "https://a.com", Code: "promo", Domain: "a.com"})
+
+		if got := st.GetURL("", "promo"); got != "https://default.com" {
+			t.Fatalf("default namespace: want https://default.com, got %q", got)
+		}
+		if got := st.GetURL("go.brand-a.com", "promo"); got != "https://a.com" {
+			t.Fatalf("brand-a namespace: want https://a.com, got %q", got)
+		}
+		if st.CodeExists("go.brand-b.com", "promo") {
+			t.Fatalf("expected code to be scoped to its namespace")
+		}
+		if _, ok := st.GetCode("", "", "https://a.com"); ok {
+			t.Fatalf("expected url to be scoped to its namespace")
+		}
+	})
+}
+
+func TestBadger_SaveBatch(t *testing.T) {
+	withStore(t, 1*time.Hour, func(st *Store) {
+		st.Save(storage.Link{URL: "https://a.com", Code: "a0", Domain: "a.com"})
+
+		err := st.SaveBatch([]storage.Link{
+			{URL: "https://a.com/x", Code: "a1", Domain: "a.com"},
+			{URL: "https://a.com/x", Code: "a2", Domain: "a.com"},
+			{URL: "https://b.com", Code: "b1", Domain: "b.com", TTL: time.Minute},
+			{Namespace: "go.brand-a.com", URL: "https://a.com", Code: "a0", Domain: "a.com"},
+		})
+		if err != nil {
+			t.Fatalf("SaveBatch: %v", err)
+		}
+
+		if got := st.GetURL("", "a2"); got != "https://a.com/x" {
+			t.Fatalf("GetURL a2: want https://a.com/x, got %q", got)
+		}
+		if got, ok := st.GetCode("", "", "https://a.com/x"); !ok || got != "a1" {
+			t.Fatalf("GetCode: want first code a1, got %q ok=%v", got, ok)
+		}
+		if _, ok := st.GetCode("", "", "https://b.com"); ok {
+			t.Fatalf("expected link with custom ttl not to be indexed by url")
+		}
+		if got := st.GetURL("go.brand-a.com", "a0"); got != "https://a.com" {
+			t.Fatalf("GetURL namespaced: want https://a.com, got %q", got)
+		}
+
+		top := st.TopDomains("", 1)
+		if len(top) != 1 || top[0].Domain != "a.com" || top[0].Shortened != 4 {
+			t.Fatalf("unexpected top domains: %+v", top)
+		}
+	})
+}
+
+func TestBadger_SaveCodeExists(t *testing.T) {
+	withStore(t, 1*time.Hour, func(st *Store) {
+		if err := st.Save(storage.Link{URL: "https://a.com", Code: "promo", Domain: "a.com"}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+		if err := st.Save(storage.Link{URL: "https://a.com", Code: "promo", Domain: "a.com"}); err != nil {
+			t.Fatalf("Save same url: want nil, got %v", err)
+		}
+		err := st.Save(storage.Link{URL: "https://b.com", Code: "promo", Domain: "b.com"})
+		if !errors.Is(err, storage.ErrCodeExists) {
+			t.Fatalf("Save other url: want ErrCodeExists, got %v", err)
+		}
+	})
+}
+
+func TestBadger_SaveBatchCodeExists(t *testing.T) {
+	withStore(t, 1*time.Hour, func(st *Store) {
+		if err := st.Save(storage.Link{URL: "https://a.com", Code: "promo", Domain: "a.com", Owner: "alice"}); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+
+		// a code saved by another owner fails the batch before any write
+		err := st.SaveBatch([]storage.Link{
+			{URL: "https://b.com", Code: "b1", Domain: "b.com", Owner: "bob"},
+			{URL: "https://evil.com", Code: "promo", Domain: "evil.com", Owner: "bob"},
+		})
+		if !errors.Is(err, storage.ErrCodeExists) {
+			t.Fatalf("SaveBatch taken code: want ErrCodeExists, got %v", err)
+		}
+		if got := st.GetURL("", "promo"); got != "https://a.com" {
+			t.Fatalf("expected promo to keep its url, got %q", got)
+		}
+		if got := st.GetURL("", "b1"); got != "" {
+			t.Fatalf("expected nothing of the failed batch written, got b1 -> %q", got)
+		}
+		if owned, _ := st.ListLinks(storage.LinkFilter{Owner: "bob"}); len(owned) != 0 {
+			t.Fatalf("expected no links of bob, got %+v", owned)
+		}
+		if top := st.TopDomains("", 5); len(top) != 1 {
+			t.Fatalf("expected only the hits of a.com, got %+v", top)
+		}
+
+		// the same link again is a no-op, a code twice in the batch fails
+		if err := st.SaveBatch([]storage.Link{{URL: "https://a.com", Code: "promo", Domain: "a.com", Owner: "alice"}}); err != nil {
+			t.Fatalf("SaveBatch same link: want nil, got %v", err)
+		}
+		err = st.SaveBatch([]storage.Link{
+			{URL: "https://c.com", Code: "c1", Domain: "c.com"},
+			{URL: "https://d.com", Code: "c1", Domain: "d.com"},
+		})
+		if !errors.Is(err, storage.ErrCodeExists) {
+			t.Fatalf("SaveBatch duplicate code: want ErrCodeExists, got %v", err)
+		}
+	})
+}
+
+func TestBadger_Idempotency(t *testing.T) {
+	withStore(t, 1*time.Hour, func(st *Store) {
+		_, reserved, err := st.ReserveIdempotencyKey("caller:key", "hash", time.Hour)
+		if err != nil || !reserved {
+			t.Fatalf("first reserve: want reserved, got reserved=%v err=%v", reserved, err)
+		}
+		rec, reserved, err := st.ReserveIdempotencyKey("caller:key", "other", time.Hour)
+		if err != nil || reserved || rec.RequestHash != "hash" || rec.Status != 0 {
+			t.Fatalf("second reserve: want in-flight record, got %+v reserved=%v err=%v", rec, reserved, err)
+		}
+
+		want := storage.IdempotencyRecord{RequestHash: "hash", Status: 200, ContentType: "application/json", Body: []byte(`{"ok":true}`)}
+		if err := st.SaveIdempotencyResponse("caller:key", want, time.Hour); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+		rec, _, _ = st.ReserveIdempotencyKey("caller:key", "hash", time.Hour)
+		if rec.Status != 200 || string(rec.Body) != `{"ok":true}` {
+			t.Fatalf("stored record: got %+v", rec)
+		}
+
+		if err := st.ReleaseIdempotencyKey("caller:key"); err != nil {
+			t.Fatalf("release: %v", err)
+		}
+		if _, reserved, _ := st.ReserveIdempotencyKey("caller:key", "hash", time.Hour); !reserved {
+			t.Fatalf("expected key to be reservable after release")
+		}
+	})
+}
+
+func TestBadger_APIKeys(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		now := time.Now().UTC()
+
+		_ = st.SaveAPIKey(storage.APIKey{ID: "b", Name: "ci", Hash: "hb", Scopes: []string{"links:write"}, CreatedAt: now.Add(time.Second)})
+		_ = st.SaveAPIKey(storage.APIKey{ID: "a", Hash: "ha", Scopes: []string{"metrics:read"}, CreatedAt: now})
+
+		key, ok, err := st.APIKeyByHash("hb")
+		if err != nil || !ok || key.ID != "b" || key.Name != "ci" || len(key.Scopes) != 1 {
+			t.Fatalf("expected key b by hash, got %+v ok=%v err=%v", key, ok, err)
+		}
+		if _, ok, err := st.APIKeyByHash("unknown"); ok || err != nil {
+			t.Fatalf("expected unknown hash to be missing, ok=%v err=%v", ok, err)
+		}
+
+		keys, err := st.ListAPIKeys()
+		if err != nil || len(keys) != 2 || keys[0].ID != "a" || keys[1].ID != "b" {
+			t.Fatalf("expected keys oldest first, got %+v err=%v", keys, err)
+		}
+
+		if err := st.RevokeAPIKey("a", now); err != nil {
+			t.Fatalf("revoke: %v", err)
+		}
+		if err := st.RevokeAPIKey("a", now.Add(time.Hour)); err != nil {
+			t.Fatalf("revoke again: %v", err)
+		}
+		key, _, _ = st.APIKeyByHash("ha")
+		if !key.Revoked() || !key.RevokedAt.Equal(now) {
+			t.Fatalf("expected key revoked at first revocation, got %v", key.RevokedAt)
+		}
+		if err := st.RevokeAPIKey("missing", now); !errors.Is(err, storage.ErrAPIKeyNotFound) {
+			t.Fatalf("expected ErrAPIKeyNotFound, got %v", err)
+		}
+	})
+}
+
+func TestBadger_Owners(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		url := "https://abcd.com/x"
+
+		_ = st.Save(storage.Link{URL: url, Code: "alice1", Domain: "abcd.com", Owner: "alice"})
+		_ = st.Save(storage.Link{URL: url, Code: "bob1", Domain: "abcd.com", Owner: "bob"})
+		_ = st.Save(storage.Link{URL: "https://other.com", Code: "bob2", Domain: "other.com", Owner: "bob"})
+
+		if c, ok := st.GetCode("", "alice", url); !ok || c != "alice1" {
+			t.Fatalf("expected alice's code, got %q ok=%v", c, ok)
+		}
+		if c, ok := st.GetCode("", "bob", url); !ok || c != "bob1" {
+			t.Fatalf("expected bob's code, got %q ok=%v", c, ok)
+		}
+		if _, ok := st.GetCode("", "", url); ok {
+			t.Fatalf("expected no code for the unowned index")
+		}
+
+		if top := st.TopDomains("alice", 3); len(top) != 1 || top[0].Domain != "abcd.com" {
+			t.Fatalf("expected alice's domains only, got %+v", top)
+		}
+		if top := st.TopDomains("", 3); len(top) != 2 || top[0].Domain != "abcd.com" || top[0].Shortened != 2 {
+			t.Fatalf("expected global domains, got %+v", top)
+		}
+
+		link, ok := st.GetLink("", "bob2")
+		if !ok || link.Owner != "bob" || link.URL != "https://other.com" || link.CreatedAt.IsZero() {
+			t.Fatalf("expected bob2, got %+v ok=%v", link, ok)
+		}
+
+		links, err := st.ListLinks(storage.LinkFilter{Owner: "bob"})
+		if err != nil || len(links) != 2 || links[0].Owner != "bob" || links[1].Owner != "bob" {
+			t.Fatalf("expected bob's links, got %+v err=%v", links, err)
+		}
+		links, _ = st.ListLinks(storage.LinkFilter{AllOwners: true})
+		if len(links) != 3 {
+			t.Fatalf("expected every link, got %+v", links)
+		}
+
+		if err := st.UpdateLink("", "bob1", storage.LinkPatch{URL: ptr("https://new.com"), Domain: "new.com"}); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		if got := st.GetURL("", "bob1"); got != "https://new.com" {
+			t.Fatalf("expected updated url, got %q", got)
+		}
+		if _, ok := st.GetCode("", "bob", url); ok {
+			t.Fatalf("expected updated link to leave the url index")
+		}
+
+		if err := st.DeleteLink("", "alice1"); err != nil {
+			t.Fatalf("delete: %v", err)
+		}
+		if _, ok := st.GetLink("", "alice1"); ok {
+			t.Fatalf("expected deleted link to be gone")
+		}
+		links, _ = st.ListLinks(storage.LinkFilter{Owner: "alice"})
+		if len(links) != 0 {
+			t.Fatalf("expected alice to have no links, got %+v", links)
+		}
+		if err := st.DeleteLink("", "alice1"); !errors.Is(err, storage.ErrLinkNotFound) {
+			t.Fatalf("expected ErrLinkNotFound, got %v", err)
+		}
+	})
+}
+
+func TestBadger_Audit(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		now := time.Now().UTC()
+
+		_ = st.AppendAudit(storage.AuditEvent{ID: "2", Time: now.Add(-time.Hour), Actor: "bob", Action: "link.update", After: []byte(`{"url":"https://a.com"}`)})
+		_ = st.AppendAudit(storage.AuditEvent{ID: "1", Time: now.Add(-48 * time.Hour), Actor: "alice", Action: "link.create"})
+		_ = st.AppendAudit(storage.AuditEvent{ID: "3", Time: now, Actor: "alice", Action: "link.delete"})
+
+		events, err := st.ListAudit(storage.AuditFilter{})
+		if err != nil || len(events) != 3 || events[0].ID != "3" || events[2].ID != "1" {
+			t.Fatalf("expected events newest first, got %+v err=%v", events, err)
+		}
+		if string(events[1].After) != `{"url":"https://a.com"}` {
+			t.Fatalf("expected after state to round trip, got %s", events[1].After)
+		}
+		events, _ = st.ListAudit(storage.AuditFilter{Action: "link.create"})
+		if len(events) != 1 || events[0].ID != "1" {
+			t.Fatalf("expected the create event, got %+v", events)
+		}
+		events, _ = st.ListAudit(storage.AuditFilter{Before: "3", Limit: 1})
+		if len(events) != 1 || events[0].ID != "2" {
+			t.Fatalf("expected one event before the cursor, got %+v", events)
+		}
+		events, _ = st.ListAudit(storage.AuditFilter{From: now.Add(-2 * time.Hour)})
+		if len(events) != 2 {
+			t.Fatalf("expected events since from, got %+v", events)
+		}
+
+		if n, err := st.PurgeAudit(now.Add(-24 * time.Hour)); err != nil || n != 1 {
+			t.Fatalf("expected one purged event, got %d err=%v", n, err)
+		}
+		if events, _ = st.ListAudit(storage.AuditFilter{}); len(events) != 2 {
+			t.Fatalf("expected recent events to be kept, got %+v", events)
+		}
+	})
+}
+
+func TestBadger_PasswordLinks(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		url := "https://abcd.com/private"
+
+		if err := st.Save(storage.Link{URL: url, Code: "secret", Domain: "abcd.com", PasswordHash: "hash"}); err != nil {
+			t.Fatalf("save: %v", err)
+		}
+		if _, ok := st.GetCode("", "", url); ok {
+			t.Fatalf("expected protected link not to be indexed by url")
+		}
+		if err := st.SaveBatch([]storage.Link{{URL: url, Code: "secret2", Domain: "abcd.com", PasswordHash: "hash2"}}); err != nil {
+			t.Fatalf("save batch: %v", err)
+		}
+		if _, ok := st.GetCode("", "", url); ok {
+			t.Fatalf("expected protected batch link not to be indexed by url")
+		}
+
+		if err := st.UpdateLink("", "secret", storage.LinkPatch{URL: ptr("https://abcd.com/moved"), Domain: "abcd.com"}); err != nil {
+			t.Fatalf("update: %v", err)
+		}
+		link, ok := st.GetLink("", "secret")
+		if !ok || link.PasswordHash != "hash" || link.URL != "https://abcd.com/moved" {
+			t.Fatalf("expected password hash to survive the update, got %+v ok=%v", link, ok)
+		}
+		if link, _ := st.GetLink("", "secret2"); link.PasswordHash != "hash2" {
+			t.Fatalf("expected batch password hash, got %+v", link)
+		}
+	})
+}
+
+func TestBadger_UseClick(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		_ = st.Save(storage.Link{URL: "https://abcd.com/x", Code: "limited", Domain: "abcd.com", MaxClicks: 10})
+		_ = st.Save(storage.Link{URL: "https://abcd.com/y", Code: "free", Domain: "abcd.com"})
+
+		var wg sync.WaitGroup
+		var used, exhausted atomic.Int32
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := st.UseClick("", "limited")
+				switch {
+				case err == nil:
+					used.Add(1)
+				case errors.Is(err, storage.ErrClicksExhausted):
+					exhausted.Add(1)
+				default:
+					t.Errorf("unexpected error: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+		if used.Load() != 10 || exhausted.Load() != 40 {
+			t.Fatalf("expected 10 clicks used and 40 exhausted, got %d and %d", used.Load(), exhausted.Load())
+		}
+		link, ok := st.GetLink("", "limited")
+		if !ok || link.MaxClicks != 10 || link.ClicksLeft != 0 || link.ExpiresAt.IsZero() {
+			t.Fatalf("expected no clicks left and the expiry kept, got %+v", link)
+		}
+
+		if err := st.UseClick("", "free"); err != nil {
+			t.Fatalf("expected unlimited link to be unaffected, got %v", err)
+		}
+		if err := st.UseClick("", "missing"); !errors.Is(err, storage.ErrLinkNotFound) {
+			t.Fatalf("expected ErrLinkNotFound, got %v", err)
+		}
+	})
+}
+
+func TestBadger_Schedule(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		start, end := time.Now().Add(time.Minute).Truncate(time.Second), time.Now().Add(time.Hour).Truncate(time.Second)
+
+		_ = st.Save(storage.Link{URL: "https://abcd.com/sale", Code: "sale", Domain: "abcd.com", NotBefore: start, NotAfter: end, FallbackURL: "https://abcd.com"})
+		_ = st.Save(storage.Link{URL: "https://abcd.com/x", Code: "plain", Domain: "abcd.com"})
+		if _, ok := st.GetCode("", "", "https://abcd.com/sale"); ok {
+			t.Fatalf("expected scheduled link not to be indexed by url")
+		}
+		link, _ := st.GetLink("", "sale")
+		if !link.NotBefore.Equal(start) || !link.NotAfter.Equal(end) || link.FallbackURL != "https://abcd.com" {
+			t.Fatalf("expected the schedule to be stored, got %+v", link)
+		}
+		if link, _ := st.GetLink("", "plain"); !link.NotBefore.IsZero() || !link.NotAfter.IsZero() {
+			t.Fatalf("expected an open window, got %+v", link)
+		}
+	})
+}
+
+func TestBadger_RedirectStatus(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		_ = st.Save(storage.Link{URL: "https://abcd.com/docs", Code: "docs", Domain: "abcd.com", RedirectStatus: 308})
+		if _, ok := st.GetCode("", "", "https://abcd.com/docs"); ok {
+			t.Fatalf("expected link with a redirect status not to be indexed by url")
+		}
+		if link, _ := st.GetLink("", "docs"); link.RedirectStatus != 308 {
+			t.Fatalf("expected the redirect status to be stored, got %+v", link)
+		}
+	})
+}
+
+func TestBadger_Passthrough(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		_ = st.Save(storage.Link{URL: "https://abcd.com/docs", Code: "docs", Domain: "abcd.com", Passthrough: "path_query"})
+		if _, ok := st.GetCode("", "", "https://abcd.com/docs"); ok {
+			t.Fatalf("expected link with passthrough not to be indexed by url")
+		}
+		if link, _ := st.GetLink("", "docs"); link.Passthrough != "path_query" {
+			t.Fatalf("expected the passthrough to be stored, got %+v", link)
+		}
+	})
+}
+
+func TestBadger_UTM(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		utm := common.UTM{Source: "news", Campaign: "spring"}
+		_ = st.Save(storage.Link{URL: "https://abcd.com/sale", Code: "sale", Domain: "abcd.com", UTM: utm})
+		if _, ok := st.GetCode("", "", "https://abcd.com/sale"); ok {
+			t.Fatalf("expected tagged link not to be indexed by url")
+		}
+		if link, _ := st.GetLink("", "sale"); link.UTM != utm || link.URL != "https://abcd.com/sale" {
+			t.Fatalf("expected the utm parameters to be stored apart from the url, got %+v", link)
+		}
+	})
+}
+
+func TestBadger_Stats(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		_ = st.Save(storage.Link{URL: "https://abcd.com/x", Code: "app", Domain: "abcd.com", Namespace: "go.brand.com"})
+
+		for _, rule := range []string{"ios", "ios", storage.DefaultRule} {
+			if err := st.RecordClick(storage.Click{Namespace: "go.brand.com", Code: "app", Time: time.Now(), Rule: rule, Referrer: "t.co", Country: "US"}); err != nil {
+				t.Fatalf("RecordClick failed: %v", err)
+			}
+		}
+		if err := st.RecordClick(storage.Click{Code: "app", Time: time.Now()}); !errors.Is(err, storage.ErrLinkNotFound) {
+			t.Fatalf("expected ErrLinkNotFound in another namespace, got %v", err)
+		}
+		stats, err := st.LinkStats("go.brand.com", "app")
+		if err != nil || stats.Clicks != 3 || stats.Rules["ios"] != 2 || stats.Rules[storage.DefaultRule] != 1 {
+			t.Fatalf("expected 3 clicks, 2 by ios, got %+v err=%v", stats, err)
+		}
+		if today := time.Now().UTC().Format(storage.DayFormat); stats.Days[today] != 3 {
+			t.Fatalf("expected 3 clicks today, got %+v", stats.Days)
+		}
+		if stats.Referrers["t.co"] != 3 || stats.Countries["US"] != 3 {
+			t.Fatalf("expected 3 clicks from t.co in US, got %v and %v", stats.Referrers, stats.Countries)
+		}
+
+		_ = st.DeleteLink("go.brand.com", "app")
+		if stats, _ := st.LinkStats("go.brand.com", "app"); stats.Clicks != 0 {
+			t.Fatalf("expected the stats to be deleted with the link, got %+v", stats)
+		}
+	})
+}
+
+func TestBadger_Variants(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		_ = st.Save(storage.Link{URL: "https://abcd.com/x", Code: "ab", Domain: "abcd.com"})
+		before, _ := st.GetLink("", "ab")
+
+		variants := []common.Variant{{Name: "a", URL: "https://abcd.com/a", Weight: 1}, {Name: "b", URL: "https://abcd.com/b", Weight: 2}}
+		if err := st.UpdateLink("", "ab", storage.LinkPatch{Variants: &variants}); err != nil {
+			t.Fatalf("UpdateLink failed: %v", err)
+		}
+		link, _ := st.GetLink("", "ab")
+		if len(link.Variants) != 2 || link.Variants[1] != variants[1] || !link.ExpiresAt.Equal(before.ExpiresAt) {
+			t.Fatalf("expected the variants to be stored with the expiry kept, got %+v", link)
+		}
+		if _, ok := st.GetCode("", "", "https://abcd.com/x"); ok {
+			t.Fatalf("expected the link not to be indexed by url anymore")
+		}
+
+		_ = st.RecordClick(storage.Click{Code: "ab", Time: time.Now(), Rule: storage.DefaultRule, Variant: "b"})
+		if stats, _ := st.LinkStats("", "ab"); stats.Variants["b"] != 1 {
+			t.Fatalf("expected the click to be counted for variant b, got %+v", stats)
+		}
+		if err := st.UpdateLink("", "missing", storage.LinkPatch{Variants: &variants}); !errors.Is(err, storage.ErrLinkNotFound) {
+			t.Fatalf("expected ErrLinkNotFound, got %v", err)
+		}
+	})
+}
+
+func TestBadger_Interstitial(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		_ = st.Save(storage.Link{URL: "https://abcd.com/x", Code: "warn", Domain: "abcd.com", Interstitial: true})
+		if _, ok := st.GetCode("", "", "https://abcd.com/x"); ok {
+			t.Fatalf("expected link with interstitial not to be indexed by url")
+		}
+		if link, _ := st.GetLink("", "warn"); !link.Interstitial {
+			t.Fatalf("expected the interstitial to be stored, got %+v", link)
+		}
+	})
+}
+
+func TestBadger_UpdateLink(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		_ = st.Save(storage.Link{URL: "https://abcd.com/x", Code: "ab", Domain: "abcd.com", Campaign: "c1"})
+		before, _ := st.GetLink("", "ab")
+
+		url, campaign := "https://efgh.com/y", ""
+		details := common.LinkDetails{Title: "Moved"}
+		if err := st.UpdateLink("", "ab", storage.LinkPatch{URL: &url, Domain: "efgh.com", Details: &details, Campaign: &campaign}); err != nil {
+			t.Fatalf("UpdateLink failed: %v", err)
+		}
+		link, _ := st.GetLink("", "ab")
+		if link.URL != url || link.Domain != "efgh.com" || link.Details.Title != "Moved" || link.Campaign != "" || !link.ExpiresAt.Equal(before.ExpiresAt) {
+			t.Fatalf("expected every change to be stored with the expiry kept, got %+v", link)
+		}
+		if _, ok := st.GetCode("", "", url); ok {
+			t.Fatalf("expected the link not to be indexed by url")
+		}
+		if err := st.UpdateLink("", "missing", storage.LinkPatch{URL: &url}); !errors.Is(err, storage.ErrLinkNotFound) {
+			t.Fatalf("expected ErrLinkNotFound, got %v", err)
+		}
+	})
+}
+
+func TestBadger_Details(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		details := common.LinkDetails{Title: "Spring Sale", Tags: []string{"promo"}, Metadata: map[string]string{"team": "growth"}}
+		_ = st.Save(storage.Link{URL: "https://abcd.com/sale", Code: "sale", Domain: "abcd.com", Details: details})
+		_ = st.Save(storage.Link{URL: "https://abcd.com/docs", Code: "docs", Domain: "abcd.com"})
+		if _, ok := st.GetCode("", "", "https://abcd.com/sale"); ok {
+			t.Fatalf("expected link with details not to be indexed by url")
+		}
+		links, _ := st.ListLinks(storage.LinkFilter{Search: "SPRING", Metadata: map[string]string{"team": "growth"}})
+		if len(links) != 1 || links[0].Code != "sale" || links[0].Details.Title != "Spring Sale" || links[0].Details.Metadata["team"] != "growth" {
+			t.Fatalf("expected only the sale link with its details, got %+v", links)
+		}
+
+		before, _ := st.GetLink("", "docs")
+		if err := st.UpdateLink("", "docs", storage.LinkPatch{Details: ptr(common.LinkDetails{Tags: []string{"promo"}})}); err != nil {
+			t.Fatalf("UpdateLink failed: %v", err)
+		}
+		if link, _ := st.GetLink("", "docs"); !link.ExpiresAt.Equal(before.ExpiresAt) {
+			t.Fatalf("expected the expiry to be kept, got %+v", link)
+		}
+		if links, _ := st.ListLinks(storage.LinkFilter{Tag: "promo"}); len(links) != 2 {
+			t.Fatalf("expected both links to be tagged, got %+v", links)
+		}
+		if err := st.UpdateLink("", "missing", storage.LinkPatch{Details: &details}); !errors.Is(err, storage.ErrLinkNotFound) {
+			t.Fatalf("expected ErrLinkNotFound, got %v", err)
+		}
+	})
+}
+
+func TestBadger_Campaigns(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		now := time.Now().UTC()
+		_ = st.SaveCampaign(storage.Campaign{ID: "c2", Name: "Summer", Owner: "acme", CreatedAt: now.Add(time.Second)})
+		_ = st.SaveCampaign(storage.Campaign{ID: "c1", Name: "Spring", Owner: "acme", CreatedAt: now, Cascade: true})
+		_ = st.SaveCampaign(storage.Campaign{ID: "c3", Name: "Other", Owner: "globex", CreatedAt: now})
+
+		if campaigns, _ := st.ListCampaigns("acme", false); len(campaigns) != 2 || campaigns[0].ID != "c1" || !campaigns[0].Cascade {
+			t.Fatalf("expected the campaigns of acme, oldest first, got %+v", campaigns)
+		}
+		if campaigns, _ := st.ListCampaigns("", true); len(campaigns) != 3 {
+			t.Fatalf("expected every campaign, got %+v", campaigns)
+		}
+
+		_ = st.Save(storage.Link{URL: "https://abcd.com/a", Code: "a", Domain: "abcd.com", Owner: "acme", Campaign: "c1"})
+		_ = st.Save(storage.Link{URL: "https://abcd.com/b", Code: "b", Domain: "abcd.com", Owner: "acme"})
+		if _, ok := st.GetCode("", "acme", "https://abcd.com/a"); ok {
+			t.Fatalf("expected link in a campaign not to be indexed by url")
+		}
+		before, _ := st.GetLink("", "b")
+		if err := st.UpdateLink("", "b", storage.LinkPatch{Campaign: ptr("c1")}); err != nil {
+			t.Fatalf("UpdateLink failed: %v", err)
+		}
+		links, _ := st.ListLinks(storage.LinkFilter{Owner: "acme", Campaign: "c1"})
+		if len(links) != 2 || links[1].Campaign != "c1" || !links[1].ExpiresAt.Equal(before.ExpiresAt) {
+			t.Fatalf("expected both links in the campaign with their expiry, got %+v", links)
+		}
+
+		if err := st.DeleteCampaign("c1"); err != nil {
+			t.Fatalf("DeleteCampaign failed: %v", err)
+		}
+		if _, ok, _ := st.GetCampaign("c1"); ok {
+			t.Fatalf("expected the campaign to be deleted")
+		}
+		if err := st.DeleteCampaign("c1"); !errors.Is(err, storage.ErrCampaignNotFound) {
+			t.Fatalf("expected ErrCampaignNotFound, got %v", err)
+		}
+	})
+}
+
+func TestBadger_Analytics(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		base := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+		for _, at := range []time.Duration{0, 30 * time.Second, time.Minute, 90 * time.Minute} {
+			if err := st.CountClick(storage.Click{Code: "app", Time: base.Add(at)}); err != nil {
+				t.Fatalf("CountClick failed: %v", err)
+			}
+		}
+		_ = st.CountClick(storage.Click{Namespace: "go.brand.com", Code: "app", Time: base})
+
+		minutes, _ := st.Buckets("", "app", storage.Minute, base, base.Add(2*time.Hour))
+		want := []storage.Bucket{{Start: base, Clicks: 2}, {Start: base.Add(time.Minute), Clicks: 1}, {Start: base.Add(90 * time.Minute), Clicks: 1}}
+		if !reflect.DeepEqual(minutes, want) {
+			t.Fatalf("expected %+v, got %+v", want, minutes)
+		}
+
+		// roll up the first hour, again, then the rest; no click counts twice
+		if err := st.Rollup(storage.Minute, base.Add(time.Hour)); err != nil {
+			t.Fatalf("Rollup failed: %v", err)
+		}
+		_ = st.Rollup(storage.Minute, base.Add(time.Hour))
+		_ = st.Rollup(storage.Minute, base.Add(2*time.Hour))
+		if rolled, _ := st.RolledUp(storage.Minute); !rolled.Equal(base.Add(2 * time.Hour)) {
+			t.Fatalf("expected minutes rolled up to %v, got %v", base.Add(2*time.Hour), rolled)
+		}
+		hours, _ := st.Buckets("", "app", storage.Hour, base, base.Add(2*time.Hour))
+		want = []storage.Bucket{{Start: base, Clicks: 3}, {Start: base.Add(time.Hour), Clicks: 1}}
+		if !reflect.DeepEqual(hours, want) {
+			t.Fatalf("expected %+v, got %+v", want, hours)
+		}
+		_ = st.Rollup(storage.Hour, base.Add(2*time.Hour))
+		if days, _ := st.Buckets("", "app", storage.Day, base.Add(-24*time.Hour), base.Add(24*time.Hour)); len(days) != 1 || days[0].Clicks != 4 {
+			t.Fatalf("expected 4 clicks on the day, got %+v", days)
+		}
+
+		// rolled up minutes are kept until purged
+		if n, _ := st.PurgeBuckets(storage.Minute, base.Add(time.Hour)); n != 3 {
+			t.Fatalf("expected 3 minute buckets purged, got %d", n)
+		}
+		if minutes, _ := st.Buckets("", "app", storage.Minute, base, base.Add(2*time.Hour)); len(minutes) != 1 {
+			t.Fatalf("expected the later minute bucket to be kept, got %+v", minutes)
+		}
+		if hours, _ := st.Buckets("", "app", storage.Hour, base, base.Add(2*time.Hour)); len(hours) != 2 {
+			t.Fatalf("expected the hour buckets to be kept, got %+v", hours)
+		}
+
+		// the buckets of a namespace with a port are not those of a code
+		// named like the port
+		_ = st.CountClick(storage.Click{Namespace: "go.b.com:8080", Code: "app", Time: base})
+		if minutes, _ := st.Buckets("go.b.com", "8080", storage.Minute, base, base.Add(time.Hour)); len(minutes) != 0 {
+			t.Fatalf("expected no buckets of go.b.com/8080, got %+v", minutes)
+		}
+		if minutes, _ := st.Buckets("go.b.com:8080", "app", storage.Minute, base, base.Add(time.Hour)); len(minutes) != 1 || minutes[0].Clicks != 1 {
+			t.Fatalf("expected the click of go.b.com:8080/app, got %+v", minutes)
+		}
+	})
+}
+
+func TestBadger_Visitors(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		day := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+		for i, visitor := range []uint64{1 << 60, 2 << 60, 1 << 60} {
+			if err := st.AddVisitor(storage.Click{Code: "app", Time: day.Add(time.Duration(i) * time.Hour), Visitor: visitor}); err != nil {
+				t.Fatalf("AddVisitor failed: %v", err)
+			}
+		}
+		_ = st.AddVisitor(storage.Click{Code: "app", Time: day.Add(24 * time.Hour), Visitor: 3 << 60})
+
+		sketches, _ := st.VisitorSketches("", "app", day, day.Add(48*time.Hour))
+		if len(sketches) != 2 || sketches["2025-03-01"].Count() != 2 || sketches["2025-03-02"].Count() != 1 {
+			t.Fatalf("expected 2 visitors on the first day and 1 on the second, got %+v", sketches)
+		}
+		// the returned sketches are copies
+		sketches["2025-03-01"].Add(4 << 60)
+		if sketches, _ := st.VisitorSketches("", "app", day, day.Add(24*time.Hour)); len(sketches) != 1 || sketches["2025-03-01"].Count() != 2 {
+			t.Fatalf("expected only the first day with 2 visitors, got %+v", sketches)
+		}
+
+		if n, _ := st.PurgeVisitorSketches(day.Add(24 * time.Hour)); n != 1 {
+			t.Fatalf("expected the first day purged, got %d", n)
+		}
+		if sketches, _ := st.VisitorSketches("", "app", day, day.Add(48*time.Hour)); len(sketches) != 1 {
+			t.Fatalf("expected the second day to be kept, got %+v", sketches)
+		}
+
+		// a namespace with a port next to a code named like the port
+		_ = st.AddVisitor(storage.Click{Namespace: "go.b.com:8080", Code: "app", Time: day, Visitor: 5 << 60})
+		if sketches, _ := st.VisitorSketches("go.b.com", "8080", day, day.Add(48*time.Hour)); len(sketches) != 0 {
+			t.Fatalf("expected no sketches of go.b.com/8080, got %+v", sketches)
+		}
+
+		salt, err := st.VisitorSalt(day)
+		if err != nil || len(salt) != saltSize {
+			t.Fatalf("VisitorSalt failed: %v", err)
+		}
+		if again, _ := st.VisitorSalt(day.Add(time.Hour)); !bytes.Equal(again, salt) {
+			t.Fatalf("expected the same salt for the day")
+		}
+		if next, _ := st.VisitorSalt(day.Add(24 * time.Hour)); bytes.Equal(next, salt) {
+			t.Fatalf("expected a new salt for the next day")
+		}
+		if n, _ := st.PurgeVisitorSalts(day.Add(24 * time.Hour)); n != 1 {
+			t.Fatalf("expected the first salt purged, got %d", n)
+		}
+		if again, _ := st.VisitorSalt(day); bytes.Equal(again, salt) {
+			t.Fatalf("expected a purged salt to be gone")
+		}
+	})
+}
+
+func TestBadger_BotClicks(t *testing.T) {
+	withStore(t, time.Hour, func(st *Store) {
+		_ = st.Save(storage.Link{URL: "https://abcd.com/x", Code: "app", Domain: "abcd.com"})
+
+		base := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+		for _, bot := range []bool{false, true, true} {
+			click := storage.Click{Code: "app", Time: base, Rule: storage.DefaultRule, Bot: bot}
+			_ = st.RecordClick(click)
+			_ = st.CountClick(click)
+		}
+
+		stats, _ := st.LinkStats("", "app")
+		if stats.Clicks != 1 || stats.Bots == nil || stats.Bots.Clicks != 2 {
+			t.Fatalf("expected 1 click and 2 bot clicks, got %+v", stats)
+		}
+
+		_ = st.Rollup(storage.Minute, base.Add(time.Minute))
+		hours, _ := st.Buckets("", "app", storage.Hour, base, base.Add(time.Hour))
+		if want := []storage.Bucket{{Start: base, Clicks: 1, Bots: 2}}; !reflect.DeepEqual(hours, want) {
+			t.Fatalf("expected %+v, got %+v", want, hours)
+		}
+	})
+}
+
+// ptr returns a pointer to v.
+func ptr[T any](v T) *T { return &v }
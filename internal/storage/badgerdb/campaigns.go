@@ -0,0 +1,93 @@
+package badgerdb
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const campaignPrefix = "campaign:"
+
+func keyCampaign(id string) []byte { return []byte(campaignPrefix + id) }
+
+// SaveCampaign stores a new campaign or replaces the one with its id.
+func (s *Store) SaveCampaign(campaign storage.Campaign) error {
+	val, err := json.Marshal(campaign)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(keyCampaign(campaign.ID), val)
+	})
+}
+
+// GetCampaign returns the campaign with the given id.
+func (s *Store) GetCampaign(id string) (storage.Campaign, bool, error) {
+	var campaign storage.Campaign
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(keyCampaign(id))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &campaign)
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return storage.Campaign{}, false, nil
+	}
+	if err != nil {
+		return storage.Campaign{}, false, err
+	}
+	return campaign, true, nil
+}
+
+// ListCampaigns returns the campaigns of owner, or of every owner if
+// allOwners is set, oldest first.
+func (s *Store) ListCampaigns(owner string, allOwners bool) ([]storage.Campaign, error) {
+	campaigns := []storage.Campaign{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(campaignPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var campaign storage.Campaign
+			if err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &campaign)
+			}); err != nil {
+				return err
+			}
+			if allOwners || campaign.Owner == owner {
+				campaigns = append(campaigns, campaign)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(campaigns, func(i, j int) bool {
+		if !campaigns[i].CreatedAt.Equal(campaigns[j].CreatedAt) {
+			return campaigns[i].CreatedAt.Before(campaigns[j].CreatedAt)
+		}
+		return campaigns[i].ID < campaigns[j].ID
+	})
+	return campaigns, nil
+}
+
+// DeleteCampaign removes a campaign.
+func (s *Store) DeleteCampaign(id string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(keyCampaign(id)); errors.Is(err, badger.ErrKeyNotFound) {
+			return storage.ErrCampaignNotFound
+		} else if err != nil {
+			return err
+		}
+		return txn.Delete(keyCampaign(id))
+	})
+}
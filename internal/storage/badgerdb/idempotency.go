@@ -0,0 +1,71 @@
+package badgerdb
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// conflictRetries is how often a transaction is retried on badger.ErrConflict.
+const conflictRetries = 3
+
+func keyIdempotency(key string) []byte { return []byte("idempotency:" + key) }
+
+// ReserveIdempotencyKey marks key as in flight for requestHash, or returns the
+// existing record if the key is known.
+func (s *Store) ReserveIdempotencyKey(key, requestHash string, ttl time.Duration) (storage.IdempotencyRecord, bool, error) {
+	var (
+		record   storage.IdempotencyRecord
+		reserved bool
+		err      error
+	)
+	for i := 0; i < conflictRetries; i++ {
+		err = s.db.Update(func(txn *badger.Txn) error {
+			item, err := txn.Get(keyIdempotency(key))
+			if err == nil {
+				reserved = false
+				return item.Value(func(val []byte) error {
+					return json.Unmarshal(val, &record)
+				})
+			}
+			if !errors.Is(err, badger.ErrKeyNotFound) {
+				return err
+			}
+			val, err := json.Marshal(storage.IdempotencyRecord{RequestHash: requestHash})
+			if err != nil {
+				return err
+			}
+			reserved = true
+			return txn.SetEntry(badger.NewEntry(keyIdempotency(key), val).WithTTL(ttl))
+		})
+		if !errors.Is(err, badger.ErrConflict) {
+			break
+		}
+	}
+	if err != nil {
+		return storage.IdempotencyRecord{}, false, err
+	}
+	return record, reserved, nil
+}
+
+// SaveIdempotencyResponse stores the response of a reserved key.
+func (s *Store) SaveIdempotencyResponse(key string, record storage.IdempotencyRecord, ttl time.Duration) error {
+	val, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.SetEntry(badger.NewEntry(keyIdempotency(key), val).WithTTL(ttl))
+	})
+}
+
+// ReleaseIdempotencyKey forgets a reserved key.
+func (s *Store) ReleaseIdempotencyKey(key string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(keyIdempotency(key))
+	})
+}
@@ -0,0 +1,307 @@
+package badgerdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/storage"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// linkValue is the value stored under a code key. Databases written before
+// links had owners store the bare url instead, which decodeLink still reads.
+type linkValue struct {
+	URL       string    `json:"url"`
+	Domain    string    `json:"domain"`
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Unindexed is set when the link has no url index entry.
+	Unindexed bool `json:"unindexed,omitempty"`
+	// PasswordHash is the bcrypt hash of the link password, if any.
+	PasswordHash string `json:"passwordHash,omitempty"`
+	// MaxClicks is the click limit of the link, zero when unlimited.
+	MaxClicks int `json:"maxClicks,omitempty"`
+	// ClicksLeft is the number of resolves left of a click-limited link.
+	ClicksLeft int `json:"clicksLeft,omitempty"`
+	// NotBefore and NotAfter bound the window the link redirects in.
+	NotBefore time.Time `json:"notBefore,omitzero"`
+	NotAfter  time.Time `json:"notAfter,omitzero"`
+	// FallbackURL is redirected to outside the window, if set.
+	FallbackURL string `json:"fallbackUrl,omitempty"`
+	// RedirectStatus is the redirect status code, zero for the default.
+	RedirectStatus int `json:"redirectStatus,omitempty"`
+	// Passthrough is what of the short url is passed on to URL.
+	Passthrough string `json:"passthrough,omitempty"`
+	// UTM are the utm parameters added to URL on redirect.
+	UTM common.UTM `json:"utm,omitzero"`
+	// Targets are the targeting rules of the link, tried in order.
+	Targets []common.TargetRule `json:"targets,omitempty"`
+	// Variants are the weighted destinations of the link.
+	Variants []common.Variant `json:"variants,omitempty"`
+	// Interstitial shows a warning page before the redirect.
+	Interstitial bool `json:"interstitial,omitempty"`
+	// Details are the title, description, tags and metadata of the link.
+	Details common.LinkDetails `json:"details,omitzero"`
+	// Campaign is the id of the campaign the link belongs to, if any.
+	Campaign string `json:"campaign,omitempty"`
+}
+
+func decodeLink(val []byte) linkValue {
+	var v linkValue
+	if bytes.HasPrefix(val, []byte("{")) && json.Unmarshal(val, &v) == nil {
+		return v
+	}
+	return linkValue{URL: string(val)}
+}
+
+// GetLink returns the link stored for code in the namespace.
+func (s *Store) GetLink(namespace, code string) (storage.LinkRecord, bool) {
+	var link storage.LinkRecord
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		link, err = getLink(txn, namespace, code)
+		return err
+	})
+	return link, err == nil
+}
+
+// ListLinks returns the live links matching filter, oldest first. Links
+// saved before owners were recorded are not indexed and not listed.
+func (s *Store) ListLinks(filter storage.LinkFilter) ([]storage.LinkRecord, error) {
+	links := []storage.LinkRecord{}
+	prefix := []byte(ownerLinksPrefix(filter.Owner, filter.AllOwners))
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			// The key ends in "<namespace>:<code>"; codes never contain ':'.
+			rest := string(it.Item().Key()[len("owner_links:"):])
+			_, rest, _ = strings.Cut(rest, ":")
+			i := strings.LastIndexByte(rest, ':')
+			if i < 0 {
+				continue
+			}
+			link, err := getLink(txn, rest[:i], rest[i+1:])
+			if errors.Is(err, badger.ErrKeyNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if filter.Matches(link) {
+				links = append(links, link)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if !links[i].CreatedAt.Equal(links[j].CreatedAt) {
+			return links[i].CreatedAt.Before(links[j].CreatedAt)
+		}
+		if links[i].Namespace != links[j].Namespace {
+			return links[i].Namespace < links[j].Namespace
+		}
+		return links[i].Code < links[j].Code
+	})
+	return links, nil
+}
+
+// UpdateLink applies every change of patch to an existing link in one
+// transaction, keeping its expiry.
+func (s *Store) UpdateLink(namespace, code string, patch storage.LinkPatch) error {
+	return s.updateLink(namespace, code, func(v *linkValue) {
+		if patch.URL != nil {
+			v.URL = *patch.URL
+			v.Domain = patch.Domain
+		}
+		if patch.Variants != nil {
+			v.Variants = *patch.Variants
+		}
+		if patch.Details != nil {
+			v.Details = *patch.Details
+		}
+		if patch.Campaign != nil {
+			v.Campaign = *patch.Campaign
+		}
+	})
+}
+
+// updateLink applies update to an existing link and removes it from the url
+// index, keeping its expiry.
+func (s *Store) updateLink(namespace, code string, update func(v *linkValue)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(keyCode(namespace, code))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return storage.ErrLinkNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var v linkValue
+		if err := item.Value(func(val []byte) error {
+			v = decodeLink(val)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := unindex(txn, namespace, code, v); err != nil {
+			return err
+		}
+		update(&v)
+		v.Unindexed = true
+		val, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return txn.SetEntry(withExpiry(badger.NewEntry(keyCode(namespace, code), val), item.ExpiresAt()))
+	})
+}
+
+// DeleteLink removes a link and its index entries.
+func (s *Store) DeleteLink(namespace, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(keyCode(namespace, code))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return storage.ErrLinkNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var v linkValue
+		if err := item.Value(func(val []byte) error {
+			v = decodeLink(val)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := unindex(txn, namespace, code, v); err != nil {
+			return err
+		}
+		if err := txn.Delete(keyOwnerLink(v.Owner, namespace, code)); err != nil {
+			return err
+		}
+		if err := txn.Delete(keyStats(namespace, code)); err != nil {
+			return err
+		}
+		return txn.Delete(keyCode(namespace, code))
+	})
+}
+
+// UseClick takes one of the clicks left of a click-limited link. Writers
+// are serialized, so the read and the decrement cannot interleave with
+// another click.
+func (s *Store) UseClick(namespace, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(keyCode(namespace, code))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return storage.ErrLinkNotFound
+		}
+		if err != nil {
+			return err
+		}
+		var v linkValue
+		if err := item.Value(func(val []byte) error {
+			v = decodeLink(val)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if v.MaxClicks == 0 {
+			return nil
+		}
+		if v.ClicksLeft <= 0 {
+			return storage.ErrClicksExhausted
+		}
+		v.ClicksLeft--
+		val, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return txn.SetEntry(withExpiry(badger.NewEntry(keyCode(namespace, code), val), item.ExpiresAt()))
+	})
+}
+
+// unindex removes the url index entry of a link if it points to code.
+func unindex(txn *badger.Txn, namespace, code string, v linkValue) error {
+	key := keyURL(namespace, v.Owner, v.URL)
+	item, err := txn.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	indexed, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+	if string(indexed) != code {
+		return nil
+	}
+	return txn.Delete(key)
+}
+
+func getLink(txn *badger.Txn, namespace, code string) (storage.LinkRecord, error) {
+	item, err := txn.Get(keyCode(namespace, code))
+	if err != nil {
+		return storage.LinkRecord{}, err
+	}
+	var v linkValue
+	if err := item.Value(func(val []byte) error {
+		v = decodeLink(val)
+		return nil
+	}); err != nil {
+		return storage.LinkRecord{}, err
+	}
+	link := storage.LinkRecord{
+		Namespace:      namespace,
+		Code:           code,
+		URL:            v.URL,
+		Domain:         v.Domain,
+		Owner:          v.Owner,
+		CreatedAt:      v.CreatedAt,
+		PasswordHash:   v.PasswordHash,
+		MaxClicks:      v.MaxClicks,
+		ClicksLeft:     v.ClicksLeft,
+		NotBefore:      v.NotBefore,
+		NotAfter:       v.NotAfter,
+		FallbackURL:    v.FallbackURL,
+		RedirectStatus: v.RedirectStatus,
+		Passthrough:    v.Passthrough,
+		UTM:            v.UTM,
+		Targets:        v.Targets,
+		Variants:       v.Variants,
+		Interstitial:   v.Interstitial,
+		Details:        v.Details,
+		Campaign:       v.Campaign,
+	}
+	if exp := item.ExpiresAt(); exp > 0 {
+		link.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	return link, nil
+}
+
+// withExpiry sets the absolute expiry of an entry, as returned by
+// badger.Item.ExpiresAt; zero means the entry does not expire.
+func withExpiry(e *badger.Entry, expiresAt uint64) *badger.Entry {
+	e.ExpiresAt = expiresAt
+	return e
+}
@@ -0,0 +1,65 @@
+package badgerdb
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// keyStats holds the click stats of a link. They expire with the link.
+func keyStats(namespace, code string) []byte { return nsKey(namespace, "stats:"+code) }
+
+// RecordClick counts click in the stats of its link. Writers are
+// serialized, so concurrent clicks are not lost.
+func (s *Store) RecordClick(click storage.Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Update(func(txn *badger.Txn) error {
+		link, err := txn.Get(keyCode(click.Namespace, click.Code))
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return storage.ErrLinkNotFound
+		}
+		if err != nil {
+			return err
+		}
+		stats, err := getStats(txn, click.Namespace, click.Code)
+		if err != nil {
+			return err
+		}
+		stats.Count(click)
+		val, err := json.Marshal(stats)
+		if err != nil {
+			return err
+		}
+		return txn.SetEntry(withExpiry(badger.NewEntry(keyStats(click.Namespace, click.Code), val), link.ExpiresAt()))
+	})
+}
+
+// LinkStats returns the stats of a link.
+func (s *Store) LinkStats(namespace, code string) (storage.LinkStats, error) {
+	var stats storage.LinkStats
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		stats, err = getStats(txn, namespace, code)
+		return err
+	})
+	return stats, err
+}
+
+func getStats(txn *badger.Txn, namespace, code string) (storage.LinkStats, error) {
+	var stats storage.LinkStats
+	item, err := txn.Get(keyStats(namespace, code))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, err
+	}
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &stats)
+	})
+	return stats, err
+}
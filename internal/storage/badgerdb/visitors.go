@@ -0,0 +1,169 @@
+package badgerdb
+
+import (
+	"crypto/rand"
+	"errors"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+	"github.com/parikshitg/urlshortener/pkg/hll"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// saltSize is the length of the visitor salts in bytes.
+const saltSize = 32
+
+// Visitor sketches are keyed "visitors:<link>:<day>", with the link as in
+// the analytics keys, so the days of a link are one prefix, ordered by day.
+const visitorsPrefix = "visitors:"
+
+func visitorPrefix(namespace, code string) string {
+	return visitorsPrefix + linkKey(namespace, code) + ":"
+}
+
+func keyVisitors(namespace, code, day string) []byte {
+	return []byte(visitorPrefix(namespace, code) + day)
+}
+
+// dayLength is the length of a day formatted as storage.DayFormat.
+const dayLength = len(storage.DayFormat)
+
+const saltPrefix = "visitor_salt:"
+
+func keySalt(day string) []byte { return []byte(saltPrefix + day) }
+
+// AddVisitor adds the visitor of click to the sketch of its link for the
+// day. The sketch is only written when the visitor changed it.
+func (s *Store) AddVisitor(click storage.Click) error {
+	key := keyVisitors(click.Namespace, click.Code, click.Time.UTC().Format(storage.DayFormat))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.db.Update(func(txn *badger.Txn) error {
+		sketch := hll.New()
+		item, err := txn.Get(key)
+		switch {
+		case err == nil:
+			if err := item.Value(sketch.UnmarshalBinary); err != nil {
+				return err
+			}
+		case !errors.Is(err, badger.ErrKeyNotFound):
+			return err
+		}
+		if !sketch.Add(click.Visitor) {
+			return nil
+		}
+		val, err := sketch.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		return txn.Set(key, val)
+	})
+}
+
+// VisitorSketches returns the sketches of a link for the days from the day
+// of from until the day before the day of to.
+func (s *Store) VisitorSketches(namespace, code string, from, to time.Time) (map[string]*hll.Sketch, error) {
+	sketches := make(map[string]*hll.Sketch)
+	prefix := visitorPrefix(namespace, code)
+	end := keyVisitors(namespace, code, to.UTC().Format(storage.DayFormat))
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(prefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Seek(keyVisitors(namespace, code, from.UTC().Format(storage.DayFormat))); it.Valid(); it.Next() {
+			key := it.Item().Key()
+			if string(key) >= string(end) {
+				break
+			}
+			sketch := hll.New()
+			if err := it.Item().Value(sketch.UnmarshalBinary); err != nil {
+				return err
+			}
+			sketches[string(key[len(prefix):])] = sketch
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sketches, nil
+}
+
+// PurgeVisitorSketches deletes the sketches of the days before the day of
+// before.
+func (s *Store) PurgeVisitorSketches(before time.Time) (int, error) {
+	end := before.UTC().Format(storage.DayFormat)
+	return s.deleteKeys([]byte(visitorsPrefix), func(key []byte) bool {
+		return string(key[len(key)-dayLength:]) < end
+	})
+}
+
+// VisitorSalt returns the salt of the day of t, creating it the first time.
+func (s *Store) VisitorSalt(t time.Time) ([]byte, error) {
+	key := keySalt(t.UTC().Format(storage.DayFormat))
+	var salt []byte
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(key)
+		if err == nil {
+			salt, err = item.ValueCopy(nil)
+			return err
+		}
+		if !errors.Is(err, badger.ErrKeyNotFound) {
+			return err
+		}
+		salt = make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return err
+		}
+		return txn.Set(key, salt)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// PurgeVisitorSalts deletes the salts of the days before the day of before.
+func (s *Store) PurgeVisitorSalts(before time.Time) (int, error) {
+	end := before.UTC().Format(storage.DayFormat)
+	return s.deleteKeys([]byte(saltPrefix), func(key []byte) bool {
+		return string(key[len(saltPrefix):]) < end
+	})
+}
+
+// deleteKeys deletes the keys with prefix that match.
+func (s *Store) deleteKeys(prefix []byte, match func(key []byte) bool) (int, error) {
+	var keys [][]byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		opts.PrefetchValues = false
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if match(it.Item().Key()) {
+				keys = append(keys, it.Item().KeyCopy(nil))
+			}
+		}
+		return nil
+	})
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+
+	wb := s.db.NewWriteBatch()
+	defer wb.Cancel()
+	for _, key := range keys {
+		if err := wb.Delete(key); err != nil {
+			return 0, err
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+)
+
+// CountClick adds click to the minute bucket of its time.
+func (m *MemStore) CountClick(click storage.Click) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b := storage.Bucket{Start: storage.Minute.Truncate(click.Time), Clicks: 1}
+	if click.Bot {
+		b.Clicks, b.Bots = 0, 1
+	}
+	m.addBucketLocked(storage.Minute, recordKey{click.Namespace, click.Code}, b)
+	return nil
+}
+
+// addBucketLocked adds the counts of b to the bucket starting at b.Start;
+// m.mu must be held for writing.
+func (m *MemStore) addBucketLocked(g storage.Granularity, key recordKey, b storage.Bucket) {
+	links := m.buckets[g]
+	if links == nil {
+		links = make(map[recordKey]map[time.Time]storage.Bucket)
+		m.buckets[g] = links
+	}
+	buckets := links[key]
+	if buckets == nil {
+		buckets = make(map[time.Time]storage.Bucket)
+		links[key] = buckets
+	}
+	sum := buckets[b.Start]
+	sum.Start = b.Start
+	sum.Clicks += b.Clicks
+	sum.Bots += b.Bots
+	buckets[b.Start] = sum
+}
+
+// Buckets returns the buckets of a link that start in [from, to).
+func (m *MemStore) Buckets(namespace, code string, g storage.Granularity, from, to time.Time) ([]storage.Bucket, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	buckets := []storage.Bucket{}
+	for start, b := range m.buckets[g][recordKey{namespace, code}] {
+		if !start.Before(from) && start.Before(to) {
+			buckets = append(buckets, b)
+		}
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Start.Before(buckets[j].Start)
+	})
+	return buckets, nil
+}
+
+// Rollup adds the buckets of g that were not rolled up yet and start before
+// before to the buckets of the next coarser granularity.
+func (m *MemStore) Rollup(g storage.Granularity, before time.Time) error {
+	coarser := g.Coarser()
+	if coarser == "" {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	from := m.rolledUp[g]
+	if !before.After(from) {
+		return nil
+	}
+	for key, buckets := range m.buckets[g] {
+		for start, b := range buckets {
+			if !start.Before(from) && start.Before(before) {
+				b.Start = coarser.Truncate(start)
+				m.addBucketLocked(coarser, key, b)
+			}
+		}
+	}
+	m.rolledUp[g] = before
+	return nil
+}
+
+// RolledUp returns the time the buckets of g are rolled up to.
+func (m *MemStore) RolledUp(g storage.Granularity) (time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.rolledUp[g], nil
+}
+
+// PurgeBuckets deletes the buckets of g starting before before.
+func (m *MemStore) PurgeBuckets(g storage.Granularity, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	purged := 0
+	links := m.buckets[g]
+	for key, buckets := range links {
+		for start := range buckets {
+			if start.Before(before) {
+				delete(buckets, start)
+				purged++
+			}
+		}
+		if len(buckets) == 0 {
+			delete(links, key)
+		}
+	}
+	return purged, nil
+}
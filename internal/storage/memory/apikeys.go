@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+)
+
+// SaveAPIKey stores a new api key.
+func (m *MemStore) SaveAPIKey(key storage.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.apiKeys[key.ID] = key
+	m.apiKeyHashes[key.Hash] = key.ID
+	return nil
+}
+
+// APIKeyByHash returns the key with the given secret hash.
+func (m *MemStore) APIKeyByHash(hash string) (storage.APIKey, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ok := m.apiKeyHashes[hash]
+	if !ok {
+		return storage.APIKey{}, false, nil
+	}
+	return m.apiKeys[id], true, nil
+}
+
+// ListAPIKeys returns all keys, oldest first.
+func (m *MemStore) ListAPIKeys() ([]storage.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]storage.APIKey, 0, len(m.apiKeys))
+	for _, key := range m.apiKeys {
+		keys = append(keys, key)
+	}
+	sortAPIKeys(keys)
+	return keys, nil
+}
+
+// RevokeAPIKey marks the key as revoked.
+func (m *MemStore) RevokeAPIKey(id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key, ok := m.apiKeys[id]
+	if !ok {
+		return storage.ErrAPIKeyNotFound
+	}
+	if !key.Revoked() {
+		key.RevokedAt = at
+		m.apiKeys[id] = key
+	}
+	return nil
+}
+
+// sortAPIKeys orders keys by creation time, then id.
+func sortAPIKeys(keys []storage.APIKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+}
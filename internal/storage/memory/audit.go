@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+)
+
+// AppendAudit stores a new event.
+func (m *MemStore) AppendAudit(event storage.AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := sort.Search(len(m.audit), func(i int) bool { return m.audit[i].ID > event.ID })
+	m.audit = append(m.audit, storage.AuditEvent{})
+	copy(m.audit[i+1:], m.audit[i:])
+	m.audit[i] = event
+	return nil
+}
+
+// ListAudit returns the events matching filter, newest first.
+func (m *MemStore) ListAudit(filter storage.AuditFilter) ([]storage.AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := []storage.AuditEvent{}
+	for i := len(m.audit) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+		event := m.audit[i]
+		if filter.Before != "" && event.ID >= filter.Before {
+			continue
+		}
+		if filter.Matches(event) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// PurgeAudit deletes the events older than before.
+func (m *MemStore) PurgeAudit(before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.audit[:0]
+	for _, event := range m.audit {
+		if !event.Time.Before(before) {
+			kept = append(kept, event)
+		}
+	}
+	purged := len(m.audit) - len(kept)
+	clear(m.audit[len(kept):])
+	m.audit = kept
+	return purged, nil
+}
@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"sort"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+)
+
+// SaveCampaign stores a new campaign or replaces the one with its id.
+func (m *MemStore) SaveCampaign(campaign storage.Campaign) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.campaigns[campaign.ID] = campaign
+	return nil
+}
+
+// GetCampaign returns the campaign with the given id.
+func (m *MemStore) GetCampaign(id string) (storage.Campaign, bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	campaign, ok := m.campaigns[id]
+	return campaign, ok, nil
+}
+
+// ListCampaigns returns the campaigns of owner, or of every owner if
+// allOwners is set, oldest first.
+func (m *MemStore) ListCampaigns(owner string, allOwners bool) ([]storage.Campaign, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	campaigns := []storage.Campaign{}
+	for _, campaign := range m.campaigns {
+		if allOwners || campaign.Owner == owner {
+			campaigns = append(campaigns, campaign)
+		}
+	}
+	sortCampaigns(campaigns)
+	return campaigns, nil
+}
+
+// DeleteCampaign removes a campaign.
+func (m *MemStore) DeleteCampaign(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.campaigns[id]; !ok {
+		return storage.ErrCampaignNotFound
+	}
+	delete(m.campaigns, id)
+	return nil
+}
+
+// sortCampaigns orders campaigns by creation time, then id.
+func sortCampaigns(campaigns []storage.Campaign) {
+	sort.Slice(campaigns, func(i, j int) bool {
+		if !campaigns[i].CreatedAt.Equal(campaigns[j].CreatedAt) {
+			return campaigns[i].CreatedAt.Before(campaigns[j].CreatedAt)
+		}
+		return campaigns[i].ID < campaigns[j].ID
+	})
+}
@@ -0,0 +1,47 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+)
+
+type idempotencyEntry struct {
+	record storage.IdempotencyRecord
+	expiry time.Time
+}
+
+// ReserveIdempotencyKey marks key as in flight for requestHash, or returns the
+// existing record if the key is known.
+func (m *MemStore) ReserveIdempotencyKey(key, requestHash string, ttl time.Duration) (storage.IdempotencyRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if entry, ok := m.idempotency[key]; ok && now.Before(entry.expiry) {
+		return entry.record, false, nil
+	}
+	m.idempotency[key] = idempotencyEntry{
+		record: storage.IdempotencyRecord{RequestHash: requestHash},
+		expiry: now.Add(ttl),
+	}
+	return storage.IdempotencyRecord{}, true, nil
+}
+
+// SaveIdempotencyResponse stores the response of a reserved key.
+func (m *MemStore) SaveIdempotencyResponse(key string, record storage.IdempotencyRecord, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.idempotency[key] = idempotencyEntry{record: record, expiry: time.Now().Add(ttl)}
+	return nil
+}
+
+// ReleaseIdempotencyKey forgets a reserved key.
+func (m *MemStore) ReleaseIdempotencyKey(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.idempotency, key)
+	return nil
+}
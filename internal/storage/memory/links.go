@@ -0,0 +1,149 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+)
+
+// GetLink returns the link stored for code in the namespace.
+func (m *MemStore) GetLink(namespace, code string) (storage.LinkRecord, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	record, ok := m.codeToRecord[recordKey{namespace, code}]
+	if !ok || !time.Now().Before(record.Expiry) {
+		return storage.LinkRecord{}, false
+	}
+	return record.link(), true
+}
+
+// ListLinks returns the live links matching filter, oldest first.
+func (m *MemStore) ListLinks(filter storage.LinkFilter) ([]storage.LinkRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	links := []storage.LinkRecord{}
+	for _, record := range m.codeToRecord {
+		if !now.Before(record.Expiry) || (!filter.AllOwners && record.Owner != filter.Owner) {
+			continue
+		}
+		if link := record.link(); filter.Matches(link) {
+			links = append(links, link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if !links[i].CreatedAt.Equal(links[j].CreatedAt) {
+			return links[i].CreatedAt.Before(links[j].CreatedAt)
+		}
+		if links[i].Namespace != links[j].Namespace {
+			return links[i].Namespace < links[j].Namespace
+		}
+		return links[i].Code < links[j].Code
+	})
+	return links, nil
+}
+
+// UpdateLink applies every change of patch to an existing link under one
+// lock, keeping its expiry.
+func (m *MemStore) UpdateLink(namespace, code string, patch storage.LinkPatch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := recordKey{namespace, code}
+	record, ok := m.codeToRecord[key]
+	if !ok || !time.Now().Before(record.Expiry) {
+		return storage.ErrLinkNotFound
+	}
+	m.unindexLocked(record)
+	if patch.URL != nil {
+		record.OriginalUrl = *patch.URL
+		record.Domain = patch.Domain
+	}
+	if patch.Variants != nil {
+		record.Variants = *patch.Variants
+	}
+	if patch.Details != nil {
+		record.Details = *patch.Details
+	}
+	if patch.Campaign != nil {
+		record.Campaign = *patch.Campaign
+	}
+	record.Unindexed = true
+	m.codeToRecord[key] = record
+	return nil
+}
+
+// DeleteLink removes a link.
+func (m *MemStore) DeleteLink(namespace, code string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := recordKey{namespace, code}
+	record, ok := m.codeToRecord[key]
+	if !ok || !time.Now().Before(record.Expiry) {
+		return storage.ErrLinkNotFound
+	}
+	m.unindexLocked(record)
+	delete(m.codeToRecord, key)
+	delete(m.stats, key)
+	return nil
+}
+
+// UseClick takes one of the clicks left of a click-limited link.
+func (m *MemStore) UseClick(namespace, code string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := recordKey{namespace, code}
+	record, ok := m.codeToRecord[key]
+	if !ok || !time.Now().Before(record.Expiry) {
+		return storage.ErrLinkNotFound
+	}
+	if record.MaxClicks == 0 {
+		return nil
+	}
+	if record.ClicksLeft <= 0 {
+		return storage.ErrClicksExhausted
+	}
+	record.ClicksLeft--
+	m.codeToRecord[key] = record
+	return nil
+}
+
+// unindexLocked removes the url index entry of record if it points to it;
+// m.mu must be held for writing.
+func (m *MemStore) unindexLocked(record Record) {
+	key := urlKey{record.Namespace, record.Owner, record.OriginalUrl}
+	if m.urlToCode[key] == record.Code {
+		delete(m.urlToCode, key)
+	}
+}
+
+func (r Record) link() storage.LinkRecord {
+	return storage.LinkRecord{
+		Namespace:      r.Namespace,
+		Code:           r.Code,
+		URL:            r.OriginalUrl,
+		Domain:         r.Domain,
+		Owner:          r.Owner,
+		CreatedAt:      r.CreatedAt,
+		ExpiresAt:      r.Expiry,
+		PasswordHash:   r.PasswordHash,
+		MaxClicks:      r.MaxClicks,
+		ClicksLeft:     r.ClicksLeft,
+		NotBefore:      r.NotBefore,
+		NotAfter:       r.NotAfter,
+		FallbackURL:    r.FallbackURL,
+		RedirectStatus: r.RedirectStatus,
+		Passthrough:    r.Passthrough,
+		UTM:            r.UTM,
+		Targets:        r.Targets,
+		Variants:       r.Variants,
+		Interstitial:   r.Interstitial,
+		Details:        r.Details,
+		Campaign:       r.Campaign,
+	}
+}
@@ -6,14 +6,47 @@ import (
 	"time"
 
 	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/storage"
+	"github.com/parikshitg/urlshortener/pkg/hll"
 )
 
 type Record struct {
+	Namespace   string
 	Domain      string
 	Code        string
 	OriginalUrl string
+	Owner       string
 	CreatedAt   time.Time
 	Expiry      time.Time
+	// Unindexed is set when the link must not be used for url dedupe.
+	Unindexed bool
+	// PasswordHash is the bcrypt hash of the link password, if any.
+	PasswordHash string
+	// MaxClicks is the click limit of the link, zero when unlimited.
+	MaxClicks int
+	// ClicksLeft is the number of resolves left of a click-limited link.
+	ClicksLeft int
+	// NotBefore and NotAfter bound the window the link redirects in.
+	NotBefore time.Time
+	NotAfter  time.Time
+	// FallbackURL is redirected to outside the window, if set.
+	FallbackURL string
+	// RedirectStatus is the redirect status code, zero for the default.
+	RedirectStatus int
+	// Passthrough is what of the short url is passed on to URL.
+	Passthrough string
+	// UTM are the utm parameters added to URL on redirect.
+	UTM common.UTM
+	// Targets are the targeting rules of the link, tried in order.
+	Targets []common.TargetRule
+	// Variants are the weighted destinations of the link.
+	Variants []common.Variant
+	// Interstitial shows a warning page before the redirect.
+	Interstitial bool
+	// Details are the title, description, tags and metadata of the link.
+	Details common.LinkDetails
+	// Campaign is the id of the campaign the link belongs to, if any.
+	Campaign string
 }
 
 // MemStore is an in memory storage unit for our service.
@@ -23,100 +56,228 @@ type MemStore struct {
 
 	expiry time.Duration
 
-	// urlToRecord is a map of url and its shortened code
-	urlToRecord map[string]Record
+	// codeToRecord is a map of namespaced code and its record
+	codeToRecord map[recordKey]Record
+
+	// urlToCode is a map of namespaced url of an owner and its shortened code
+	urlToCode map[urlKey]string
 
 	// domainHits is a map of domain and number of times that domain has been shortened
 	domainHits map[string]int
+
+	// ownerHits is a map of owner and its domain hits
+	ownerHits map[string]map[string]int
+
+	// idempotency is a map of idempotency key and its stored response
+	idempotency map[string]idempotencyEntry
+
+	// apiKeys is a map of api key id and its key
+	apiKeys map[string]storage.APIKey
+
+	// apiKeyHashes is a map of api key secret hash and its id
+	apiKeyHashes map[string]string
+
+	// audit is the audit log, ordered by event id
+	audit []storage.AuditEvent
+
+	// stats is a map of namespaced code and the click stats of its link
+	stats map[recordKey]storage.LinkStats
+
+	// campaigns is a map of campaign id and its campaign
+	campaigns map[string]storage.Campaign
+
+	// buckets holds the analytics buckets by granularity, namespaced code
+	// and bucket start
+	buckets map[storage.Granularity]map[recordKey]map[time.Time]storage.Bucket
+
+	// rolledUp is the time the buckets of each granularity are rolled up to
+	rolledUp map[storage.Granularity]time.Time
+
+	// visitors is a map of namespaced code and its visitor sketches by day
+	visitors map[recordKey]map[string]*hll.Sketch
+
+	// salts is a map of day and its visitor salt
+	salts map[string][]byte
+}
+
+// recordKey identifies a code within a namespace.
+type recordKey struct {
+	namespace string
+	key       string
+}
+
+// urlKey identifies the url of an owner within a namespace.
+type urlKey struct {
+	namespace string
+	owner     string
+	url       string
 }
 
 // NewMemStore creates an instance of MemStore.
 func NewMemStore(expiry time.Duration) *MemStore {
 	return &MemStore{
-		expiry:      expiry,
-		urlToRecord: make(map[string]Record),
-		domainHits:  make(map[string]int),
+		expiry:       expiry,
+		codeToRecord: make(map[recordKey]Record),
+		urlToCode:    make(map[urlKey]string),
+		domainHits:   make(map[string]int),
+		ownerHits:    make(map[string]map[string]int),
+		idempotency:  make(map[string]idempotencyEntry),
+		apiKeys:      make(map[string]storage.APIKey),
+		apiKeyHashes: make(map[string]string),
+		stats:        make(map[recordKey]storage.LinkStats),
+		campaigns:    make(map[string]storage.Campaign),
+		buckets:      make(map[storage.Granularity]map[recordKey]map[time.Time]storage.Bucket),
+		rolledUp:     make(map[storage.Granularity]time.Time),
+		visitors:     make(map[recordKey]map[string]*hll.Sketch),
+		salts:        make(map[string][]byte),
 	}
 }
 
-// GetCode takes an url and gives the corresponding unique code.
-func (m *MemStore) GetCode(url string) (string, bool) {
+// GetCode takes an url and gives the corresponding unique code of the owner in the namespace.
+func (m *MemStore) GetCode(namespace, owner, url string) (string, bool) {
 	if url == "" {
 		return "", false
 	}
 
 	m.mu.RLock()
-	record, ok := m.urlToRecord[url]
-	m.mu.RUnlock()
+	defer m.mu.RUnlock()
 
+	code, ok := m.urlToCode[urlKey{namespace, owner, url}]
 	if !ok {
 		return "", false
 	}
-
-	now := time.Now()
-	if now.Before(record.Expiry) {
-		return record.Code, true
+	record, ok := m.codeToRecord[recordKey{namespace, code}]
+	if !ok || record.OriginalUrl != url || record.Owner != owner || record.Unindexed || !time.Now().Before(record.Expiry) {
+		return "", false
 	}
-	// expired: delete and miss
-	m.mu.Lock()
-	delete(m.urlToRecord, url)
-	m.mu.Unlock()
-	return "", false
+	return code, true
 }
 
-// GetURL takes a code and gives corresponding original url if exists.
-func (m *MemStore) GetURL(code string) string {
+// GetURL takes a code and gives corresponding original url if exists in the namespace.
+func (m *MemStore) GetURL(namespace, code string) string {
 	if code == "" {
 		return ""
 	}
 
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	for url, c := range m.urlToRecord {
-		if c.Code == code && time.Now().Before(c.Expiry) {
-			return url
-		}
+
+	record, ok := m.codeToRecord[recordKey{namespace, code}]
+	if !ok || !time.Now().Before(record.Expiry) {
+		return ""
 	}
-	return ""
+	return record.OriginalUrl
 }
 
-// Save saves the url, code and domain hits in memstore.
-func (m *MemStore) Save(url, code, domain string) {
-	if url == "" || code == "" || domain == "" {
-		return // Skip invalid entries
+// Save saves the link and its domain hit in memstore.
+func (m *MemStore) Save(link storage.Link) error {
+	if link.URL == "" || link.Code == "" || link.Domain == "" {
+		return nil // Skip invalid entries
 	}
 
-	now := time.Now()
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return m.saveLocked(link, time.Now())
+}
+
+// SaveBatch saves all links under a single lock, checking every code before
+// saving any link.
+func (m *MemStore) SaveBatch(links []storage.Link) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	batch := make(map[recordKey]storage.Link, len(links))
+	for _, link := range links {
+		if link.URL == "" || link.Code == "" || link.Domain == "" {
+			continue
+		}
+		key := recordKey{link.Namespace, link.Code}
+		if other, ok := batch[key]; ok && (other.URL != link.URL || other.Owner != link.Owner) {
+			return storage.ErrCodeExists
+		}
+		batch[key] = link
+		if existing, exists := m.codeToRecord[key]; exists && now.Before(existing.Expiry) &&
+			(existing.OriginalUrl != link.URL || existing.Owner != link.Owner) {
+			return storage.ErrCodeExists
+		}
+	}
+	for _, link := range links {
+		if link.URL == "" || link.Code == "" || link.Domain == "" {
+			continue
+		}
+		if err := m.saveLocked(link, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	if existing, exists := m.urlToRecord[url]; exists {
-		if now.After(existing.Expiry) {
-			// overwrite expired
-			m.urlToRecord[url] = Record{
-				Domain:      domain,
-				Code:        code,
-				OriginalUrl: url,
-				CreatedAt:   now,
-				Expiry:      now.Add(m.expiry),
-			}
-			m.domainHits[domain]++
+// saveLocked stores link; m.mu must be held for writing.
+func (m *MemStore) saveLocked(link storage.Link, now time.Time) error {
+	codeKey := recordKey{link.Namespace, link.Code}
+	if existing, exists := m.codeToRecord[codeKey]; exists && now.Before(existing.Expiry) {
+		if existing.OriginalUrl == link.URL && existing.Owner == link.Owner {
+			return nil
 		}
-		return
+		return storage.ErrCodeExists
+	}
+
+	// an expired link with the same code may have left stats behind
+	delete(m.stats, codeKey)
+
+	ttl := m.expiry
+	if link.TTL > 0 {
+		ttl = link.TTL
 	}
+	m.codeToRecord[codeKey] = Record{
+		Namespace:      link.Namespace,
+		Domain:         link.Domain,
+		Code:           link.Code,
+		OriginalUrl:    link.URL,
+		Owner:          link.Owner,
+		CreatedAt:      now,
+		Expiry:         now.Add(ttl),
+		Unindexed:      !link.Indexed(),
+		PasswordHash:   link.PasswordHash,
+		MaxClicks:      link.MaxClicks,
+		ClicksLeft:     link.MaxClicks,
+		NotBefore:      link.NotBefore,
+		NotAfter:       link.NotAfter,
+		FallbackURL:    link.FallbackURL,
+		RedirectStatus: link.RedirectStatus,
+		Passthrough:    link.Passthrough,
+		UTM:            link.UTM,
+		Targets:        link.Targets,
+		Variants:       link.Variants,
+		Interstitial:   link.Interstitial,
+		Details:        link.Details,
+		Campaign:       link.Campaign,
+	}
+	m.domainHits[link.Domain]++
+	if m.ownerHits[link.Owner] == nil {
+		m.ownerHits[link.Owner] = make(map[string]int)
+	}
+	m.ownerHits[link.Owner][link.Domain]++
 
-	m.urlToRecord[url] = Record{
-		Domain:      domain,
-		Code:        code,
-		OriginalUrl: url,
-		CreatedAt:   now,
-		Expiry:      now.Add(m.expiry),
+	if link.Indexed() {
+		key := urlKey{link.Namespace, link.Owner, link.URL}
+		if code, ok := m.urlToCode[key]; !ok || !m.liveLocked(link.Namespace, code, now) {
+			m.urlToCode[key] = link.Code
+		}
 	}
-	m.domainHits[domain]++
+	return nil
 }
 
-// TopDomains returns the top n domains based on domain hits.
-func (m *MemStore) TopDomains(n int) []common.TopN {
+// liveLocked reports whether code exists and has not expired.
+func (m *MemStore) liveLocked(namespace, code string, now time.Time) bool {
+	record, ok := m.codeToRecord[recordKey{namespace, code}]
+	return ok && now.Before(record.Expiry)
+}
+
+// TopDomains returns the top n domains based on the domain hits of owner,
+// or on all domain hits if owner is empty.
+func (m *MemStore) TopDomains(owner string, n int) []common.TopN {
 	if n <= 0 {
 		return []common.TopN{}
 	}
@@ -129,8 +290,13 @@ func (m *MemStore) TopDomains(n int) []common.TopN {
 		hits   int
 	}
 
+	domainHits := m.domainHits
+	if owner != "" {
+		domainHits = m.ownerHits[owner]
+	}
+
 	var kvs []kv
-	for domain, hits := range m.domainHits {
+	for domain, hits := range domainHits {
 		kvs = append(kvs, kv{
 			domain: domain,
 			hits:   hits,
@@ -164,15 +330,26 @@ func (m *MemStore) Purge() {
 	defer m.mu.Unlock()
 
 	now := time.Now()
-	for url, r := range m.urlToRecord {
+	for key, r := range m.codeToRecord {
 		if now.After(r.Expiry) {
-			delete(m.urlToRecord, url)
+			delete(m.codeToRecord, key)
+			delete(m.stats, key)
+		}
+	}
+	for key, code := range m.urlToCode {
+		if !m.liveLocked(key.namespace, code, now) {
+			delete(m.urlToCode, key)
+		}
+	}
+	for key, entry := range m.idempotency {
+		if now.After(entry.expiry) {
+			delete(m.idempotency, key)
 		}
 	}
 }
 
-// CodeExists checks if a shortcode already exists in the storage.
-func (m *MemStore) CodeExists(code string) bool {
+// CodeExists checks if a shortcode already exists in the namespace.
+func (m *MemStore) CodeExists(namespace, code string) bool {
 	if code == "" {
 		return false
 	}
@@ -180,11 +357,5 @@ func (m *MemStore) CodeExists(code string) bool {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	now := time.Now()
-	for _, record := range m.urlToRecord {
-		if record.Code == code && now.Before(record.Expiry) {
-			return true
-		}
-	}
-	return false
+	return m.liveLocked(namespace, code, time.Now())
 }
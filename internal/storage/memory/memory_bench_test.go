@@ -4,15 +4,17 @@ import (
 	"fmt"
 	"testing"
 	"time"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
 )
 
 func BenchmarkMem_GetURL(b *testing.B) {
 	store := NewMemStore(1 * time.Hour)
-	store.Save("https://example.com", "abc1234", "example.com")
+	store.Save(storage.Link{URL: "https://example.com", Code: "abc1234", Domain: "example.com"})
 	b.ReportAllocs()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = store.GetURL("abc1234")
+		_ = store.GetURL("", "abc1234")
 	}
 }
 
@@ -22,6 +24,6 @@ func BenchmarkMem_Save(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		code := fmt.Sprintf("code%07d", i)
-		store.Save("https://example.com", code, "example.com")
+		store.Save(storage.Link{URL: "https://example.com", Code: code, Domain: "example.com"})
 	}
 }
@@ -1,9 +1,16 @@
 package memory
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/internal/storage"
 )
 
 func TestMemStore_SaveAndGet(t *testing.T) {
@@ -12,16 +19,48 @@ func TestMemStore_SaveAndGet(t *testing.T) {
 	code := "xyz789"
 	domain := "abcd.com"
 
-	m.Save(url, code, domain)
+	m.Save(storage.Link{URL: url, Code: code, Domain: domain})
 
-	if c, ok := m.GetCode(url); !ok || c != code {
+	if c, ok := m.GetCode("", "", url); !ok || c != code {
 		t.Fatalf("expected code %q,got %q, ok=%v", code, c, ok)
 	}
-	if got := m.GetURL(code); got != url {
+	if got := m.GetURL("", code); got != url {
 		t.Fatalf("expected url %q,got %q", url, got)
 	}
 }
 
+func TestMemStore_SaveBatchCodeExists(t *testing.T) {
+	m := NewMemStore(time.Hour)
+	_ = m.Save(storage.Link{URL: "https://a.com", Code: "promo", Domain: "a.com", Owner: "alice"})
+
+	// a code saved by another owner fails the batch before any write
+	err := m.SaveBatch([]storage.Link{
+		{URL: "https://b.com", Code: "b1", Domain: "b.com", Owner: "bob"},
+		{URL: "https://evil.com", Code: "promo", Domain: "evil.com", Owner: "bob"},
+	})
+	if !errors.Is(err, storage.ErrCodeExists) {
+		t.Fatalf("SaveBatch taken code: want ErrCodeExists, got %v", err)
+	}
+	if got := m.GetURL("", "promo"); got != "https://a.com" {
+		t.Fatalf("expected promo to keep its url, got %q", got)
+	}
+	if got := m.GetURL("", "b1"); got != "" {
+		t.Fatalf("expected nothing of the failed batch written, got b1 -> %q", got)
+	}
+
+	// the same link again is a no-op, a code twice in the batch fails
+	if err := m.SaveBatch([]storage.Link{{URL: "https://a.com", Code: "promo", Domain: "a.com", Owner: "alice"}}); err != nil {
+		t.Fatalf("SaveBatch same link: want nil, got %v", err)
+	}
+	err = m.SaveBatch([]storage.Link{
+		{URL: "https://c.com", Code: "c1", Domain: "c.com"},
+		{URL: "https://d.com", Code: "c1", Domain: "d.com"},
+	})
+	if !errors.Is(err, storage.ErrCodeExists) || m.GetURL("", "c1") != "" {
+		t.Fatalf("SaveBatch duplicate code: want ErrCodeExists and nothing written, got %v", err)
+	}
+}
+
 func TestMemStore_SaveDuplicateUrls(t *testing.T) {
 	m := NewMemStore(time.Hour)
 	url := "https://abcd.com/x"
@@ -29,11 +68,11 @@ func TestMemStore_SaveDuplicateUrls(t *testing.T) {
 	url2 := "https://abcd.com/y"
 	code2 := "def"
 
-	m.Save(url, code, "abcd.com")
-	m.Save(url, code, "abcd.com") // duplicate should not increase domain hits
-	m.Save(url2, code2, "abcd.com")
+	m.Save(storage.Link{URL: url, Code: code, Domain: "abcd.com"})
+	m.Save(storage.Link{URL: url, Code: code, Domain: "abcd.com"}) // duplicate should not increase domain hits
+	m.Save(storage.Link{URL: url2, Code: code2, Domain: "abcd.com"})
 
-	top := m.TopDomains(1)
+	top := m.TopDomains("", 1)
 	if len(top) != 1 {
 		t.Fatalf("expected 1 top domain, got %d", len(top))
 	}
@@ -46,14 +85,14 @@ func TestMemStore_TopDomainsOrderingAndBounds(t *testing.T) {
 	m := NewMemStore(time.Hour)
 
 	// make hits: x:3, y:2, z:1
-	m.Save("https://x.com/1", "x1", "x.com")
-	m.Save("https://x.com/2", "x2", "x.com")
-	m.Save("https://x.com/3", "x3", "x.com")
-	m.Save("https://y.com/1", "y1", "y.com")
-	m.Save("https://y.com/2", "y2", "y.com")
-	m.Save("https://z.com/1", "z1", "z.com")
-
-	got := m.TopDomains(5)
+	m.Save(storage.Link{URL: "https://x.com/1", Code: "x1", Domain: "x.com"})
+	m.Save(storage.Link{URL: "https://x.com/2", Code: "x2", Domain: "x.com"})
+	m.Save(storage.Link{URL: "https://x.com/3", Code: "x3", Domain: "x.com"})
+	m.Save(storage.Link{URL: "https://y.com/1", Code: "y1", Domain: "y.com"})
+	m.Save(storage.Link{URL: "https://y.com/2", Code: "y2", Domain: "y.com"})
+	m.Save(storage.Link{URL: "https://z.com/1", Code: "z1", Domain: "z.com"})
+
+	got := m.TopDomains("", 5)
 	expectedDomains := []string{"x.com", "y.com", "z.com"}
 	if len(got) != 3 {
 		t.Fatalf("expected 3 results, got %d", len(got))
@@ -65,8 +104,575 @@ func TestMemStore_TopDomainsOrderingAndBounds(t *testing.T) {
 	}
 
 	// Request n=2
-	got2 := m.TopDomains(2)
+	got2 := m.TopDomains("", 2)
 	if !reflect.DeepEqual([]string{got2[0].Domain, got2[1].Domain}, []string{"x.com", "y.com"}) {
 		t.Fatalf("unexpected top2: %+v", got2)
 	}
 }
+
+func TestMemStore_Namespaces(t *testing.T) {
+	m := NewMemStore(time.Hour)
+
+	m.Save(storage.Link{Namespace: "go.brand-a.com", URL: "https://a.com/promo", Code: "promo", Domain: "a.com"})
+	m.Save(storage.Link{Namespace: "go.brand-b.com", URL: "https://b.com/promo", Code: "promo", Domain: "b.com"})
+
+	if got := m.GetURL("go.brand-a.com", "promo"); got != "https://a.com/promo" {
+		t.Fatalf("brand-a: expected https://a.com/promo, got %q", got)
+	}
+	if got := m.GetURL("go.brand-b.com", "promo"); got != "https://b.com/promo" {
+		t.Fatalf("brand-b: expected https://b.com/promo, got %q", got)
+	}
+	if got := m.GetURL("", "promo"); got != "" {
+		t.Fatalf("default namespace: expected miss, got %q", got)
+	}
+	if m.CodeExists("", "promo") {
+		t.Fatalf("expected code to be scoped to its namespace")
+	}
+	if _, ok := m.GetCode("go.brand-b.com", "", "https://a.com/promo"); ok {
+		t.Fatalf("expected url to be scoped to its namespace")
+	}
+}
+
+func TestMemStore_AliasAndTTL(t *testing.T) {
+	m := NewMemStore(time.Hour)
+	url := "https://abcd.com/x"
+
+	if err := m.Save(storage.Link{URL: url, Code: "gen1234", Domain: "abcd.com"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.Save(storage.Link{URL: url, Code: "promo", Domain: "abcd.com"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := m.Save(storage.Link{URL: "https://other.com", Code: "promo", Domain: "other.com"}); !errors.Is(err, storage.ErrCodeExists) {
+		t.Fatalf("expected ErrCodeExists, got %v", err)
+	}
+	if c, ok := m.GetCode("", "", url); !ok || c != "gen1234" {
+		t.Fatalf("expected first code to stay indexed, got %q ok=%v", c, ok)
+	}
+
+	if err := m.Save(storage.Link{URL: "https://short.com", Code: "short1", Domain: "short.com", TTL: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := m.GetCode("", "", "https://short.com"); ok {
+		t.Fatalf("expected link with custom ttl not to be indexed by url")
+	}
+	if got := m.GetURL("", "short1"); got != "https://short.com" {
+		t.Fatalf("expected url before expiry, got %q", got)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := m.GetURL("", "short1"); got != "" {
+		t.Fatalf("expected custom ttl to expire, got %q", got)
+	}
+}
+
+func TestMemStore_APIKeys(t *testing.T) {
+	m := NewMemStore(time.Hour)
+	now := time.Now()
+
+	_ = m.SaveAPIKey(storage.APIKey{ID: "b", Hash: "hb", Scopes: []string{"links:write"}, CreatedAt: now.Add(time.Second)})
+	_ = m.SaveAPIKey(storage.APIKey{ID: "a", Hash: "ha", Scopes: []string{"metrics:read"}, CreatedAt: now})
+
+	key, ok, err := m.APIKeyByHash("hb")
+	if err != nil || !ok || key.ID != "b" {
+		t.Fatalf("expected key b by hash, got %+v ok=%v err=%v", key, ok, err)
+	}
+	if _, ok, _ := m.APIKeyByHash("unknown"); ok {
+		t.Fatalf("expected unknown hash to be missing")
+	}
+
+	keys, _ := m.ListAPIKeys()
+	if len(keys) != 2 || keys[0].ID != "a" || keys[1].ID != "b" {
+		t.Fatalf("expected keys oldest first, got %+v", keys)
+	}
+
+	if err := m.RevokeAPIKey("a", now); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if err := m.RevokeAPIKey("a", now.Add(time.Hour)); err != nil {
+		t.Fatalf("revoke again: %v", err)
+	}
+	key, _, _ = m.APIKeyByHash("ha")
+	if !key.Revoked() || !key.RevokedAt.Equal(now) {
+		t.Fatalf("expected key revoked at first revocation, got %v", key.RevokedAt)
+	}
+	if err := m.RevokeAPIKey("missing", now); !errors.Is(err, storage.ErrAPIKeyNotFound) {
+		t.Fatalf("expected ErrAPIKeyNotFound, got %v", err)
+	}
+}
+
+func TestMemStore_Owners(t *testing.T) {
+	m := NewMemStore(time.Hour)
+	url := "https://abcd.com/x"
+
+	_ = m.Save(storage.Link{URL: url, Code: "alice1", Domain: "abcd.com", Owner: "alice"})
+	_ = m.Save(storage.Link{URL: url, Code: "bob1", Domain: "abcd.com", Owner: "bob"})
+	_ = m.Save(storage.Link{URL: "https://other.com", Code: "bob2", Domain: "other.com", Owner: "bob"})
+
+	if c, ok := m.GetCode("", "alice", url); !ok || c != "alice1" {
+		t.Fatalf("expected alice's code, got %q ok=%v", c, ok)
+	}
+	if c, ok := m.GetCode("", "bob", url); !ok || c != "bob1" {
+		t.Fatalf("expected bob's code, got %q ok=%v", c, ok)
+	}
+	if _, ok := m.GetCode("", "", url); ok {
+		t.Fatalf("expected no code for the unowned index")
+	}
+
+	if top := m.TopDomains("alice", 3); len(top) != 1 || top[0].Domain != "abcd.com" {
+		t.Fatalf("expected alice's domains only, got %+v", top)
+	}
+	if top := m.TopDomains("", 3); len(top) != 2 || top[0].Domain != "abcd.com" || top[0].Shortened != 2 {
+		t.Fatalf("expected global domains, got %+v", top)
+	}
+
+	links, _ := m.ListLinks(storage.LinkFilter{Owner: "bob"})
+	if len(links) != 2 || links[0].Owner != "bob" || links[1].Owner != "bob" {
+		t.Fatalf("expected bob's links, got %+v", links)
+	}
+	links, _ = m.ListLinks(storage.LinkFilter{AllOwners: true})
+	if len(links) != 3 {
+		t.Fatalf("expected every link, got %+v", links)
+	}
+
+	if err := m.UpdateLink("", "bob1", storage.LinkPatch{URL: ptr("https://new.com"), Domain: "new.com"}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if got := m.GetURL("", "bob1"); got != "https://new.com" {
+		t.Fatalf("expected updated url, got %q", got)
+	}
+	if _, ok := m.GetCode("", "bob", url); ok {
+		t.Fatalf("expected updated link to leave the url index")
+	}
+	if _, ok := m.GetCode("", "bob", "https://new.com"); ok {
+		t.Fatalf("expected updated link not to be used for dedupe")
+	}
+
+	if err := m.DeleteLink("", "alice1"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, ok := m.GetLink("", "alice1"); ok {
+		t.Fatalf("expected deleted link to be gone")
+	}
+	if err := m.DeleteLink("", "alice1"); !errors.Is(err, storage.ErrLinkNotFound) {
+		t.Fatalf("expected ErrLinkNotFound, got %v", err)
+	}
+	if err := m.UpdateLink("", "missing", storage.LinkPatch{URL: ptr(url), Domain: "abcd.com"}); !errors.Is(err, storage.ErrLinkNotFound) {
+		t.Fatalf("expected ErrLinkNotFound, got %v", err)
+	}
+}
+
+func TestMemStore_Audit(t *testing.T) {
+	m := NewMemStore(time.Hour)
+	now := time.Now().UTC()
+
+	// appended out of order, listed newest first
+	_ = m.AppendAudit(storage.AuditEvent{ID: "2", Time: now.Add(-time.Hour), Actor: "bob", Action: "link.update"})
+	_ = m.AppendAudit(storage.AuditEvent{ID: "1", Time: now.Add(-48 * time.Hour), Actor: "alice", Action: "link.create"})
+	_ = m.AppendAudit(storage.AuditEvent{ID: "3", Time: now, Actor: "alice", Action: "link.delete"})
+
+	ids := func(events []storage.AuditEvent) []string {
+		out := []string{}
+		for _, e := range events {
+			out = append(out, e.ID)
+		}
+		return out
+	}
+	events, _ := m.ListAudit(storage.AuditFilter{})
+	if got := ids(events); !reflect.DeepEqual(got, []string{"3", "2", "1"}) {
+		t.Fatalf("expected newest first, got %v", got)
+	}
+	events, _ = m.ListAudit(storage.AuditFilter{Actor: "alice"})
+	if got := ids(events); !reflect.DeepEqual(got, []string{"3", "1"}) {
+		t.Fatalf("expected alice's events, got %v", got)
+	}
+	events, _ = m.ListAudit(storage.AuditFilter{Before: "3", Limit: 1})
+	if got := ids(events); !reflect.DeepEqual(got, []string{"2"}) {
+		t.Fatalf("expected one event before the cursor, got %v", got)
+	}
+	events, _ = m.ListAudit(storage.AuditFilter{From: now.Add(-2 * time.Hour), To: now})
+	if got := ids(events); !reflect.DeepEqual(got, []string{"2"}) {
+		t.Fatalf("expected events in [from, to), got %v", got)
+	}
+
+	if n, _ := m.PurgeAudit(now.Add(-24 * time.Hour)); n != 1 {
+		t.Fatalf("expected one purged event, got %d", n)
+	}
+	events, _ = m.ListAudit(storage.AuditFilter{})
+	if got := ids(events); !reflect.DeepEqual(got, []string{"3", "2"}) {
+		t.Fatalf("expected recent events to be kept, got %v", got)
+	}
+}
+
+func TestMemStore_PasswordLinks(t *testing.T) {
+	m := NewMemStore(time.Hour)
+	url := "https://abcd.com/private"
+
+	if err := m.Save(storage.Link{URL: url, Code: "secret", Domain: "abcd.com", PasswordHash: "hash"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := m.GetCode("", "", url); ok {
+		t.Fatalf("expected protected link not to be indexed by url")
+	}
+	link, ok := m.GetLink("", "secret")
+	if !ok || link.PasswordHash != "hash" {
+		t.Fatalf("expected password hash to be stored, got %+v ok=%v", link, ok)
+	}
+	if err := m.UpdateLink("", "secret", storage.LinkPatch{URL: ptr("https://abcd.com/moved"), Domain: "abcd.com"}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if link, _ := m.GetLink("", "secret"); link.PasswordHash != "hash" {
+		t.Fatalf("expected update to keep the password, got %+v", link)
+	}
+}
+
+func TestMemStore_UseClick(t *testing.T) {
+	m := NewMemStore(time.Hour)
+	_ = m.Save(storage.Link{URL: "https://abcd.com/x", Code: "limited", Domain: "abcd.com", MaxClicks: 10})
+	_ = m.Save(storage.Link{URL: "https://abcd.com/y", Code: "free", Domain: "abcd.com"})
+
+	if _, ok := m.GetCode("", "", "https://abcd.com/x"); ok {
+		t.Fatalf("expected click-limited link not to be indexed by url")
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	used, exhausted := 0, 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := m.UseClick("", "limited")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				used++
+			case errors.Is(err, storage.ErrClicksExhausted):
+				exhausted++
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if used != 10 || exhausted != 40 {
+		t.Fatalf("expected 10 clicks used and 40 exhausted, got %d and %d", used, exhausted)
+	}
+	if link, _ := m.GetLink("", "limited"); link.MaxClicks != 10 || link.ClicksLeft != 0 {
+		t.Fatalf("expected no clicks left, got %+v", link)
+	}
+
+	if err := m.UseClick("", "free"); err != nil {
+		t.Fatalf("expected unlimited link to be unaffected, got %v", err)
+	}
+	if err := m.UseClick("", "missing"); !errors.Is(err, storage.ErrLinkNotFound) {
+		t.Fatalf("expected ErrLinkNotFound, got %v", err)
+	}
+}
+
+func TestMemStore_Schedule(t *testing.T) {
+	m := NewMemStore(time.Hour)
+	start, end := time.Now().Add(time.Minute), time.Now().Add(time.Hour)
+
+	_ = m.Save(storage.Link{URL: "https://abcd.com/sale", Code: "sale", Domain: "abcd.com", NotBefore: start, NotAfter: end, FallbackURL: "https://abcd.com"})
+	if _, ok := m.GetCode("", "", "https://abcd.com/sale"); ok {
+		t.Fatalf("expected scheduled link not to be indexed by url")
+	}
+	link, _ := m.GetLink("", "sale")
+	if !link.NotBefore.Equal(start) || !link.NotAfter.Equal(end) || link.FallbackURL != "https://abcd.com" {
+		t.Fatalf("expected the schedule to be stored, got %+v", link)
+	}
+}
+
+func TestMemStore_Stats(t *testing.T) {
+	m := NewMemStore(time.Hour)
+	_ = m.Save(storage.Link{URL: "https://abcd.com/x", Code: "app", Domain: "abcd.com"})
+
+	clicked := time.Date(2025, 3, 1, 23, 30, 0, 0, time.UTC)
+	for _, rule := range []string{"ios", "ios", storage.DefaultRule} {
+		if err := m.RecordClick(storage.Click{Code: "app", Time: clicked, Rule: rule}); err != nil {
+			t.Fatalf("RecordClick failed: %v", err)
+		}
+	}
+	if err := m.RecordClick(storage.Click{Code: "missing", Time: time.Now()}); !errors.Is(err, storage.ErrLinkNotFound) {
+		t.Fatalf("expected ErrLinkNotFound, got %v", err)
+	}
+	want := storage.LinkStats{Clicks: 3, Rules: map[string]int64{"ios": 2, storage.DefaultRule: 1}, Days: map[string]int64{"2025-03-01": 3}}
+	if stats, _ := m.LinkStats("", "app"); !reflect.DeepEqual(stats, want) {
+		t.Fatalf("expected %+v, got %+v", want, stats)
+	}
+
+	_ = m.DeleteLink("", "app")
+	_ = m.Save(storage.Link{URL: "https://abcd.com/y", Code: "app", Domain: "abcd.com"})
+	if stats, _ := m.LinkStats("", "app"); stats.Clicks != 0 {
+		t.Fatalf("expected the stats to be deleted with the link, got %+v", stats)
+	}
+}
+
+func TestMemStore_UpdateVariants(t *testing.T) {
+	m := NewMemStore(time.Hour)
+	_ = m.Save(storage.Link{URL: "https://abcd.com/x", Code: "ab", Domain: "abcd.com"})
+
+	variants := []common.Variant{{Name: "a", URL: "https://abcd.com/a", Weight: 1}, {Name: "b", URL: "https://abcd.com/b", Weight: 2}}
+	if err := m.UpdateLink("", "ab", storage.LinkPatch{Variants: &variants}); err != nil {
+		t.Fatalf("UpdateLink failed: %v", err)
+	}
+	if link, _ := m.GetLink("", "ab"); !reflect.DeepEqual(link.Variants, variants) {
+		t.Fatalf("expected the variants to be stored, got %+v", link.Variants)
+	}
+	if _, ok := m.GetCode("", "", "https://abcd.com/x"); ok {
+		t.Fatalf("expected the link not to be indexed by url anymore")
+	}
+	if err := m.UpdateLink("", "missing", storage.LinkPatch{Variants: &variants}); !errors.Is(err, storage.ErrLinkNotFound) {
+		t.Fatalf("expected ErrLinkNotFound, got %v", err)
+	}
+}
+
+func TestMemStore_UpdateLink(t *testing.T) {
+	m := NewMemStore(time.Hour)
+	_ = m.Save(storage.Link{URL: "https://abcd.com/x", Code: "ab", Domain: "abcd.com", Campaign: "c1"})
+	before, _ := m.GetLink("", "ab")
+
+	url, campaign := "https://efgh.com/y", ""
+	details := common.LinkDetails{Title: "Moved"}
+	if err := m.UpdateLink("", "ab", storage.LinkPatch{URL: &url, Domain: "efgh.com", Details: &details, Campaign: &campaign}); err != nil {
+		t.Fatalf("UpdateLink failed: %v", err)
+	}
+	link, _ := m.GetLink("", "ab")
+	if link.URL != url || link.Domain != "efgh.com" || link.Details.Title != "Moved" || link.Campaign != "" || !link.ExpiresAt.Equal(before.ExpiresAt) {
+		t.Fatalf("expected every change to be stored with the expiry kept, got %+v", link)
+	}
+	if err := m.UpdateLink("", "ab", storage.LinkPatch{}); err != nil {
+		t.Fatalf("UpdateLink failed: %v", err)
+	}
+	if again, _ := m.GetLink("", "ab"); !reflect.DeepEqual(again, link) {
+		t.Fatalf("expected an empty patch to keep the link, got %+v", again)
+	}
+	if err := m.UpdateLink("", "missing", storage.LinkPatch{URL: &url}); !errors.Is(err, storage.ErrLinkNotFound) {
+		t.Fatalf("expected ErrLinkNotFound, got %v", err)
+	}
+}
+
+func TestMemStore_Details(t *testing.T) {
+	m := NewMemStore(time.Hour)
+	details := common.LinkDetails{Title: "Spring Sale", Tags: []string{"promo"}, Metadata: map[string]string{"team": "growth"}}
+	_ = m.Save(storage.Link{URL: "https://abcd.com/sale", Code: "sale", Domain: "abcd.com", Details: details})
+	_ = m.Save(storage.Link{URL: "https://abcd.com/docs", Code: "docs", Domain: "abcd.com"})
+
+	if _, ok := m.GetCode("", "", "https://abcd.com/sale"); ok {
+		t.Fatalf("expected link with details not to be indexed by url")
+	}
+	filters := map[string]storage.LinkFilter{
+		"tag":      {Tag: "PROMO"},
+		"search":   {Search: "spring"},
+		"metadata": {Metadata: map[string]string{"team": "growth"}},
+	}
+	for name, filter := range filters {
+		links, _ := m.ListLinks(filter)
+		if len(links) != 1 || links[0].Code != "sale" || !reflect.DeepEqual(links[0].Details, details) {
+			t.Fatalf("%s: expected only the sale link, got %+v", name, links)
+		}
+	}
+
+	if err := m.UpdateLink("", "docs", storage.LinkPatch{Details: ptr(common.LinkDetails{Tags: []string{"promo"}})}); err != nil {
+		t.Fatalf("UpdateLink failed: %v", err)
+	}
+	if links, _ := m.ListLinks(storage.LinkFilter{Tag: "promo"}); len(links) != 2 {
+		t.Fatalf("expected both links to be tagged, got %+v", links)
+	}
+	if _, ok := m.GetCode("", "", "https://abcd.com/docs"); ok {
+		t.Fatalf("expected the link not to be indexed by url anymore")
+	}
+	if err := m.UpdateLink("", "missing", storage.LinkPatch{Details: &details}); !errors.Is(err, storage.ErrLinkNotFound) {
+		t.Fatalf("expected ErrLinkNotFound, got %v", err)
+	}
+}
+
+func TestMemStore_Campaigns(t *testing.T) {
+	m := NewMemStore(time.Hour)
+	now := time.Now()
+	_ = m.SaveCampaign(storage.Campaign{ID: "c2", Name: "Summer", Owner: "acme", CreatedAt: now.Add(time.Second)})
+	_ = m.SaveCampaign(storage.Campaign{ID: "c1", Name: "Spring", Owner: "acme", CreatedAt: now})
+	_ = m.SaveCampaign(storage.Campaign{ID: "c3", Name: "Other", Owner: "globex", CreatedAt: now})
+
+	if campaigns, _ := m.ListCampaigns("acme", false); len(campaigns) != 2 || campaigns[0].ID != "c1" {
+		t.Fatalf("expected the campaigns of acme, oldest first, got %+v", campaigns)
+	}
+	if campaigns, _ := m.ListCampaigns("", true); len(campaigns) != 3 {
+		t.Fatalf("expected every campaign, got %+v", campaigns)
+	}
+	if campaign, ok, _ := m.GetCampaign("c2"); !ok || campaign.Name != "Summer" {
+		t.Fatalf("expected campaign c2, got %+v", campaign)
+	}
+
+	_ = m.Save(storage.Link{URL: "https://abcd.com/a", Code: "a", Domain: "abcd.com", Owner: "acme", Campaign: "c1"})
+	_ = m.Save(storage.Link{URL: "https://abcd.com/b", Code: "b", Domain: "abcd.com", Owner: "acme"})
+	if _, ok := m.GetCode("", "acme", "https://abcd.com/a"); ok {
+		t.Fatalf("expected link in a campaign not to be indexed by url")
+	}
+	if err := m.UpdateLink("", "b", storage.LinkPatch{Campaign: ptr("c1")}); err != nil {
+		t.Fatalf("UpdateLink failed: %v", err)
+	}
+	if links, _ := m.ListLinks(storage.LinkFilter{Owner: "acme", Campaign: "c1"}); len(links) != 2 {
+		t.Fatalf("expected both links in the campaign, got %+v", links)
+	}
+	if err := m.UpdateLink("", "missing", storage.LinkPatch{Campaign: ptr("c1")}); !errors.Is(err, storage.ErrLinkNotFound) {
+		t.Fatalf("expected ErrLinkNotFound, got %v", err)
+	}
+
+	if err := m.DeleteCampaign("c1"); err != nil {
+		t.Fatalf("DeleteCampaign failed: %v", err)
+	}
+	if _, ok, _ := m.GetCampaign("c1"); ok {
+		t.Fatalf("expected the campaign to be deleted")
+	}
+	if err := m.DeleteCampaign("c1"); !errors.Is(err, storage.ErrCampaignNotFound) {
+		t.Fatalf("expected ErrCampaignNotFound, got %v", err)
+	}
+}
+
+func TestMemStore_Analytics(t *testing.T) {
+	m := NewMemStore(time.Hour)
+
+	base := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	for _, at := range []time.Duration{0, 30 * time.Second, time.Minute, 90 * time.Minute} {
+		if err := m.CountClick(storage.Click{Code: "app", Time: base.Add(at)}); err != nil {
+			t.Fatalf("CountClick failed: %v", err)
+		}
+	}
+	_ = m.CountClick(storage.Click{Namespace: "go.brand.com", Code: "app", Time: base})
+
+	minutes, _ := m.Buckets("", "app", storage.Minute, base, base.Add(2*time.Hour))
+	want := []storage.Bucket{{Start: base, Clicks: 2}, {Start: base.Add(time.Minute), Clicks: 1}, {Start: base.Add(90 * time.Minute), Clicks: 1}}
+	if !reflect.DeepEqual(minutes, want) {
+		t.Fatalf("expected %+v, got %+v", want, minutes)
+	}
+
+	// roll up the first hour, again, then the rest; no click counts twice
+	if err := m.Rollup(storage.Minute, base.Add(time.Hour)); err != nil {
+		t.Fatalf("Rollup failed: %v", err)
+	}
+	_ = m.Rollup(storage.Minute, base.Add(time.Hour))
+	_ = m.Rollup(storage.Minute, base.Add(2*time.Hour))
+	if rolled, _ := m.RolledUp(storage.Minute); !rolled.Equal(base.Add(2 * time.Hour)) {
+		t.Fatalf("expected minutes rolled up to %v, got %v", base.Add(2*time.Hour), rolled)
+	}
+	hours, _ := m.Buckets("", "app", storage.Hour, base, base.Add(2*time.Hour))
+	want = []storage.Bucket{{Start: base, Clicks: 3}, {Start: base.Add(time.Hour), Clicks: 1}}
+	if !reflect.DeepEqual(hours, want) {
+		t.Fatalf("expected %+v, got %+v", want, hours)
+	}
+	_ = m.Rollup(storage.Hour, base.Add(2*time.Hour))
+	if days, _ := m.Buckets("", "app", storage.Day, base.Add(-24*time.Hour), base.Add(24*time.Hour)); len(days) != 1 || days[0].Clicks != 4 {
+		t.Fatalf("expected 4 clicks on the day, got %+v", days)
+	}
+
+	// rolled up minutes are kept until purged
+	if n, _ := m.PurgeBuckets(storage.Minute, base.Add(time.Hour)); n != 3 {
+		t.Fatalf("expected 3 minute buckets purged, got %d", n)
+	}
+	if minutes, _ := m.Buckets("", "app", storage.Minute, base, base.Add(2*time.Hour)); len(minutes) != 1 {
+		t.Fatalf("expected the later minute bucket to be kept, got %+v", minutes)
+	}
+	if hours, _ := m.Buckets("", "app", storage.Hour, base, base.Add(2*time.Hour)); len(hours) != 2 {
+		t.Fatalf("expected the hour buckets to be kept, got %+v", hours)
+	}
+}
+
+func TestMemStore_Visitors(t *testing.T) {
+	m := NewMemStore(time.Hour)
+
+	day := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i, visitor := range []uint64{1 << 60, 2 << 60, 1 << 60} {
+		if err := m.AddVisitor(storage.Click{Code: "app", Time: day.Add(time.Duration(i) * time.Hour), Visitor: visitor}); err != nil {
+			t.Fatalf("AddVisitor failed: %v", err)
+		}
+	}
+	_ = m.AddVisitor(storage.Click{Code: "app", Time: day.Add(24 * time.Hour), Visitor: 3 << 60})
+
+	sketches, _ := m.VisitorSketches("", "app", day, day.Add(48*time.Hour))
+	if len(sketches) != 2 || sketches["2025-03-01"].Count() != 2 || sketches["2025-03-02"].Count() != 1 {
+		t.Fatalf("expected 2 visitors on the first day and 1 on the second, got %+v", sketches)
+	}
+	// the returned sketches are copies
+	sketches["2025-03-01"].Add(4 << 60)
+	if sketches, _ := m.VisitorSketches("", "app", day, day.Add(24*time.Hour)); len(sketches) != 1 || sketches["2025-03-01"].Count() != 2 {
+		t.Fatalf("expected only the first day with 2 visitors, got %+v", sketches)
+	}
+
+	if n, _ := m.PurgeVisitorSketches(day.Add(24 * time.Hour)); n != 1 {
+		t.Fatalf("expected the first day purged, got %d", n)
+	}
+	if sketches, _ := m.VisitorSketches("", "app", day, day.Add(48*time.Hour)); len(sketches) != 1 {
+		t.Fatalf("expected the second day to be kept, got %+v", sketches)
+	}
+
+	salt, err := m.VisitorSalt(day)
+	if err != nil || len(salt) != saltSize {
+		t.Fatalf("VisitorSalt failed: %v", err)
+	}
+	if again, _ := m.VisitorSalt(day.Add(time.Hour)); !bytes.Equal(again, salt) {
+		t.Fatalf("expected the same salt for the day")
+	}
+	if next, _ := m.VisitorSalt(day.Add(24 * time.Hour)); bytes.Equal(next, salt) {
+		t.Fatalf("expected a new salt for the next day")
+	}
+	if n, _ := m.PurgeVisitorSalts(day.Add(24 * time.Hour)); n != 1 {
+		t.Fatalf("expected the first salt purged, got %d", n)
+	}
+	if again, _ := m.VisitorSalt(day); bytes.Equal(again, salt) {
+		t.Fatalf("expected a purged salt to be gone")
+	}
+}
+
+func TestMemStore_BotClicks(t *testing.T) {
+	m := NewMemStore(time.Hour)
+	_ = m.Save(storage.Link{URL: "https://abcd.com/x", Code: "app", Domain: "abcd.com"})
+
+	base := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+	for _, bot := range []bool{false, true, true} {
+		click := storage.Click{Code: "app", Time: base, Rule: storage.DefaultRule, Bot: bot}
+		_ = m.RecordClick(click)
+		_ = m.CountClick(click)
+	}
+
+	stats, _ := m.LinkStats("", "app")
+	if stats.Clicks != 1 || stats.Bots == nil || stats.Bots.Clicks != 2 || stats.Bots.Bots != nil {
+		t.Fatalf("expected 1 click and 2 bot clicks, got %+v", stats)
+	}
+	if all := stats.WithBots(); all.Clicks != 3 || all.Rules[storage.DefaultRule] != 3 || all.Days["2025-03-01"] != 3 {
+		t.Fatalf("expected 3 clicks with the bots, got %+v", all)
+	}
+
+	_ = m.Rollup(storage.Minute, base.Add(time.Minute))
+	hours, _ := m.Buckets("", "app", storage.Hour, base, base.Add(time.Hour))
+	if want := []storage.Bucket{{Start: base, Clicks: 1, Bots: 2}}; !reflect.DeepEqual(hours, want) {
+		t.Fatalf("expected %+v, got %+v", want, hours)
+	}
+}
+
+func TestMemStore_StatsBreakdown(t *testing.T) {
+	m := NewMemStore(time.Hour)
+	_ = m.Save(storage.Link{URL: "https://abcd.com/x", Code: "app", Domain: "abcd.com"})
+
+	now := time.Now()
+	_ = m.RecordClick(storage.Click{Code: "app", Time: now, Referrer: "t.co", Country: "US", Region: "US-CA"})
+	_ = m.RecordClick(storage.Click{Code: "app", Time: now, Referrer: "t.co", Country: "DE"})
+	_ = m.RecordClick(storage.Click{Code: "app", Time: now})
+	for i := range storage.MaxBreakdown {
+		_ = m.RecordClick(storage.Click{Code: "app", Time: now, Referrer: fmt.Sprintf("spam%d.example", i)})
+	}
+	_ = m.RecordClick(storage.Click{Code: "app", Time: now, Referrer: "t.co"})
+
+	stats, _ := m.LinkStats("", "app")
+	if !reflect.DeepEqual(stats.Countries, map[string]int64{"US": 1, "DE": 1}) || !reflect.DeepEqual(stats.Regions, map[string]int64{"US-CA": 1}) {
+		t.Fatalf("expected clicks by country and region, got %v and %v", stats.Countries, stats.Regions)
+	}
+	// known referrers keep counting once the breakdown is full
+	if stats.Referrers["t.co"] != 3 || stats.Referrers[storage.OtherKey] != 1 || len(stats.Referrers) != storage.MaxBreakdown+1 {
+		t.Fatalf("expected 3 clicks from t.co and the last new referrer as other, got %d and %d of %d", stats.Referrers["t.co"], stats.Referrers[storage.OtherKey], len(stats.Referrers))
+	}
+}
+
+// ptr returns a pointer to v.
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,46 @@
+package memory
+
+import (
+	"maps"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+)
+
+// RecordClick counts click in the stats of its link.
+func (m *MemStore) RecordClick(click storage.Click) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := recordKey{click.Namespace, click.Code}
+	if !m.liveLocked(click.Namespace, click.Code, time.Now()) {
+		return storage.ErrLinkNotFound
+	}
+	stats := m.stats[key]
+	stats.Count(click)
+	m.stats[key] = stats
+	return nil
+}
+
+// LinkStats returns the stats of a link.
+func (m *MemStore) LinkStats(namespace, code string) (storage.LinkStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return cloneStats(m.stats[recordKey{namespace, code}]), nil
+}
+
+// cloneStats returns a deep copy of stats, which RecordClick changes in place.
+func cloneStats(stats storage.LinkStats) storage.LinkStats {
+	stats.Rules = maps.Clone(stats.Rules)
+	stats.Variants = maps.Clone(stats.Variants)
+	stats.Days = maps.Clone(stats.Days)
+	stats.Referrers = maps.Clone(stats.Referrers)
+	stats.Countries = maps.Clone(stats.Countries)
+	stats.Regions = maps.Clone(stats.Regions)
+	if stats.Bots != nil {
+		bots := cloneStats(*stats.Bots)
+		stats.Bots = &bots
+	}
+	return stats
+}
@@ -0,0 +1,105 @@
+package memory
+
+import (
+	"crypto/rand"
+	"time"
+
+	"github.com/parikshitg/urlshortener/internal/storage"
+	"github.com/parikshitg/urlshortener/pkg/hll"
+)
+
+// saltSize is the length of the visitor salts in bytes.
+const saltSize = 32
+
+// AddVisitor adds the visitor of click to the sketch of its link for the day.
+func (m *MemStore) AddVisitor(click storage.Click) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := recordKey{click.Namespace, click.Code}
+	days := m.visitors[key]
+	if days == nil {
+		days = make(map[string]*hll.Sketch)
+		m.visitors[key] = days
+	}
+	day := click.Time.UTC().Format(storage.DayFormat)
+	sketch := days[day]
+	if sketch == nil {
+		sketch = hll.New()
+		days[day] = sketch
+	}
+	sketch.Add(click.Visitor)
+	return nil
+}
+
+// VisitorSketches returns copies of the sketches of a link for the days from
+// the day of from until the day before the day of to.
+func (m *MemStore) VisitorSketches(namespace, code string, from, to time.Time) (map[string]*hll.Sketch, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	first, end := from.UTC().Format(storage.DayFormat), to.UTC().Format(storage.DayFormat)
+	sketches := make(map[string]*hll.Sketch)
+	for day, sketch := range m.visitors[recordKey{namespace, code}] {
+		if day >= first && day < end {
+			c := *sketch
+			sketches[day] = &c
+		}
+	}
+	return sketches, nil
+}
+
+// PurgeVisitorSketches deletes the sketches of the days before the day of
+// before.
+func (m *MemStore) PurgeVisitorSketches(before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	end := before.UTC().Format(storage.DayFormat)
+	purged := 0
+	for key, days := range m.visitors {
+		for day := range days {
+			if day < end {
+				delete(days, day)
+				purged++
+			}
+		}
+		if len(days) == 0 {
+			delete(m.visitors, key)
+		}
+	}
+	return purged, nil
+}
+
+// VisitorSalt returns the salt of the day of t, creating it the first time.
+func (m *MemStore) VisitorSalt(t time.Time) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	day := t.UTC().Format(storage.DayFormat)
+	if salt, ok := m.salts[day]; ok {
+		return salt, nil
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	m.salts[day] = salt
+	return salt, nil
+}
+
+// PurgeVisitorSalts deletes the salts of the days before the day of before.
+func (m *MemStore) PurgeVisitorSalts(before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	end := before.UTC().Format(storage.DayFormat)
+	purged := 0
+	for day := range m.salts {
+		if day < end {
+			delete(m.salts, day)
+			purged++
+		}
+	}
+	return purged, nil
+}
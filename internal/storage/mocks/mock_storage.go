@@ -11,8 +11,11 @@ package mocks
 
 import (
 	reflect "reflect"
+	time "time"
 
 	common "github.com/parikshitg/urlshortener/internal/common"
+	storage "github.com/parikshitg/urlshortener/internal/storage"
+	hll "github.com/parikshitg/urlshortener/pkg/hll"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -41,46 +44,90 @@ func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
 }
 
 // CodeExists mocks base method.
-func (m *MockStorage) CodeExists(code string) bool {
+func (m *MockStorage) CodeExists(namespace, code string) bool {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CodeExists", code)
+	ret := m.ctrl.Call(m, "CodeExists", namespace, code)
 	ret0, _ := ret[0].(bool)
 	return ret0
 }
 
 // CodeExists indicates an expected call of CodeExists.
-func (mr *MockStorageMockRecorder) CodeExists(code any) *gomock.Call {
+func (mr *MockStorageMockRecorder) CodeExists(namespace, code any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CodeExists", reflect.TypeOf((*MockStorage)(nil).CodeExists), code)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CodeExists", reflect.TypeOf((*MockStorage)(nil).CodeExists), namespace, code)
+}
+
+// DeleteLink mocks base method.
+func (m *MockStorage) DeleteLink(namespace, code string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteLink", namespace, code)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteLink indicates an expected call of DeleteLink.
+func (mr *MockStorageMockRecorder) DeleteLink(namespace, code any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteLink", reflect.TypeOf((*MockStorage)(nil).DeleteLink), namespace, code)
 }
 
 // GetCode mocks base method.
-func (m *MockStorage) GetCode(url string) (string, bool) {
+func (m *MockStorage) GetCode(namespace, owner, url string) (string, bool) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetCode", url)
+	ret := m.ctrl.Call(m, "GetCode", namespace, owner, url)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(bool)
 	return ret0, ret1
 }
 
 // GetCode indicates an expected call of GetCode.
-func (mr *MockStorageMockRecorder) GetCode(url any) *gomock.Call {
+func (mr *MockStorageMockRecorder) GetCode(namespace, owner, url any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCode", reflect.TypeOf((*MockStorage)(nil).GetCode), url)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCode", reflect.TypeOf((*MockStorage)(nil).GetCode), namespace, owner, url)
+}
+
+// GetLink mocks base method.
+func (m *MockStorage) GetLink(namespace, code string) (storage.LinkRecord, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLink", namespace, code)
+	ret0, _ := ret[0].(storage.LinkRecord)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// GetLink indicates an expected call of GetLink.
+func (mr *MockStorageMockRecorder) GetLink(namespace, code any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLink", reflect.TypeOf((*MockStorage)(nil).GetLink), namespace, code)
 }
 
 // GetURL mocks base method.
-func (m *MockStorage) GetURL(code string) string {
+func (m *MockStorage) GetURL(namespace, code string) string {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetURL", code)
+	ret := m.ctrl.Call(m, "GetURL", namespace, code)
 	ret0, _ := ret[0].(string)
 	return ret0
 }
 
 // GetURL indicates an expected call of GetURL.
-func (mr *MockStorageMockRecorder) GetURL(code any) *gomock.Call {
+func (mr *MockStorageMockRecorder) GetURL(namespace, code any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetURL", reflect.TypeOf((*MockStorage)(nil).GetURL), namespace, code)
+}
+
+// ListLinks mocks base method.
+func (m *MockStorage) ListLinks(filter storage.LinkFilter) ([]storage.LinkRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListLinks", filter)
+	ret0, _ := ret[0].([]storage.LinkRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListLinks indicates an expected call of ListLinks.
+func (mr *MockStorageMockRecorder) ListLinks(filter any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetURL", reflect.TypeOf((*MockStorage)(nil).GetURL), code)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListLinks", reflect.TypeOf((*MockStorage)(nil).ListLinks), filter)
 }
 
 // Purge mocks base method.
@@ -96,27 +143,645 @@ func (mr *MockStorageMockRecorder) Purge() *gomock.Call {
 }
 
 // Save mocks base method.
-func (m *MockStorage) Save(url, code, domain string) {
+func (m *MockStorage) Save(link storage.Link) error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Save", url, code, domain)
+	ret := m.ctrl.Call(m, "Save", link)
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // Save indicates an expected call of Save.
-func (mr *MockStorageMockRecorder) Save(url, code, domain any) *gomock.Call {
+func (mr *MockStorageMockRecorder) Save(link any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockStorage)(nil).Save), url, code, domain)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockStorage)(nil).Save), link)
 }
 
 // TopDomains mocks base method.
-func (m *MockStorage) TopDomains(n int) []common.TopN {
+func (m *MockStorage) TopDomains(owner string, n int) []common.TopN {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "TopDomains", n)
+	ret := m.ctrl.Call(m, "TopDomains", owner, n)
 	ret0, _ := ret[0].([]common.TopN)
 	return ret0
 }
 
 // TopDomains indicates an expected call of TopDomains.
-func (mr *MockStorageMockRecorder) TopDomains(n any) *gomock.Call {
+func (mr *MockStorageMockRecorder) TopDomains(owner, n any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TopDomains", reflect.TypeOf((*MockStorage)(nil).TopDomains), owner, n)
+}
+
+// UpdateLink mocks base method.
+func (m *MockStorage) UpdateLink(namespace, code string, patch storage.LinkPatch) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateLink", namespace, code, patch)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateLink indicates an expected call of UpdateLink.
+func (mr *MockStorageMockRecorder) UpdateLink(namespace, code, patch any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateLink", reflect.TypeOf((*MockStorage)(nil).UpdateLink), namespace, code, patch)
+}
+
+// UseClick mocks base method.
+func (m *MockStorage) UseClick(namespace, code string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseClick", namespace, code)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UseClick indicates an expected call of UseClick.
+func (mr *MockStorageMockRecorder) UseClick(namespace, code any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseClick", reflect.TypeOf((*MockStorage)(nil).UseClick), namespace, code)
+}
+
+// MockBatchSaver is a mock of BatchSaver interface.
+type MockBatchSaver struct {
+	ctrl     *gomock.Controller
+	recorder *MockBatchSaverMockRecorder
+	isgomock struct{}
+}
+
+// MockBatchSaverMockRecorder is the mock recorder for MockBatchSaver.
+type MockBatchSaverMockRecorder struct {
+	mock *MockBatchSaver
+}
+
+// NewMockBatchSaver creates a new mock instance.
+func NewMockBatchSaver(ctrl *gomock.Controller) *MockBatchSaver {
+	mock := &MockBatchSaver{ctrl: ctrl}
+	mock.recorder = &MockBatchSaverMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBatchSaver) EXPECT() *MockBatchSaverMockRecorder {
+	return m.recorder
+}
+
+// SaveBatch mocks base method.
+func (m *MockBatchSaver) SaveBatch(links []storage.Link) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveBatch", links)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveBatch indicates an expected call of SaveBatch.
+func (mr *MockBatchSaverMockRecorder) SaveBatch(links any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveBatch", reflect.TypeOf((*MockBatchSaver)(nil).SaveBatch), links)
+}
+
+// MockIdempotencyStore is a mock of IdempotencyStore interface.
+type MockIdempotencyStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockIdempotencyStoreMockRecorder
+	isgomock struct{}
+}
+
+// MockIdempotencyStoreMockRecorder is the mock recorder for MockIdempotencyStore.
+type MockIdempotencyStoreMockRecorder struct {
+	mock *MockIdempotencyStore
+}
+
+// NewMockIdempotencyStore creates a new mock instance.
+func NewMockIdempotencyStore(ctrl *gomock.Controller) *MockIdempotencyStore {
+	mock := &MockIdempotencyStore{ctrl: ctrl}
+	mock.recorder = &MockIdempotencyStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockIdempotencyStore) EXPECT() *MockIdempotencyStoreMockRecorder {
+	return m.recorder
+}
+
+// ReleaseIdempotencyKey mocks base method.
+func (m *MockIdempotencyStore) ReleaseIdempotencyKey(key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseIdempotencyKey", key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseIdempotencyKey indicates an expected call of ReleaseIdempotencyKey.
+func (mr *MockIdempotencyStoreMockRecorder) ReleaseIdempotencyKey(key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseIdempotencyKey", reflect.TypeOf((*MockIdempotencyStore)(nil).ReleaseIdempotencyKey), key)
+}
+
+// ReserveIdempotencyKey mocks base method.
+func (m *MockIdempotencyStore) ReserveIdempotencyKey(key, requestHash string, ttl time.Duration) (storage.IdempotencyRecord, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReserveIdempotencyKey", key, requestHash, ttl)
+	ret0, _ := ret[0].(storage.IdempotencyRecord)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReserveIdempotencyKey indicates an expected call of ReserveIdempotencyKey.
+func (mr *MockIdempotencyStoreMockRecorder) ReserveIdempotencyKey(key, requestHash, ttl any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReserveIdempotencyKey", reflect.TypeOf((*MockIdempotencyStore)(nil).ReserveIdempotencyKey), key, requestHash, ttl)
+}
+
+// SaveIdempotencyResponse mocks base method.
+func (m *MockIdempotencyStore) SaveIdempotencyResponse(key string, record storage.IdempotencyRecord, ttl time.Duration) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveIdempotencyResponse", key, record, ttl)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveIdempotencyResponse indicates an expected call of SaveIdempotencyResponse.
+func (mr *MockIdempotencyStoreMockRecorder) SaveIdempotencyResponse(key, record, ttl any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveIdempotencyResponse", reflect.TypeOf((*MockIdempotencyStore)(nil).SaveIdempotencyResponse), key, record, ttl)
+}
+
+// MockAPIKeyStore is a mock of APIKeyStore interface.
+type MockAPIKeyStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockAPIKeyStoreMockRecorder
+	isgomock struct{}
+}
+
+// MockAPIKeyStoreMockRecorder is the mock recorder for MockAPIKeyStore.
+type MockAPIKeyStoreMockRecorder struct {
+	mock *MockAPIKeyStore
+}
+
+// NewMockAPIKeyStore creates a new mock instance.
+func NewMockAPIKeyStore(ctrl *gomock.Controller) *MockAPIKeyStore {
+	mock := &MockAPIKeyStore{ctrl: ctrl}
+	mock.recorder = &MockAPIKeyStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAPIKeyStore) EXPECT() *MockAPIKeyStoreMockRecorder {
+	return m.recorder
+}
+
+// APIKeyByHash mocks base method.
+func (m *MockAPIKeyStore) APIKeyByHash(hash string) (storage.APIKey, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "APIKeyByHash", hash)
+	ret0, _ := ret[0].(storage.APIKey)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// APIKeyByHash indicates an expected call of APIKeyByHash.
+func (mr *MockAPIKeyStoreMockRecorder) APIKeyByHash(hash any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "APIKeyByHash", reflect.TypeOf((*MockAPIKeyStore)(nil).APIKeyByHash), hash)
+}
+
+// ListAPIKeys mocks base method.
+func (m *MockAPIKeyStore) ListAPIKeys() ([]storage.APIKey, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAPIKeys")
+	ret0, _ := ret[0].([]storage.APIKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAPIKeys indicates an expected call of ListAPIKeys.
+func (mr *MockAPIKeyStoreMockRecorder) ListAPIKeys() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAPIKeys", reflect.TypeOf((*MockAPIKeyStore)(nil).ListAPIKeys))
+}
+
+// RevokeAPIKey mocks base method.
+func (m *MockAPIKeyStore) RevokeAPIKey(id string, at time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeAPIKey", id, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeAPIKey indicates an expected call of RevokeAPIKey.
+func (mr *MockAPIKeyStoreMockRecorder) RevokeAPIKey(id, at any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeAPIKey", reflect.TypeOf((*MockAPIKeyStore)(nil).RevokeAPIKey), id, at)
+}
+
+// SaveAPIKey mocks base method.
+func (m *MockAPIKeyStore) SaveAPIKey(key storage.APIKey) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveAPIKey", key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveAPIKey indicates an expected call of SaveAPIKey.
+func (mr *MockAPIKeyStoreMockRecorder) SaveAPIKey(key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveAPIKey", reflect.TypeOf((*MockAPIKeyStore)(nil).SaveAPIKey), key)
+}
+
+// MockAuditStore is a mock of AuditStore interface.
+type MockAuditStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockAuditStoreMockRecorder
+	isgomock struct{}
+}
+
+// MockAuditStoreMockRecorder is the mock recorder for MockAuditStore.
+type MockAuditStoreMockRecorder struct {
+	mock *MockAuditStore
+}
+
+// NewMockAuditStore creates a new mock instance.
+func NewMockAuditStore(ctrl *gomock.Controller) *MockAuditStore {
+	mock := &MockAuditStore{ctrl: ctrl}
+	mock.recorder = &MockAuditStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAuditStore) EXPECT() *MockAuditStoreMockRecorder {
+	return m.recorder
+}
+
+// AppendAudit mocks base method.
+func (m *MockAuditStore) AppendAudit(event storage.AuditEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AppendAudit", event)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AppendAudit indicates an expected call of AppendAudit.
+func (mr *MockAuditStoreMockRecorder) AppendAudit(event any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AppendAudit", reflect.TypeOf((*MockAuditStore)(nil).AppendAudit), event)
+}
+
+// ListAudit mocks base method.
+func (m *MockAuditStore) ListAudit(filter storage.AuditFilter) ([]storage.AuditEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAudit", filter)
+	ret0, _ := ret[0].([]storage.AuditEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAudit indicates an expected call of ListAudit.
+func (mr *MockAuditStoreMockRecorder) ListAudit(filter any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAudit", reflect.TypeOf((*MockAuditStore)(nil).ListAudit), filter)
+}
+
+// PurgeAudit mocks base method.
+func (m *MockAuditStore) PurgeAudit(before time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeAudit", before)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeAudit indicates an expected call of PurgeAudit.
+func (mr *MockAuditStoreMockRecorder) PurgeAudit(before any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeAudit", reflect.TypeOf((*MockAuditStore)(nil).PurgeAudit), before)
+}
+
+// MockStatsStore is a mock of StatsStore interface.
+type MockStatsStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockStatsStoreMockRecorder
+	isgomock struct{}
+}
+
+// MockStatsStoreMockRecorder is the mock recorder for MockStatsStore.
+type MockStatsStoreMockRecorder struct {
+	mock *MockStatsStore
+}
+
+// NewMockStatsStore creates a new mock instance.
+func NewMockStatsStore(ctrl *gomock.Controller) *MockStatsStore {
+	mock := &MockStatsStore{ctrl: ctrl}
+	mock.recorder = &MockStatsStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStatsStore) EXPECT() *MockStatsStoreMockRecorder {
+	return m.recorder
+}
+
+// LinkStats mocks base method.
+func (m *MockStatsStore) LinkStats(namespace, code string) (storage.LinkStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LinkStats", namespace, code)
+	ret0, _ := ret[0].(storage.LinkStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LinkStats indicates an expected call of LinkStats.
+func (mr *MockStatsStoreMockRecorder) LinkStats(namespace, code any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkStats", reflect.TypeOf((*MockStatsStore)(nil).LinkStats), namespace, code)
+}
+
+// RecordClick mocks base method.
+func (m *MockStatsStore) RecordClick(click storage.Click) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordClick", click)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordClick indicates an expected call of RecordClick.
+func (mr *MockStatsStoreMockRecorder) RecordClick(click any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordClick", reflect.TypeOf((*MockStatsStore)(nil).RecordClick), click)
+}
+
+// MockCampaignStore is a mock of CampaignStore interface.
+type MockCampaignStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockCampaignStoreMockRecorder
+	isgomock struct{}
+}
+
+// MockCampaignStoreMockRecorder is the mock recorder for MockCampaignStore.
+type MockCampaignStoreMockRecorder struct {
+	mock *MockCampaignStore
+}
+
+// NewMockCampaignStore creates a new mock instance.
+func NewMockCampaignStore(ctrl *gomock.Controller) *MockCampaignStore {
+	mock := &MockCampaignStore{ctrl: ctrl}
+	mock.recorder = &MockCampaignStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCampaignStore) EXPECT() *MockCampaignStoreMockRecorder {
+	return m.recorder
+}
+
+// DeleteCampaign mocks base method.
+func (m *MockCampaignStore) DeleteCampaign(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCampaign", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCampaign indicates an expected call of DeleteCampaign.
+func (mr *MockCampaignStoreMockRecorder) DeleteCampaign(id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCampaign", reflect.TypeOf((*MockCampaignStore)(nil).DeleteCampaign), id)
+}
+
+// GetCampaign mocks base method.
+func (m *MockCampaignStore) GetCampaign(id string) (storage.Campaign, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCampaign", id)
+	ret0, _ := ret[0].(storage.Campaign)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetCampaign indicates an expected call of GetCampaign.
+func (mr *MockCampaignStoreMockRecorder) GetCampaign(id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCampaign", reflect.TypeOf((*MockCampaignStore)(nil).GetCampaign), id)
+}
+
+// ListCampaigns mocks base method.
+func (m *MockCampaignStore) ListCampaigns(owner string, allOwners bool) ([]storage.Campaign, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListCampaigns", owner, allOwners)
+	ret0, _ := ret[0].([]storage.Campaign)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListCampaigns indicates an expected call of ListCampaigns.
+func (mr *MockCampaignStoreMockRecorder) ListCampaigns(owner, allOwners any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListCampaigns", reflect.TypeOf((*MockCampaignStore)(nil).ListCampaigns), owner, allOwners)
+}
+
+// SaveCampaign mocks base method.
+func (m *MockCampaignStore) SaveCampaign(campaign storage.Campaign) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveCampaign", campaign)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveCampaign indicates an expected call of SaveCampaign.
+func (mr *MockCampaignStoreMockRecorder) SaveCampaign(campaign any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveCampaign", reflect.TypeOf((*MockCampaignStore)(nil).SaveCampaign), campaign)
+}
+
+// MockAnalyticsStore is a mock of AnalyticsStore interface.
+type MockAnalyticsStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockAnalyticsStoreMockRecorder
+	isgomock struct{}
+}
+
+// MockAnalyticsStoreMockRecorder is the mock recorder for MockAnalyticsStore.
+type MockAnalyticsStoreMockRecorder struct {
+	mock *MockAnalyticsStore
+}
+
+// NewMockAnalyticsStore creates a new mock instance.
+func NewMockAnalyticsStore(ctrl *gomock.Controller) *MockAnalyticsStore {
+	mock := &MockAnalyticsStore{ctrl: ctrl}
+	mock.recorder = &MockAnalyticsStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAnalyticsStore) EXPECT() *MockAnalyticsStoreMockRecorder {
+	return m.recorder
+}
+
+// Buckets mocks base method.
+func (m *MockAnalyticsStore) Buckets(namespace, code string, g storage.Granularity, from, to time.Time) ([]storage.Bucket, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Buckets", namespace, code, g, from, to)
+	ret0, _ := ret[0].([]storage.Bucket)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Buckets indicates an expected call of Buckets.
+func (mr *MockAnalyticsStoreMockRecorder) Buckets(namespace, code, g, from, to any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Buckets", reflect.TypeOf((*MockAnalyticsStore)(nil).Buckets), namespace, code, g, from, to)
+}
+
+// CountClick mocks base method.
+func (m *MockAnalyticsStore) CountClick(click storage.Click) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountClick", click)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CountClick indicates an expected call of CountClick.
+func (mr *MockAnalyticsStoreMockRecorder) CountClick(click any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountClick", reflect.TypeOf((*MockAnalyticsStore)(nil).CountClick), click)
+}
+
+// PurgeBuckets mocks base method.
+func (m *MockAnalyticsStore) PurgeBuckets(g storage.Granularity, before time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeBuckets", g, before)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeBuckets indicates an expected call of PurgeBuckets.
+func (mr *MockAnalyticsStoreMockRecorder) PurgeBuckets(g, before any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeBuckets", reflect.TypeOf((*MockAnalyticsStore)(nil).PurgeBuckets), g, before)
+}
+
+// RolledUp mocks base method.
+func (m *MockAnalyticsStore) RolledUp(g storage.Granularity) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RolledUp", g)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RolledUp indicates an expected call of RolledUp.
+func (mr *MockAnalyticsStoreMockRecorder) RolledUp(g any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RolledUp", reflect.TypeOf((*MockAnalyticsStore)(nil).RolledUp), g)
+}
+
+// Rollup mocks base method.
+func (m *MockAnalyticsStore) Rollup(g storage.Granularity, before time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rollup", g, before)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Rollup indicates an expected call of Rollup.
+func (mr *MockAnalyticsStoreMockRecorder) Rollup(g, before any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rollup", reflect.TypeOf((*MockAnalyticsStore)(nil).Rollup), g, before)
+}
+
+// MockVisitorStore is a mock of VisitorStore interface.
+type MockVisitorStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockVisitorStoreMockRecorder
+	isgomock struct{}
+}
+
+// MockVisitorStoreMockRecorder is the mock recorder for MockVisitorStore.
+type MockVisitorStoreMockRecorder struct {
+	mock *MockVisitorStore
+}
+
+// NewMockVisitorStore creates a new mock instance.
+func NewMockVisitorStore(ctrl *gomock.Controller) *MockVisitorStore {
+	mock := &MockVisitorStore{ctrl: ctrl}
+	mock.recorder = &MockVisitorStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockVisitorStore) EXPECT() *MockVisitorStoreMockRecorder {
+	return m.recorder
+}
+
+// AddVisitor mocks base method.
+func (m *MockVisitorStore) AddVisitor(click storage.Click) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddVisitor", click)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddVisitor indicates an expected call of AddVisitor.
+func (mr *MockVisitorStoreMockRecorder) AddVisitor(click any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddVisitor", reflect.TypeOf((*MockVisitorStore)(nil).AddVisitor), click)
+}
+
+// PurgeVisitorSalts mocks base method.
+func (m *MockVisitorStore) PurgeVisitorSalts(before time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeVisitorSalts", before)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeVisitorSalts indicates an expected call of PurgeVisitorSalts.
+func (mr *MockVisitorStoreMockRecorder) PurgeVisitorSalts(before any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeVisitorSalts", reflect.TypeOf((*MockVisitorStore)(nil).PurgeVisitorSalts), before)
+}
+
+// PurgeVisitorSketches mocks base method.
+func (m *MockVisitorStore) PurgeVisitorSketches(before time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeVisitorSketches", before)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeVisitorSketches indicates an expected call of PurgeVisitorSketches.
+func (mr *MockVisitorStoreMockRecorder) PurgeVisitorSketches(before any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeVisitorSketches", reflect.TypeOf((*MockVisitorStore)(nil).PurgeVisitorSketches), before)
+}
+
+// VisitorSalt mocks base method.
+func (m *MockVisitorStore) VisitorSalt(t time.Time) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VisitorSalt", t)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VisitorSalt indicates an expected call of VisitorSalt.
+func (mr *MockVisitorStoreMockRecorder) VisitorSalt(t any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VisitorSalt", reflect.TypeOf((*MockVisitorStore)(nil).VisitorSalt), t)
+}
+
+// VisitorSketches mocks base method.
+func (m *MockVisitorStore) VisitorSketches(namespace, code string, from, to time.Time) (map[string]*hll.Sketch, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "VisitorSketches", namespace, code, from, to)
+	ret0, _ := ret[0].(map[string]*hll.Sketch)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// VisitorSketches indicates an expected call of VisitorSketches.
+func (mr *MockVisitorStoreMockRecorder) VisitorSketches(namespace, code, from, to any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TopDomains", reflect.TypeOf((*MockStorage)(nil).TopDomains), n)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "VisitorSketches", reflect.TypeOf((*MockVisitorStore)(nil).VisitorSketches), namespace, code, from, to)
 }
@@ -1,27 +1,665 @@
 package storage
 
 import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
 	"github.com/parikshitg/urlshortener/internal/common"
+	"github.com/parikshitg/urlshortener/pkg/hll"
 )
 
+// ErrCodeExists is returned by Save when the code is already used by another
+// url or owner in the same namespace.
+var ErrCodeExists = errors.New("code already exists")
+
+// ErrLinkNotFound is returned when a link does not exist or has expired.
+var ErrLinkNotFound = errors.New("link not found")
+
+// ErrClicksExhausted is returned by UseClick when a click-limited link has
+// no clicks left.
+var ErrClicksExhausted = errors.New("link clicks exhausted")
+
+// Link is a shortened url record as handed to the storage layer.
+type Link struct {
+	// Namespace is the short domain the link belongs to ("" is the default domain).
+	Namespace string
+	// Code is the short code, either generated or a user supplied alias.
+	Code string
+	// URL is the normalized original url.
+	URL string
+	// Domain is the host of URL, used for domain hit metrics.
+	Domain string
+	// TTL overrides the store expiry when non-zero.
+	TTL time.Duration
+	// Owner is the tenant the link belongs to ("" when created without auth).
+	Owner string
+	// PasswordHash is the bcrypt hash of the password protecting the link,
+	// empty for public links.
+	PasswordHash string
+	// MaxClicks is the number of times the link can be resolved, unlimited
+	// when zero.
+	MaxClicks int
+	// NotBefore and NotAfter bound the window in which the link redirects
+	// to URL, independent of its expiry. Zero times leave it open.
+	NotBefore time.Time
+	NotAfter  time.Time
+	// FallbackURL is redirected to outside the window, if set.
+	FallbackURL string
+	// RedirectStatus is the status code the link redirects with, the
+	// configured default when zero.
+	RedirectStatus int
+	// Passthrough is what of the short url is passed on to URL: "query",
+	// "path_query" or "" for nothing.
+	Passthrough string
+	// UTM are the utm parameters added to URL on redirect. URL itself is
+	// kept untagged.
+	UTM common.UTM
+	// Targets are tried in order; the first matching rule replaces URL.
+	Targets []common.TargetRule
+	// Variants split the visitors no rule matches between their urls by
+	// weight.
+	Variants []common.Variant
+	// Interstitial shows a warning page before redirecting to destinations
+	// that are not allowlisted.
+	Interstitial bool
+	// Details are the title, description, tags and metadata of the link.
+	Details common.LinkDetails
+	// Campaign is the id of the campaign the link belongs to, if any.
+	Campaign string
+}
+
+// Indexed reports whether the link is indexed by url. Only plain links are,
+// so GetCode never hands out links with a custom TTL, a password, a click
+// limit, a schedule, a redirect status, passthrough, utm parameters,
+// targeting rules, variants, an interstitial, details or a campaign for
+// dedupe.
+func (l Link) Indexed() bool {
+	return l.TTL == 0 && l.PasswordHash == "" && l.MaxClicks == 0 &&
+		l.NotBefore.IsZero() && l.NotAfter.IsZero() && l.FallbackURL == "" &&
+		l.RedirectStatus == 0 && l.Passthrough == "" && l.UTM == (common.UTM{}) &&
+		len(l.Targets) == 0 && len(l.Variants) == 0 && !l.Interstitial &&
+		l.Details.IsZero() && l.Campaign == ""
+}
+
+// LinkRecord is a stored link.
+type LinkRecord struct {
+	Namespace string
+	Code      string
+	URL       string
+	Domain    string
+	Owner     string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	// PasswordHash is the bcrypt hash of the link password, empty for public links.
+	PasswordHash string
+	// MaxClicks is the click limit of the link, zero when unlimited.
+	MaxClicks int
+	// ClicksLeft is the number of resolves left of a click-limited link.
+	ClicksLeft int
+	// NotBefore and NotAfter bound the window in which the link redirects
+	// to URL; zero times leave it open.
+	NotBefore time.Time
+	NotAfter  time.Time
+	// FallbackURL is redirected to outside the window, if set.
+	FallbackURL string
+	// RedirectStatus is the redirect status code, zero for the default.
+	RedirectStatus int
+	// Passthrough is what of the short url is passed on to URL.
+	Passthrough string
+	// UTM are the utm parameters added to URL on redirect.
+	UTM common.UTM
+	// Targets are the targeting rules of the link, tried in order.
+	Targets []common.TargetRule
+	// Variants are the weighted destinations of the link.
+	Variants []common.Variant
+	// Interstitial shows a warning page before the redirect.
+	Interstitial bool
+	// Details are the title, description, tags and metadata of the link.
+	Details common.LinkDetails
+	// Campaign is the id of the campaign the link belongs to, if any.
+	Campaign string
+}
+
+// LinkPatch holds the changes UpdateLink applies to a link together. Nil
+// fields are kept.
+type LinkPatch struct {
+	// URL is the new destination, on Domain.
+	URL    *string
+	Domain string
+	// Variants replace the variants of the link.
+	Variants *[]common.Variant
+	// Details replace the details of the link.
+	Details *common.LinkDetails
+	// Campaign is the id of the campaign to move the link to, empty to move
+	// it out of its campaign.
+	Campaign *string
+}
+
+// LinkFilter selects the links returned by ListLinks.
+type LinkFilter struct {
+	// Owner restricts the result to the links of one owner, unless AllOwners is set.
+	Owner string
+	// AllOwners returns the links of every owner.
+	AllOwners bool
+	// Tag only returns links with the tag.
+	Tag string
+	// Search only returns links whose code, url, title or description
+	// contain it, case-insensitively.
+	Search string
+	// Metadata only returns links with all of these key/value pairs.
+	Metadata map[string]string
+	// Campaign only returns the links of the campaign with this id.
+	Campaign string
+}
+
+// Matches reports whether link matches the filter, ignoring Owner and
+// AllOwners.
+func (f LinkFilter) Matches(link LinkRecord) bool {
+	if f.Campaign != "" && link.Campaign != f.Campaign {
+		return false
+	}
+	if f.Tag != "" && !slices.Contains(link.Details.Tags, strings.ToLower(f.Tag)) {
+		return false
+	}
+	for key, value := range f.Metadata {
+		if v, ok := link.Details.Metadata[key]; !ok || v != value {
+			return false
+		}
+	}
+	if f.Search == "" {
+		return true
+	}
+	search := strings.ToLower(f.Search)
+	for _, field := range []string{link.Code, link.URL, link.Details.Title, link.Details.Description} {
+		if strings.Contains(strings.ToLower(field), search) {
+			return true
+		}
+	}
+	return false
+}
+
 // Storage is an adapter interface, that defines the methods for our services
 // storage logic.
+//
+// Links are scoped by namespace, which is the short domain the link was
+// created on. The empty namespace is the default domain (Config.BaseURL), so
+// the same code can exist independently in different namespaces. Codes are
+// unique within a namespace across owners, while the url to code index and
+// domain hits are kept per owner.
 type Storage interface {
-	// CodeExists checks if a shortcode already exists in the storage.
-	CodeExists(code string) bool
+	// CodeExists checks if a shortcode already exists in the namespace.
+	CodeExists(namespace, code string) bool
+
+	// GetCode takes an url and gives the corresponding unique code of the
+	// owner in the namespace.
+	GetCode(namespace, owner, url string) (string, bool)
+
+	// GetURL takes a code and gives corresponding original url if exists in the namespace.
+	GetURL(namespace, code string) string
+
+	// GetLink returns the link stored for code in the namespace.
+	GetLink(namespace, code string) (LinkRecord, bool)
+
+	// ListLinks returns the live links matching filter, oldest first.
+	ListLinks(filter LinkFilter) ([]LinkRecord, error)
 
-	// GetCode takes an url and gives the corresponding unique code.
-	GetCode(url string) (string, bool)
+	// UpdateLink applies every change of patch to an existing link at once,
+	// keeping its code and expiry, so the link is never left half updated.
+	// The link is no longer used for url dedupe. Unknown codes return
+	// ErrLinkNotFound.
+	UpdateLink(namespace, code string, patch LinkPatch) error
 
-	// GetURL takes a code and gives corresponding original url if exists.
-	GetURL(code string) string
+	// DeleteLink removes a link. Unknown codes return ErrLinkNotFound.
+	DeleteLink(namespace, code string) error
 
-	// Save saves the url, code and domain hits in memstore.
-	Save(url, code, domain string)
+	// UseClick atomically takes one of the clicks left of a click-limited
+	// link, so concurrent resolves never exceed the limit. It returns
+	// ErrClicksExhausted when none are left and ErrLinkNotFound for unknown
+	// codes. Links without a limit are not changed.
+	UseClick(namespace, code string) error
 
-	// TopDomains returns the top n domains based on domain hits.
-	TopDomains(n int) []common.TopN
+	// Save saves the link and its domain hit. Saving an existing code for the
+	// same url and owner is a no-op, otherwise it returns ErrCodeExists.
+	Save(link Link) error
+
+	// TopDomains returns the top n domains based on the domain hits of owner,
+	// or on all domain hits if owner is empty.
+	TopDomains(owner string, n int) []common.TopN
 
 	// Purge deletes the expired records
 	Purge()
 }
+
+// BatchSaver is implemented by backends that can persist many links in a
+// single write. Like Save, a link whose code is stored with the same url
+// and owner is left as is. A code taken by another link, or used twice in
+// the batch for different links, fails the batch with ErrCodeExists before
+// anything is written.
+type BatchSaver interface {
+	SaveBatch(links []Link) error
+}
+
+// IdempotencyRecord is the stored outcome of a request sent with an
+// Idempotency-Key header.
+type IdempotencyRecord struct {
+	// RequestHash identifies the request the key was first used with.
+	RequestHash string `json:"requestHash"`
+	// Status is the response status code, zero while the request is in flight.
+	Status int `json:"status"`
+	// ContentType is the response Content-Type header.
+	ContentType string `json:"contentType,omitempty"`
+	// Body is the response body.
+	Body []byte `json:"body,omitempty"`
+}
+
+// IdempotencyStore persists idempotency keys and their responses.
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey marks key as in flight for requestHash. If the key
+	// is already known, its record is returned and reserved is false.
+	ReserveIdempotencyKey(key, requestHash string, ttl time.Duration) (record IdempotencyRecord, reserved bool, err error)
+
+	// SaveIdempotencyResponse stores the response of a reserved key.
+	SaveIdempotencyResponse(key string, record IdempotencyRecord, ttl time.Duration) error
+
+	// ReleaseIdempotencyKey forgets a reserved key so the request can be retried.
+	ReleaseIdempotencyKey(key string) error
+}
+
+// ErrAPIKeyNotFound is returned when an api key id is unknown.
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// APIKey is a stored api key. Only the hash of the secret is kept.
+type APIKey struct {
+	// ID identifies the key in management requests.
+	ID string `json:"id"`
+	// Name is a free-form label for the key.
+	Name string `json:"name"`
+	// Hash is the hex encoded sha256 of the secret.
+	Hash string `json:"hash"`
+	// Scopes are the permissions granted to the key.
+	Scopes []string `json:"scopes"`
+	// Tenant is the tenant the key acts for.
+	Tenant string `json:"tenant,omitempty"`
+	// Role is the role of the key, empty for keys created before roles.
+	Role string `json:"role,omitempty"`
+	// CreatedAt is when the key was created.
+	CreatedAt time.Time `json:"createdAt"`
+	// RevokedAt is when the key was revoked, zero while it is active.
+	RevokedAt time.Time `json:"revokedAt"`
+}
+
+// Revoked reports whether the key has been revoked.
+func (k APIKey) Revoked() bool { return !k.RevokedAt.IsZero() }
+
+// APIKeyStore persists api keys.
+type APIKeyStore interface {
+	// SaveAPIKey stores a new api key.
+	SaveAPIKey(key APIKey) error
+
+	// APIKeyByHash returns the key with the given secret hash.
+	APIKeyByHash(hash string) (APIKey, bool, error)
+
+	// ListAPIKeys returns all keys, including revoked ones, oldest first.
+	ListAPIKeys() ([]APIKey, error)
+
+	// RevokeAPIKey marks the key as revoked at the given time. Revoking a
+	// revoked key keeps its original revocation time. Unknown ids return
+	// ErrAPIKeyNotFound.
+	RevokeAPIKey(id string, at time.Time) error
+}
+
+// AuditEvent is an entry of the append-only audit log.
+type AuditEvent struct {
+	// ID orders events by time; later events have greater ids.
+	ID   string    `json:"id"`
+	Time time.Time `json:"time"`
+	// Actor is the subject of the caller, empty without auth.
+	Actor  string `json:"actor,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+	Role   string `json:"role,omitempty"`
+	// RequestID is the id of the request that caused the event.
+	RequestID string `json:"requestId,omitempty"`
+	// Action is what was done or attempted, e.g. "link.update".
+	Action string `json:"action"`
+	// Target is what the action was done on, e.g. "link:<namespace>/<code>".
+	Target string `json:"target,omitempty"`
+	// Outcome is "success" or "denied".
+	Outcome string `json:"outcome"`
+	// Before and After are the json values of the target around the change.
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditFilter selects the events returned by ListAudit. Empty fields match
+// every event.
+type AuditFilter struct {
+	Actor  string
+	Action string
+	Target string
+	// From and To bound the event time, inclusive and exclusive.
+	From time.Time
+	To   time.Time
+	// Before only returns events with a smaller id, to page backwards.
+	Before string
+	// Limit is the maximum number of events returned.
+	Limit int
+}
+
+// Matches reports whether event matches the filter, ignoring Before and Limit.
+func (f AuditFilter) Matches(event AuditEvent) bool {
+	return (f.Actor == "" || event.Actor == f.Actor) &&
+		(f.Action == "" || event.Action == f.Action) &&
+		(f.Target == "" || event.Target == f.Target) &&
+		(f.From.IsZero() || !event.Time.Before(f.From)) &&
+		(f.To.IsZero() || event.Time.Before(f.To))
+}
+
+// AuditStore persists the audit log. Events are never changed; they are only
+// deleted once they are older than the retention.
+type AuditStore interface {
+	// AppendAudit stores a new event.
+	AppendAudit(event AuditEvent) error
+
+	// ListAudit returns the events matching filter, newest first.
+	ListAudit(filter AuditFilter) ([]AuditEvent, error)
+
+	// PurgeAudit deletes the events older than before and returns how many
+	// were deleted.
+	PurgeAudit(before time.Time) (int, error)
+}
+
+// Click is a redirect of a link, counted in its stats.
+type Click struct {
+	Namespace string
+	Code      string
+	Time      time.Time
+	// Rule is the name of the targeting rule that picked the destination,
+	// DefaultRule for the url of the link.
+	Rule string
+	// Variant is the name of the variant the visitor was assigned, empty
+	// for links without variants.
+	Variant string
+	// Visitor is a hash of the client ip and user agent, salted with the
+	// salt of the day, counted in the unique visitors. Zero when unknown.
+	Visitor uint64
+	// Bot is set for clicks of bots and crawlers, which are counted apart
+	// from the clicks of people.
+	Bot bool
+	// Referrer is the host of the page the visitor came from, empty when
+	// unknown.
+	Referrer string
+	// Country and Region are the ISO 3166 codes of where the visitor is,
+	// derived from the client ip, which is not kept. Empty when unknown.
+	Country string
+	Region  string
+}
+
+// DefaultRule counts the clicks redirected to the url of a link rather than
+// a targeting rule.
+const DefaultRule = "default"
+
+const (
+	// MaxBreakdown is the most referrers or regions the stats of a link
+	// count apart, so made up Referer headers cannot grow them without
+	// bound. The clicks of the others are counted as OtherKey.
+	MaxBreakdown = 1000
+	// OtherKey counts the clicks past MaxBreakdown.
+	OtherKey = "other"
+)
+
+// LinkStats are the click counts of a link.
+type LinkStats struct {
+	Clicks int64 `json:"clicks"`
+	// Rules counts the clicks by the targeting rule that matched.
+	Rules map[string]int64 `json:"rules,omitempty"`
+	// Variants counts the clicks by the variant the visitor was assigned.
+	Variants map[string]int64 `json:"variants,omitempty"`
+	// Days counts the clicks by UTC day, formatted as DayFormat.
+	Days map[string]int64 `json:"days,omitempty"`
+	// Referrers counts the clicks by referrer host.
+	Referrers map[string]int64 `json:"referrers,omitempty"`
+	// Countries and Regions count the clicks by ISO 3166 country and
+	// region code.
+	Countries map[string]int64 `json:"countries,omitempty"`
+	Regions   map[string]int64 `json:"regions,omitempty"`
+	// Bots are the stats of the clicks of bots, which are not counted in
+	// the other fields. Nil until a bot clicked.
+	Bots *LinkStats `json:"bots,omitempty"`
+}
+
+// DayFormat formats the days of LinkStats.Days.
+const DayFormat = "2006-01-02"
+
+// Count adds click to the stats, or to the stats of bots.
+func (s *LinkStats) Count(click Click) {
+	if click.Bot {
+		if s.Bots == nil {
+			s.Bots = &LinkStats{}
+		}
+		click.Bot = false
+		s.Bots.Count(click)
+		return
+	}
+	s.Clicks++
+	if click.Rule != "" {
+		if s.Rules == nil {
+			s.Rules = make(map[string]int64)
+		}
+		s.Rules[click.Rule]++
+	}
+	if click.Variant != "" {
+		if s.Variants == nil {
+			s.Variants = make(map[string]int64)
+		}
+		s.Variants[click.Variant]++
+	}
+	if s.Days == nil {
+		s.Days = make(map[string]int64)
+	}
+	s.Days[click.Time.UTC().Format(DayFormat)]++
+	s.Referrers = countKey(s.Referrers, click.Referrer)
+	s.Countries = countKey(s.Countries, click.Country)
+	s.Regions = countKey(s.Regions, click.Region)
+}
+
+// countKey counts a click for key in counts, allocating it if needed. Empty
+// keys are not counted, and new keys past MaxBreakdown count as OtherKey.
+func countKey(counts map[string]int64, key string) map[string]int64 {
+	if key == "" {
+		return counts
+	}
+	if counts == nil {
+		counts = make(map[string]int64)
+	}
+	if _, ok := counts[key]; !ok && len(counts) >= MaxBreakdown {
+		key = OtherKey
+	}
+	counts[key]++
+	return counts
+}
+
+// WithBots returns the stats with the clicks of bots added to the others.
+func (s LinkStats) WithBots() LinkStats {
+	if s.Bots == nil {
+		return s
+	}
+	all := LinkStats{Clicks: s.Clicks + s.Bots.Clicks, Bots: s.Bots}
+	for _, stats := range []LinkStats{s, *s.Bots} {
+		all.Rules = addCounts(all.Rules, stats.Rules)
+		all.Variants = addCounts(all.Variants, stats.Variants)
+		all.Days = addCounts(all.Days, stats.Days)
+		all.Referrers = addCounts(all.Referrers, stats.Referrers)
+		all.Countries = addCounts(all.Countries, stats.Countries)
+		all.Regions = addCounts(all.Regions, stats.Regions)
+	}
+	return all
+}
+
+// addCounts adds the counts of src to dst, allocating it if needed.
+func addCounts(dst, src map[string]int64) map[string]int64 {
+	if len(src) > 0 && dst == nil {
+		dst = make(map[string]int64, len(src))
+	}
+	for k, n := range src {
+		dst[k] += n
+	}
+	return dst
+}
+
+// StatsStore keeps the click stats of links. The stats of a link are
+// deleted with it.
+type StatsStore interface {
+	// RecordClick counts click in the stats of its link. Unknown codes
+	// return ErrLinkNotFound.
+	RecordClick(click Click) error
+
+	// LinkStats returns the stats of a link, empty if it was never clicked.
+	LinkStats(namespace, code string) (LinkStats, error)
+}
+
+// ErrCampaignNotFound is returned when a campaign id is unknown.
+var ErrCampaignNotFound = errors.New("campaign not found")
+
+// Campaign groups links, like a folder. Links refer to their campaign by id.
+type Campaign struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Owner string `json:"owner,omitempty"`
+	// CreatedAt is when the campaign was created.
+	CreatedAt time.Time `json:"createdAt"`
+	// ExpiresAt is when the campaign ends and is deleted, zero for never.
+	ExpiresAt time.Time `json:"expiresAt,omitzero"`
+	// Cascade deletes the links of the campaign with it when it expires.
+	Cascade bool `json:"cascade,omitempty"`
+}
+
+// Expired reports whether the campaign has ended at now.
+func (c Campaign) Expired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && !now.Before(c.ExpiresAt)
+}
+
+// CampaignStore persists campaigns. Deleting a campaign does not touch its
+// links; callers move or delete them first.
+type CampaignStore interface {
+	// SaveCampaign stores a new campaign or replaces the one with its id.
+	SaveCampaign(campaign Campaign) error
+
+	// GetCampaign returns the campaign with the given id.
+	GetCampaign(id string) (Campaign, bool, error)
+
+	// ListCampaigns returns the campaigns of owner, or of every owner if
+	// allOwners is set, oldest first.
+	ListCampaigns(owner string, allOwners bool) ([]Campaign, error)
+
+	// DeleteCampaign removes a campaign. Unknown ids return
+	// ErrCampaignNotFound.
+	DeleteCampaign(id string) error
+}
+
+// Granularity is the width of an analytics bucket.
+type Granularity string
+
+const (
+	Minute Granularity = "minute"
+	Hour   Granularity = "hour"
+	Day    Granularity = "day"
+)
+
+// Granularities are the bucket granularities, finest first. Each one is
+// rolled up into the next.
+var Granularities = []Granularity{Minute, Hour, Day}
+
+// Duration returns the width of a bucket, zero for unknown granularities.
+func (g Granularity) Duration() time.Duration {
+	switch g {
+	case Minute:
+		return time.Minute
+	case Hour:
+		return time.Hour
+	case Day:
+		return 24 * time.Hour
+	}
+	return 0
+}
+
+// Truncate returns the start of the bucket t falls in. Buckets are aligned
+// to UTC.
+func (g Granularity) Truncate(t time.Time) time.Time {
+	return t.UTC().Truncate(g.Duration())
+}
+
+// Coarser returns the granularity g is rolled up into, empty for Day.
+func (g Granularity) Coarser() Granularity {
+	switch g {
+	case Minute:
+		return Hour
+	case Hour:
+		return Day
+	}
+	return ""
+}
+
+// Bucket is the number of clicks of a link in the bucket starting at Start.
+type Bucket struct {
+	Start  time.Time `json:"start"`
+	Clicks int64     `json:"clicks"`
+	// Bots is the number of clicks of bots, not counted in Clicks.
+	Bots int64 `json:"bots,omitempty"`
+}
+
+// AnalyticsStore keeps the clicks of links in time buckets. Clicks are
+// counted in minute buckets, which are rolled up into hour buckets, which
+// are rolled up into day buckets. Rolling up copies the counts, so every
+// granularity keeps its buckets until they are purged. Buckets are not
+// deleted with their link.
+type AnalyticsStore interface {
+	// CountClick adds click to the minute bucket of its time, to Bots for
+	// the clicks of bots.
+	CountClick(click Click) error
+
+	// Buckets returns the buckets of granularity g of a link that start in
+	// [from, to), oldest first. Buckets without clicks are left out.
+	Buckets(namespace, code string, g Granularity, from, to time.Time) ([]Bucket, error)
+
+	// Rollup adds the buckets of g starting in [RolledUp(g), before) to
+	// the buckets of g.Coarser() and moves RolledUp(g) to before. Rolling
+	// up to a time not after RolledUp(g) does nothing.
+	Rollup(g Granularity, before time.Time) error
+
+	// RolledUp returns the time the buckets of g are rolled up to, zero if
+	// they never were.
+	RolledUp(g Granularity) (time.Time, error)
+
+	// PurgeBuckets deletes the buckets of g starting before before and
+	// returns how many were deleted.
+	PurgeBuckets(g Granularity, before time.Time) (int, error)
+}
+
+// VisitorStore keeps a HyperLogLog sketch of the visitors of each link per
+// UTC day. Days are merged to count the unique visitors of longer ranges.
+// Like analytics buckets, sketches are not deleted with their link.
+type VisitorStore interface {
+	// AddVisitor adds the visitor of click to the sketch of its link for
+	// the day of its time.
+	AddVisitor(click Click) error
+
+	// VisitorSketches returns the sketches of a link from the day of from
+	// until the day before the day of to, keyed by day formatted as
+	// DayFormat. Days without visitors are left out.
+	VisitorSketches(namespace, code string, from, to time.Time) (map[string]*hll.Sketch, error)
+
+	// PurgeVisitorSketches deletes the sketches of the days before the day
+	// of before and returns how many were deleted.
+	PurgeVisitorSketches(before time.Time) (int, error)
+
+	// VisitorSalt returns the salt of the day of t, creating a random one
+	// the first time. Every caller gets the same salt for a day.
+	VisitorSalt(t time.Time) ([]byte, error)
+
+	// PurgeVisitorSalts deletes the salts of the days before the day of
+	// before, so the visitor hashes of those days cannot be recomputed.
+	PurgeVisitorSalts(before time.Time) (int, error)
+}
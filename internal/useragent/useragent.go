@@ -0,0 +1,88 @@
+// Package useragent classifies clients by their User-Agent header.
+package useragent
+
+import (
+	"slices"
+	"strings"
+)
+
+// Platforms and device classes a User-Agent is matched against.
+const (
+	IOS     = "ios"
+	Android = "android"
+	Windows = "windows"
+	MacOS   = "macos"
+	Linux   = "linux"
+	Mobile  = "mobile"
+	Desktop = "desktop"
+)
+
+// Devices are the values accepted by Is.
+var Devices = []string{IOS, Android, Windows, MacOS, Linux, Mobile, Desktop}
+
+// Platform returns the operating system of ua, one of IOS, Android,
+// Windows, MacOS or Linux, or "" when it is not recognized.
+func Platform(ua string) string {
+	ua = strings.ToLower(ua)
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return IOS
+	case strings.Contains(ua, "android"):
+		return Android
+	case strings.Contains(ua, "windows"):
+		return Windows
+	case strings.Contains(ua, "macintosh"), strings.Contains(ua, "mac os x"):
+		return MacOS
+	case strings.Contains(ua, "linux"), strings.Contains(ua, "x11"):
+		return Linux
+	}
+	return ""
+}
+
+// IsMobile reports whether ua is a phone or tablet.
+func IsMobile(ua string) bool {
+	switch Platform(ua) {
+	case IOS, Android:
+		return true
+	}
+	return strings.Contains(strings.ToLower(ua), "mobile")
+}
+
+// Is reports whether ua is of device, a platform or Mobile or Desktop.
+// Clients with an unknown platform are neither mobile nor desktop.
+func Is(ua, device string) bool {
+	switch device {
+	case Mobile:
+		return IsMobile(ua)
+	case Desktop:
+		return Platform(ua) != "" && !IsMobile(ua)
+	}
+	return Platform(ua) == device
+}
+
+// Valid reports whether device is one of Devices.
+func Valid(device string) bool {
+	return slices.Contains(Devices, device)
+}
+
+// BotPatterns are the default User-Agent patterns of bots: link unfurlers,
+// crawlers, uptime checkers and http libraries.
+var BotPatterns = []string{
+	"bot", "crawler", "spider", "slurp", "facebookexternalhit", "facebookcatalog",
+	"embedly", "skypeuripreview", "whatsapp", "vkshare",
+	"uptime", "pingdom", "statuscake", "site24x7", "monitor",
+	"curl", "wget", "python-requests", "go-http-client", "okhttp", "java/", "httpclient",
+	"headlesschrome", "lighthouse", "preview",
+}
+
+// IsBot reports whether ua contains one of patterns, ignoring case. Patterns
+// are expected in lower case.
+func IsBot(ua string, patterns []string) bool {
+	ua = strings.ToLower(ua)
+	for _, p := range patterns {
+		if p != "" && strings.Contains(ua, p) {
+			return true
+		}
+	}
+	return false
+}
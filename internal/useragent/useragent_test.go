@@ -0,0 +1,86 @@
+package useragent
+
+import "testing"
+
+const (
+	iPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+	pixel   = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36"
+	windows = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	mac     = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15"
+	ubuntu  = "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"
+)
+
+func TestPlatform(t *testing.T) {
+	tests := []struct {
+		ua       string
+		platform string
+		mobile   bool
+	}{
+		{iPhone, IOS, true},
+		{pixel, Android, true},
+		{windows, Windows, false},
+		{mac, MacOS, false},
+		{ubuntu, Linux, false},
+		{"curl/8.4.0", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := Platform(tt.ua); got != tt.platform {
+			t.Errorf("Platform(%q) = %q, want %q", tt.ua, got, tt.platform)
+		}
+		if got := IsMobile(tt.ua); got != tt.mobile {
+			t.Errorf("IsMobile(%q) = %v, want %v", tt.ua, got, tt.mobile)
+		}
+	}
+}
+
+func TestIs(t *testing.T) {
+	tests := []struct {
+		ua     string
+		device string
+		want   bool
+	}{
+		{iPhone, IOS, true},
+		{iPhone, MacOS, false},
+		{iPhone, Mobile, true},
+		{iPhone, Desktop, false},
+		{pixel, Android, true},
+		{pixel, Linux, false},
+		{mac, Desktop, true},
+		{"curl/8.4.0", Desktop, false},
+		{"curl/8.4.0", Mobile, false},
+	}
+	for _, tt := range tests {
+		if got := Is(tt.ua, tt.device); got != tt.want {
+			t.Errorf("Is(%q, %q) = %v, want %v", tt.ua, tt.device, got, tt.want)
+		}
+	}
+	if Valid("tv") || !Valid(Desktop) {
+		t.Errorf("expected only the listed devices to be valid")
+	}
+}
+
+func TestIsBot(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want bool
+	}{
+		{"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", true},
+		{"Twitterbot/1.0", true},
+		{"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", true},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", true},
+		{"Mozilla/5.0 (compatible; UptimeRobot/2.0; http://www.uptimerobot.com/)", true},
+		{"curl/8.4.0", true},
+		{iPhone, false},
+		{windows, false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsBot(tt.ua, BotPatterns); got != tt.want {
+			t.Errorf("IsBot(%q) = %v, want %v", tt.ua, got, tt.want)
+		}
+	}
+	if IsBot("Slackbot 1.0", []string{"crawler"}) || !IsBot("MyChecker/1.0", []string{"mychecker"}) {
+		t.Errorf("expected only the given patterns to match")
+	}
+}
@@ -46,57 +46,91 @@ func NewURLValidator() *URLValidator {
 	}
 }
 
+// Reason is a machine-readable cause of a validation failure.
+type Reason string
+
+const (
+	ReasonEmpty            Reason = "empty"
+	ReasonTooLong          Reason = "too_long"
+	ReasonMissingScheme    Reason = "missing_scheme"
+	ReasonSuspicious       Reason = "suspicious_content"
+	ReasonMalformed        Reason = "malformed"
+	ReasonSchemeNotAllowed Reason = "scheme_not_allowed"
+	ReasonHostRequired     Reason = "host_required"
+	ReasonDomainBlocked    Reason = "domain_blocked"
+	ReasonInvalidHostname  Reason = "invalid_hostname"
+	ReasonIPBlocked        Reason = "ip_blocked"
+)
+
+// Error is a validation failure with its reason.
+type Error struct {
+	Reason  Reason
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func newError(reason Reason, format string, args ...interface{}) *Error {
+	return &Error{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
 // ValidationResult contains the result of URL validation
 type ValidationResult struct {
 	IsValid bool
 	Error   string
+	Reason  Reason
 	URL     string
 }
 
+// invalid builds the result for a failed validation.
+func invalid(rawURL string, err *Error) ValidationResult {
+	return ValidationResult{IsValid: false, Error: err.Message, Reason: err.Reason, URL: rawURL}
+}
+
 // Validate performs comprehensive URL validation
 func (v *URLValidator) Validate(rawURL string) ValidationResult {
 	// Basic format validation
 	if err := v.validateFormat(rawURL); err != nil {
-		return ValidationResult{IsValid: false, Error: err.Error(), URL: rawURL}
+		return invalid(rawURL, err)
 	}
 
 	// Parse URL
 	parsedURL, err := url.Parse(rawURL)
 	if err != nil {
-		return ValidationResult{IsValid: false, Error: "invalid URL format", URL: rawURL}
+		return invalid(rawURL, newError(ReasonMalformed, "invalid URL format"))
 	}
 
 	// Scheme validation
 	if err := v.validateScheme(parsedURL.Scheme); err != nil {
-		return ValidationResult{IsValid: false, Error: err.Error(), URL: rawURL}
+		return invalid(rawURL, err)
 	}
 
 	// Host validation
 	if err := v.validateHost(parsedURL.Host); err != nil {
-		return ValidationResult{IsValid: false, Error: err.Error(), URL: rawURL}
+		return invalid(rawURL, err)
 	}
 
 	// Security validation
 	if err := v.validateSecurity(parsedURL); err != nil {
-		return ValidationResult{IsValid: false, Error: err.Error(), URL: rawURL}
+		return invalid(rawURL, err)
 	}
 
 	return ValidationResult{IsValid: true, URL: rawURL}
 }
 
 // validateFormat checks basic URL format
-func (v *URLValidator) validateFormat(rawURL string) error {
+func (v *URLValidator) validateFormat(rawURL string) *Error {
 	if rawURL == "" {
-		return fmt.Errorf("URL cannot be empty")
+		return newError(ReasonEmpty, "URL cannot be empty")
 	}
 
 	if len(rawURL) > v.maxURLLength {
-		return fmt.Errorf("URL too long (max %d characters)", v.maxURLLength)
+		return newError(ReasonTooLong, "URL too long (max %d characters)", v.maxURLLength)
 	}
 
 	// Check for basic URL structure
 	if !strings.Contains(rawURL, "://") {
-		return fmt.Errorf("URL must contain scheme (http:// or https://)")
+		return newError(ReasonMissingScheme, "URL must contain scheme (http:// or https://)")
 	}
 
 	// Check for suspicious patterns
@@ -117,7 +151,7 @@ func (v *URLValidator) validateFormat(rawURL string) error {
 	lowerURL := strings.ToLower(rawURL)
 	for _, pattern := range suspiciousPatterns {
 		if strings.Contains(lowerURL, pattern) {
-			return fmt.Errorf("URL contains suspicious content")
+			return newError(ReasonSuspicious, "URL contains suspicious content")
 		}
 	}
 
@@ -125,9 +159,9 @@ func (v *URLValidator) validateFormat(rawURL string) error {
 }
 
 // validateScheme checks if the URL scheme is allowed
-func (v *URLValidator) validateScheme(scheme string) error {
+func (v *URLValidator) validateScheme(scheme string) *Error {
 	if scheme == "" {
-		return fmt.Errorf("URL scheme is required")
+		return newError(ReasonMissingScheme, "URL scheme is required")
 	}
 
 	for _, allowedScheme := range v.allowedSchemes {
@@ -136,13 +170,13 @@ func (v *URLValidator) validateScheme(scheme string) error {
 		}
 	}
 
-	return fmt.Errorf("scheme '%s' is not allowed. Only %v are permitted", scheme, v.allowedSchemes)
+	return newError(ReasonSchemeNotAllowed, "scheme '%s' is not allowed. Only %v are permitted", scheme, v.allowedSchemes)
 }
 
 // validateHost checks if the host is valid and not blocked
-func (v *URLValidator) validateHost(host string) error {
+func (v *URLValidator) validateHost(host string) *Error {
 	if host == "" {
-		return fmt.Errorf("URL host is required")
+		return newError(ReasonHostRequired, "URL host is required")
 	}
 
 	// Remove port if present
@@ -151,7 +185,7 @@ func (v *URLValidator) validateHost(host string) error {
 	// Check against blocked domains
 	for _, blockedDomain := range v.blockedDomains {
 		if hostname == blockedDomain {
-			return fmt.Errorf("domain '%s' is not allowed", hostname)
+			return newError(ReasonDomainBlocked, "domain '%s' is not allowed", hostname)
 		}
 	}
 
@@ -169,31 +203,31 @@ func (v *URLValidator) validateHost(host string) error {
 }
 
 // validateHostname checks hostname format
-func (v *URLValidator) validateHostname(hostname string) error {
+func (v *URLValidator) validateHostname(hostname string) *Error {
 	// Check length
 	if len(hostname) > 253 {
-		return fmt.Errorf("hostname too long")
+		return newError(ReasonInvalidHostname, "hostname too long")
 	}
 
 	// Check for valid characters
 	hostnameRegex := regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9\-]{0,61}[a-zA-Z0-9])?)*$`)
 	if !hostnameRegex.MatchString(hostname) {
-		return fmt.Errorf("invalid hostname format")
+		return newError(ReasonInvalidHostname, "invalid hostname format")
 	}
 
 	// Check for consecutive dots
 	if strings.Contains(hostname, "..") {
-		return fmt.Errorf("hostname cannot contain consecutive dots")
+		return newError(ReasonInvalidHostname, "hostname cannot contain consecutive dots")
 	}
 
 	return nil
 }
 
 // validateIPAddress checks if IP address is allowed
-func (v *URLValidator) validateIPAddress(ip string) error {
+func (v *URLValidator) validateIPAddress(ip string) *Error {
 	parsedIP := net.ParseIP(ip)
 	if parsedIP == nil {
-		return fmt.Errorf("invalid IP address")
+		return newError(ReasonInvalidHostname, "invalid IP address")
 	}
 
 	// Check against blocked IP ranges
@@ -203,7 +237,7 @@ func (v *URLValidator) validateIPAddress(ip string) error {
 			continue
 		}
 		if network.Contains(parsedIP) {
-			return fmt.Errorf("IP address %s is in blocked range %s", ip, blockedRange)
+			return newError(ReasonIPBlocked, "IP address %s is in blocked range %s", ip, blockedRange)
 		}
 	}
 
@@ -211,7 +245,7 @@ func (v *URLValidator) validateIPAddress(ip string) error {
 }
 
 // validateSecurity performs security-related validations
-func (v *URLValidator) validateSecurity(parsedURL *url.URL) error {
+func (v *URLValidator) validateSecurity(parsedURL *url.URL) *Error {
 	// Check for suspicious query parameters
 	suspiciousParams := []string{
 		"javascript",
@@ -227,7 +261,7 @@ func (v *URLValidator) validateSecurity(parsedURL *url.URL) error {
 	query := strings.ToLower(parsedURL.RawQuery)
 	for _, param := range suspiciousParams {
 		if strings.Contains(query, param) {
-			return fmt.Errorf("URL contains suspicious query parameters")
+			return newError(ReasonSuspicious, "URL contains suspicious query parameters")
 		}
 	}
 
@@ -235,13 +269,13 @@ func (v *URLValidator) validateSecurity(parsedURL *url.URL) error {
 	fragment := strings.ToLower(parsedURL.Fragment)
 	for _, param := range suspiciousParams {
 		if strings.Contains(fragment, param) {
-			return fmt.Errorf("URL contains suspicious fragment")
+			return newError(ReasonSuspicious, "URL contains suspicious fragment")
 		}
 	}
 
 	// Check for excessive path length (potential buffer overflow)
 	if len(parsedURL.Path) > 1000 {
-		return fmt.Errorf("URL path too long")
+		return newError(ReasonTooLong, "URL path too long")
 	}
 
 	return nil
@@ -1,6 +1,7 @@
 package validator
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -202,3 +203,37 @@ func TestNormalizeURL_AddScheme(t *testing.T) {
 		})
 	}
 }
+
+func TestValidate_Reasons(t *testing.T) {
+	validator := NewURLValidator()
+
+	tests := []struct {
+		url    string
+		reason Reason
+	}{
+		{"", ReasonEmpty},
+		{"example.com", ReasonMissingScheme},
+		{"htp://example.com", ReasonSchemeNotAllowed},
+		{"http://localhost/x", ReasonDomainBlocked},
+		{"http://10.0.0.1/x", ReasonIPBlocked},
+		{"https://exa_mple.com", ReasonInvalidHostname},
+		{"https://example.com/?onload=1", ReasonSuspicious},
+		{"https://example.com/" + strings.Repeat("a", 2100), ReasonTooLong},
+	}
+
+	for _, test := range tests {
+		t.Run(test.url, func(t *testing.T) {
+			result := validator.Validate(test.url)
+			if result.IsValid {
+				t.Fatalf("Expected invalid URL %s, but validation passed", test.url)
+			}
+			if result.Reason != test.reason {
+				t.Errorf("Expected reason %q, got %q (%s)", test.reason, result.Reason, result.Error)
+			}
+		})
+	}
+
+	if result := validator.Validate("https://example.com"); result.Reason != "" {
+		t.Errorf("Expected no reason for valid URL, got %q", result.Reason)
+	}
+}
@@ -0,0 +1,88 @@
+// Package hll implements HyperLogLog sketches, which estimate the number of
+// distinct items added to them in a fixed amount of memory. Sketches of
+// different sets merge into the sketch of their union.
+package hll
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+const (
+	// Precision is the number of hash bits selecting a register. The
+	// standard error of the estimate is 1.04/sqrt(2^Precision), about 1.6%.
+	Precision = 12
+	// m is the number of registers.
+	m = 1 << Precision
+	// version is the first byte of marshaled sketches.
+	version = 1
+)
+
+// ErrInvalidSketch is returned when unmarshaling data that is not a sketch
+// of this precision.
+var ErrInvalidSketch = errors.New("invalid hll sketch")
+
+// Sketch is a HyperLogLog sketch of 64-bit hashes. Items must be hashed
+// uniformly, e.g. with a cryptographic hash, before they are added.
+type Sketch struct {
+	registers [m]uint8
+}
+
+// New returns an empty sketch.
+func New() *Sketch {
+	return &Sketch{}
+}
+
+// Add adds a hash to the sketch and reports whether the sketch changed.
+func (s *Sketch) Add(hash uint64) bool {
+	i := hash >> (64 - Precision)
+	// the guard bit bounds the rank when the remaining bits are all zero
+	rank := uint8(bits.LeadingZeros64(hash<<Precision|1<<(Precision-1))) + 1
+	if rank <= s.registers[i] {
+		return false
+	}
+	s.registers[i] = rank
+	return true
+}
+
+// Merge adds the items of other to the sketch.
+func (s *Sketch) Merge(other *Sketch) {
+	for i, rank := range other.registers {
+		s.registers[i] = max(s.registers[i], rank)
+	}
+}
+
+// Count returns the estimated number of distinct hashes added.
+func (s *Sketch) Count() uint64 {
+	sum, zeros := 0.0, 0
+	for _, rank := range s.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// linear counting is more accurate for small sets
+		estimate = m * math.Log(float64(m)/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// MarshalBinary encodes the sketch as a version byte, the precision and the
+// registers.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, 2+m)
+	data = append(data, version, Precision)
+	return append(data, s.registers[:]...), nil
+}
+
+// UnmarshalBinary decodes a sketch encoded by MarshalBinary.
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) != 2+m || data[0] != version || data[1] != Precision {
+		return ErrInvalidSketch
+	}
+	copy(s.registers[:], data[2:])
+	return nil
+}
@@ -0,0 +1,70 @@
+package hll
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// hash spreads i over 64 bits with the splitmix64 finalizer.
+func hash(i int) uint64 {
+	x := uint64(i) + 0x9e3779b97f4a7c15
+	x = (x ^ x>>30) * 0xbf58476d1ce4e5b9
+	x = (x ^ x>>27) * 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+func TestSketch_Count(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 10_000, 1_000_000} {
+		s := New()
+		for i := range n {
+			s.Add(hash(i))
+			// repeats do not count
+			s.Add(hash(i))
+		}
+		got := float64(s.Count())
+		if diff := math.Abs(got - float64(n)); diff > 0.05*float64(n)+1 {
+			t.Fatalf("expected about %d, got %.0f", n, got)
+		}
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	a, b, union := New(), New(), New()
+	for i := range 30_000 {
+		a.Add(hash(i))
+		union.Add(hash(i))
+	}
+	for i := 20_000; i < 50_000; i++ {
+		b.Add(hash(i))
+		union.Add(hash(i))
+	}
+	a.Merge(b)
+	if a.Count() != union.Count() {
+		t.Fatalf("expected the merge to equal the sketch of the union, got %d and %d", a.Count(), union.Count())
+	}
+	if got := float64(a.Count()); math.Abs(got-50_000) > 2_500 {
+		t.Fatalf("expected about 50000, got %.0f", got)
+	}
+}
+
+func TestSketch_Marshal(t *testing.T) {
+	s := New()
+	for i := range 1000 {
+		s.Add(hash(i))
+	}
+	if s.Add(hash(1)) {
+		t.Fatalf("expected a repeat not to change the sketch")
+	}
+	data, _ := s.MarshalBinary()
+	var decoded Sketch
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary failed: %v", err)
+	}
+	if decoded.Count() != s.Count() {
+		t.Fatalf("expected %d after a round trip, got %d", s.Count(), decoded.Count())
+	}
+	if err := decoded.UnmarshalBinary(data[:10]); !errors.Is(err, ErrInvalidSketch) {
+		t.Fatalf("expected ErrInvalidSketch, got %v", err)
+	}
+}
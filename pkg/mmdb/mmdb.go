@@ -0,0 +1,360 @@
+// Package mmdb reads MaxMind DB files, the format of the GeoIP2 and GeoLite2
+// databases. Databases are read from local files only; updating them is left
+// to the operator.
+package mmdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"os"
+)
+
+// ErrInvalidDatabase is returned for data that is not a valid MaxMind DB.
+var ErrInvalidDatabase = errors.New("invalid mmdb database")
+
+// metadataMarker starts the metadata at the end of the file.
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+const (
+	// dataSeparator is the number of zero bytes between the search tree and
+	// the data section.
+	dataSeparator = 16
+	// maxDepth bounds the nesting of decoded values, so malformed pointers
+	// cannot recurse forever.
+	maxDepth = 64
+)
+
+// Data types of the data section.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// uintSizes are the largest sizes of the unsigned integer types.
+var uintSizes = map[int]uint64{typeUint16: 2, typeUint32: 4, typeUint64: 8}
+
+// Metadata describes a database.
+type Metadata struct {
+	NodeCount    uint64
+	RecordSize   uint64
+	IPVersion    uint64
+	DatabaseType string
+	BuildEpoch   uint64
+}
+
+// Reader looks up addresses in a database held in memory.
+type Reader struct {
+	meta Metadata
+	tree []byte
+	data []byte
+	// ipv4Start is the node IPv4 addresses start at in IPv6 trees, after
+	// the 96 zero bits of ::/96.
+	ipv4Start uint64
+}
+
+// Open reads the database at path.
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return FromBytes(buf)
+}
+
+// FromBytes returns a reader of the database in buf, which it keeps.
+func FromBytes(buf []byte) (*Reader, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%w: no metadata", ErrInvalidDatabase)
+	}
+	v, _, err := decoder{buf: buf[i+len(metadataMarker):]}.decode(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", ErrInvalidDatabase)
+	}
+	var meta Metadata
+	meta.NodeCount, _ = fields["node_count"].(uint64)
+	meta.RecordSize, _ = fields["record_size"].(uint64)
+	meta.IPVersion, _ = fields["ip_version"].(uint64)
+	meta.DatabaseType, _ = fields["database_type"].(string)
+	meta.BuildEpoch, _ = fields["build_epoch"].(uint64)
+
+	switch {
+	case meta.RecordSize != 24 && meta.RecordSize != 28 && meta.RecordSize != 32:
+		return nil, fmt.Errorf("%w: record size %d", ErrInvalidDatabase, meta.RecordSize)
+	case meta.IPVersion != 4 && meta.IPVersion != 6:
+		return nil, fmt.Errorf("%w: ip version %d", ErrInvalidDatabase, meta.IPVersion)
+	}
+	treeSize := meta.NodeCount * meta.RecordSize / 4
+	if treeSize+dataSeparator > uint64(i) {
+		return nil, fmt.Errorf("%w: search tree past the end of the data", ErrInvalidDatabase)
+	}
+
+	r := &Reader{meta: meta, tree: buf[:treeSize], data: buf[treeSize+dataSeparator : i]}
+	if meta.IPVersion == 6 {
+		node := uint64(0)
+		for i := 0; i < 96 && node < meta.NodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// Metadata returns the metadata of the database.
+func (r *Reader) Metadata() Metadata {
+	return r.meta
+}
+
+// Lookup returns the data of the network containing ip, or nil if the
+// database has none. Maps are returned as map[string]any and arrays as
+// []any; numbers are uint64, int64, float64, float32 or, for 128-bit
+// integers, *big.Int.
+func (r *Reader) Lookup(ip netip.Addr) (any, error) {
+	ip = ip.Unmap()
+	var (
+		addr []byte
+		node uint64
+	)
+	switch {
+	case ip.Is4():
+		a := ip.As4()
+		addr = a[:]
+		node = r.ipv4Start
+	case r.meta.IPVersion == 4:
+		// IPv6 addresses are not in IPv4 databases
+		return nil, nil
+	default:
+		a := ip.As16()
+		addr = a[:]
+	}
+
+	for i := 0; i < len(addr)*8 && node < r.meta.NodeCount; i++ {
+		node = r.record(node, addr[i/8]>>(7-i%8)&1)
+	}
+	switch {
+	case node == r.meta.NodeCount:
+		return nil, nil
+	case node < r.meta.NodeCount:
+		return nil, fmt.Errorf("%w: search tree deeper than the address", ErrInvalidDatabase)
+	}
+	offset := node - r.meta.NodeCount - dataSeparator
+	if offset >= uint64(len(r.data)) {
+		return nil, fmt.Errorf("%w: data pointer past the data section", ErrInvalidDatabase)
+	}
+	v, _, err := decoder{buf: r.data}.decode(offset, 0)
+	return v, err
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node.
+func (r *Reader) record(node uint64, bit byte) uint64 {
+	switch r.meta.RecordSize {
+	case 24:
+		b := r.tree[node*6+uint64(bit)*3:]
+		return uint64(b[0])<<16 | uint64(b[1])<<8 | uint64(b[2])
+	case 28:
+		b := r.tree[node*7:]
+		if bit == 0 {
+			return uint64(b[3]&0xF0)<<20 | uint64(b[0])<<16 | uint64(b[1])<<8 | uint64(b[2])
+		}
+		return uint64(b[3]&0x0F)<<24 | uint64(b[4])<<16 | uint64(b[5])<<8 | uint64(b[6])
+	default:
+		b := r.tree[node*8+uint64(bit)*4:]
+		return uint64(b[0])<<24 | uint64(b[1])<<16 | uint64(b[2])<<8 | uint64(b[3])
+	}
+}
+
+// decoder decodes the values of a data section. Pointers are offsets into
+// buf.
+type decoder struct {
+	buf []byte
+}
+
+// decode returns the value at offset and the offset after it.
+func (d decoder) decode(offset uint64, depth int) (any, uint64, error) {
+	if depth > maxDepth {
+		return nil, 0, fmt.Errorf("%w: values nested too deep", ErrInvalidDatabase)
+	}
+	typ, size, offset, err := d.control(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	if typ == typePointer {
+		target, next, err := d.pointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(target, depth+1)
+		return v, next, err
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, min(size, 64))
+		for range size {
+			var key, v any
+			if key, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("%w: map key is not a string", ErrInvalidDatabase)
+			}
+			if v, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			m[k] = v
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 64))
+		for range size {
+			var v any
+			if v, offset, err = d.decode(offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+		}
+		return a, offset, nil
+	case typeBool:
+		if size > 1 {
+			return nil, 0, fmt.Errorf("%w: bool of size %d", ErrInvalidDatabase, size)
+		}
+		return size == 1, offset, nil
+	}
+
+	end := offset + size
+	if end > uint64(len(d.buf)) || end < offset {
+		return nil, 0, fmt.Errorf("%w: value past the end of the data", ErrInvalidDatabase)
+	}
+	b := d.buf[offset:end]
+	switch typ {
+	case typeString:
+		return string(b), end, nil
+	case typeBytes:
+		return bytes.Clone(b), end, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("%w: double of size %d", ErrInvalidDatabase, size)
+		}
+		return math.Float64frombits(uintFrom(b)), end, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("%w: float of size %d", ErrInvalidDatabase, size)
+		}
+		return math.Float32frombits(uint32(uintFrom(b))), end, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > uintSizes[typ] {
+			return nil, 0, fmt.Errorf("%w: integer of size %d", ErrInvalidDatabase, size)
+		}
+		return uintFrom(b), end, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("%w: integer of size %d", ErrInvalidDatabase, size)
+		}
+		return int64(int32(uintFrom(b))), end, nil
+	case typeUint128:
+		if size > 16 {
+			return nil, 0, fmt.Errorf("%w: integer of size %d", ErrInvalidDatabase, size)
+		}
+		return new(big.Int).SetBytes(b), end, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unexpected data type %d", ErrInvalidDatabase, typ)
+}
+
+// control decodes the control byte at offset and returns the type and size
+// of the value, and the offset of its payload. For pointers the size holds
+// the bits of the control byte.
+func (d decoder) control(offset uint64) (int, uint64, uint64, error) {
+	next := func() (byte, error) {
+		if offset >= uint64(len(d.buf)) {
+			return 0, fmt.Errorf("%w: value past the end of the data", ErrInvalidDatabase)
+		}
+		b := d.buf[offset]
+		offset++
+		return b, nil
+	}
+	ctrl, err := next()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	typ := int(ctrl >> 5)
+	if typ == typePointer {
+		return typ, uint64(ctrl & 0x1F), offset, nil
+	}
+	if typ == typeExtended {
+		ext, err := next()
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		typ = 7 + int(ext)
+		if typ <= typeMap || typ > typeFloat {
+			return 0, 0, 0, fmt.Errorf("%w: extended type %d", ErrInvalidDatabase, typ)
+		}
+	}
+
+	size := uint64(ctrl & 0x1F)
+	if size >= 29 {
+		n := int(size) - 28
+		var extra uint64
+		for range n {
+			b, err := next()
+			if err != nil {
+				return 0, 0, 0, err
+			}
+			extra = extra<<8 | uint64(b)
+		}
+		size = []uint64{29, 285, 65821}[n-1] + extra
+	}
+	return typ, size, offset, nil
+}
+
+// pointer decodes the pointer with control bits ctrl and payload at offset,
+// and returns its target and the offset after it.
+func (d decoder) pointer(ctrl, offset uint64) (uint64, uint64, error) {
+	n := ctrl>>3 + 1
+	end := offset + n
+	if end > uint64(len(d.buf)) {
+		return 0, 0, fmt.Errorf("%w: pointer past the end of the data", ErrInvalidDatabase)
+	}
+	p := uintFrom(d.buf[offset:end])
+	switch n {
+	case 1:
+		p |= (ctrl & 7) << 8
+	case 2:
+		p = (p | (ctrl&7)<<16) + 2048
+	case 3:
+		p = (p | (ctrl&7)<<24) + 526336
+	}
+	return p, end, nil
+}
+
+// uintFrom decodes a big endian unsigned integer of up to 8 bytes.
+func uintFrom(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
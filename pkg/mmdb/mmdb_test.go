@@ -0,0 +1,141 @@
+package mmdb
+
+import (
+	"bytes"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/parikshitg/urlshortener/internal/mmdbtest"
+)
+
+func TestWriterRoundTrip(t *testing.T) {
+	w := mmdbtest.NewWriter("GeoLite2-Country")
+	de := map[string]any{"country": map[string]any{"iso_code": "DE", "names": map[string]any{"en": "Germany"}}}
+	us := map[string]any{"country": map[string]any{"iso_code": "US"}, "subdivisions": []any{map[string]any{"iso_code": "CA"}}}
+	// a network inserted after the one containing it splits it
+	for _, n := range []struct {
+		prefix string
+		value  any
+	}{
+		{"81.0.0.0/8", de},
+		{"81.2.69.0/24", us},
+		{"2a02:8100::/32", de},
+		{"192.0.2.128/25", "long " + strings.Repeat("x", 300)},
+		{"198.51.100.0/24", map[string]any{"anycast": true, "asn": uint64(64500)}},
+	} {
+		if err := w.Insert(netip.MustParsePrefix(n.prefix), n.value); err != nil {
+			t.Fatalf("Insert %s failed: %v", n.prefix, err)
+		}
+	}
+	buf, err := w.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, buf, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if meta := r.Metadata(); meta.DatabaseType != "GeoLite2-Country" || meta.IPVersion != 6 || meta.RecordSize != 32 {
+		t.Fatalf("unexpected metadata %+v", meta)
+	}
+
+	tests := []struct {
+		ip   string
+		want any
+	}{
+		{"81.1.1.1", de},
+		{"81.2.69.160", us},
+		{"::ffff:81.2.69.1", us},
+		{"2a02:8100:1::1", de},
+		{"192.0.2.200", "long " + strings.Repeat("x", 300)},
+		{"192.0.2.1", nil},
+		{"198.51.100.7", map[string]any{"anycast": true, "asn": uint64(64500)}},
+		{"10.0.0.1", nil},
+		{"2001:db8::1", nil},
+	}
+	for _, tt := range tests {
+		got, err := r.Lookup(netip.MustParseAddr(tt.ip))
+		if err != nil {
+			t.Fatalf("Lookup %s failed: %v", tt.ip, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Lookup %s: expected %v, got %v", tt.ip, tt.want, got)
+		}
+	}
+}
+
+// TestRecordSizes reads one node IPv4 databases with each record size: the
+// left half of the addresses has data, the right half none.
+func TestRecordSizes(t *testing.T) {
+	const nodeCount = 1
+	left, right := nodeCount+dataSeparator, nodeCount
+	for size, tree := range map[int][]byte{
+		24: {0, 0, byte(left), 0, 0, byte(right)},
+		28: {0, 0, byte(left), 0, 0, 0, byte(right)},
+		32: {0, 0, 0, byte(left), 0, 0, 0, byte(right)},
+	} {
+		var buf bytes.Buffer
+		buf.Write(tree)
+		buf.Write(make([]byte, dataSeparator))
+		_ = mmdbtest.Encode(&buf, "low")
+		buf.Write(metadataMarker)
+		_ = mmdbtest.Encode(&buf, map[string]any{"node_count": nodeCount, "record_size": size, "ip_version": 4})
+
+		r, err := FromBytes(buf.Bytes())
+		if err != nil {
+			t.Fatalf("record size %d: FromBytes failed: %v", size, err)
+		}
+		if v, err := r.Lookup(netip.MustParseAddr("10.0.0.1")); err != nil || v != "low" {
+			t.Errorf("record size %d: expected low, got %v err=%v", size, v, err)
+		}
+		if v, err := r.Lookup(netip.MustParseAddr("200.0.0.1")); err != nil || v != nil {
+			t.Errorf("record size %d: expected no data, got %v err=%v", size, v, err)
+		}
+		if v, err := r.Lookup(netip.MustParseAddr("2001:db8::1")); err != nil || v != nil {
+			t.Errorf("record size %d: expected no data for IPv6, got %v err=%v", size, v, err)
+		}
+	}
+}
+
+func TestDecodePointers(t *testing.T) {
+	var buf bytes.Buffer
+	_ = mmdbtest.Encode(&buf, "de")
+	// a map whose value points to the string at offset 0
+	buf.Write([]byte{typeMap<<5 | 1})
+	_ = mmdbtest.Encode(&buf, "iso_code")
+	buf.Write([]byte{typePointer << 5, 0})
+
+	v, _, err := decoder{buf: buf.Bytes()}.decode(3, 0)
+	if err != nil || !reflect.DeepEqual(v, map[string]any{"iso_code": "de"}) {
+		t.Fatalf("expected the pointer to be followed, got %v err=%v", v, err)
+	}
+
+	// a pointer to itself
+	if _, _, err := (decoder{buf: []byte{1, typeArray - 7, typePointer << 5, 0}}).decode(0, 0); !errors.Is(err, ErrInvalidDatabase) {
+		t.Fatalf("expected ErrInvalidDatabase for a pointer loop, got %v", err)
+	}
+}
+
+func TestInvalidDatabase(t *testing.T) {
+	for name, buf := range map[string][]byte{
+		"empty":       nil,
+		"no metadata": []byte("not a database"),
+		"truncated":   append(bytes.Clone(metadataMarker), typeMap<<5|1),
+	} {
+		if _, err := FromBytes(buf); !errors.Is(err, ErrInvalidDatabase) {
+			t.Errorf("%s: expected ErrInvalidDatabase, got %v", name, err)
+		}
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.mmdb")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected a missing file to fail with ErrNotExist, got %v", err)
+	}
+}
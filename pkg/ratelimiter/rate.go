@@ -50,6 +50,18 @@ func (r *RateStore) Allowed(ip string) bool {
 	return true
 }
 
+// Refund gives back a token taken by Allowed in the current window, for
+// requests that turn out not to count.
+func (r *RateStore) Refund(ip string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rate, ok := r.store[ip]
+	if ok && !time.Now().After(rate.ExpiresAt) && rate.Tokens < r.maxAvailable {
+		rate.Tokens++
+	}
+}
+
 func (r *RateStore) Purge() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
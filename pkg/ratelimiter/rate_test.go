@@ -91,3 +91,25 @@ func TestPurge_RemovesExpiredOnly(t *testing.T) {
 		t.Fatalf("expected expired ip to be recreated and allowed after purge")
 	}
 }
+
+func TestRefund_GivesBackToken(t *testing.T) {
+	store := NewRateStore(2, 200*time.Millisecond)
+	ip := "10.0.0.3"
+
+	// refunds of unknown ips and full buckets are ignored
+	store.Refund(ip)
+	store.Allowed(ip)
+	store.Refund(ip)
+	store.Refund(ip)
+
+	if !store.Allowed(ip) || !store.Allowed(ip) {
+		t.Fatalf("expected both tokens to be available after the refund")
+	}
+	if store.Allowed(ip) {
+		t.Fatalf("expected refunds not to go past the max tokens")
+	}
+	store.Refund(ip)
+	if !store.Allowed(ip) {
+		t.Fatalf("expected the refunded token to be allowed")
+	}
+}